@@ -4,8 +4,14 @@ import (
 	"flag"
 	"log"
 	"os"
+	"os/signal"
+	"runtime"
 	"strconv"
+	"strings"
+	"syscall"
 
+	"github.com/martinsaporiti/blockchain-sample/internal/blkcrypto"
+	"github.com/martinsaporiti/blockchain-sample/internal/blockchain"
 	"github.com/martinsaporiti/blockchain-sample/internal/config"
 	"github.com/martinsaporiti/blockchain-sample/internal/controller"
 	"github.com/martinsaporiti/blockchain-sample/internal/servers"
@@ -18,11 +24,42 @@ func init() {
 
 func main() {
 	port := flag.Uint("port", 5000, "TCP port to listen on")
+	ledgerMode := flag.String("ledger", "utxo", "How transactions move coins: utxo or account")
+	dataDir := flag.String("datadir", "", "Directory where the blockchain is stored. If empty, nothing is saved on disk")
+	maxBlockTxs := flag.Int("max-block-txs", blockchain.DEFAULT_MAX_BLOCK_TRANSACTIONS,
+		"Maximum number of transactions of the blocks this node mines")
+	maxBlockSize := flag.Int("max-block-size", blockchain.DEFAULT_MAX_BLOCK_SIZE,
+		"Maximum size in bytes of the transactions of the blocks this node mines")
+	blockInterval := flag.Duration("block-interval", blockchain.DEFAULT_TARGET_BLOCK_INTERVAL,
+		"Expected time between blocks, the difficulty is adjusted to keep it")
+	retargetWindow := flag.Int64("retarget-window", blockchain.DEFAULT_RETARGET_WINDOW,
+		"Number of blocks between two adjustments of the difficulty")
+	miningWorkers := flag.Int("mining-workers", runtime.NumCPU(),
+		"Number of goroutines that look for the proof of work of a block in parallel")
+	consensus := flag.String("consensus", string(blockchain.CONSENSUS_POW),
+		"How blocks are sealed: pow (proof of work), poa (proof of authority) or pos (proof of stake)")
+	signers := flag.String("signers", "",
+		"Comma separated blockchain addresses of the proof of authority signers, in the order of their turns. "+
+			"With proof of stake, they take turns while nothing is bonded")
+	genesisFile := flag.String("genesis", "",
+		"JSON file with the genesis of the network. It replaces the consensus flags and MINING_DIFFICULTY")
+	checkpoints := flag.String("checkpoints", "",
+		"Comma separated number:hash of the blocks every chain must have, they and the blocks before them are final")
+	maxReorgDepth := flag.Int64("max-reorg-depth", blockchain.DEFAULT_MAX_REORG_DEPTH,
+		"Number of blocks under the tip that another branch can replace, the blocks under them are final")
+	mempoolMaxTxs := flag.Int("mempool-max-txs", blockchain.DEFAULT_MEMPOOL_MAX_TRANSACTIONS,
+		"Maximum number of pending transactions, the ones with the lowest fee rate are evicted")
+	mempoolMaxSize := flag.Int("mempool-max-size", blockchain.DEFAULT_MEMPOOL_MAX_SIZE,
+		"Maximum size in bytes of the pending transactions, the ones with the lowest fee rate are evicted")
+	mempoolMaxPerSender := flag.Int("mempool-max-per-sender", blockchain.DEFAULT_MEMPOOL_MAX_PER_SENDER,
+		"Maximum number of pending transactions of a sender")
+	mempoolTTL := flag.Duration("mempool-ttl", blockchain.DEFAULT_MEMPOOL_TTL,
+		"How long a transaction can wait to be mined before it is discarded")
 	flag.Parse()
 
 	miningDifficulty := os.Getenv("MINING_DIFFICULTY")
 	if miningDifficulty == "" {
-		log.Printf("MINING_DIFFICULTY not set, using default value: %s", "5")
+		log.Printf("MINING_DIFFICULTY not set, using default value for the genesis block: %s", "5")
 		miningDifficulty = "5"
 	}
 
@@ -31,13 +68,61 @@ func main() {
 		log.Panicf("Invalid mining difficulty: %s", miningDifficulty)
 	}
 
+	// The signer of a proof of authority or stake network needs its key, the rewards go to its address.
+	blockchainAddress := wallet.New().BlockchainAddress()
+	signerKey := os.Getenv("SIGNER_PRIVATE_KEY")
+	if signerKey != "" {
+		key, err := blkcrypto.PrivateKeyFromHex(signerKey)
+		if err != nil {
+			log.Panicf("Invalid SIGNER_PRIVATE_KEY: %v", err)
+		}
+		blockchainAddress = blkcrypto.AddressFromPublicKey(&key.PublicKey)
+	}
+	var signerAddresses []string
+	if *signers != "" {
+		signerAddresses = strings.Split(*signers, ",")
+	}
+	var checkpointValues []string
+	if *checkpoints != "" {
+		checkpointValues = strings.Split(*checkpoints, ",")
+	}
+
 	config := config.Config{
-		Port:              uint16(*port),
-		BlockchainAddress: wallet.New().BlockchainAddress(),
-		MiningDifficulty:  md,
+		Port:                 uint16(*port),
+		BlockchainAddress:    blockchainAddress,
+		MiningDifficulty:     md,
+		DataDir:              *dataDir,
+		LedgerMode:           *ledgerMode,
+		MaxBlockTransactions: *maxBlockTxs,
+		MaxBlockSize:         *maxBlockSize,
+		TargetBlockInterval:  *blockInterval,
+		RetargetWindow:       *retargetWindow,
+		MiningWorkers:        *miningWorkers,
+		Consensus:            *consensus,
+		Signers:              signerAddresses,
+		SignerKey:            signerKey,
+		GenesisFile:          *genesisFile,
+		Checkpoints:          checkpointValues,
+		MaxReorgDepth:        *maxReorgDepth,
+		MempoolMaxTxs:        *mempoolMaxTxs,
+		MempoolMaxSize:       *mempoolMaxSize,
+		MempoolMaxPerSender:  *mempoolMaxPerSender,
+		MempoolTTL:           *mempoolTTL,
 	}
 
-	ctrl := controller.New(config)
+	ctrl, err := controller.New(config)
+	if err != nil {
+		log.Panicf("Could not start the node: %v", err)
+	}
+	// On a graceful shutdown the node saves what it would lose otherwise.
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-stop
+		log.Println("Stopping the node")
+		ctrl.Stop()
+		os.Exit(0)
+	}()
 	server := servers.NewBlockchainServer(config, ctrl)
 	server.Start()
 }
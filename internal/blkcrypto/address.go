@@ -0,0 +1,54 @@
+package blkcrypto
+
+import (
+	"crypto/ecdsa"
+	"crypto/sha256"
+
+	"github.com/btcsuite/btcd/btcutil/base58"
+	"golang.org/x/crypto/ripemd160"
+)
+
+// AddressFromPublicKey - Returns the blockchain address of a public key, the way Bitcoin builds it.
+// A transaction can only be signed by the owner of its sender address if the public key that verifies it
+// derives that address.
+func AddressFromPublicKey(publicKey *ecdsa.PublicKey) string {
+	// 1. Perform SHA256 hashing on the public key (32 bytes).
+	h2 := sha256.New()
+	h2.Write(publicKey.X.Bytes())
+	h2.Write(publicKey.Y.Bytes())
+	digest2 := h2.Sum(nil)
+
+	// 2. Perform RIPEMD-160 hashing on the result of SHA-256 (20 bytes).
+	h3 := ripemd160.New()
+	h3.Write(digest2)
+	digest3 := h3.Sum(nil)
+
+	// 3. Add version byte in front of RIPEMD-160 hash (0x00 for Main Network).
+	vd4 := make([]byte, 21)
+	vd4[0] = 0x00
+	copy(vd4[1:], digest3[:])
+
+	// 4. Perform SHA-256 hash on the extended RIPEMD-160 result
+	h5 := sha256.New()
+	h5.Write(vd4)
+	digest5 := h5.Sum(nil)
+
+	// 5. Perform SHA-256 hash on the result of the previous SHA-256 hash
+	h6 := sha256.New()
+	h6.Write(digest5)
+	digest6 := h6.Sum(nil)
+
+	// 6. Take the first 4 bytes of the second SHA-256 hash. This is the address checksum
+	chsum := digest6[:4]
+
+	// 7. Add the 4 checksum bytes from stage 6 at the end of extended RIPEMD-160 hash from stage 3.
+	// This is the 25-byte binary Bitcoin Address.
+	dc8 := make([]byte, 25)
+	copy(dc8[:21], vd4[:])
+	copy(dc8[21:], chsum[:])
+
+	// 8. Convert the result from a byte string into a base58 string using Base58Check encoding.
+	// This is the most commonly used Bitcoin Address format
+	address := base58.Encode(dc8)
+	return address
+}
@@ -4,6 +4,7 @@ import (
 	"crypto/ecdsa"
 	"crypto/elliptic"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"math/big"
 )
@@ -56,3 +57,21 @@ func PrivateKeyFromString(s string, publicKey *ecdsa.PublicKey) *ecdsa.PrivateKe
 		D:         &bi,
 	}
 }
+
+// PrivateKeyFromHex - Returns the P-256 private key encoded in hex, with its public key.
+func PrivateKeyFromHex(s string) (*ecdsa.PrivateKey, error) {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid private key: %w", err)
+	}
+	curve := elliptic.P256()
+	d := new(big.Int).SetBytes(b)
+	if d.Sign() == 0 || d.Cmp(curve.Params().N) >= 0 {
+		return nil, errors.New("invalid private key: it is out of the range of the curve")
+	}
+	x, y := curve.ScalarBaseMult(d.Bytes())
+	return &ecdsa.PrivateKey{
+		PublicKey: ecdsa.PublicKey{Curve: curve, X: x, Y: y},
+		D:         d,
+	}, nil
+}
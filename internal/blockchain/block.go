@@ -1,97 +1,225 @@
 package blockchain
 
 import (
-	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"time"
+
+	"github.com/martinsaporiti/blockchain-sample/internal/codec"
+	"github.com/martinsaporiti/blockchain-sample/internal/merkle"
 )
 
+// Block - Header and body (the transactions) of a block.
 type Block struct {
-	number       int64
-	nonce        int
-	previousHash [32]byte
+	header       BlockHeader
 	transactions []*Transaction
-	timestamp    int64
 }
 
 func NewBlock(number int64, nonce int, previousHash [32]byte, transactions []*Transaction) *Block {
 	b := new(Block)
-	b.timestamp = time.Now().UnixNano()
-	b.number = number
-	b.nonce = nonce
-	b.previousHash = previousHash
+	b.header = BlockHeader{
+		version:      BLOCK_VERSION,
+		number:       number,
+		previousHash: previousHash,
+		merkleRoot:   computeMerkleRoot(transactions),
+		timestamp:    time.Now().UnixNano(),
+		nonce:        nonce,
+	}
 	b.transactions = transactions
 	return b
 }
 
+// computeMerkleRoot - Returns the root of the merkle tree of the transaction IDs.
+func computeMerkleRoot(transactions []*Transaction) [32]byte {
+	return merkle.Root(transactionHashes(transactions))
+}
+
+func transactionHashes(transactions []*Transaction) [][32]byte {
+	hashes := make([][32]byte, len(transactions))
+	for i, t := range transactions {
+		hashes[i] = t.Hash()
+	}
+	return hashes
+}
+
+// Header - Returns a copy of the header of the block.
+func (b *Block) Header() *BlockHeader {
+	h := b.header
+	return &h
+}
+
 func (b *Block) Number() int64 {
-	return b.number
+	return b.header.number
 }
 
 func (b *Block) PreviousHash() [32]byte {
-	return b.previousHash
+	return b.header.previousHash
 }
 
 func (b *Block) Nonce() int {
-	return b.nonce
+	return b.header.nonce
+}
+
+func (b *Block) MerkleRoot() [32]byte {
+	return b.header.merkleRoot
+}
+
+func (b *Block) Timestamp() int64 {
+	return b.header.timestamp
+}
+
+// TransactionProof - Returns the proof that the transaction with the ID is part of the block.
+func (b *Block) TransactionProof(txID [32]byte) (*merkle.Proof, error) {
+	hashes := transactionHashes(b.transactions)
+	for i, h := range hashes {
+		if h == txID {
+			return merkle.New(hashes).Proof(i)
+		}
+	}
+	return nil, ErrTransactionNotFound
 }
 
 func (b *Block) Transactions() []*Transaction {
 	return b.transactions
 }
 
-// Hash - returns the hash of the block
+// Hash - returns the hash of the block, that is the hash of its header.
 func (b *Block) Hash() [32]byte {
-	m, _ := json.Marshal(b)
-	return sha256.Sum256([]byte(m))
+	return b.header.Hash()
+}
+
+// ParseBlockHash - Returns the block hash encoded in hex by s.
+func ParseBlockHash(s string) ([32]byte, error) {
+	var hash [32]byte
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return hash, fmt.Errorf("invalid block hash: %w", err)
+	}
+	if len(b) != len(hash) {
+		return hash, fmt.Errorf("invalid block hash length: %d bytes", len(b))
+	}
+	copy(hash[:], b)
+	return hash, nil
+}
+
+// MarshalBinary - Encodes the block in the canonical encoding: the version byte, the header, its seal and
+// the transactions, each one length prefixed.
+func (b *Block) MarshalBinary() ([]byte, error) {
+	e := codec.NewEncoder()
+	e.PutUint8(codec.CODEC_VERSION)
+	e.PutBytes(b.header.Bytes())
+	e.PutBytes(b.header.seal)
+	e.PutUint32(uint32(len(b.transactions)))
+	for _, t := range b.transactions {
+		tx, err := t.MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+		e.PutBytes(tx)
+	}
+	return e.Bytes(), nil
+}
+
+// UnmarshalBinary - Decodes a block encoded by MarshalBinary.
+func (b *Block) UnmarshalBinary(data []byte) error {
+	d := codec.NewDecoder(data)
+	d.Version()
+	header := d.Bytes()
+	seal := d.Bytes()
+	n := d.Count()
+	if err := d.Err(); err != nil {
+		return err
+	}
+	if err := b.header.UnmarshalBinary(header); err != nil {
+		return err
+	}
+	if len(seal) > 0 {
+		b.header.seal = seal
+	}
+
+	b.transactions = make([]*Transaction, n)
+	for i := range b.transactions {
+		t := new(Transaction)
+		if err := t.UnmarshalBinary(d.Bytes()); err != nil {
+			return fmt.Errorf("transaction %d: %w", i, err)
+		}
+		b.transactions[i] = t
+	}
+	return d.Finish()
 }
 
 func (b *Block) MarshalJSON() ([]byte, error) {
 	return json.Marshal(struct {
+		Version      uint32         `json:"version"`
 		Number       int64          `json:"number"`
 		Nonce        int            `json:"nonce"`
 		PreviousHash string         `json:"previous_hash"`
+		MerkleRoot   string         `json:"merkle_root"`
 		Timestamp    int64          `json:"timestamp"`
+		Bits         uint32         `json:"bits"`
+		Seal         string         `json:"seal,omitempty"`
 		Transactions []*Transaction `json:"transactions"`
 	}{
-		Number:       b.number,
-		Nonce:        b.nonce,
-		PreviousHash: fmt.Sprintf("%x", b.previousHash),
-		Timestamp:    b.timestamp,
+		Version:      b.header.version,
+		Number:       b.header.number,
+		Nonce:        b.header.nonce,
+		PreviousHash: fmt.Sprintf("%x", b.header.previousHash),
+		MerkleRoot:   fmt.Sprintf("%x", b.header.merkleRoot),
+		Timestamp:    b.header.timestamp,
+		Bits:         b.header.bits,
+		Seal:         hex.EncodeToString(b.header.seal),
 		Transactions: b.transactions,
 	})
 }
 
 func (b *Block) UnmarshalJSON(data []byte) error {
-	var previousHash string
+	var previousHash, merkleRoot, seal string
 	bl := &struct {
+		Version      *uint32         `json:"version"`
 		Number       *int64          `json:"number"`
 		Timestamp    *int64          `json:"timestamp"`
 		Nonce        *int            `json:"nonce"`
 		PreviousHash *string         `json:"previous_hash"`
+		MerkleRoot   *string         `json:"merkle_root"`
+		Bits         *uint32         `json:"bits"`
+		Seal         *string         `json:"seal"`
 		Transactions *[]*Transaction `json:"transactions"`
 	}{
-		Number:       &b.number,
-		Timestamp:    &b.timestamp,
-		Nonce:        &b.nonce,
+		Version:      &b.header.version,
+		Number:       &b.header.number,
+		Timestamp:    &b.header.timestamp,
+		Nonce:        &b.header.nonce,
 		PreviousHash: &previousHash,
+		MerkleRoot:   &merkleRoot,
+		Bits:         &b.header.bits,
+		Seal:         &seal,
 		Transactions: &b.transactions,
 	}
 	if err := json.Unmarshal(data, &bl); err != nil {
 		return err
 	}
-	ph, _ := hex.DecodeString(*bl.PreviousHash)
-	copy(b.previousHash[:], ph[:32])
+	var err error
+	if b.header.previousHash, err = ParseBlockHash(previousHash); err != nil {
+		return fmt.Errorf("previous hash: %w", err)
+	}
+	if b.header.merkleRoot, err = ParseBlockHash(merkleRoot); err != nil {
+		return fmt.Errorf("merkle root: %w", err)
+	}
+	if b.header.seal, err = decodeSeal(seal); err != nil {
+		return err
+	}
 	return nil
 }
 
 func (b *Block) Print() {
-	fmt.Printf("number: %d\n", b.number)
-	fmt.Printf("timestamp: %d\n", b.timestamp)
-	fmt.Printf("nonce: %d\n", b.nonce)
-	fmt.Printf("previousHash: %x\n", b.previousHash)
+	fmt.Printf("version: %d\n", b.header.version)
+	fmt.Printf("number: %d\n", b.header.number)
+	fmt.Printf("timestamp: %d\n", b.header.timestamp)
+	fmt.Printf("bits: %08x\n", b.header.bits)
+	fmt.Printf("nonce: %d\n", b.header.nonce)
+	fmt.Printf("previousHash: %x\n", b.header.previousHash)
+	fmt.Printf("merkleRoot: %x\n", b.header.merkleRoot)
 	for _, t := range b.transactions {
 		t.Print()
 	}
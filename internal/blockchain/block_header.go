@@ -0,0 +1,212 @@
+package blockchain
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+const (
+	// BLOCK_VERSION - Version of the header format and of the block rules.
+	// Version 2 replaced the leading zeros difficulty by the compact bits of the target.
+	BLOCK_VERSION = 2
+	// BLOCK_HEADER_SIZE - Size of the binary serialization of a header.
+	BLOCK_HEADER_SIZE = 4 + 8 + 32 + 32 + 8 + 4 + 8
+)
+
+var ErrInvalidHeaderSize = errors.New("invalid block header size")
+
+// BlockHeader - Fields of a block that are hashed. The transactions are committed by the merkle root,
+// so the hash of the block (and the proof of work) does not depend on the size of the block.
+// The seal is not hashed, it proves the hash: the consensus engine fills it when it seals the block.
+type BlockHeader struct {
+	version      uint32
+	number       int64
+	previousHash [32]byte
+	merkleRoot   [32]byte
+	timestamp    int64
+	// bits - Compact form of the 256 bits target the hash of the header must not exceed.
+	bits  uint32
+	nonce int
+	// seal - Signature of the header for the engines that sign blocks, empty for proof of work.
+	seal []byte
+}
+
+func (h *BlockHeader) Version() uint32 {
+	return h.version
+}
+
+func (h *BlockHeader) Number() int64 {
+	return h.number
+}
+
+func (h *BlockHeader) PreviousHash() [32]byte {
+	return h.previousHash
+}
+
+func (h *BlockHeader) MerkleRoot() [32]byte {
+	return h.merkleRoot
+}
+
+func (h *BlockHeader) Timestamp() int64 {
+	return h.timestamp
+}
+
+func (h *BlockHeader) Bits() uint32 {
+	return h.bits
+}
+
+// Target - Returns the target the hash of the header must not exceed.
+func (h *BlockHeader) Target() *big.Int {
+	return bitsToTarget(h.bits)
+}
+
+// Work - Returns the expected number of hashes needed to mine the header.
+func (h *BlockHeader) Work() *big.Int {
+	return targetWork(h.Target())
+}
+
+func (h *BlockHeader) Nonce() int {
+	return h.nonce
+}
+
+// Round - Returns the round the header was signed in, for the engines that sign blocks: how many
+// proposers of the ranking let their ROUND_TIMEOUT pass before. It is kept in the nonce.
+func (h *BlockHeader) Round() int {
+	return h.nonce
+}
+
+func (h *BlockHeader) Seal() []byte {
+	return h.seal
+}
+
+// Bytes - Returns the fixed size serialization of the header:
+// version (4 bytes), number (8), previous hash (32), merkle root (32), timestamp (8), bits (4)
+// and nonce (8). Integers are big endian.
+func (h *BlockHeader) Bytes() []byte {
+	buf := make([]byte, BLOCK_HEADER_SIZE)
+	binary.BigEndian.PutUint32(buf[0:4], h.version)
+	binary.BigEndian.PutUint64(buf[4:12], uint64(h.number))
+	copy(buf[12:44], h.previousHash[:])
+	copy(buf[44:76], h.merkleRoot[:])
+	binary.BigEndian.PutUint64(buf[76:84], uint64(h.timestamp))
+	binary.BigEndian.PutUint32(buf[84:88], h.bits)
+	binary.BigEndian.PutUint64(buf[88:96], uint64(h.nonce))
+	return buf
+}
+
+// ParseBlockHeader - Decodes a header serialized with Bytes.
+func ParseBlockHeader(buf []byte) (*BlockHeader, error) {
+	if len(buf) != BLOCK_HEADER_SIZE {
+		return nil, fmt.Errorf("%w: %d", ErrInvalidHeaderSize, len(buf))
+	}
+	h := &BlockHeader{
+		version:   binary.BigEndian.Uint32(buf[0:4]),
+		number:    int64(binary.BigEndian.Uint64(buf[4:12])),
+		timestamp: int64(binary.BigEndian.Uint64(buf[76:84])),
+		bits:      binary.BigEndian.Uint32(buf[84:88]),
+		nonce:     int(binary.BigEndian.Uint64(buf[88:96])),
+	}
+	copy(h.previousHash[:], buf[12:44])
+	copy(h.merkleRoot[:], buf[44:76])
+	return h, nil
+}
+
+func (h *BlockHeader) MarshalBinary() ([]byte, error) {
+	return h.Bytes(), nil
+}
+
+func (h *BlockHeader) UnmarshalBinary(data []byte) error {
+	parsed, err := ParseBlockHeader(data)
+	if err != nil {
+		return err
+	}
+	*h = *parsed
+	return nil
+}
+
+// MarshalJSON - Encodes the header with the same fields of the JSON of a block, without the transactions.
+func (h *BlockHeader) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Version      uint32 `json:"version"`
+		Number       int64  `json:"number"`
+		Nonce        int    `json:"nonce"`
+		PreviousHash string `json:"previous_hash"`
+		MerkleRoot   string `json:"merkle_root"`
+		Timestamp    int64  `json:"timestamp"`
+		Bits         uint32 `json:"bits"`
+		Seal         string `json:"seal,omitempty"`
+	}{
+		Version:      h.version,
+		Number:       h.number,
+		Nonce:        h.nonce,
+		PreviousHash: fmt.Sprintf("%x", h.previousHash),
+		MerkleRoot:   fmt.Sprintf("%x", h.merkleRoot),
+		Timestamp:    h.timestamp,
+		Bits:         h.bits,
+		Seal:         hex.EncodeToString(h.seal),
+	})
+}
+
+func (h *BlockHeader) UnmarshalJSON(data []byte) error {
+	var previousHash, merkleRoot, seal string
+	v := &struct {
+		Version      *uint32 `json:"version"`
+		Number       *int64  `json:"number"`
+		Nonce        *int    `json:"nonce"`
+		PreviousHash *string `json:"previous_hash"`
+		MerkleRoot   *string `json:"merkle_root"`
+		Timestamp    *int64  `json:"timestamp"`
+		Bits         *uint32 `json:"bits"`
+		Seal         *string `json:"seal"`
+	}{
+		Version:      &h.version,
+		Number:       &h.number,
+		Nonce:        &h.nonce,
+		PreviousHash: &previousHash,
+		MerkleRoot:   &merkleRoot,
+		Timestamp:    &h.timestamp,
+		Bits:         &h.bits,
+		Seal:         &seal,
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return err
+	}
+	var err error
+	if h.previousHash, err = ParseBlockHash(previousHash); err != nil {
+		return fmt.Errorf("previous hash: %w", err)
+	}
+	if h.merkleRoot, err = ParseBlockHash(merkleRoot); err != nil {
+		return fmt.Errorf("merkle root: %w", err)
+	}
+	if h.seal, err = decodeSeal(seal); err != nil {
+		return err
+	}
+	return nil
+}
+
+// decodeSeal - Decodes the seal encoded in hex, an empty seal is nil.
+func decodeSeal(s string) ([]byte, error) {
+	if s == "" {
+		return nil, nil
+	}
+	seal, err := hex.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid seal: %w", err)
+	}
+	return seal, nil
+}
+
+// Hash - Returns the hash of the header, that is the hash of the block.
+func (h *BlockHeader) Hash() [32]byte {
+	return sha256.Sum256(h.Bytes())
+}
+
+// meetsTarget - Returns true if the hash of the header is not above its target.
+func (h *BlockHeader) meetsTarget() bool {
+	return hashMeetsTarget(h.Hash(), h.Target())
+}
@@ -0,0 +1,133 @@
+package blockchain
+
+import (
+	"errors"
+	"sync"
+)
+
+var ErrBlockNotFound = errors.New("block not found")
+
+// BlockStore - Keeps the blocks of the chain.
+// Implementations must be safe for concurrent use.
+type BlockStore interface {
+	// Append - Adds a block at the end of the chain.
+	Append(block *Block) error
+	// Get - Returns the block with the given number.
+	Get(number int64) (*Block, error)
+	// GetByHash - Returns the block with the given hash.
+	GetByHash(hash [32]byte) (*Block, error)
+	// Iterate - Calls fn for every block from the first one to the tip.
+	// The iteration stops when fn returns false.
+	Iterate(fn func(block *Block) bool) error
+	// Tip - Returns the last block of the chain or nil if the store is empty.
+	Tip() *Block
+	// Len - Returns the number of blocks in the store.
+	Len() int
+	// Truncate - Removes every block whose number is greater or equal than number.
+	Truncate(number int64) error
+	// Replace - Replaces the whole chain with the given blocks.
+	Replace(chain []*Block) error
+	// Close - Releases the resources held by the store.
+	Close() error
+}
+
+type memoryBlockStore struct {
+	chain  []*Block
+	byHash map[[32]byte]*Block
+	mux    sync.RWMutex
+}
+
+// NewMemoryBlockStore - Returns a BlockStore that keeps the blocks only in memory.
+func NewMemoryBlockStore() BlockStore {
+	return &memoryBlockStore{
+		chain:  make([]*Block, 0),
+		byHash: make(map[[32]byte]*Block),
+	}
+}
+
+func (s *memoryBlockStore) Append(block *Block) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.chain = append(s.chain, block)
+	s.byHash[block.Hash()] = block
+	return nil
+}
+
+func (s *memoryBlockStore) Get(number int64) (*Block, error) {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+	for _, b := range s.chain {
+		if b.Number() == number {
+			return b, nil
+		}
+	}
+	return nil, ErrBlockNotFound
+}
+
+func (s *memoryBlockStore) GetByHash(hash [32]byte) (*Block, error) {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+	b, ok := s.byHash[hash]
+	if !ok {
+		return nil, ErrBlockNotFound
+	}
+	return b, nil
+}
+
+func (s *memoryBlockStore) Iterate(fn func(block *Block) bool) error {
+	s.mux.RLock()
+	chain := s.chain
+	s.mux.RUnlock()
+	for _, b := range chain {
+		if !fn(b) {
+			break
+		}
+	}
+	return nil
+}
+
+func (s *memoryBlockStore) Tip() *Block {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+	if len(s.chain) == 0 {
+		return nil
+	}
+	return s.chain[len(s.chain)-1]
+}
+
+func (s *memoryBlockStore) Len() int {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+	return len(s.chain)
+}
+
+func (s *memoryBlockStore) Truncate(number int64) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	for i, b := range s.chain {
+		if b.Number() >= number {
+			for _, removed := range s.chain[i:] {
+				delete(s.byHash, removed.Hash())
+			}
+			s.chain = s.chain[:i:i]
+			break
+		}
+	}
+	return nil
+}
+
+func (s *memoryBlockStore) Replace(chain []*Block) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.chain = make([]*Block, 0, len(chain))
+	s.byHash = make(map[[32]byte]*Block)
+	for _, b := range chain {
+		s.chain = append(s.chain, b)
+		s.byHash[b.Hash()] = b
+	}
+	return nil
+}
+
+func (s *memoryBlockStore) Close() error {
+	return nil
+}
@@ -1,8 +1,14 @@
 package blockchain
 
 import (
+	"encoding/json"
+	"errors"
+	"reflect"
 	"testing"
 	"time"
+
+	"github.com/martinsaporiti/blockchain-sample/internal/coin"
+	"github.com/martinsaporiti/blockchain-sample/internal/merkle"
 )
 
 func TestHash(t *testing.T) {
@@ -12,14 +18,14 @@ func TestHash(t *testing.T) {
 
 	timestamp := date.UnixNano()
 	block := NewBlock(1, 0, [32]byte{}, []*Transaction{})
-	block.timestamp = timestamp
+	block.header.timestamp = timestamp
 	tests := map[string]struct {
 		input *Block
 		want  [32]byte
 	}{
 		"hash sould return a correct hash array": {
 			input: block,
-			want:  [32]byte{217, 253, 26, 86, 184, 176, 55, 115, 121, 40, 209, 126, 49, 176, 168, 27, 194, 43, 24, 246, 115, 224, 202, 180, 3, 72, 95, 170, 239, 121, 118, 90},
+			want:  [32]byte{82, 201, 207, 198, 243, 117, 134, 103, 19, 28, 243, 136, 144, 101, 183, 220, 27, 64, 244, 56, 145, 37, 15, 18, 9, 237, 110, 15, 229, 221, 236, 41},
 		},
 	}
 
@@ -32,3 +38,191 @@ func TestHash(t *testing.T) {
 		})
 	}
 }
+
+func TestBlockHeader_Bytes(t *testing.T) {
+
+	header := BlockHeader{
+		version:      BLOCK_VERSION,
+		number:       7,
+		previousHash: [32]byte{1, 2, 3},
+		merkleRoot:   [32]byte{4, 5, 6},
+		timestamp:    1654369662,
+		bits:         0x1f100000,
+		nonce:        42,
+	}
+
+	buf := header.Bytes()
+	if len(buf) != BLOCK_HEADER_SIZE {
+		t.Fatalf("len(Bytes()) = %d, want %d", len(buf), BLOCK_HEADER_SIZE)
+	}
+	got, err := ParseBlockHeader(buf)
+	if err != nil {
+		t.Fatalf("ParseBlockHeader() = %v", err)
+	}
+	if !reflect.DeepEqual(*got, header) {
+		t.Errorf("ParseBlockHeader() = %+v, want %+v", *got, header)
+	}
+
+	if _, err := ParseBlockHeader(buf[1:]); !errors.Is(err, ErrInvalidHeaderSize) {
+		t.Errorf("ParseBlockHeader() = %v, want %v", err, ErrInvalidHeaderSize)
+	}
+}
+
+func TestBlock_HashDependsOnlyOnTheHeader(t *testing.T) {
+
+	tx := NewTransaction("15TZoyyxFmeTXJGjYwX1X3ARtXX94BbFrk", "1CHD4Jjqsak4RV5JHAdYZ9CKY1dQe4tkXW", 1, 1654369662, nil, nil)
+	block := NewBlock(1, 0, [32]byte{}, []*Transaction{tx})
+
+	withoutBody := &Block{header: block.header}
+	if withoutBody.Hash() != block.Hash() {
+		t.Errorf("Hash() without transactions = %x, want %x", withoutBody.Hash(), block.Hash())
+	}
+
+	other := NewBlock(1, 0, [32]byte{}, []*Transaction{
+		NewTransaction("15TZoyyxFmeTXJGjYwX1X3ARtXX94BbFrk", "1CHD4Jjqsak4RV5JHAdYZ9CKY1dQe4tkXW", 2, 1654369662, nil, nil)})
+	other.header.timestamp = block.header.timestamp
+	if other.Hash() == block.Hash() {
+		t.Errorf("Hash() of blocks with different transactions should be different")
+	}
+}
+
+func TestBlock_MarshalBinary(t *testing.T) {
+
+	account := newTestAccount()
+	rba := "1CHD4Jjqsak4RV5JHAdYZ9CKY1dQe4tkXW"
+	block := NewBlock(2, 42, [32]byte{9}, []*Transaction{
+		account.signed(NewTransaction(account.address, rba, 200, 1654369662,
+			[]*TxInput{NewTxInput([32]byte{1}, 0)},
+			[]*TxOutput{NewTxOutput(rba, 200)})),
+		NewTransaction("THE BLOCKCHAIN", rba, MINING_REWARD, 1654369662,
+			[]*TxInput{NewCoinbaseInput(2)},
+			[]*TxOutput{NewTxOutput(rba, MINING_REWARD)}),
+	})
+	block.header.bits = 0x1f100000
+	block.header.seal = []byte{7, 8, 9}
+
+	m, err := block.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary() = %v", err)
+	}
+	var decoded Block
+	if err := decoded.UnmarshalBinary(m); err != nil {
+		t.Fatalf("UnmarshalBinary() = %v", err)
+	}
+
+	if !reflect.DeepEqual(decoded.header, block.header) {
+		t.Errorf("header = %+v, want %+v", decoded.header, block.header)
+	}
+	if decoded.Hash() != block.Hash() {
+		t.Errorf("Hash() = %x, want %x", decoded.Hash(), block.Hash())
+	}
+	if len(decoded.transactions) != len(block.transactions) {
+		t.Fatalf("len(transactions) = %d, want %d", len(decoded.transactions), len(block.transactions))
+	}
+	for i, tx := range decoded.transactions {
+		if tx.ID() != block.transactions[i].ID() {
+			t.Errorf("transaction %d ID() = %s, want %s", i, tx.ID(), block.transactions[i].ID())
+		}
+	}
+	if decoded.MerkleRoot() != computeMerkleRoot(decoded.transactions) {
+		t.Errorf("MerkleRoot() does not match the decoded transactions")
+	}
+}
+
+func TestBlock_UnmarshalJSON(t *testing.T) {
+
+	block := NewBlock(2, 42, [32]byte{9}, []*Transaction{
+		NewTransaction("THE BLOCKCHAIN", "1CHD4Jjqsak4RV5JHAdYZ9CKY1dQe4tkXW", MINING_REWARD, 1654369662,
+			[]*TxInput{NewCoinbaseInput(2)},
+			[]*TxOutput{NewTxOutput("1CHD4Jjqsak4RV5JHAdYZ9CKY1dQe4tkXW", MINING_REWARD)}),
+	})
+	block.header.seal = []byte{7, 8, 9}
+	m, err := json.Marshal(block)
+	if err != nil {
+		t.Fatalf("Marshal() = %v", err)
+	}
+
+	tests := map[string]struct {
+		// change - Changes the fields of the encoded block.
+		change  func(fields map[string]json.RawMessage)
+		wantErr bool
+	}{
+		"should decode the block it encodes": {
+			change: func(fields map[string]json.RawMessage) {},
+		},
+		"should reject a previous hash that is not hex": {
+			change: func(fields map[string]json.RawMessage) {
+				fields["previous_hash"] = json.RawMessage(`"zz"`)
+			},
+			wantErr: true,
+		},
+		"should reject a previous hash that is not 32 bytes long": {
+			change: func(fields map[string]json.RawMessage) {
+				fields["previous_hash"] = json.RawMessage(`"0900"`)
+			},
+			wantErr: true,
+		},
+		"should reject a block without previous hash": {
+			change: func(fields map[string]json.RawMessage) {
+				delete(fields, "previous_hash")
+			},
+			wantErr: true,
+		},
+		"should reject a merkle root that is not hex": {
+			change: func(fields map[string]json.RawMessage) {
+				fields["merkle_root"] = json.RawMessage(`"not a hash"`)
+			},
+			wantErr: true,
+		},
+		"should reject a merkle root that is not 32 bytes long": {
+			change: func(fields map[string]json.RawMessage) {
+				fields["merkle_root"] = json.RawMessage(`"abcd"`)
+			},
+			wantErr: true,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			fields := make(map[string]json.RawMessage)
+			if err := json.Unmarshal(m, &fields); err != nil {
+				t.Fatal(err)
+			}
+			tc.change(fields)
+			data, _ := json.Marshal(fields)
+
+			var decoded Block
+			err := json.Unmarshal(data, &decoded)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("Unmarshal() = %v, want an error %t", err, tc.wantErr)
+			}
+			if err == nil && decoded.Hash() != block.Hash() {
+				t.Errorf("Hash() = %x, want %x", decoded.Hash(), block.Hash())
+			}
+		})
+	}
+}
+
+func TestBlock_TransactionProof(t *testing.T) {
+
+	transactions := make([]*Transaction, 0)
+	for i := 0; i < 5; i++ {
+		transactions = append(transactions, NewTransaction("15TZoyyxFmeTXJGjYwX1X3ARtXX94BbFrk",
+			"1CHD4Jjqsak4RV5JHAdYZ9CKY1dQe4tkXW", coin.Amount(i+1), 1654369662, nil, nil))
+	}
+	block := NewBlock(2, 0, [32]byte{}, transactions)
+
+	for _, tx := range transactions {
+		proof, err := block.TransactionProof(tx.Hash())
+		if err != nil {
+			t.Fatalf("TransactionProof() = %v", err)
+		}
+		if !merkle.Verify(block.MerkleRoot(), tx.Hash(), proof) {
+			t.Errorf("merkle.Verify() of transaction %s = false, want true", tx.ID())
+		}
+	}
+
+	if _, err := block.TransactionProof([32]byte{1}); err != ErrTransactionNotFound {
+		t.Errorf("TransactionProof() = %v, want %v", err, ErrTransactionNotFound)
+	}
+}
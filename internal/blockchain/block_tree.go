@@ -0,0 +1,96 @@
+package blockchain
+
+import (
+	"math/big"
+)
+
+// blockNode - A block the node knows, in the main chain or in a side branch,
+// with the total work of its branch from the genesis block.
+type blockNode struct {
+	header    BlockHeader
+	hash      [32]byte
+	parent    *blockNode
+	chainWork *big.Int
+	// block - Body of a block out of the main chain. The blocks of the main chain are read from the store.
+	block *Block
+}
+
+// ancestor - Returns the node of the branch with the number, or nil if the branch does not reach it.
+func (n *blockNode) ancestor(number int64) *blockNode {
+	for n != nil && n.header.number > number {
+		n = n.parent
+	}
+	if n == nil || n.header.number != number {
+		return nil
+	}
+	return n
+}
+
+// headerAt - Reads the headers of the branch that ends in the node.
+func (n *blockNode) headerAt(number int64) (*BlockHeader, error) {
+	a := n.ancestor(number)
+	if a == nil {
+		return nil, ErrBlockNotFound
+	}
+	return &a.header, nil
+}
+
+// blockTree - Every block the node accepted, linked to its parent.
+type blockTree struct {
+	nodes map[[32]byte]*blockNode
+}
+
+func newBlockTree() *blockTree {
+	return &blockTree{nodes: make(map[[32]byte]*blockNode)}
+}
+
+// newBlockTreeFromChain - Returns a tree with a single branch, the chain.
+func newBlockTreeFromChain(chain []*Block) *blockTree {
+	tree := newBlockTree()
+	var parent *blockNode
+	for _, b := range chain {
+		parent = tree.add(&b.header, parent)
+	}
+	return tree
+}
+
+// add - Adds the header as a child of the parent. The parent is nil for the genesis block.
+func (t *blockTree) add(header *BlockHeader, parent *blockNode) *blockNode {
+	work := header.Work()
+	if parent != nil {
+		work.Add(work, parent.chainWork)
+	}
+	n := &blockNode{header: *header, hash: header.Hash(), parent: parent, chainWork: work}
+	t.nodes[n.hash] = n
+	return n
+}
+
+// get - Returns the node of the block with the hash.
+func (t *blockTree) get(hash [32]byte) (*blockNode, bool) {
+	n, ok := t.nodes[hash]
+	return n, ok
+}
+
+// remove - Forgets the node and every node that descends from it.
+func (t *blockTree) remove(n *blockNode) {
+	for hash, other := range t.nodes {
+		if other.ancestor(n.header.number) == n {
+			delete(t.nodes, hash)
+		}
+	}
+}
+
+// fork - Returns the last node the branches of a and b share, or nil if they do not share any.
+func fork(a *blockNode, b *blockNode) *blockNode {
+	for a != nil && b != nil && a != b {
+		if a.header.number >= b.header.number {
+			a = a.parent
+		} else {
+			b = b.parent
+		}
+	}
+	if a != b {
+		return nil
+	}
+	return a
+}
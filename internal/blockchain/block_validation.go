@@ -0,0 +1,160 @@
+package blockchain
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/martinsaporiti/blockchain-sample/internal/coin"
+)
+
+const (
+	// MAX_BLOCK_TIME_DRIFT - How far in the future, according to our clock, the timestamp of a block can be.
+	MAX_BLOCK_TIME_DRIFT = 2 * time.Minute
+)
+
+var (
+	ErrUnsupportedVersion = errors.New("block version is not supported")
+	ErrUnknownParent      = errors.New("block does not extend the expected parent")
+	ErrInvalidNumber      = errors.New("block number does not follow the parent number")
+	ErrInvalidDifficulty  = errors.New("block difficulty is not the difficulty required by the chain")
+	ErrInvalidProof       = errors.New("block nonce does not satisfy the proof of work")
+	ErrInvalidMerkleRoot  = errors.New("block merkle root does not match its transactions")
+	ErrTimestampTooOld    = errors.New("block timestamp is not after the parent timestamp")
+	ErrTimestampInFuture  = errors.New("block timestamp is too far in the future")
+	ErrMissingCoinbase    = errors.New("block has no coinbase transaction")
+	ErrMultipleCoinbase   = errors.New("block has more than one coinbase transaction")
+	ErrInvalidCoinbase    = errors.New("coinbase does not pay the mining reward of the block")
+	ErrKnownBlock         = errors.New("block is already known")
+)
+
+// BlockValidationError - Explains which rule a block breaks.
+// Err is one of the block errors of this package or the error of the ledger that rejected a transaction,
+// so callers can check it with errors.Is.
+type BlockValidationError struct {
+	Number int64
+	Err    error
+}
+
+func (e *BlockValidationError) Error() string {
+	return fmt.Sprintf("block %d is not valid: %v", e.Number, e.Err)
+}
+
+func (e *BlockValidationError) Unwrap() error {
+	return e.Err
+}
+
+// ValidateBlock - Verifies the block can follow the parent, a block of our chain.
+// Checks the version, the link with the parent, the merkle root, the difficulty, the seal and the
+// timestamp of the header, the coinbase, and verifies every transaction. Whether the transactions can be applied to the ledger is checked when the block is added.
+// The difficulty must be the one our chain requires after the parent, not the difficulty of this node.
+func (bc *Blockchain) ValidateBlock(block *Block, parent *Block) error {
+	if err := bc.validateBlock(block, &parent.header, bc.storedHeader); err != nil {
+		return &BlockValidationError{Number: block.Number(), Err: err}
+	}
+	return nil
+}
+
+func (bc *Blockchain) validateBlock(block *Block, parent *BlockHeader, headerAt HeaderByNumber) error {
+	if err := bc.validateHeader(&block.header, parent, headerAt); err != nil {
+		return err
+	}
+	if block.header.merkleRoot != computeMerkleRoot(block.transactions) {
+		return ErrInvalidMerkleRoot
+	}
+
+	if err := validateCoinbase(block); err != nil {
+		return err
+	}
+
+	for _, t := range block.transactions {
+		if err := t.Verify(bc.ChainID()); err != nil {
+			return fmt.Errorf("%w: transaction %s", err, t.ID())
+		}
+	}
+	return nil
+}
+
+// validateHeader - Verifies the rules of the header alone: the version, the link with the parent,
+// the difficulty, the seal of the consensus engine, the timestamp and the checkpoints.
+func (bc *Blockchain) validateHeader(header *BlockHeader, parent *BlockHeader, headerAt HeaderByNumber) error {
+	if header.version != BLOCK_VERSION {
+		return fmt.Errorf("%w: %d", ErrUnsupportedVersion, header.version)
+	}
+	if header.previousHash != parent.Hash() {
+		return ErrUnknownParent
+	}
+	if header.number != parent.Number()+1 {
+		return fmt.Errorf("%w: %d, expected %d", ErrInvalidNumber, header.number, parent.Number()+1)
+	}
+	bits, err := bc.engine.NextBits(parent, header.Round(), headerAt)
+	if err != nil {
+		return err
+	}
+	if header.bits != bits {
+		return fmt.Errorf("%w: bits %08x, expected %08x", ErrInvalidDifficulty, header.bits, bits)
+	}
+	if err := bc.engine.VerifySeal(header, parent); err != nil {
+		return err
+	}
+
+	if header.timestamp <= parent.Timestamp() {
+		return ErrTimestampTooOld
+	}
+	if header.timestamp > time.Now().Add(MAX_BLOCK_TIME_DRIFT).UnixNano() {
+		return ErrTimestampInFuture
+	}
+	return bc.verifyCheckpoint(header)
+}
+
+// validateCoinbase - Verifies the block has exactly one coinbase, that it belongs to the block
+// and that it pays the mining reward plus the fees of the other transactions.
+func validateCoinbase(block *Block) error {
+	var coinbase *Transaction
+	for _, t := range block.transactions {
+		if !t.IsCoinbase() {
+			continue
+		}
+		if coinbase != nil {
+			return ErrMultipleCoinbase
+		}
+		coinbase = t
+	}
+	if coinbase == nil {
+		return ErrMissingCoinbase
+	}
+
+	if int64(coinbase.inputs[0].index) != block.Number() {
+		return fmt.Errorf("%w: it was created for block %d", ErrInvalidCoinbase, coinbase.inputs[0].index)
+	}
+	if coinbase.fee != 0 {
+		return fmt.Errorf("%w: it has a fee", ErrInvalidCoinbase)
+	}
+	fees, err := blockFees(block.transactions)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidCoinbase, err)
+	}
+	reward, err := MINING_REWARD.Add(fees)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidCoinbase, err)
+	}
+	total, err := outputsTotal(coinbase)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidCoinbase, err)
+	}
+	if coinbase.value != reward || total != reward {
+		return fmt.Errorf("%w: it pays %s, the reward and the fees are %s", ErrInvalidCoinbase, total, reward)
+	}
+	return nil
+}
+
+// blockFees - Returns the sum of the fees of the transactions.
+func blockFees(transactions []*Transaction) (coin.Amount, error) {
+	fees := make([]coin.Amount, 0, len(transactions))
+	for _, t := range transactions {
+		if !t.IsCoinbase() {
+			fees = append(fees, t.fee)
+		}
+	}
+	return coin.Sum(fees...)
+}
@@ -0,0 +1,208 @@
+package blockchain
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/martinsaporiti/blockchain-sample/internal/coin"
+)
+
+// mineTestBlock - Returns a block with a valid proof of work that follows the parent.
+func mineTestBlock(blockchain *Blockchain, parent *Block, transactions []*Transaction, timestamp int64) *Block {
+	header, err := blockchain.newBlockHeader(parent, transactions)
+	if err != nil {
+		panic(err)
+	}
+	header.timestamp = timestamp
+	for !header.meetsTarget() {
+		header.nonce++
+	}
+	return &Block{header: *header, transactions: transactions}
+}
+
+func TestBlockchain_ValidateBlock(t *testing.T) {
+
+	account := newTestAccount()
+	sba := account.address
+	rba := "1CHD4Jjqsak4RV5JHAdYZ9CKY1dQe4tkXW"
+
+	blockchain, _ := NewBlockchain("Node 500", "THE BLOCKCHAIN", newTestGenesis(), newTestProofOfWork(1), NewMemoryBlockStore(), LEDGER_MODE_UTXO)
+	fundingID := fundTestAddress(blockchain, sba, 200)
+	parent := blockchain.LastBlock()
+	timestamp := parent.Timestamp() + 1
+
+	spend := func() *Transaction {
+		return NewTransaction(sba, rba, 200, 1654369662,
+			[]*TxInput{NewTxInput(fundingID, 0)},
+			[]*TxOutput{NewTxOutput(rba, 200)})
+	}
+	// spendWithFee - Pays 50 units of the funding output to the miner.
+	spendWithFee := func() *Transaction {
+		return withFee(NewTransaction(sba, rba, 150, 1654369662,
+			[]*TxInput{NewTxInput(fundingID, 0)},
+			[]*TxOutput{NewTxOutput(rba, 150)}), 50)
+	}
+	coinbase := func(number int64, reward coin.Amount) *Transaction {
+		return NewTransaction("Node 500", "THE BLOCKCHAIN", reward, 1654369662,
+			[]*TxInput{NewCoinbaseInput(number)},
+			[]*TxOutput{NewTxOutput("THE BLOCKCHAIN", reward)})
+	}
+
+	tests := map[string]struct {
+		input func() *Block
+		want  error
+	}{
+		"should accept a valid block": {
+			input: func() *Block {
+				return mineTestBlock(blockchain, parent,
+					[]*Transaction{account.signed(spend()), coinbase(3, MINING_REWARD)}, timestamp)
+			},
+		},
+		"should accept a coinbase that collects the fees": {
+			input: func() *Block {
+				return mineTestBlock(blockchain, parent,
+					[]*Transaction{account.signed(spendWithFee()), coinbase(3, MINING_REWARD+50)}, timestamp)
+			},
+		},
+		"should reject a coinbase that pays more than the reward and the fees": {
+			input: func() *Block {
+				return mineTestBlock(blockchain, parent,
+					[]*Transaction{account.signed(spendWithFee()), coinbase(3, MINING_REWARD+51)}, timestamp)
+			},
+			want: ErrInvalidCoinbase,
+		},
+		"should reject a block that does not extend the parent": {
+			input: func() *Block {
+				b := mineTestBlock(blockchain, parent, []*Transaction{coinbase(3, MINING_REWARD)}, timestamp)
+				b.header.previousHash = [32]byte{1}
+				return b
+			},
+			want: ErrUnknownParent,
+		},
+		"should reject a block with a number that does not follow the parent": {
+			input: func() *Block {
+				b := mineTestBlock(blockchain, parent, []*Transaction{coinbase(4, MINING_REWARD)}, timestamp)
+				b.header.number = 4
+				return b
+			},
+			want: ErrInvalidNumber,
+		},
+		"should reject a block whose merkle root does not match its transactions": {
+			input: func() *Block {
+				b := mineTestBlock(blockchain, parent, []*Transaction{coinbase(3, MINING_REWARD)}, timestamp)
+				b.transactions = append(b.transactions, account.signed(spend()))
+				return b
+			},
+			want: ErrInvalidMerkleRoot,
+		},
+		"should reject a block with an unsupported version": {
+			input: func() *Block {
+				b := mineTestBlock(blockchain, parent, []*Transaction{coinbase(3, MINING_REWARD)}, timestamp)
+				b.header.version = BLOCK_VERSION + 1
+				return b
+			},
+			want: ErrUnsupportedVersion,
+		},
+		"should reject a block mined with another difficulty": {
+			input: func() *Block {
+				b := mineTestBlock(blockchain, parent, []*Transaction{coinbase(3, MINING_REWARD)}, timestamp)
+				b.header.bits, _ = DifficultyToBits(2)
+				return b
+			},
+			want: ErrInvalidDifficulty,
+		},
+		"should reject a block with an invalid proof of work": {
+			input: func() *Block {
+				b := mineTestBlock(blockchain, parent, []*Transaction{coinbase(3, MINING_REWARD)}, timestamp)
+				for b.header.meetsTarget() {
+					b.header.nonce++
+				}
+				return b
+			},
+			want: ErrInvalidProof,
+		},
+		"should reject a block older than the parent": {
+			input: func() *Block {
+				return mineTestBlock(blockchain, parent, []*Transaction{coinbase(3, MINING_REWARD)}, parent.Timestamp())
+			},
+			want: ErrTimestampTooOld,
+		},
+		"should reject a block from the future": {
+			input: func() *Block {
+				return mineTestBlock(blockchain, parent, []*Transaction{coinbase(3, MINING_REWARD)},
+					time.Now().Add(time.Hour).UnixNano())
+			},
+			want: ErrTimestampInFuture,
+		},
+		"should reject a block without coinbase": {
+			input: func() *Block {
+				return mineTestBlock(blockchain, parent, []*Transaction{account.signed(spend())}, timestamp)
+			},
+			want: ErrMissingCoinbase,
+		},
+		"should reject a block with two coinbases": {
+			input: func() *Block {
+				cb := coinbase(3, MINING_REWARD)
+				return mineTestBlock(blockchain, parent, []*Transaction{cb, cb}, timestamp)
+			},
+			want: ErrMultipleCoinbase,
+		},
+		"should reject a coinbase paying more than the mining reward": {
+			input: func() *Block {
+				return mineTestBlock(blockchain, parent, []*Transaction{coinbase(3, coin.Coins(1000))}, timestamp)
+			},
+			want: ErrInvalidCoinbase,
+		},
+		"should reject a coinbase of another block": {
+			input: func() *Block {
+				return mineTestBlock(blockchain, parent, []*Transaction{coinbase(2, MINING_REWARD)}, timestamp)
+			},
+			want: ErrInvalidCoinbase,
+		},
+		"should reject a transaction without witness": {
+			input: func() *Block {
+				return mineTestBlock(blockchain, parent,
+					[]*Transaction{spend(), coinbase(3, MINING_REWARD)}, timestamp)
+			},
+			want: ErrMissingWitness,
+		},
+		"should reject a transaction signed by the owner of another address": {
+			input: func() *Block {
+				return mineTestBlock(blockchain, parent,
+					[]*Transaction{newTestAccount().signed(spend()), coinbase(3, MINING_REWARD)}, timestamp)
+			},
+			want: ErrWrongSenderKey,
+		},
+		"should reject a transaction signed for another chain": {
+			input: func() *Block {
+				replayed := spend()
+				replayed.chainID = "other"
+				return mineTestBlock(blockchain, parent,
+					[]*Transaction{account.signed(replayed), coinbase(3, MINING_REWARD)}, timestamp)
+			},
+			want: ErrWrongChainID,
+		},
+		"should reject a forged transaction": {
+			input: func() *Block {
+				forged := account.signed(spend())
+				forged.outputs = []*TxOutput{NewTxOutput(sba, 200)}
+				return mineTestBlock(blockchain, parent, []*Transaction{forged, coinbase(3, MINING_REWARD)}, timestamp)
+			},
+			want: ErrInvalidSignature,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := blockchain.ValidateBlock(tc.input(), parent)
+			if !errors.Is(err, tc.want) {
+				t.Errorf("ValidateBlock() = %v, want %v", err, tc.want)
+			}
+			var validationErr *BlockValidationError
+			if err != nil && !errors.As(err, &validationErr) {
+				t.Errorf("ValidateBlock() = %T, want *BlockValidationError", err)
+			}
+		})
+	}
+}
@@ -2,46 +2,167 @@ package blockchain
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"math/big"
 	"strings"
 	"sync"
 	"time"
+
+	"github.com/martinsaporiti/blockchain-sample/internal/coin"
+	"github.com/martinsaporiti/blockchain-sample/internal/merkle"
 )
 
 const (
-	MINING_REWARD = 1.0
+	MINING_REWARD = coin.Amount(1 * coin.UNITS_PER_COIN)
 )
 
+var ErrTransactionNotFound = errors.New("transaction not found")
+
 type Blockchain struct {
 	blockchainAddress string
-	difficulty        int
-	chain             []*Block
-	txPool            *TransactionPool
-	nodeName          string
-	mux               sync.Mutex
+	genesis           *Genesis
+	genesisHash       [32]byte
+	engine            ConsensusEngine
+	store             BlockStore
+	ledgerMode        LedgerMode
+	ledger            Ledger
+	// tree - The blocks of the main chain and of the side branches, with their chainwork.
+	tree           *blockTree
+	orphans        *orphanPool
+	txIndex        *txIndex
+	finality       FinalityRules
+	reorgListeners []func(*ReorgEvent)
+	txPool         *TransactionPool
+	nodeName       string
+	mux            sync.Mutex
 }
 
-func NewBlockchain(nodeName string, blockchainAddress string, miningDificulty int) *Blockchain {
-	b := &Block{}
+// NewBlockchain - Creates a blockchain that keeps its blocks in the given store.
+// The genesis decides the first block of the chain, every node of the network must use the same one.
+// The consensus engine decides who can create the blocks and how they are sealed (proof of work, proof of
+// authority or proof of stake). The ledger mode decides how the transactions move coins (UTXO or account
+// based).
+// If the store is empty the genesis block is created, otherwise the stored chain is verified, it must
+// start with the same genesis block, and the blockchain resumes from the stored tip.
+func NewBlockchain(nodeName string, blockchainAddress string, genesis *Genesis, engine ConsensusEngine,
+	store BlockStore, ledgerMode LedgerMode) (*Blockchain, error) {
+	ledger, err := NewLedger(ledgerMode)
+	if err != nil {
+		return nil, err
+	}
+
 	bc := new(Blockchain)
 	bc.blockchainAddress = blockchainAddress
-	bc.difficulty = miningDificulty
-	bc.CreateBlock(1, 0, b.Hash(), nil)
+	bc.genesis = genesis
+	bc.engine = engine
 	bc.nodeName = nodeName
-	return bc
+	bc.store = store
+	bc.ledgerMode = ledgerMode
+	bc.ledger = ledger
+	bc.tree = newBlockTree()
+	bc.orphans = newOrphanPool()
+	bc.txIndex = newTxIndex()
+	bc.finality = FinalityRules{}.withDefaults()
+
+	genesisBlock := genesis.Block(engine.GenesisBits())
+	bc.genesisHash = genesisBlock.Hash()
+	if store.Len() == 0 {
+		if err := bc.addBlock(genesisBlock); err != nil {
+			return nil, err
+		}
+		log.Printf("Created the genesis block %x of the chain %s", bc.genesisHash, genesis.ChainID)
+		return bc, nil
+	}
+
+	chain := bc.Chain()
+	if err := bc.ValidateChain(chain); err != nil {
+		return nil, fmt.Errorf("the stored chain is not valid: %w", err)
+	}
+	ledger, err = bc.buildLedger(chain)
+	if err != nil {
+		return nil, err
+	}
+	bc.ledger = ledger
+	bc.tree = newBlockTreeFromChain(chain)
+	bc.txIndex = newTxIndexFromChain(chain)
+	log.Printf("Resuming blockchain from block %d", store.Tip().Number())
+	return bc, nil
 }
 
+// Chain - Returns all the blocks of the blockchain.
 func (bc *Blockchain) Chain() []*Block {
-	return bc.chain
+	chain := make([]*Block, 0, bc.store.Len())
+	if err := bc.store.Iterate(func(b *Block) bool {
+		chain = append(chain, b)
+		return true
+	}); err != nil {
+		log.Printf("ERROR: reading the chain: %v", err)
+	}
+	return chain
+}
+
+// ChainID - Returns the name of the network, from the genesis.
+func (bc *Blockchain) ChainID() string {
+	return bc.genesis.ChainID
+}
+
+// GenesisHash - Returns the hash of the genesis block.
+func (bc *Blockchain) GenesisHash() [32]byte {
+	return bc.genesisHash
 }
 
-func (bc *Blockchain) SetChain(chain []*Block) {
-	bc.chain = chain
+// Ledger - Returns the state (UTXO set or accounts) derived from the chain.
+func (bc *Blockchain) Ledger() Ledger {
+	return bc.ledger
 }
 
-func (bc *Blockchain) CreateMinerTransaction() *Transaction {
-	return NewTransaction(bc.nodeName, bc.blockchainAddress, MINING_REWARD, time.Now().Unix())
+// LedgerMode - Returns how the transactions of the chain move coins.
+func (bc *Blockchain) LedgerMode() LedgerMode {
+	return bc.ledgerMode
+}
+
+// Close - Closes the block store once no block is being written. The blockchain can not be used after it.
+func (bc *Blockchain) Close() error {
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+	return bc.store.Close()
+}
+
+// buildLedger - Applies every block of the chain to an empty ledger.
+func (bc *Blockchain) buildLedger(chain []*Block) (Ledger, error) {
+	ledger, err := NewLedger(bc.ledgerMode)
+	if err != nil {
+		return nil, err
+	}
+	for _, b := range chain {
+		if err := bc.applyBlock(ledger, b); err != nil {
+			return nil, &BlockValidationError{Number: b.Number(), Err: err}
+		}
+	}
+	return ledger, nil
+}
+
+// applyBlock - Verifies the rules of the consensus that depend on the state, like the proposer of proof of
+// stake, and applies the block to the ledger, that must be on its parent.
+func (bc *Blockchain) applyBlock(ledger Ledger, b *Block) error {
+	if err := bc.engine.VerifyProposer(&b.header, ledger); err != nil {
+		return err
+	}
+	return ledger.ApplyBlock(b)
+}
+
+// CreateMinerTransaction - Creates the coinbase transaction for the block number, that pays the mining
+// reward plus the fees of the transactions of the block.
+func (bc *Blockchain) CreateMinerTransaction(number int64, fees coin.Amount) (*Transaction, error) {
+	reward, err := MINING_REWARD.Add(fees)
+	if err != nil {
+		return nil, err
+	}
+	inputs := []*TxInput{NewCoinbaseInput(number)}
+	outputs := []*TxOutput{NewTxOutput(bc.blockchainAddress, reward)}
+	return NewTransaction(bc.nodeName, bc.blockchainAddress, reward, time.Now().Unix(), inputs, outputs), nil
 }
 
 // CreateBlock creates a new block in the blockchain
@@ -55,143 +176,154 @@ func (bc *Blockchain) CreateBlock(number int64, nonce int, previousHash [32]byte
 		return nil
 	}
 
-	log.Printf("Creating block: %d with %d transactions", nonce, len(transactions))
 	b := NewBlock(number, nonce, previousHash, transactions)
-	if bc.addBlock(b) {
-		return b
+	b.header.bits = bc.engine.GenesisBits()
+	return bc.createBlock(b)
+}
+
+// newBlockHeader - Returns the header of the block that follows the parent with the transactions,
+// ready to be mined with the difficulty the chain requires.
+func (bc *Blockchain) newBlockHeader(parent *Block, transactions []*Transaction) (*BlockHeader, error) {
+	bits, err := bc.engine.NextBits(&parent.header, 0, bc.storedHeader)
+	if err != nil {
+		return nil, err
 	}
+	return &BlockHeader{
+		version:      BLOCK_VERSION,
+		number:       parent.Number() + 1,
+		previousHash: parent.Hash(),
+		merkleRoot:   computeMerkleRoot(transactions),
+		timestamp:    time.Now().UnixNano(),
+		bits:         bits,
+	}, nil
+}
 
-	return nil
+// createBlock - Adds a block created by this node to the blockchain.
+func (bc *Blockchain) createBlock(b *Block) *Block {
+	log.Printf("Creating block: %d with %d transactions", b.Nonce(), len(b.transactions))
+	if err := bc.addBlock(b); err != nil {
+		log.Printf("ERROR: %v", err)
+		return nil
+	}
+
+	return b
 }
 
 // addBlock - Adds a new block to the blockchain.
-// If the block is valid, it will be added to the blockchain.
-// If the block is invalid, it will be ignored.
-func (bc *Blockchain) addBlock(block *Block) bool {
+// The block must extend the last block and its transactions must be valid on top of the ledger.
+func (bc *Blockchain) addBlock(block *Block) error {
 	bc.mux.Lock()
 	defer bc.mux.Unlock()
 
-	if len(bc.chain) == 0 {
-		bc.chain = append(bc.chain, block)
-		return true
+	tip := bc.tipNode()
+	if tip != nil && block.PreviousHash() != tip.hash {
+		return &BlockValidationError{Number: block.Number(), Err: ErrUnknownParent}
 	}
 
-	if block.previousHash != bc.LastBlock().Hash() {
-		return false
+	if err := bc.applyBlock(bc.ledger, block); err != nil {
+		return &BlockValidationError{Number: block.Number(), Err: err}
 	}
 
-	bc.chain = append(bc.chain, block)
-	return true
-}
-
-func (bc *Blockchain) replaceLastBlock(block *Block) {
-	bc.mux.Lock()
-	defer bc.mux.Unlock()
-	bc.chain[len(bc.chain)-1] = block
+	if err := bc.store.Append(block); err != nil {
+		bc.ledger.RevertBlock(block)
+		return fmt.Errorf("storing block %d: %w", block.Number(), err)
+	}
+	bc.tree.add(&block.header, tip)
+	bc.txIndex.connect(block)
+	bc.pruneLedger()
+	return nil
 }
 
 // LastBlock - Returns the last block of the blockchain
 func (bc *Blockchain) LastBlock() *Block {
-	return bc.chain[len(bc.chain)-1]
-}
-
-// validProof - Validates the Proof.
-// Returns true if the Proof is valid, false otherwise.
-func (bc *Blockchain) validProof(number int64, nonce int, previousHash [32]byte, transactions []*Transaction,
-	difficulty int) bool {
-
-	zeros := strings.Repeat("0", difficulty)
-	guessBlock := &Block{
-		number: number, nonce: nonce,
-		previousHash: previousHash,
-		transactions: transactions,
-	}
-	guessHashStr := fmt.Sprintf("%x", guessBlock.Hash())
-	return guessHashStr[:difficulty] == zeros
-
-}
-
-// AddProposedBlockFromNetwork - Adds a new block from the network
-// If the block is valid, it will be added to the blockchain
-// If the block is invalid, it will be ignored
-func (bc *Blockchain) AddProposedBlockFromNetwork(proposedBlock *Block) bool {
-	currentLastBlock := bc.LastBlock()
-	newBlockAccepted := false
-	if proposedBlock.Number() == currentLastBlock.Number()+1 {
-		log.Printf("Adding new block from network: %d", proposedBlock.Number())
-		previousHash := currentLastBlock.Hash()
-		if bc.validProof(proposedBlock.Number(), proposedBlock.Nonce(), previousHash, proposedBlock.Transactions(),
-			bc.difficulty) {
-			bc.addBlock(proposedBlock)
-			log.Printf("New block added: %d", proposedBlock.Number())
-			newBlockAccepted = true
-		}
-	}
+	return bc.store.Tip()
+}
 
-	if proposedBlock.Number() == currentLastBlock.Number() {
-		log.Printf("Proposed block has the same number than our last block: %d",
-			proposedBlock.Number())
-
-		if proposedBlock.timestamp < currentLastBlock.timestamp {
-			log.Printf("Proposed block is older than the current last block: %d", proposedBlock.Number())
-			previousHash := currentLastBlock.PreviousHash()
-			if bc.validProof(proposedBlock.Number(), proposedBlock.Nonce(), previousHash, proposedBlock.Transactions(),
-				bc.difficulty) {
-				log.Printf("Adding new block from network after removing current lastblock  block: %d",
-					proposedBlock.Number())
-				bc.replaceLastBlock(proposedBlock)
-				newBlockAccepted = true
-			}
-		}
+// tipNode - Returns the node of the last block, or nil before the genesis block is added.
+func (bc *Blockchain) tipNode() *blockNode {
+	tip := bc.store.Tip()
+	if tip == nil {
+		return nil
 	}
+	n, _ := bc.tree.get(tip.Hash())
+	return n
+}
 
-	if newBlockAccepted {
-		log.Printf("Proposed Block was added: %d", proposedBlock.Number())
-		return true
+// ChainWork - Returns the total work of the branch from the genesis block up to the block with the hash.
+// The block can be in the main chain or in a side branch.
+func (bc *Blockchain) ChainWork(hash [32]byte) (*big.Int, error) {
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+	n, ok := bc.tree.get(hash)
+	if !ok {
+		return nil, ErrBlockNotFound
 	}
+	return new(big.Int).Set(n.chainWork), nil
+}
 
-	log.Printf("Proposed block was ignored: %d", proposedBlock.Number())
-	return false
+// HasBlock - Returns true if the block with the hash is in the main chain or in a side branch.
+// Orphan blocks are not counted, the node does not know how they connect to its chain yet.
+func (bc *Blockchain) HasBlock(hash [32]byte) bool {
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+	_, ok := bc.tree.get(hash)
+	return ok
 }
 
-// isValidChain - Validates the chain.
-// Returns true if the chain is valid, false otherwise.
-func (bc *Blockchain) IsValidChain(chain []*Block) bool {
-	preBlock := chain[0]
-	currentIndex := 1
-	for currentIndex < len(chain) {
-		b := chain[currentIndex]
-		if b.previousHash != preBlock.Hash() {
-			return false
-		}
+// BlockByHash - Returns the block with the hash, from the main chain or from a side branch.
+func (bc *Blockchain) BlockByHash(hash [32]byte) (*Block, error) {
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+	n, ok := bc.tree.get(hash)
+	if !ok {
+		return nil, ErrBlockNotFound
+	}
+	if n.block != nil {
+		return n.block, nil
+	}
+	return bc.store.GetByHash(hash)
+}
 
-		if !bc.validProof(b.Number(), b.Nonce(), b.PreviousHash(), b.Transactions(), bc.difficulty) {
-			log.Printf("Nonce is invalid: %d", b.Nonce())
-			return false
+// ValidateChain - Validates every block of the chain against its parent and the ledger built from the
+// blocks before it. The first block must be our genesis block.
+// The difficulty every block must have is computed from the timestamps of the chain itself.
+func (bc *Blockchain) ValidateChain(chain []*Block) error {
+	if len(chain) > 0 && chain[0].Hash() != bc.genesisHash {
+		return &BlockValidationError{Number: chain[0].Number(), Err: ErrGenesisMismatch}
+	}
+	for i := 1; i < len(chain); i++ {
+		if err := bc.validateBlock(chain[i], &chain[i-1].header, chainHeader(chain)); err != nil {
+			return &BlockValidationError{Number: chain[i].Number(), Err: err}
 		}
+	}
+	if _, err := bc.buildLedger(chain); err != nil {
+		return err
+	}
+	return nil
+}
 
-		preBlock = b
-		currentIndex += 1
+// TransactionProof - Finds the block of the main chain that includes the transaction with the ID and
+// returns the proof that links the transaction to the merkle root of the block.
+func (bc *Blockchain) TransactionProof(txID string) (*Block, *merkle.Proof, error) {
+	location, err := bc.TransactionLocation(txID)
+	if err != nil {
+		return nil, nil, err
+	}
+	block, err := bc.store.GetByHash(location.BlockHash)
+	if err != nil {
+		return nil, nil, err
 	}
-	return true
+	proof, err := block.TransactionProof(block.transactions[location.Index].Hash())
+	if err != nil {
+		return nil, nil, err
+	}
+	return block, proof, nil
 }
 
 // CalculateTotalAmount - Calculates the total amount for a Blockchain Address
-func (bc *Blockchain) CalculateTotalAmount(blockchainAddress string) float32 {
-	var totalAmount float32 = 0.0
-	for _, b := range bc.chain {
-		for _, t := range b.transactions {
-			value := t.value
-			if t.recipientBlockchainAddress == blockchainAddress {
-				totalAmount += value
-			}
-
-			if t.senderBlockchainAddress == blockchainAddress {
-				totalAmount -= value
-			}
-		}
-	}
-	return totalAmount
+// It is a lookup in the ledger, the chain is not scanned.
+func (bc *Blockchain) CalculateTotalAmount(blockchainAddress string) coin.Amount {
+	return bc.ledger.Balance(blockchainAddress)
 }
 
 func (bc *Blockchain) Transactions() []*Transaction {
@@ -202,24 +334,27 @@ func (bc *Blockchain) MarshalJSON() ([]byte, error) {
 	return json.Marshal(struct {
 		Blocks []*Block `json:"chain"`
 	}{
-		Blocks: bc.chain,
+		Blocks: bc.Chain(),
 	})
 }
 
+// UnmarshalJSON - Decodes a chain received from the network into an in-memory store.
 func (bc *Blockchain) UnmarshalJSON(data []byte) error {
+	var chain []*Block
 	v := &struct {
 		Blocks *[]*Block `json:"chain"`
 	}{
-		Blocks: &bc.chain,
+		Blocks: &chain,
 	}
 	if err := json.Unmarshal(data, &v); err != nil {
 		return err
 	}
-	return nil
+	bc.store = NewMemoryBlockStore()
+	return bc.store.Replace(chain)
 }
 
 func (bc *Blockchain) Print() {
-	for i, b := range bc.chain {
+	for i, b := range bc.Chain() {
 		fmt.Printf("%s Chain %d %s\n", strings.Repeat("-", 20), i, strings.Repeat("-", 20))
 		b.Print()
 	}
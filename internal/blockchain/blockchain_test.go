@@ -1,16 +1,19 @@
 package blockchain
 
 import (
+	"errors"
 	"testing"
-	"time"
+
+	"github.com/martinsaporiti/blockchain-sample/internal/coin"
 )
 
 func TestBlockchain_CreateMinerTransaction(t *testing.T) {
 
-	blk := NewBlockchain("Node 500", "THE BLOCKCHAIN", 1)
+	blk, _ := NewBlockchain("Node 500", "THE BLOCKCHAIN", newTestGenesis(), newTestProofOfWork(1), NewMemoryBlockStore(), LEDGER_MODE_UTXO)
 
 	tests := map[string]struct {
 		input *Blockchain
+		fees  coin.Amount
 		want  *Transaction
 	}{
 		"should return a miner transaction": {
@@ -18,14 +21,26 @@ func TestBlockchain_CreateMinerTransaction(t *testing.T) {
 			want: &Transaction{
 				senderBlockchainAddress:    "Node 500",
 				recipientBlockchainAddress: "THE BLOCKCHAIN",
-				value:                      1.0,
+				value:                      coin.Coins(1),
+			},
+		},
+		"should collect the fees of the block": {
+			input: blk,
+			fees:  coin.Coins(2),
+			want: &Transaction{
+				senderBlockchainAddress:    "Node 500",
+				recipientBlockchainAddress: "THE BLOCKCHAIN",
+				value:                      coin.Coins(3),
 			},
 		},
 	}
 
 	for name, tc := range tests {
 		t.Run(name, func(t *testing.T) {
-			tx := tc.input.CreateMinerTransaction()
+			tx, err := tc.input.CreateMinerTransaction(2, tc.fees)
+			if err != nil {
+				t.Fatalf("CreateMinerTransaction() = %v", err)
+			}
 
 			if tx.senderBlockchainAddress != tc.want.senderBlockchainAddress {
 				t.Errorf("CreateMinerTransaction() = %v, want %v", tx.senderBlockchainAddress, tc.want.senderBlockchainAddress)
@@ -39,9 +54,17 @@ func TestBlockchain_CreateMinerTransaction(t *testing.T) {
 				t.Errorf("CreateMinerTransaction() = %v, want %v", tx.value, tc.want.value)
 			}
 
+			if total, _ := outputsTotal(tx); total != tc.want.value {
+				t.Errorf("CreateMinerTransaction() outputs = %v, want %v", total, tc.want.value)
+			}
+
 			if tx.timestamp == 0 {
 				t.Errorf("CreateMinerTransaction() = %v, want %v", tx.timestamp, tc.want.timestamp)
 			}
+
+			if !tx.IsCoinbase() {
+				t.Errorf("CreateMinerTransaction() should return a coinbase transaction")
+			}
 		})
 	}
 }
@@ -50,7 +73,7 @@ func TestBlockchain_CreateBlock(t *testing.T) {
 
 	sba := "15TZoyyxFmeTXJGjYwX1X3ARtXX94BbFrk"
 	rba := "1CHD4Jjqsak4RV5JHAdYZ9CKY1dQe4tkXW"
-	value := float32(200)
+	value := coin.Coins(200)
 	timestamp := int64(1654369662)
 
 	tx := &Transaction{
@@ -58,6 +81,8 @@ func TestBlockchain_CreateBlock(t *testing.T) {
 		recipientBlockchainAddress: rba,
 		value:                      value,
 		timestamp:                  timestamp,
+		inputs:                     []*TxInput{NewCoinbaseInput(2)},
+		outputs:                    []*TxOutput{NewTxOutput(rba, value)},
 	}
 
 	txs := make([]*Transaction, 0)
@@ -70,7 +95,7 @@ func TestBlockchain_CreateBlock(t *testing.T) {
 		transactions []*Transaction
 	}
 
-	blockchain := NewBlockchain("Node 500", "THE BLOCKCHAIN", 1)
+	blockchain, _ := NewBlockchain("Node 500", "THE BLOCKCHAIN", newTestGenesis(), newTestProofOfWork(1), NewMemoryBlockStore(), LEDGER_MODE_UTXO)
 
 	tests := map[string]struct {
 		input input
@@ -85,9 +110,11 @@ func TestBlockchain_CreateBlock(t *testing.T) {
 			},
 
 			want: &Block{
-				number:       1,
-				nonce:        123,
-				previousHash: blockchain.LastBlock().Hash(),
+				header: BlockHeader{
+					number:       1,
+					nonce:        123,
+					previousHash: blockchain.LastBlock().Hash(),
+				},
 				transactions: txs,
 			},
 		},
@@ -95,9 +122,9 @@ func TestBlockchain_CreateBlock(t *testing.T) {
 		"sould not create a block": {
 			input: input{
 				number:       1,
-				nonce:        0,
+				nonce:        123,
 				previousHash: blockchain.LastBlock().Hash(),
-				transactions: txs,
+				transactions: nil,
 			},
 			want: nil,
 		},
@@ -116,16 +143,16 @@ func TestBlockchain_CreateBlock(t *testing.T) {
 					t.Errorf("CreateBlock() = %v, want %v", blockchain.LastBlock().Hash(), blk.Hash())
 				}
 
-				if blk.number != tc.want.number {
-					t.Errorf("CreateBlock() = %v, want %v", blk.number, tc.want.number)
+				if blk.header.number != tc.want.header.number {
+					t.Errorf("CreateBlock() = %v, want %v", blk.header.number, tc.want.header.number)
 				}
 
-				if blk.nonce != tc.want.nonce {
-					t.Errorf("CreateBlock() = %v, want %v", blk.nonce, tc.want.nonce)
+				if blk.header.nonce != tc.want.header.nonce {
+					t.Errorf("CreateBlock() = %v, want %v", blk.header.nonce, tc.want.header.nonce)
 				}
 
-				if blk.previousHash != tc.want.previousHash {
-					t.Errorf("CreateBlock() = %v, want %v", blk.previousHash, tc.want.previousHash)
+				if blk.header.previousHash != tc.want.header.previousHash {
+					t.Errorf("CreateBlock() = %v, want %v", blk.header.previousHash, tc.want.header.previousHash)
 				}
 
 				if len(blk.transactions) != len(tc.want.transactions) {
@@ -159,66 +186,197 @@ func TestBlockchain_CreateBlock(t *testing.T) {
 
 func TestBlockchain_AddProposedBlockFromNetwork(t *testing.T) {
 
-	blockchain := NewBlockchain("Node 500", "THE BLOCKCHAIN", 1)
-
-	sba := "15TZoyyxFmeTXJGjYwX1X3ARtXX94BbFrk"
+	account := newTestAccount()
+	sba := account.address
 	rba := "1CHD4Jjqsak4RV5JHAdYZ9CKY1dQe4tkXW"
-	value := float32(200)
-	timestamp := int64(1654369662)
 
-	tx := &Transaction{
-		senderBlockchainAddress:    sba,
-		recipientBlockchainAddress: rba,
-		value:                      value,
-		timestamp:                  timestamp,
+	// newBlocks - Returns a blockchain where sba owns 200 coins and two blocks that can follow it,
+	// with the same number and content but different timestamps.
+	newBlocks := func(reward coin.Amount, value coin.Amount) (*Blockchain, *Block, *Block) {
+		blockchain, _ := NewBlockchain("Node 500", "THE BLOCKCHAIN", newTestGenesis(), newTestProofOfWork(1), NewMemoryBlockStore(), LEDGER_MODE_UTXO)
+		fundingID := fundTestAddress(blockchain, sba, coin.Coins(200))
+		parent := blockchain.LastBlock()
+
+		coinbase := NewTransaction("Node 500", "THE BLOCKCHAIN", reward, 1654369662,
+			[]*TxInput{NewCoinbaseInput(parent.Number() + 1)},
+			[]*TxOutput{NewTxOutput("THE BLOCKCHAIN", reward)})
+		tx := account.signed(NewTransaction(sba, rba, value, 1654369662,
+			[]*TxInput{NewTxInput(fundingID, 0)},
+			[]*TxOutput{NewTxOutput(rba, value)}))
+		txs := []*Transaction{tx, coinbase}
+
+		older := mineTestBlock(blockchain, parent, txs, parent.Timestamp()+1)
+		newer := mineTestBlock(blockchain, parent, txs, parent.Timestamp()+2)
+		return blockchain, older, newer
 	}
 
-	txs := make([]*Transaction, 0)
-	txs = append(txs, tx)
+	tests := map[string]struct {
+		input func() (*Blockchain, *Block)
+		want  error
+		// wantSideBranch - The block is added but it does not become the last block.
+		wantSideBranch bool
+	}{
+		"should add a block": {
+			input: func() (*Blockchain, *Block) {
+				blockchain, _, newer := newBlocks(MINING_REWARD, coin.Coins(200))
+				return blockchain, newer
+			},
+		},
+		"should keep the last block when a block with the same number has the same work": {
+			input: func() (*Blockchain, *Block) {
+				blockchain, older, newer := newBlocks(MINING_REWARD, coin.Coins(200))
+				if err := blockchain.AddProposedBlockFromNetwork(newer); err != nil {
+					t.Fatalf("AddProposedBlockFromNetwork() = %v", err)
+				}
+				return blockchain, older
+			},
+			wantSideBranch: true,
+		},
+		"should ignore a block that is already known": {
+			input: func() (*Blockchain, *Block) {
+				blockchain, _, newer := newBlocks(MINING_REWARD, coin.Coins(200))
+				if err := blockchain.AddProposedBlockFromNetwork(newer); err != nil {
+					t.Fatalf("AddProposedBlockFromNetwork() = %v", err)
+				}
+				return blockchain, newer
+			},
+			want: ErrKnownBlock,
+		},
+		"should keep a block whose parent is not known": {
+			input: func() (*Blockchain, *Block) {
+				blockchain, _, newer := newBlocks(MINING_REWARD, coin.Coins(200))
+				orphan := &Block{header: newer.header, transactions: newer.transactions}
+				orphan.header.previousHash = [32]byte{1}
+				for !orphan.header.meetsTarget() {
+					orphan.header.nonce++
+				}
+				return blockchain, orphan
+			},
+			want: ErrOrphanBlock,
+		},
+		"should reject a block whose parent is not known with an invalid proof of work": {
+			input: func() (*Blockchain, *Block) {
+				blockchain, _, newer := newBlocks(MINING_REWARD, coin.Coins(200))
+				orphan := &Block{header: newer.header, transactions: newer.transactions}
+				orphan.header.previousHash = [32]byte{1}
+				for orphan.header.meetsTarget() {
+					orphan.header.nonce++
+				}
+				return blockchain, orphan
+			},
+			want: ErrInvalidProof,
+		},
+		"should reject a block whose parent is not known with a body that does not match its header": {
+			input: func() (*Blockchain, *Block) {
+				blockchain, older, newer := newBlocks(MINING_REWARD, coin.Coins(200))
+				orphan := &Block{header: newer.header, transactions: older.transactions[1:]}
+				orphan.header.previousHash = [32]byte{1}
+				for !orphan.header.meetsTarget() {
+					orphan.header.nonce++
+				}
+				return blockchain, orphan
+			},
+			want: ErrInvalidMerkleRoot,
+		},
+		"should reject a block paying more than the mining reward": {
+			input: func() (*Blockchain, *Block) {
+				blockchain, _, newer := newBlocks(coin.Coins(1000), coin.Coins(200))
+				return blockchain, newer
+			},
+			want: ErrInvalidCoinbase,
+		},
+		"should reject a block with a transaction that spends more than its inputs": {
+			input: func() (*Blockchain, *Block) {
+				blockchain, _, newer := newBlocks(MINING_REWARD, coin.Coins(300))
+				return blockchain, newer
+			},
+			want: ErrOverspend,
+		},
+	}
 
-	ok := false
-	nonce := 0
-	for !ok {
-		nonce++
-		ok = blockchain.validProof(2, nonce, blockchain.LastBlock().Hash(), txs, 1)
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			blockchain, block := tc.input()
+			err := blockchain.AddProposedBlockFromNetwork(block)
+			if !errors.Is(err, tc.want) {
+				t.Errorf("AddProposedBlockFromNetwork() = %v, want %v", err, tc.want)
+			}
+			if err == nil && !tc.wantSideBranch && blockchain.LastBlock().Hash() != block.Hash() {
+				t.Errorf("AddProposedBlockFromNetwork() should make the block the last block")
+			}
+			if tc.wantSideBranch && blockchain.LastBlock().Hash() == block.Hash() {
+				t.Errorf("AddProposedBlockFromNetwork() should add the block to a side branch")
+			}
+		})
 	}
+}
 
-	blk1 := &Block{
-		number:       2,
-		nonce:        nonce,
-		previousHash: blockchain.LastBlock().Hash(),
-		transactions: txs,
-		timestamp:    time.Now().Unix(),
+func TestBlockchain_ChainWork(t *testing.T) {
+
+	blockchain, _ := NewBlockchain("Node 500", "THE BLOCKCHAIN", newTestGenesis(), newTestProofOfWork(1), NewMemoryBlockStore(), LEDGER_MODE_UTXO)
+	fundTestAddress(blockchain, "1CHD4Jjqsak4RV5JHAdYZ9CKY1dQe4tkXW", 100)
+	fundTestAddress(blockchain, "1CHD4Jjqsak4RV5JHAdYZ9CKY1dQe4tkXW", 100)
+
+	// Every block has the easiest target, 2^252, and 2^256 / (2^252 + 1) hashes of work.
+	for i, want := range []int64{15, 30, 45} {
+		block := blockchain.Chain()[i]
+		got, err := blockchain.ChainWork(block.Hash())
+		if err != nil {
+			t.Fatalf("ChainWork() = %v", err)
+		}
+		if got.Int64() != want {
+			t.Errorf("ChainWork() of block %d = %s, want %d", block.Number(), got, want)
+		}
 	}
 
-	blk2 := &Block{
-		number:       2,
-		nonce:        nonce,
-		previousHash: blockchain.LastBlock().Hash(),
-		transactions: txs,
-		timestamp:    time.Now().Add(time.Second * time.Duration(-5)).Unix(),
+	if _, err := blockchain.ChainWork([32]byte{1}); !errors.Is(err, ErrBlockNotFound) {
+		t.Errorf("ChainWork() = %v, want %v", err, ErrBlockNotFound)
 	}
+}
+
+func TestBlockchain_ValidateChain(t *testing.T) {
 
 	tests := map[string]struct {
-		input *Block
-		want  bool
+		// chain - Returns the chain to validate, it starts at our genesis block.
+		chain func(f *forkTest) []*Block
+		want  error
 	}{
-		"should add a block": {
-			input: blk1,
-			want:  true,
+		"should accept a valid chain": {
+			chain: func(f *forkTest) []*Block {
+				genesis := f.blockchain.Chain()[0]
+				b2 := f.mine(genesis, 2)
+				return []*Block{genesis, b2, f.mine(b2, 2)}
+			},
 		},
-
-		"should add the block with same number": {
-			input: blk2,
-			want:  true,
+		"should reject a chain with a block whose body does not match its header": {
+			chain: func(f *forkTest) []*Block {
+				genesis := f.blockchain.Chain()[0]
+				b2 := f.mine(genesis, 2)
+				b3 := f.mine(b2, 2)
+				b3.transactions = b2.transactions
+				return []*Block{genesis, b2, b3}
+			},
+			want: ErrInvalidMerkleRoot,
+		},
+		"should reject a chain with a block with an invalid proof of work": {
+			chain: func(f *forkTest) []*Block {
+				genesis := f.blockchain.Chain()[0]
+				b2 := f.mine(genesis, 2)
+				for b2.header.meetsTarget() {
+					b2.header.nonce++
+				}
+				return []*Block{genesis, b2}
+			},
+			want: ErrInvalidProof,
 		},
 	}
 
 	for name, tc := range tests {
 		t.Run(name, func(t *testing.T) {
-			added := blockchain.AddProposedBlockFromNetwork(tc.input)
-			if added != tc.want {
-				t.Errorf("AddProposedBlockFromNetwork() = %v, want %v", added, tc.want)
+			f := newForkTest(t)
+			chain := tc.chain(f)
+			if err := f.blockchain.ValidateChain(chain); !errors.Is(err, tc.want) {
+				t.Errorf("ValidateChain() = %v, want %v", err, tc.want)
 			}
 		})
 	}
@@ -0,0 +1,165 @@
+package blockchain
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/martinsaporiti/blockchain-sample/internal/blkcrypto"
+)
+
+type ConsensusMode string
+
+const (
+	// CONSENSUS_POW - The blocks are sealed with a proof of work.
+	CONSENSUS_POW ConsensusMode = "pow"
+	// CONSENSUS_POA - The blocks are signed, in turns, by a fixed set of signers.
+	CONSENSUS_POA ConsensusMode = "poa"
+	// CONSENSUS_POS - The blocks are signed by validators chosen by their stake.
+	CONSENSUS_POS ConsensusMode = "pos"
+)
+
+const (
+	// SIGNED_SEAL_SIZE - Size of the seal of a signed block: the public key of the signer (X and Y) and the
+	// signature of the hash of the header (R and S), 32 bytes each.
+	SIGNED_SEAL_SIZE = 4 * 32
+	// ROUND_TIMEOUT - Time the proposer of a round has to sign the block, in the engines that sign blocks.
+	// When it passes, the next proposer of the ranking can sign the block in the next round.
+	ROUND_TIMEOUT = 10 * time.Second
+	// IN_TURN_BITS - Bits of the signed blocks of the round 0. Its target is half the easiest one, so they
+	// have twice the work of the blocks of the next rounds and the branch of the proposers in turn is the
+	// heaviest.
+	IN_TURN_BITS = 0x20080000
+)
+
+var (
+	ErrRoundNotStarted = errors.New("block is signed before its round started")
+)
+
+// HeaderByNumber - Returns the header of the block of a chain with the number.
+type HeaderByNumber func(number int64) (*BlockHeader, error)
+
+// ConsensusEngine - Decides who can create the next block and how the block proves it.
+// Every node of a network must use the same engine, with the same settings.
+type ConsensusEngine interface {
+	// GenesisBits - Returns the bits of the genesis block.
+	GenesisBits() uint32
+	// NextBits - Returns the bits the block that follows the parent must have, when it is sealed in the
+	// round. headerAt reads the headers of the branch of the parent. Proof of work has no rounds.
+	NextBits(parent *BlockHeader, round int, headerAt HeaderByNumber) (uint32, error)
+	// Seal - Completes the header of the block so that VerifySeal accepts it. The parent is the header the
+	// block follows and the state is the ledger after it.
+	// Returns the error of the context when it is cancelled before.
+	Seal(ctx context.Context, block *Block, parent *BlockHeader, state Ledger) error
+	// VerifySeal - Verifies the header was sealed following the rules of the engine. The parent is nil when
+	// it is not known yet, then only the rules of the header alone are verified.
+	VerifySeal(header *BlockHeader, parent *BlockHeader) error
+	// VerifyProposer - Verifies the rules of the engine that depend on the state of the chain, the ledger
+	// after the parent of the block. It is checked when the block is applied to the ledger.
+	VerifyProposer(header *BlockHeader, state Ledger) error
+}
+
+// signHeader - Returns the seal of the header signed with the key: the public key and the signature of
+// the hash of the header.
+func signHeader(key *ecdsa.PrivateKey, header *BlockHeader) ([]byte, error) {
+	hash := header.Hash()
+	r, s, err := ecdsa.Sign(rand.Reader, key, hash[:])
+	if err != nil {
+		return nil, err
+	}
+	seal := make([]byte, SIGNED_SEAL_SIZE)
+	key.X.FillBytes(seal[0:32])
+	key.Y.FillBytes(seal[32:64])
+	r.FillBytes(seal[64:96])
+	s.FillBytes(seal[96:128])
+	return seal, nil
+}
+
+// headerSigner - Verifies the signature of the seal of the header and returns the address of the signer.
+func headerSigner(header *BlockHeader) (string, error) {
+	seal := header.seal
+	if len(seal) != SIGNED_SEAL_SIZE {
+		return "", fmt.Errorf("%w: the seal has %d bytes", ErrInvalidSeal, len(seal))
+	}
+	publicKey := &ecdsa.PublicKey{
+		Curve: elliptic.P256(),
+		X:     new(big.Int).SetBytes(seal[0:32]),
+		Y:     new(big.Int).SetBytes(seal[32:64]),
+	}
+	if !publicKey.Curve.IsOnCurve(publicKey.X, publicKey.Y) {
+		return "", fmt.Errorf("%w: the public key is not valid", ErrInvalidSeal)
+	}
+	hash := header.Hash()
+	r, s := new(big.Int).SetBytes(seal[64:96]), new(big.Int).SetBytes(seal[96:128])
+	if !ecdsa.Verify(publicKey, hash[:], r, s) {
+		return "", fmt.Errorf("%w: the signature is not valid", ErrInvalidSeal)
+	}
+	return blkcrypto.AddressFromPublicKey(publicKey), nil
+}
+
+// roundBits - Returns the bits of a signed block sealed in the round.
+func roundBits(round int) uint32 {
+	if round == 0 {
+		return IN_TURN_BITS
+	}
+	return POA_BITS
+}
+
+// roundStart - Returns when the round of the block that follows the parent starts, in nanoseconds: the
+// proposer of every round before it had ROUND_TIMEOUT to sign the block.
+func roundStart(parent *BlockHeader, round int) int64 {
+	return parent.timestamp + int64(round)*int64(ROUND_TIMEOUT)
+}
+
+// verifyRoundStart - Verifies the signed header is not signed before its round started. Without the parent
+// only the round itself is verified.
+func verifyRoundStart(header *BlockHeader, parent *BlockHeader) error {
+	round := header.Round()
+	if round < 0 {
+		return fmt.Errorf("%w: round %d", ErrInvalidSeal, round)
+	}
+	if parent == nil {
+		return nil
+	}
+	if elapsed := header.timestamp - parent.timestamp; elapsed/int64(ROUND_TIMEOUT) < int64(round) {
+		return fmt.Errorf("%w: block %d is signed %v after its parent, round %d starts after %v",
+			ErrRoundNotStarted, header.number, time.Duration(elapsed), round, time.Duration(round)*ROUND_TIMEOUT)
+	}
+	return nil
+}
+
+// sealRound - Waits until the round of the block that follows the parent starts and signs the header with
+// the key in the round, with the bits of the round and the time it is signed.
+// Returns the error of the context when it is cancelled before.
+func sealRound(ctx context.Context, key *ecdsa.PrivateKey, block *Block, parent *BlockHeader, round int) error {
+	if wait := time.Until(time.Unix(0, roundStart(parent, round))); wait > 0 {
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	header := &block.header
+	header.nonce = round
+	header.bits = roundBits(round)
+	if now := time.Now().UnixNano(); now > header.timestamp {
+		header.timestamp = now
+	}
+	seal, err := signHeader(key, header)
+	if err != nil {
+		return err
+	}
+	header.seal = seal
+	return nil
+}
@@ -0,0 +1,76 @@
+package blockchain
+
+import (
+	"math/big"
+	"time"
+)
+
+const (
+	DEFAULT_TARGET_BLOCK_INTERVAL = 10 * time.Second
+	DEFAULT_RETARGET_WINDOW       = 10
+	// MAX_RETARGET_FACTOR - The most the target can grow or shrink in one adjustment.
+	MAX_RETARGET_FACTOR = 4
+)
+
+// DifficultyRules - How the difficulty follows the time between blocks. Zero values use the defaults.
+// Every node of the network must use the same rules, they are part of the consensus.
+type DifficultyRules struct {
+	// TargetInterval - Expected time between two blocks.
+	TargetInterval time.Duration
+	// Window - Number of blocks between two adjustments of the difficulty.
+	Window int64
+}
+
+func (r DifficultyRules) withDefaults() DifficultyRules {
+	if r.TargetInterval == 0 {
+		r.TargetInterval = DEFAULT_TARGET_BLOCK_INTERVAL
+	}
+	if r.Window == 0 {
+		r.Window = DEFAULT_RETARGET_WINDOW
+	}
+	return r
+}
+
+// retarget - Returns the bits for the next window, given the time the last window took.
+// The target is scaled by how much longer or shorter than expected the window was, at most
+// MAX_RETARGET_FACTOR times, and never becomes easier than the easiest difficulty.
+func (r DifficultyRules) retarget(bits uint32, elapsed time.Duration) uint32 {
+	expected := r.TargetInterval * time.Duration(r.Window)
+	if elapsed < expected/MAX_RETARGET_FACTOR {
+		elapsed = expected / MAX_RETARGET_FACTOR
+	}
+	if elapsed > expected*MAX_RETARGET_FACTOR {
+		elapsed = expected * MAX_RETARGET_FACTOR
+	}
+
+	target := bitsToTarget(bits)
+	target.Mul(target, big.NewInt(int64(elapsed)))
+	target.Div(target, big.NewInt(int64(expected)))
+	if target.Cmp(powLimit) > 0 {
+		target = powLimit
+	}
+	return targetToBits(target)
+}
+
+// storedHeader - Reads the headers of the blocks of our chain.
+func (bc *Blockchain) storedHeader(number int64) (*BlockHeader, error) {
+	b, err := bc.store.Get(number)
+	if err != nil {
+		return nil, err
+	}
+	return &b.header, nil
+}
+
+// chainHeader - Reads the headers of a chain that is not stored, like a chain received from another node.
+func chainHeader(chain []*Block) HeaderByNumber {
+	return func(number int64) (*BlockHeader, error) {
+		if len(chain) == 0 {
+			return nil, ErrBlockNotFound
+		}
+		i := number - chain[0].Number()
+		if i < 0 || i >= int64(len(chain)) {
+			return nil, ErrBlockNotFound
+		}
+		return &chain[i].header, nil
+	}
+}
@@ -0,0 +1,78 @@
+package blockchain
+
+import (
+	"math/big"
+	"testing"
+	"time"
+)
+
+// newTimedChain - Returns a chain of blocks with the bits, from the genesis block,
+// where every block comes the interval after its parent.
+func newTimedChain(length int, bits uint32, interval time.Duration) []*Block {
+	chain := make([]*Block, length)
+	timestamp := time.Date(2022, 6, 4, 0, 0, 0, 0, time.UTC).UnixNano()
+	for i := range chain {
+		chain[i] = &Block{header: BlockHeader{
+			number:    int64(i + 1),
+			timestamp: timestamp + int64(i)*int64(interval),
+			bits:      bits,
+		}}
+	}
+	return chain
+}
+
+func TestDifficultyRules_retarget(t *testing.T) {
+
+	rules := DifficultyRules{TargetInterval: 10 * time.Second, Window: 10}
+	bits := uint32(0x1f100000)
+	target := bitsToTarget(bits)
+	scaled := func(num, den int64) uint32 {
+		t := new(big.Int).Mul(target, big.NewInt(num))
+		return targetToBits(t.Div(t, big.NewInt(den)))
+	}
+
+	tests := map[string]struct {
+		bits    uint32
+		elapsed time.Duration
+		want    uint32
+	}{
+		"should keep the target when the blocks follow the interval": {
+			bits:    bits,
+			elapsed: 100 * time.Second,
+			want:    bits,
+		},
+		"should make the target harder when the blocks are faster": {
+			bits:    bits,
+			elapsed: 50 * time.Second,
+			want:    scaled(1, 2),
+		},
+		"should make the target easier when the blocks are slower": {
+			bits:    bits,
+			elapsed: 150 * time.Second,
+			want:    scaled(3, 2),
+		},
+		"should not make the target more than four times harder": {
+			bits:    bits,
+			elapsed: time.Second,
+			want:    scaled(1, 4),
+		},
+		"should not make the target more than four times easier": {
+			bits:    bits,
+			elapsed: time.Hour,
+			want:    scaled(4, 1),
+		},
+		"should not make the target easier than the limit": {
+			bits:    targetToBits(powLimit),
+			elapsed: time.Hour,
+			want:    targetToBits(powLimit),
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := rules.retarget(tc.bits, tc.elapsed); got != tc.want {
+				t.Errorf("retarget() = %08x, want %08x", got, tc.want)
+			}
+		})
+	}
+}
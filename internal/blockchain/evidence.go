@@ -0,0 +1,88 @@
+package blockchain
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/martinsaporiti/blockchain-sample/internal/codec"
+)
+
+var ErrInvalidEvidence = errors.New("evidence does not prove a double signature")
+
+// Evidence - Two different headers with the same number signed by the same key. A validator of proof of
+// stake signs one block per number, the evidence proves it did not and its stake is slashed.
+type Evidence struct {
+	first  BlockHeader
+	second BlockHeader
+}
+
+func NewEvidence(first *BlockHeader, second *BlockHeader) *Evidence {
+	return &Evidence{first: *first, second: *second}
+}
+
+// Bytes - Encodes the evidence: the version byte and, for every header, its bytes and its seal.
+func (e *Evidence) Bytes() []byte {
+	enc := codec.NewEncoder()
+	enc.PutUint8(codec.CODEC_VERSION)
+	for _, h := range []*BlockHeader{&e.first, &e.second} {
+		enc.PutBytes(h.Bytes())
+		enc.PutBytes(h.seal)
+	}
+	return enc.Bytes()
+}
+
+// ParseEvidence - Decodes evidence encoded with Bytes.
+func ParseEvidence(data []byte) (*Evidence, error) {
+	d := codec.NewDecoder(data)
+	d.Version()
+	buf := [2][2][]byte{}
+	for i := range buf {
+		buf[i][0] = d.Bytes()
+		buf[i][1] = d.Bytes()
+	}
+	if err := d.Finish(); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidEvidence, err)
+	}
+
+	e := &Evidence{}
+	for i, h := range []*BlockHeader{&e.first, &e.second} {
+		if err := h.UnmarshalBinary(buf[i][0]); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidEvidence, err)
+		}
+		h.seal = buf[i][1]
+	}
+	return e, nil
+}
+
+// Number - Returns the number of the headers.
+func (e *Evidence) Number() int64 {
+	return e.first.number
+}
+
+// Extends - Returns true if one of the headers follows the block with the hash.
+func (e *Evidence) Extends(hash [32]byte) bool {
+	return e.first.previousHash == hash || e.second.previousHash == hash
+}
+
+// Offender - Verifies the evidence and returns the address that signed both headers.
+func (e *Evidence) Offender() (string, error) {
+	if e.first.number != e.second.number {
+		return "", fmt.Errorf("%w: the headers have the numbers %d and %d", ErrInvalidEvidence,
+			e.first.number, e.second.number)
+	}
+	if e.first.Hash() == e.second.Hash() {
+		return "", fmt.Errorf("%w: the headers are the same", ErrInvalidEvidence)
+	}
+	first, err := headerSigner(&e.first)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidEvidence, err)
+	}
+	second, err := headerSigner(&e.second)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidEvidence, err)
+	}
+	if first != second {
+		return "", fmt.Errorf("%w: the headers are signed by %s and %s", ErrInvalidEvidence, first, second)
+	}
+	return first, nil
+}
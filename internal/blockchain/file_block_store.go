@@ -0,0 +1,632 @@
+package blockchain
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+const (
+	// MAX_SEGMENT_SIZE - When the active segment grows over this size a new one is started.
+	MAX_SEGMENT_SIZE = 8 * 1024 * 1024
+
+	currentFileName   = "CURRENT"
+	indexFileName     = "index.dat"
+	segmentFilePrefix = "segment-"
+	generationPrefix  = "chain-"
+
+	// record header: payload length (4 bytes) + crc32 of the payload (4 bytes)
+	recordHeaderSize = 8
+	// index entry: number (8) + segment (4) + offset (8) + length (4) + hash (32)
+	indexEntrySize = 56
+)
+
+var ErrCorruptedStore = errors.New("corrupted block store")
+
+type indexEntry struct {
+	number  int64
+	segment uint32
+	offset  int64
+	length  uint32
+	hash    [32]byte
+}
+
+func (e *indexEntry) encode() []byte {
+	buf := make([]byte, indexEntrySize)
+	binary.BigEndian.PutUint64(buf[0:8], uint64(e.number))
+	binary.BigEndian.PutUint32(buf[8:12], e.segment)
+	binary.BigEndian.PutUint64(buf[12:20], uint64(e.offset))
+	binary.BigEndian.PutUint32(buf[20:24], e.length)
+	copy(buf[24:], e.hash[:])
+	return buf
+}
+
+func decodeIndexEntry(buf []byte) indexEntry {
+	e := indexEntry{
+		number:  int64(binary.BigEndian.Uint64(buf[0:8])),
+		segment: binary.BigEndian.Uint32(buf[8:12]),
+		offset:  int64(binary.BigEndian.Uint64(buf[12:20])),
+		length:  binary.BigEndian.Uint32(buf[20:24]),
+	}
+	copy(e.hash[:], buf[24:indexEntrySize])
+	return e
+}
+
+// fileBlockStore - BlockStore that keeps the blocks on disk.
+// Blocks are written to append-only segment files. Each record is prefixed by its length and checksum.
+// An index file maps every block number and hash to the position of the record in the segments.
+// The chain lives in a generation directory pointed by the CURRENT file, so the whole chain can be
+// replaced atomically writing a new generation and switching the pointer.
+type fileBlockStore struct {
+	dir         string
+	generation  string
+	index       *os.File
+	segment     *os.File
+	segmentID   uint32
+	segmentSize int64
+	entries     []indexEntry
+	byNumber    map[int64]int
+	byHash      map[[32]byte]int
+	tip         *Block
+	mux         sync.RWMutex
+}
+
+// NewFileBlockStore - Opens the block store kept in dir, creating it when it does not exist.
+// Records that were partially written (for instance, because the node crashed) are discarded.
+func NewFileBlockStore(dir string) (BlockStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	s := &fileBlockStore{dir: dir}
+	generation, err := s.readCurrent()
+	if err != nil {
+		return nil, err
+	}
+
+	if generation == "" {
+		generation = generationPrefix + "000001"
+		if err := os.MkdirAll(filepath.Join(dir, generation), 0o755); err != nil {
+			return nil, err
+		}
+		if err := s.writeCurrent(generation); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := s.open(generation); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *fileBlockStore) readCurrent() (string, error) {
+	data, err := os.ReadFile(filepath.Join(s.dir, currentFileName))
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// writeCurrent - Points the CURRENT file to the given generation.
+// The file is replaced with a rename, so readers see either the old or the new generation.
+func (s *fileBlockStore) writeCurrent(generation string) error {
+	tmp := filepath.Join(s.dir, currentFileName+".tmp")
+	if err := writeFileSync(tmp, []byte(generation+"\n")); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, filepath.Join(s.dir, currentFileName)); err != nil {
+		return err
+	}
+	return syncDir(s.dir)
+}
+
+// open - Loads the index of a generation and recovers the records that are not indexed yet.
+func (s *fileBlockStore) open(generation string) error {
+	s.generation = generation
+	s.entries = make([]indexEntry, 0)
+	s.byNumber = make(map[int64]int)
+	s.byHash = make(map[[32]byte]int)
+	s.tip = nil
+
+	genDir := filepath.Join(s.dir, generation)
+	index, err := os.OpenFile(filepath.Join(genDir, indexFileName), os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+	s.index = index
+
+	data, err := io.ReadAll(index)
+	if err != nil {
+		return err
+	}
+	for i := 0; i+indexEntrySize <= len(data); i += indexEntrySize {
+		e := decodeIndexEntry(data[i : i+indexEntrySize])
+		if !s.validEntry(e) {
+			log.Printf("Block store: index entry for block %d points to a missing record, dropping it", e.number)
+			break
+		}
+		s.addEntry(e)
+	}
+
+	// Drops any partial entry and the entries that were not valid.
+	if err := s.index.Truncate(int64(len(s.entries) * indexEntrySize)); err != nil {
+		return err
+	}
+	if _, err := s.index.Seek(0, io.SeekEnd); err != nil {
+		return err
+	}
+
+	if err := s.recover(); err != nil {
+		return err
+	}
+
+	if len(s.entries) > 0 {
+		tip, err := s.read(s.entries[len(s.entries)-1])
+		if err != nil {
+			return err
+		}
+		s.tip = tip
+	}
+	return nil
+}
+
+// validEntry - Checks the entry points to a record that exists in the segments.
+func (s *fileBlockStore) validEntry(e indexEntry) bool {
+	info, err := os.Stat(s.segmentPath(e.segment))
+	if err != nil {
+		return false
+	}
+	return e.offset+recordHeaderSize+int64(e.length) <= info.Size()
+}
+
+// recover - Scans the segments from the last indexed record and indexes the complete records found.
+// The first record that is truncated or does not match its checksum ends the chain. It and everything
+// after it is removed.
+func (s *fileBlockStore) recover() error {
+	segmentID := uint32(1)
+	offset := int64(0)
+	if len(s.entries) > 0 {
+		last := s.entries[len(s.entries)-1]
+		segmentID = last.segment
+		offset = last.offset + recordHeaderSize + int64(last.length)
+	}
+
+	for {
+		f, err := os.OpenFile(s.segmentPath(segmentID), os.O_RDWR|os.O_CREATE, 0o644)
+		if err != nil {
+			return err
+		}
+
+		for {
+			payload, err := readRecord(f, offset)
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				log.Printf("Block store: discarding incomplete record at segment %d offset %d", segmentID, offset)
+				if err := f.Truncate(offset); err != nil {
+					f.Close()
+					return err
+				}
+				if err := s.removeSegmentsAfter(segmentID); err != nil {
+					f.Close()
+					return err
+				}
+				break
+			}
+
+			var b Block
+			if err := json.Unmarshal(payload, &b); err != nil {
+				f.Close()
+				return fmt.Errorf("%w: %v", ErrCorruptedStore, err)
+			}
+			e := indexEntry{
+				number:  b.Number(),
+				segment: segmentID,
+				offset:  offset,
+				length:  uint32(len(payload)),
+				hash:    b.Hash(),
+			}
+			if err := s.writeEntry(e); err != nil {
+				f.Close()
+				return err
+			}
+			offset += recordHeaderSize + int64(len(payload))
+		}
+
+		if _, err := os.Stat(s.segmentPath(segmentID + 1)); err == nil {
+			f.Close()
+			segmentID++
+			offset = 0
+			continue
+		}
+
+		if _, err := f.Seek(0, io.SeekEnd); err != nil {
+			f.Close()
+			return err
+		}
+		s.segment = f
+		s.segmentID = segmentID
+		s.segmentSize = offset
+		return nil
+	}
+}
+
+func (s *fileBlockStore) removeSegmentsAfter(segmentID uint32) error {
+	for id := segmentID + 1; ; id++ {
+		err := os.Remove(s.segmentPath(id))
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (s *fileBlockStore) segmentPath(id uint32) string {
+	return filepath.Join(s.dir, s.generation, fmt.Sprintf("%s%06d.dat", segmentFilePrefix, id))
+}
+
+func (s *fileBlockStore) addEntry(e indexEntry) {
+	s.byNumber[e.number] = len(s.entries)
+	s.byHash[e.hash] = len(s.entries)
+	s.entries = append(s.entries, e)
+}
+
+// writeEntry - Appends the entry to the index file and syncs it.
+func (s *fileBlockStore) writeEntry(e indexEntry) error {
+	if _, err := s.index.Write(e.encode()); err != nil {
+		return err
+	}
+	if err := s.index.Sync(); err != nil {
+		return err
+	}
+	s.addEntry(e)
+	return nil
+}
+
+// Append - Writes the block to the active segment and then indexes it.
+// The record is synced before it is indexed, so a crash never leaves an index entry without its block.
+func (s *fileBlockStore) Append(block *Block) error {
+	payload, err := json.Marshal(block)
+	if err != nil {
+		return err
+	}
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if s.segmentSize > 0 && s.segmentSize+recordHeaderSize+int64(len(payload)) > MAX_SEGMENT_SIZE {
+		if err := s.rollSegment(); err != nil {
+			return err
+		}
+	}
+
+	offset := s.segmentSize
+	if _, err := s.segment.Write(encodeRecord(payload)); err != nil {
+		// Leaves the segment as it was before the write.
+		s.segment.Truncate(offset)
+		s.segment.Seek(offset, io.SeekStart)
+		return err
+	}
+	if err := s.segment.Sync(); err != nil {
+		return err
+	}
+	s.segmentSize += recordHeaderSize + int64(len(payload))
+
+	e := indexEntry{
+		number:  block.Number(),
+		segment: s.segmentID,
+		offset:  offset,
+		length:  uint32(len(payload)),
+		hash:    block.Hash(),
+	}
+	if err := s.writeEntry(e); err != nil {
+		return err
+	}
+	s.tip = block
+	return nil
+}
+
+func (s *fileBlockStore) rollSegment() error {
+	if err := s.segment.Close(); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(s.segmentPath(s.segmentID+1), os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	s.segment = f
+	s.segmentID++
+	s.segmentSize = 0
+	return nil
+}
+
+func (s *fileBlockStore) Get(number int64) (*Block, error) {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+	i, ok := s.byNumber[number]
+	if !ok {
+		return nil, ErrBlockNotFound
+	}
+	return s.read(s.entries[i])
+}
+
+func (s *fileBlockStore) GetByHash(hash [32]byte) (*Block, error) {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+	i, ok := s.byHash[hash]
+	if !ok {
+		return nil, ErrBlockNotFound
+	}
+	return s.read(s.entries[i])
+}
+
+func (s *fileBlockStore) Iterate(fn func(block *Block) bool) error {
+	s.mux.RLock()
+	entries := s.entries
+	s.mux.RUnlock()
+	for _, e := range entries {
+		s.mux.RLock()
+		b, err := s.read(e)
+		s.mux.RUnlock()
+		if err != nil {
+			return err
+		}
+		if !fn(b) {
+			break
+		}
+	}
+	return nil
+}
+
+func (s *fileBlockStore) Tip() *Block {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+	return s.tip
+}
+
+func (s *fileBlockStore) Len() int {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+	return len(s.entries)
+}
+
+// Truncate - Removes the blocks from number on, cutting the index and the segments at the first removed record.
+func (s *fileBlockStore) Truncate(number int64) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	cut := -1
+	for i, e := range s.entries {
+		if e.number >= number {
+			cut = i
+			break
+		}
+	}
+	if cut == -1 {
+		return nil
+	}
+
+	first := s.entries[cut]
+	if err := s.index.Truncate(int64(cut * indexEntrySize)); err != nil {
+		return err
+	}
+	if _, err := s.index.Seek(0, io.SeekEnd); err != nil {
+		return err
+	}
+	if err := s.index.Sync(); err != nil {
+		return err
+	}
+
+	if err := s.segment.Close(); err != nil {
+		return err
+	}
+	if err := s.removeSegmentsAfter(first.segment); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(s.segmentPath(first.segment), os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+	if err := f.Truncate(first.offset); err != nil {
+		f.Close()
+		return err
+	}
+	if _, err := f.Seek(0, io.SeekEnd); err != nil {
+		f.Close()
+		return err
+	}
+	s.segment = f
+	s.segmentID = first.segment
+	s.segmentSize = first.offset
+
+	for _, e := range s.entries[cut:] {
+		delete(s.byNumber, e.number)
+		delete(s.byHash, e.hash)
+	}
+	s.entries = s.entries[:cut:cut]
+
+	s.tip = nil
+	if cut > 0 {
+		tip, err := s.read(s.entries[cut-1])
+		if err != nil {
+			return err
+		}
+		s.tip = tip
+	}
+	return nil
+}
+
+// Replace - Writes the chain into a new generation and switches CURRENT to it.
+// If anything fails before the switch, the current chain is left untouched.
+func (s *fileBlockStore) Replace(chain []*Block) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	next := fmt.Sprintf("%s%06d", generationPrefix, s.generationNumber()+1)
+	nextDir := filepath.Join(s.dir, next)
+	if err := os.RemoveAll(nextDir); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(nextDir, 0o755); err != nil {
+		return err
+	}
+
+	tmp := &fileBlockStore{dir: s.dir}
+	if err := tmp.open(next); err != nil {
+		os.RemoveAll(nextDir)
+		return err
+	}
+	for _, b := range chain {
+		if err := tmp.Append(b); err != nil {
+			tmp.Close()
+			os.RemoveAll(nextDir)
+			return err
+		}
+	}
+
+	if err := s.writeCurrent(next); err != nil {
+		tmp.Close()
+		os.RemoveAll(nextDir)
+		return err
+	}
+
+	previous := s.generation
+	s.closeFiles()
+	s.generation = tmp.generation
+	s.index = tmp.index
+	s.segment = tmp.segment
+	s.segmentID = tmp.segmentID
+	s.segmentSize = tmp.segmentSize
+	s.entries = tmp.entries
+	s.byNumber = tmp.byNumber
+	s.byHash = tmp.byHash
+	s.tip = tmp.tip
+
+	if err := os.RemoveAll(filepath.Join(s.dir, previous)); err != nil {
+		log.Printf("Block store: could not remove old generation %s: %v", previous, err)
+	}
+	return nil
+}
+
+func (s *fileBlockStore) generationNumber() int {
+	var n int
+	fmt.Sscanf(strings.TrimPrefix(s.generation, generationPrefix), "%d", &n)
+	return n
+}
+
+func (s *fileBlockStore) Close() error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return s.closeFiles()
+}
+
+func (s *fileBlockStore) closeFiles() error {
+	var err error
+	if s.segment != nil {
+		err = s.segment.Close()
+	}
+	if s.index != nil {
+		if e := s.index.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// read - Reads and decodes the block pointed by the entry.
+func (s *fileBlockStore) read(e indexEntry) (*Block, error) {
+	f, err := os.Open(s.segmentPath(e.segment))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	payload, err := readRecord(f, e.offset)
+	if err != nil {
+		return nil, fmt.Errorf("%w: block %d: %v", ErrCorruptedStore, e.number, err)
+	}
+	b := new(Block)
+	if err := json.Unmarshal(payload, b); err != nil {
+		return nil, fmt.Errorf("%w: block %d: %v", ErrCorruptedStore, e.number, err)
+	}
+	return b, nil
+}
+
+func encodeRecord(payload []byte) []byte {
+	buf := make([]byte, recordHeaderSize+len(payload))
+	binary.BigEndian.PutUint32(buf[0:4], uint32(len(payload)))
+	binary.BigEndian.PutUint32(buf[4:8], crc32.ChecksumIEEE(payload))
+	copy(buf[recordHeaderSize:], payload)
+	return buf
+}
+
+// readRecord - Reads the record that starts at offset.
+// Returns io.EOF when there is no record at offset and an error when the record is incomplete or corrupted.
+func readRecord(f *os.File, offset int64) ([]byte, error) {
+	header := make([]byte, recordHeaderSize)
+	n, err := f.ReadAt(header, offset)
+	if n == 0 && err == io.EOF {
+		return nil, io.EOF
+	}
+	if n < recordHeaderSize {
+		return nil, io.ErrUnexpectedEOF
+	}
+
+	length := binary.BigEndian.Uint32(header[0:4])
+	checksum := binary.BigEndian.Uint32(header[4:8])
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if offset+recordHeaderSize+int64(length) > info.Size() {
+		return nil, io.ErrUnexpectedEOF
+	}
+	payload := make([]byte, length)
+	if _, err := f.ReadAt(payload, offset+recordHeaderSize); err != nil {
+		return nil, io.ErrUnexpectedEOF
+	}
+	if crc32.ChecksumIEEE(payload) != checksum {
+		return nil, ErrCorruptedStore
+	}
+	return payload, nil
+}
+
+func writeFileSync(name string, data []byte) error {
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
@@ -0,0 +1,133 @@
+package blockchain
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/martinsaporiti/blockchain-sample/internal/coin"
+)
+
+func newTestChain(length int) []*Block {
+	chain := make([]*Block, 0, length)
+	previousHash := (&Block{}).Hash()
+	for i := 1; i <= length; i++ {
+		tx := NewTransaction("15TZoyyxFmeTXJGjYwX1X3ARtXX94BbFrk", "1CHD4Jjqsak4RV5JHAdYZ9CKY1dQe4tkXW", coin.Amount(i), int64(1654369662+i),
+			[]*TxInput{NewCoinbaseInput(int64(i))}, []*TxOutput{NewTxOutput("1CHD4Jjqsak4RV5JHAdYZ9CKY1dQe4tkXW", coin.Amount(i))})
+		b := NewBlock(int64(i), i, previousHash, []*Transaction{tx})
+		chain = append(chain, b)
+		previousHash = b.Hash()
+	}
+	return chain
+}
+
+func TestFileBlockStore_Reopen(t *testing.T) {
+
+	tests := map[string]struct {
+		blocks  int
+		corrupt func(dir string)
+		want    int64
+	}{
+		"should resume from the stored tip": {
+			blocks: 5,
+			want:   5,
+		},
+		"should discard a partially written block": {
+			blocks: 5,
+			corrupt: func(dir string) {
+				segment := filepath.Join(dir, "chain-000001", "segment-000001.dat")
+				info, _ := os.Stat(segment)
+				os.Truncate(segment, info.Size()-3)
+			},
+			want: 4,
+		},
+		"should rebuild the index from the segments": {
+			blocks: 5,
+			corrupt: func(dir string) {
+				os.Remove(filepath.Join(dir, "chain-000001", "index.dat"))
+			},
+			want: 5,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			store, err := NewFileBlockStore(dir)
+			if err != nil {
+				t.Fatalf("NewFileBlockStore() error = %v", err)
+			}
+			chain := newTestChain(tc.blocks)
+			for _, b := range chain {
+				if err := store.Append(b); err != nil {
+					t.Fatalf("Append() error = %v", err)
+				}
+			}
+			store.Close()
+
+			if tc.corrupt != nil {
+				tc.corrupt(dir)
+			}
+
+			store, err = NewFileBlockStore(dir)
+			if err != nil {
+				t.Fatalf("NewFileBlockStore() error = %v", err)
+			}
+			defer store.Close()
+
+			if store.Tip().Number() != tc.want {
+				t.Errorf("Tip() = %v, want %v", store.Tip().Number(), tc.want)
+			}
+			if store.Tip().Hash() != chain[tc.want-1].Hash() {
+				t.Errorf("Tip() = %x, want %x", store.Tip().Hash(), chain[tc.want-1].Hash())
+			}
+
+			b, err := store.GetByHash(chain[1].Hash())
+			if err != nil || b.Number() != 2 {
+				t.Errorf("GetByHash() = %v, %v, want block 2", b, err)
+			}
+		})
+	}
+}
+
+func TestFileBlockStore_TruncateAndReplace(t *testing.T) {
+
+	dir := t.TempDir()
+	store, err := NewFileBlockStore(dir)
+	if err != nil {
+		t.Fatalf("NewFileBlockStore() error = %v", err)
+	}
+	defer store.Close()
+
+	chain := newTestChain(4)
+	for _, b := range chain {
+		store.Append(b)
+	}
+
+	if err := store.Truncate(3); err != nil {
+		t.Fatalf("Truncate() error = %v", err)
+	}
+	if store.Len() != 2 || store.Tip().Hash() != chain[1].Hash() {
+		t.Errorf("Truncate() left %d blocks, want 2", store.Len())
+	}
+	if _, err := store.Get(3); err != ErrBlockNotFound {
+		t.Errorf("Get() error = %v, want %v", err, ErrBlockNotFound)
+	}
+
+	newChain := newTestChain(6)
+	if err := store.Replace(newChain); err != nil {
+		t.Fatalf("Replace() error = %v", err)
+	}
+	store.Close()
+
+	store, err = NewFileBlockStore(dir)
+	if err != nil {
+		t.Fatalf("NewFileBlockStore() error = %v", err)
+	}
+	if store.Len() != 6 || store.Tip().Hash() != newChain[5].Hash() {
+		t.Errorf("Replace() stored %d blocks, want 6", store.Len())
+	}
+	if _, err := os.Stat(filepath.Join(dir, "chain-000001")); !os.IsNotExist(err) {
+		t.Errorf("Replace() should remove the previous generation")
+	}
+}
@@ -0,0 +1,126 @@
+package blockchain
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	// DEFAULT_MAX_REORG_DEPTH - How many blocks under the tip can still be replaced by another branch.
+	DEFAULT_MAX_REORG_DEPTH = 100
+)
+
+var (
+	ErrCheckpointMismatch = errors.New("block does not match the checkpoint")
+	ErrFinalizedBlock     = errors.New("branch forks the chain below the finalized block")
+	ErrInvalidCheckpoint  = errors.New("invalid checkpoint")
+)
+
+// FinalityRules - When the blocks of the main chain become final, no reorganization replaces them.
+// A block is final when it is MaxReorgDepth blocks under the tip, or when it is at or under a checkpoint.
+// The checkpoints are the hashes every chain must have at some numbers.
+type FinalityRules struct {
+	Checkpoints   map[int64][32]byte
+	MaxReorgDepth int64
+}
+
+// withDefaults - Returns the rules with the default depth when it is not set.
+func (r FinalityRules) withDefaults() FinalityRules {
+	if r.MaxReorgDepth == 0 {
+		r.MaxReorgDepth = DEFAULT_MAX_REORG_DEPTH
+	}
+	return r
+}
+
+// ParseCheckpoints - Parses checkpoints written as "number:hash", with the hash in hex.
+func ParseCheckpoints(values []string) (map[int64][32]byte, error) {
+	checkpoints := make(map[int64][32]byte, len(values))
+	for _, v := range values {
+		number, hash, ok := strings.Cut(v, ":")
+		if !ok {
+			return nil, fmt.Errorf("%w: %q, expected number:hash", ErrInvalidCheckpoint, v)
+		}
+		n, err := strconv.ParseInt(number, 10, 64)
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("%w: %q, the number must be positive", ErrInvalidCheckpoint, v)
+		}
+		h, err := ParseBlockHash(hash)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %q: %v", ErrInvalidCheckpoint, v, err)
+		}
+		checkpoints[n] = h
+	}
+	return checkpoints, nil
+}
+
+// SetFinalityRules - Changes when the blocks become final. The main chain must match the checkpoints.
+func (bc *Blockchain) SetFinalityRules(rules FinalityRules) error {
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+
+	rules = rules.withDefaults()
+	for number, hash := range rules.Checkpoints {
+		n := bc.tipNode().ancestor(number)
+		if n != nil && n.hash != hash {
+			return fmt.Errorf("%w: block %d is %x, the checkpoint is %x", ErrCheckpointMismatch, number,
+				n.hash, hash)
+		}
+	}
+	bc.finality = rules
+	return nil
+}
+
+// FinalizedNumber - Returns the number of the last final block of the main chain, 0 when no block is final.
+func (bc *Blockchain) FinalizedNumber() int64 {
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+	return bc.finalizedNumber()
+}
+
+func (bc *Blockchain) finalizedNumber() int64 {
+	tip := bc.store.Tip()
+	if tip == nil {
+		return 0
+	}
+	finalized := tip.Number() - bc.finality.MaxReorgDepth
+	for number := range bc.finality.Checkpoints {
+		if number <= tip.Number() && number > finalized {
+			finalized = number
+		}
+	}
+	if finalized < 0 {
+		return 0
+	}
+	return finalized
+}
+
+// pruneLedger - Makes the ledger forget how to roll back the final blocks, they never leave the main chain.
+func (bc *Blockchain) pruneLedger() {
+	bc.ledger.Prune(bc.finalizedNumber())
+}
+
+// verifyCheckpoint - Verifies the header has the hash of the checkpoint at its number, if there is one.
+func (bc *Blockchain) verifyCheckpoint(header *BlockHeader) error {
+	hash, ok := bc.finality.Checkpoints[header.number]
+	if ok && header.Hash() != hash {
+		return fmt.Errorf("%w: block %d is %x, the checkpoint is %x", ErrCheckpointMismatch, header.number,
+			header.Hash(), hash)
+	}
+	return nil
+}
+
+// verifyForkDepth - Verifies a branch that follows the node does not replace final blocks of the main
+// chain. A nil node is a branch with another genesis block, that replaces the whole chain.
+func (bc *Blockchain) verifyForkDepth(node *blockNode) error {
+	var forkNumber int64
+	if forkNode := fork(bc.tipNode(), node); forkNode != nil {
+		forkNumber = forkNode.header.number
+	}
+	if finalized := bc.finalizedNumber(); forkNumber < finalized {
+		return fmt.Errorf("%w: the branch forks at block %d, block %d is final", ErrFinalizedBlock,
+			forkNumber, finalized)
+	}
+	return nil
+}
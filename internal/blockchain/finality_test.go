@@ -0,0 +1,139 @@
+package blockchain
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestBlockchain_Finality(t *testing.T) {
+
+	tests := map[string]struct {
+		// rules - Returns the finality rules of the blockchain with the genesis block, fork and a3.
+		rules func(f *forkTest) FinalityRules
+		// block - Returns the block proposed after a3.
+		block         func(f *forkTest) *Block
+		wantFinalized int64
+		want          error
+	}{
+		"should accept a side branch above the finalized block": {
+			rules: func(f *forkTest) FinalityRules {
+				return FinalityRules{MaxReorgDepth: 1}
+			},
+			block: func(f *forkTest) *Block {
+				return f.mine(f.fork, 2)
+			},
+			wantFinalized: 2,
+		},
+		"should reject a branch that forks below the finalized block": {
+			rules: func(f *forkTest) FinalityRules {
+				return FinalityRules{MaxReorgDepth: 1}
+			},
+			block: func(f *forkTest) *Block {
+				return f.mine(f.blockchain.Chain()[0], 2)
+			},
+			wantFinalized: 2,
+			want:          ErrFinalizedBlock,
+		},
+		"should finalize the blocks up to a checkpoint": {
+			rules: func(f *forkTest) FinalityRules {
+				return FinalityRules{Checkpoints: map[int64][32]byte{3: f.a3.Hash()}}
+			},
+			block: func(f *forkTest) *Block {
+				return f.mine(f.fork, 2)
+			},
+			wantFinalized: 3,
+			want:          ErrFinalizedBlock,
+		},
+		"should not finalize any block while the chain is shorter than the depth": {
+			rules: func(f *forkTest) FinalityRules {
+				return FinalityRules{}
+			},
+			block: func(f *forkTest) *Block {
+				return f.mine(f.blockchain.Chain()[0], 2)
+			},
+		},
+		"should reject a block that does not match the checkpoint": {
+			rules: func(f *forkTest) FinalityRules {
+				return FinalityRules{Checkpoints: map[int64][32]byte{4: {1}}}
+			},
+			block: func(f *forkTest) *Block {
+				return f.mine(f.a3, 2)
+			},
+			want: ErrCheckpointMismatch,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			f := newForkTest(t)
+			if err := f.blockchain.SetFinalityRules(tc.rules(f)); err != nil {
+				t.Fatalf("SetFinalityRules() = %v", err)
+			}
+			if got := f.blockchain.FinalizedNumber(); got != tc.wantFinalized {
+				t.Errorf("FinalizedNumber() = %d, want %d", got, tc.wantFinalized)
+			}
+			err := f.blockchain.AddProposedBlockFromNetwork(tc.block(f))
+			if !errors.Is(err, tc.want) {
+				t.Errorf("AddProposedBlockFromNetwork() = %v, want %v", err, tc.want)
+			}
+		})
+	}
+}
+
+func TestBlockchain_SetFinalityRules(t *testing.T) {
+
+	f := newForkTest(t)
+	rules := FinalityRules{Checkpoints: map[int64][32]byte{3: f.fork.Hash()}}
+	if err := f.blockchain.SetFinalityRules(rules); !errors.Is(err, ErrCheckpointMismatch) {
+		t.Errorf("SetFinalityRules() = %v, want %v", err, ErrCheckpointMismatch)
+	}
+
+	chain := f.blockchain.Chain()
+	if err := f.blockchain.SetFinalityRules(FinalityRules{MaxReorgDepth: 1}); err != nil {
+		t.Fatalf("SetFinalityRules() = %v", err)
+	}
+	if _, err := f.blockchain.ValidateHeaders([]*BlockHeader{&f.mine(chain[0], 2).header}); !errors.Is(err,
+		ErrFinalizedBlock) {
+		t.Errorf("ValidateHeaders() = %v, want %v", err, ErrFinalizedBlock)
+	}
+}
+
+func TestParseCheckpoints(t *testing.T) {
+
+	hash := "00000a3f9c1e00000000000000000000000000000000000000000000000000ff"
+
+	tests := map[string]struct {
+		values []string
+		want   int
+		err    error
+	}{
+		"should parse the checkpoints": {
+			values: []string{"1:" + hash, "100:" + hash},
+			want:   2,
+		},
+		"should reject a checkpoint without hash": {
+			values: []string{"100"},
+			err:    ErrInvalidCheckpoint,
+		},
+		"should reject a checkpoint of the block 0": {
+			values: []string{"0:" + hash},
+			err:    ErrInvalidCheckpoint,
+		},
+		"should reject a checkpoint with an invalid hash": {
+			values: []string{"1:00ff"},
+			err:    ErrInvalidCheckpoint,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := ParseCheckpoints(tc.values)
+			if !errors.Is(err, tc.err) {
+				t.Fatalf("ParseCheckpoints() = %v, want %v", err, tc.err)
+			}
+			if len(got) != tc.want {
+				t.Errorf("ParseCheckpoints() = %d checkpoints, want %d", len(got), tc.want)
+			}
+		})
+	}
+}
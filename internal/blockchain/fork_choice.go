@@ -0,0 +1,246 @@
+package blockchain
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+var ErrOrphanBlock = errors.New("block parent is not known yet")
+
+// ReorgEvent - Describes a change of the main chain to another branch.
+type ReorgEvent struct {
+	// ForkPoint - Last block shared by the old and the new branch, nil if they do not share any.
+	ForkPoint *Block
+	// Disconnected - Blocks of the old branch that left the main chain, from the old tip down.
+	Disconnected []*Block
+	// Connected - Blocks of the new branch that joined the main chain, from the fork point up.
+	Connected []*Block
+}
+
+// OnReorg - Registers a function that is called every time the main chain moves to another branch.
+// The ledger is already on the new branch when the function is called.
+func (bc *Blockchain) OnReorg(fn func(*ReorgEvent)) {
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+	bc.reorgListeners = append(bc.reorgListeners, fn)
+}
+
+func (bc *Blockchain) emitReorg(event *ReorgEvent) {
+	log.Printf("Reorganization: %d blocks disconnected, %d blocks connected",
+		len(event.Disconnected), len(event.Connected))
+	bc.mux.Lock()
+	listeners := bc.reorgListeners
+	bc.mux.Unlock()
+	for _, fn := range listeners {
+		fn(event)
+	}
+}
+
+// AddProposedBlockFromNetwork - Adds a new block from the network to the tree of blocks.
+// The block must pass ValidateBlock against its parent, that can be any block we know. If the parent is
+// not known the block is kept as an orphan until it arrives, and ErrOrphanBlock is returned; only its seal
+// and its merkle root are verified until then.
+// The main chain is the branch with the most work: when the block (or the orphans it connects) makes
+// another branch heavier, the chain is reorganized to it, its transactions must be valid on top of the
+// ledger. On the same work the branch seen first is kept. A block that forks the main chain below the
+// finalized block is rejected, see FinalityRules.
+// Returns why the block was ignored, a *BlockValidationError when the block breaks a rule.
+func (bc *Blockchain) AddProposedBlockFromNetwork(proposedBlock *Block) error {
+	log.Printf("Adding new block from network: %d", proposedBlock.Number())
+	event, err := bc.processBlock(proposedBlock)
+	if err != nil {
+		log.Printf("Proposed block was ignored: %v", err)
+		return err
+	}
+	if event != nil {
+		bc.emitReorg(event)
+	}
+	log.Printf("Proposed Block was added: %d", proposedBlock.Number())
+	return nil
+}
+
+// processBlock - Adds the block and the orphans that wait for it to the tree, and moves the main chain
+// to the heaviest branch. Returns the reorg event when blocks left the main chain.
+func (bc *Blockchain) processBlock(block *Block) (*ReorgEvent, error) {
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+
+	hash := block.Hash()
+	if _, ok := bc.tree.get(hash); ok || bc.orphans.has(hash) {
+		return nil, &BlockValidationError{Number: block.Number(), Err: ErrKnownBlock}
+	}
+	parent, ok := bc.tree.get(block.PreviousHash())
+	if !ok {
+		// Without the parent only the seal and the body can be verified, enough to keep junk out of the pool.
+		if err := bc.engine.VerifySeal(&block.header, nil); err != nil {
+			return nil, &BlockValidationError{Number: block.Number(), Err: err}
+		}
+		if block.header.merkleRoot != computeMerkleRoot(block.transactions) {
+			return nil, &BlockValidationError{Number: block.Number(), Err: ErrInvalidMerkleRoot}
+		}
+		bc.orphans.add(block, time.Now())
+		return nil, fmt.Errorf("%w: block %d", ErrOrphanBlock, block.Number())
+	}
+	if err := bc.verifyForkDepth(parent); err != nil {
+		return nil, &BlockValidationError{Number: block.Number(), Err: err}
+	}
+	if err := bc.validateBlock(block, &parent.header, parent.headerAt); err != nil {
+		return nil, &BlockValidationError{Number: block.Number(), Err: err}
+	}
+
+	node := bc.tree.add(&block.header, parent)
+	node.block = block
+	best := node
+	for _, n := range bc.connectOrphans(node) {
+		if n.chainWork.Cmp(best.chainWork) > 0 {
+			best = n
+		}
+	}
+
+	if best.chainWork.Cmp(bc.tipNode().chainWork) <= 0 {
+		log.Printf("Block %d was added to a side branch", block.Number())
+		return nil, nil
+	}
+	return bc.reorganize(best)
+}
+
+// connectOrphans - Adds to the tree the orphans that descend from the node, validating each one
+// against its parent. The orphans that break a rule are discarded. Returns the nodes added.
+func (bc *Blockchain) connectOrphans(node *blockNode) []*blockNode {
+	added := make([]*blockNode, 0)
+	pending := []*blockNode{node}
+	for len(pending) > 0 {
+		parent := pending[0]
+		pending = pending[1:]
+		for _, orphan := range bc.orphans.take(parent.hash, time.Now()) {
+			if err := bc.validateBlock(orphan, &parent.header, parent.headerAt); err != nil {
+				log.Printf("Discarding orphan block %d: %v", orphan.Number(), err)
+				continue
+			}
+			n := bc.tree.add(&orphan.header, parent)
+			n.block = orphan
+			added = append(added, n)
+			pending = append(pending, n)
+		}
+	}
+	return added
+}
+
+// reorganize - Makes the branch that ends in the node the main chain. The blocks of the current chain
+// after the fork point are reverted and the blocks of the new branch are applied to the ledger.
+// If a block of the new branch can not be applied, the current chain is restored and the block and its
+// descendants are forgotten. If the store can not be moved to the new branch, the store and the ledger are
+// restored to the current chain. Returns the reorg event when blocks left the main chain.
+func (bc *Blockchain) reorganize(node *blockNode) (*ReorgEvent, error) {
+	tip := bc.tipNode()
+	forkNode := fork(tip, node)
+	if forkNode == nil {
+		return nil, &BlockValidationError{Number: node.header.number, Err: ErrUnknownParent}
+	}
+
+	disconnectedNodes := make([]*blockNode, 0)
+	disconnected := make([]*Block, 0)
+	for n := tip; n != forkNode; n = n.parent {
+		b, err := bc.store.GetByHash(n.hash)
+		if err != nil {
+			return nil, fmt.Errorf("reading block %d: %w", n.header.number, err)
+		}
+		disconnectedNodes = append(disconnectedNodes, n)
+		disconnected = append(disconnected, b)
+	}
+	connectedNodes := make([]*blockNode, 0)
+	for n := node; n != forkNode; n = n.parent {
+		connectedNodes = append([]*blockNode{n}, connectedNodes...)
+	}
+	connected := make([]*Block, len(connectedNodes))
+	for i, n := range connectedNodes {
+		connected[i] = n.block
+	}
+
+	for i, b := range disconnected {
+		if err := bc.ledger.RevertBlock(b); err != nil {
+			bc.reapply(disconnected[:i])
+			return nil, fmt.Errorf("reverting block %d: %w", b.Number(), err)
+		}
+	}
+	for i, b := range connected {
+		if err := bc.applyBlock(bc.ledger, b); err != nil {
+			bc.revert(connected[:i])
+			bc.reapply(disconnected)
+			bc.tree.remove(connectedNodes[i])
+			return nil, &BlockValidationError{Number: b.Number(), Err: err}
+		}
+	}
+
+	if err := bc.store.Truncate(forkNode.header.number + 1); err != nil {
+		bc.revert(connected)
+		bc.reapply(disconnected)
+		bc.restoreStore(forkNode.header.number, disconnected)
+		return nil, fmt.Errorf("removing the blocks after block %d: %w", forkNode.header.number, err)
+	}
+	for _, b := range connected {
+		if err := bc.store.Append(b); err != nil {
+			bc.revert(connected)
+			bc.reapply(disconnected)
+			bc.restoreStore(forkNode.header.number, disconnected)
+			return nil, fmt.Errorf("storing block %d: %w", b.Number(), err)
+		}
+	}
+
+	// The blocks that left the main chain keep their body in the tree, the new ones are in the store.
+	for i, n := range disconnectedNodes {
+		n.block = disconnected[i]
+		bc.txIndex.disconnect(disconnected[i])
+	}
+	for _, n := range connectedNodes {
+		n.block = nil
+	}
+	for _, b := range connected {
+		bc.txIndex.connect(b)
+	}
+	bc.pruneLedger()
+
+	if len(disconnected) == 0 {
+		return nil, nil
+	}
+	forkPoint, err := bc.store.GetByHash(forkNode.hash)
+	if err != nil {
+		return nil, fmt.Errorf("reading block %d: %w", forkNode.header.number, err)
+	}
+	return &ReorgEvent{ForkPoint: forkPoint, Disconnected: disconnected, Connected: connected}, nil
+}
+
+// restoreStore - Puts back in the store the blocks of the old branch, reverted from the tip down, after
+// the fork point, when the store could not be moved to the new branch.
+func (bc *Blockchain) restoreStore(forkNumber int64, disconnected []*Block) {
+	if err := bc.store.Truncate(forkNumber + 1); err != nil {
+		log.Printf("ERROR: removing the blocks after block %d: %v", forkNumber, err)
+		return
+	}
+	for i := len(disconnected) - 1; i >= 0; i-- {
+		if err := bc.store.Append(disconnected[i]); err != nil {
+			log.Printf("ERROR: storing block %d: %v", disconnected[i].Number(), err)
+			return
+		}
+	}
+}
+
+// revert - Reverts the blocks, applied in order, from the ledger.
+func (bc *Blockchain) revert(blocks []*Block) {
+	for i := len(blocks) - 1; i >= 0; i-- {
+		if err := bc.ledger.RevertBlock(blocks[i]); err != nil {
+			log.Printf("ERROR: reverting block %d: %v", blocks[i].Number(), err)
+		}
+	}
+}
+
+// reapply - Applies again the blocks, reverted from the tip down, to the ledger.
+func (bc *Blockchain) reapply(blocks []*Block) {
+	for i := len(blocks) - 1; i >= 0; i-- {
+		if err := bc.ledger.ApplyBlock(blocks[i]); err != nil {
+			log.Printf("ERROR: applying block %d: %v", blocks[i].Number(), err)
+		}
+	}
+}
@@ -0,0 +1,225 @@
+package blockchain
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/martinsaporiti/blockchain-sample/internal/coin"
+)
+
+// forkTest - A blockchain where the account owns 200 units in the block fork, and a block a3 on top of it
+// that pays them to the recipient.
+type forkTest struct {
+	blockchain *Blockchain
+	pool       *TransactionPool
+	events     []*ReorgEvent
+	recipient  *testAccount
+	fork       *Block
+	payment    *Transaction
+	a3         *Block
+}
+
+func newForkTest(t *testing.T) *forkTest {
+	account := newTestAccount()
+	f := &forkTest{recipient: newTestAccount()}
+	f.blockchain, _ = NewBlockchain("Node 500", "THE BLOCKCHAIN", newTestGenesis(), newTestProofOfWork(1), NewMemoryBlockStore(), LEDGER_MODE_UTXO)
+	f.pool = NewTransactionPool(make(chan bool, 1), f.blockchain.Ledger(), testChainID)
+	f.blockchain.OnReorg(func(event *ReorgEvent) {
+		f.events = append(f.events, event)
+		f.pool.UpdateFromReorg(event)
+	})
+
+	fundingID := fundTestAddress(f.blockchain, account.address, 200)
+	f.fork = f.blockchain.LastBlock()
+	f.payment = account.signed(NewTransaction(account.address, f.recipient.address, 200, 1654369662,
+		[]*TxInput{NewTxInput(fundingID, 0)},
+		[]*TxOutput{NewTxOutput(f.recipient.address, 200)}))
+	f.a3 = f.mine(f.fork, 1, f.payment)
+	if err := f.blockchain.AddProposedBlockFromNetwork(f.a3); err != nil {
+		t.Fatalf("AddProposedBlockFromNetwork() = %v", err)
+	}
+	return f
+}
+
+// mine - Returns a block on top of the parent with the transactions and a coinbase, the branch
+// makes the coinbases of blocks with the same number different.
+func (f *forkTest) mine(parent *Block, branch int64, transactions ...*Transaction) *Block {
+	number := parent.Number() + 1
+	coinbase := NewTransaction("Node 500", "THE BLOCKCHAIN", MINING_REWARD, 1654369662+branch,
+		[]*TxInput{NewCoinbaseInput(number)},
+		[]*TxOutput{NewTxOutput("THE BLOCKCHAIN", MINING_REWARD)})
+	return mineTestBlock(f.blockchain, parent, append(transactions, coinbase), parent.Timestamp()+branch)
+}
+
+func TestBlockchain_Reorganization(t *testing.T) {
+
+	tests := map[string]struct {
+		// blocks - Returns the blocks proposed after a3, and the block that must be the last one.
+		blocks func(f *forkTest) ([]*Block, *Block)
+		want   error
+		// wantBalance - Balance of the recipient of the payment of a3 after the blocks.
+		wantBalance coin.Amount
+	}{
+		"should keep the first branch when the other one has the same work": {
+			blocks: func(f *forkTest) ([]*Block, *Block) {
+				return []*Block{f.mine(f.fork, 2)}, f.a3
+			},
+			wantBalance: 200,
+		},
+		"should move to the branch with more work": {
+			blocks: func(f *forkTest) ([]*Block, *Block) {
+				b3 := f.mine(f.fork, 2)
+				b4 := f.mine(b3, 2)
+				return []*Block{b3, b4}, b4
+			},
+		},
+		"should connect the orphans when their parent arrives": {
+			blocks: func(f *forkTest) ([]*Block, *Block) {
+				b3 := f.mine(f.fork, 2)
+				b4 := f.mine(b3, 2)
+				if err := f.blockchain.AddProposedBlockFromNetwork(b4); !errors.Is(err, ErrOrphanBlock) {
+					t.Fatalf("AddProposedBlockFromNetwork() = %v, want %v", err, ErrOrphanBlock)
+				}
+				return []*Block{b3}, b4
+			},
+		},
+		"should keep the chain when the branch with more work is not valid on the ledger": {
+			blocks: func(f *forkTest) ([]*Block, *Block) {
+				// The output of the payment does not exist in the other branch.
+				spend := f.recipient.signed(NewTransaction(f.recipient.address, "1CHD4Jjqsak4RV5JHAdYZ9CKY1dQe4tkXW",
+					200, 1654369662,
+					[]*TxInput{NewTxInput(f.payment.Hash(), 0)},
+					[]*TxOutput{NewTxOutput("1CHD4Jjqsak4RV5JHAdYZ9CKY1dQe4tkXW", 200)}))
+				b3 := f.mine(f.fork, 2, spend)
+				b4 := f.mine(b3, 2)
+				return []*Block{b3, b4}, f.a3
+			},
+			want:        ErrMissingInput,
+			wantBalance: 200,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			f := newForkTest(t)
+			blocks, wantLast := tc.blocks(f)
+
+			var err error
+			for _, b := range blocks {
+				err = f.blockchain.AddProposedBlockFromNetwork(b)
+			}
+			if !errors.Is(err, tc.want) {
+				t.Errorf("AddProposedBlockFromNetwork() = %v, want %v", err, tc.want)
+			}
+			if got := f.blockchain.LastBlock(); got.Hash() != wantLast.Hash() {
+				t.Errorf("LastBlock() = block %d %x, want block %d %x", got.Number(), got.Hash(),
+					wantLast.Number(), wantLast.Hash())
+			}
+			if got := f.blockchain.Ledger().Balance(f.recipient.address); got != tc.wantBalance {
+				t.Errorf("Balance() = %v, want %v", got, tc.wantBalance)
+			}
+		})
+	}
+}
+
+func TestBlockchain_ReorganizationEvent(t *testing.T) {
+
+	f := newForkTest(t)
+	b3 := f.mine(f.fork, 2)
+	b4 := f.mine(b3, 2)
+	for _, b := range []*Block{b3, b4} {
+		if err := f.blockchain.AddProposedBlockFromNetwork(b); err != nil {
+			t.Fatalf("AddProposedBlockFromNetwork() = %v", err)
+		}
+	}
+
+	if len(f.events) != 1 {
+		t.Fatalf("len(events) = %d, want %d", len(f.events), 1)
+	}
+	event := f.events[0]
+	if event.ForkPoint.Hash() != f.fork.Hash() {
+		t.Errorf("ForkPoint = block %d, want block %d", event.ForkPoint.Number(), f.fork.Number())
+	}
+	if len(event.Disconnected) != 1 || event.Disconnected[0].Hash() != f.a3.Hash() {
+		t.Errorf("Disconnected = %v, want [a3]", event.Disconnected)
+	}
+	if len(event.Connected) != 2 || event.Connected[0].Hash() != b3.Hash() || event.Connected[1].Hash() != b4.Hash() {
+		t.Errorf("Connected = %v, want [b3 b4]", event.Connected)
+	}
+
+	if got := f.blockchain.Ledger().Balance(f.recipient.address); got != 0 {
+		t.Errorf("Balance() = %v, want %v", got, 0)
+	}
+	if txs := f.pool.Transactions(); len(txs) != 1 || txs[0].ID() != f.payment.ID() {
+		t.Errorf("Transactions() = %v, want the payment of the disconnected block", txs)
+	}
+
+	// The disconnected block is kept in a side branch and the chain can go back to it.
+	a4 := f.mine(f.a3, 1)
+	a5 := f.mine(a4, 1)
+	for _, b := range []*Block{a4, a5} {
+		if err := f.blockchain.AddProposedBlockFromNetwork(b); err != nil {
+			t.Fatalf("AddProposedBlockFromNetwork() = %v", err)
+		}
+	}
+	if got := f.blockchain.LastBlock(); got.Hash() != a5.Hash() {
+		t.Errorf("LastBlock() = block %d, want block %d", got.Number(), a5.Number())
+	}
+	if got := f.pool.Length(); got != 0 {
+		t.Errorf("Length() = %d, want %d after the payment is mined again", got, 0)
+	}
+}
+
+// failingBlockStore - Block store that fails to append the block with the hash fail.
+type failingBlockStore struct {
+	BlockStore
+	fail [32]byte
+}
+
+func (s *failingBlockStore) Append(block *Block) error {
+	if block.Hash() == s.fail {
+		return errors.New("disk full")
+	}
+	return s.BlockStore.Append(block)
+}
+
+func TestBlockchain_ReorganizationStoreFailure(t *testing.T) {
+
+	f := newForkTest(t)
+	store := &failingBlockStore{BlockStore: f.blockchain.store}
+	f.blockchain.store = store
+
+	b3 := f.mine(f.fork, 2)
+	if err := f.blockchain.AddProposedBlockFromNetwork(b3); err != nil {
+		t.Fatalf("AddProposedBlockFromNetwork() = %v", err)
+	}
+	store.fail = b3.Hash()
+	b4 := f.mine(b3, 2)
+	if err := f.blockchain.AddProposedBlockFromNetwork(b4); err == nil {
+		t.Fatalf("AddProposedBlockFromNetwork() = nil, want the error of the store")
+	}
+
+	// The store and the ledger stay on the old branch.
+	if got := f.blockchain.LastBlock(); got.Hash() != f.a3.Hash() {
+		t.Errorf("LastBlock() = block %d, want block %d", got.Number(), f.a3.Number())
+	}
+	if got := f.blockchain.Ledger().Balance(f.recipient.address); got != 200 {
+		t.Errorf("Balance() = %v, want %v", got, 200)
+	}
+	if _, err := f.blockchain.TransactionLocation(f.payment.ID()); err != nil {
+		t.Errorf("TransactionLocation() = %v, the payment should stay mined", err)
+	}
+
+	// The new branch is kept in the tree, the next block moves the chain to it.
+	store.fail = [32]byte{}
+	b5 := f.mine(b4, 2)
+	if err := f.blockchain.AddProposedBlockFromNetwork(b5); err != nil {
+		t.Fatalf("AddProposedBlockFromNetwork() = %v", err)
+	}
+	if got := f.blockchain.LastBlock(); got.Hash() != b5.Hash() {
+		t.Errorf("LastBlock() = block %d, want block %d", got.Number(), b5.Number())
+	}
+	if got := f.blockchain.Ledger().Balance(f.recipient.address); got != 0 {
+		t.Errorf("Balance() = %v, want %v", got, 0)
+	}
+}
@@ -0,0 +1,160 @@
+package blockchain
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/martinsaporiti/blockchain-sample/internal/codec"
+	"github.com/martinsaporiti/blockchain-sample/internal/coin"
+)
+
+const (
+	// DEFAULT_CHAIN_ID - Chain ID of the genesis of the nodes started without a genesis file.
+	DEFAULT_CHAIN_ID = "gochain"
+	// DEFAULT_GENESIS_TIMESTAMP - Time, in unix seconds, of the genesis of the nodes started without a
+	// genesis file.
+	DEFAULT_GENESIS_TIMESTAMP = 1654369000
+	// GENESIS_SENDER - Sender of the transactions of the genesis block that pay the allocations.
+	GENESIS_SENDER = "GENESIS"
+)
+
+var (
+	ErrInvalidGenesis  = errors.New("invalid genesis")
+	ErrGenesisMismatch = errors.New("chain has another genesis block")
+)
+
+// Genesis - Settings every node of a network shares: they decide the genesis block, so nodes with the
+// same settings have the same genesis block and nodes with other settings can not exchange blocks.
+type Genesis struct {
+	// ChainID - Name of the network.
+	ChainID string `json:"chain_id"`
+	// Timestamp - Time of the genesis block, in unix seconds.
+	Timestamp int64 `json:"timestamp"`
+	// Difficulty - Leading zero hex digits of the genesis block, for proof of work.
+	Difficulty int              `json:"difficulty"`
+	Consensus  GenesisConsensus `json:"consensus"`
+	// Alloc - Coins every address owns in the genesis block.
+	Alloc map[string]coin.Amount `json:"alloc,omitempty"`
+}
+
+// GenesisConsensus - Settings of the consensus engine.
+type GenesisConsensus struct {
+	Engine ConsensusMode `json:"engine"`
+	// Signers - Signers of proof of authority, or bootstrap signers of proof of stake.
+	Signers []string `json:"signers,omitempty"`
+	// BlockInterval - Expected time between blocks of proof of work, like "10s". Empty is the default.
+	BlockInterval string `json:"block_interval,omitempty"`
+	// RetargetWindow - Blocks between two adjustments of the difficulty. 0 is the default.
+	RetargetWindow int64 `json:"retarget_window,omitempty"`
+}
+
+// LoadGenesis - Reads and validates the genesis from a JSON file.
+func LoadGenesis(path string) (*Genesis, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading the genesis: %w", err)
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	g := new(Genesis)
+	if err := dec.Decode(g); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidGenesis, err)
+	}
+	if g.Consensus.Engine == "" {
+		g.Consensus.Engine = CONSENSUS_POW
+	}
+	if err := g.Validate(); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+// Validate - Verifies the settings of the genesis.
+func (g *Genesis) Validate() error {
+	if g.ChainID == "" {
+		return fmt.Errorf("%w: the chain ID is empty", ErrInvalidGenesis)
+	}
+	if g.Timestamp <= 0 {
+		return fmt.Errorf("%w: the timestamp must be positive", ErrInvalidGenesis)
+	}
+	switch g.Consensus.Engine {
+	case CONSENSUS_POW:
+		if _, err := DifficultyToBits(g.Difficulty); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidGenesis, err)
+		}
+	case CONSENSUS_POA, CONSENSUS_POS:
+	default:
+		return fmt.Errorf("%w: unknown consensus engine %q", ErrInvalidGenesis, g.Consensus.Engine)
+	}
+	if _, err := g.Consensus.DifficultyRules(); err != nil {
+		return err
+	}
+	for address, amount := range g.Alloc {
+		if address == "" || amount <= 0 {
+			return fmt.Errorf("%w: allocation of %s to %q", ErrInvalidGenesis, amount, address)
+		}
+	}
+	return nil
+}
+
+// DifficultyRules - Returns the rules that adjust the difficulty of proof of work.
+func (c GenesisConsensus) DifficultyRules() (DifficultyRules, error) {
+	rules := DifficultyRules{Window: c.RetargetWindow}
+	if c.BlockInterval != "" {
+		interval, err := time.ParseDuration(c.BlockInterval)
+		if err != nil || interval <= 0 {
+			return rules, fmt.Errorf("%w: block interval %q", ErrInvalidGenesis, c.BlockInterval)
+		}
+		rules.TargetInterval = interval
+	}
+	return rules, nil
+}
+
+// settingsHash - Returns the hash of the settings of the genesis that are not in the genesis block. It is
+// the previous hash of the genesis block, so the hash of the block depends on all the settings.
+// The difficulty rules are hashed with their defaults applied, so "10s" and "10000ms" are the same
+// settings.
+func (g *Genesis) settingsHash() [32]byte {
+	rules, _ := g.Consensus.DifficultyRules()
+	rules = rules.withDefaults()
+	enc := codec.NewEncoder()
+	enc.PutUint8(codec.CODEC_VERSION)
+	enc.PutString(g.ChainID)
+	enc.PutInt64(int64(g.Difficulty))
+	enc.PutString(string(g.Consensus.Engine))
+	enc.PutUint32(uint32(len(g.Consensus.Signers)))
+	for _, s := range g.Consensus.Signers {
+		enc.PutString(s)
+	}
+	enc.PutInt64(int64(rules.TargetInterval))
+	enc.PutInt64(rules.Window)
+	return sha256.Sum256(enc.Bytes())
+}
+
+// Block - Returns the genesis block, with the bits of the consensus engine. It has one coinbase per
+// allocation, in the order of the addresses, and nothing in it depends on the node that creates it.
+func (g *Genesis) Block(bits uint32) *Block {
+	addresses := make([]string, 0, len(g.Alloc))
+	for address := range g.Alloc {
+		addresses = append(addresses, address)
+	}
+	sort.Strings(addresses)
+
+	transactions := make([]*Transaction, len(addresses))
+	for i, address := range addresses {
+		amount := g.Alloc[address]
+		transactions[i] = NewTransaction(GENESIS_SENDER, address, amount, g.Timestamp,
+			[]*TxInput{NewCoinbaseInput(1)}, []*TxOutput{NewTxOutput(address, amount)})
+	}
+
+	b := NewBlock(1, 0, g.settingsHash(), transactions)
+	b.header.timestamp = time.Unix(g.Timestamp, 0).UnixNano()
+	b.header.bits = bits
+	return b
+}
@@ -0,0 +1,156 @@
+package blockchain
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/martinsaporiti/blockchain-sample/internal/coin"
+)
+
+// testChainID - Chain ID of the test network, the test accounts sign their transactions for it.
+const testChainID = "test"
+
+// newTestGenesis - Returns the genesis of a proof of work test network without allocations.
+func newTestGenesis() *Genesis {
+	return &Genesis{
+		ChainID:    testChainID,
+		Timestamp:  DEFAULT_GENESIS_TIMESTAMP,
+		Difficulty: 1,
+		Consensus:  GenesisConsensus{Engine: CONSENSUS_POW},
+	}
+}
+
+func TestGenesis_Block(t *testing.T) {
+
+	alloc := map[string]coin.Amount{"1A": coin.Coins(10), "1B": coin.Coins(5)}
+
+	tests := map[string]struct {
+		// change - Changes the settings of the second genesis.
+		change   func(g *Genesis)
+		wantSame bool
+	}{
+		"should create the same genesis block with the same settings": {
+			change:   func(g *Genesis) {},
+			wantSame: true,
+		},
+		"should create another genesis block with another chain ID": {
+			change: func(g *Genesis) {
+				g.ChainID = "other"
+			},
+		},
+		"should create another genesis block with other signers": {
+			change: func(g *Genesis) {
+				g.Consensus.Signers = []string{"1C"}
+			},
+		},
+		"should create the same genesis block with the block interval written another way": {
+			change: func(g *Genesis) {
+				g.Consensus.BlockInterval = "10000ms"
+			},
+			wantSame: true,
+		},
+		"should create another genesis block with another block interval": {
+			change: func(g *Genesis) {
+				g.Consensus.BlockInterval = "20s"
+			},
+		},
+		"should create another genesis block with other allocations": {
+			change: func(g *Genesis) {
+				g.Alloc = map[string]coin.Amount{"1A": coin.Coins(10)}
+			},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			first, second := newTestGenesis(), newTestGenesis()
+			first.Alloc, second.Alloc = alloc, alloc
+			tc.change(second)
+
+			a, b := first.Block(POA_BITS), second.Block(POA_BITS)
+			if got := a.Hash() == b.Hash(); got != tc.wantSame {
+				t.Errorf("Block() hashes %x and %x, want the same %t", a.Hash(), b.Hash(), tc.wantSame)
+			}
+		})
+	}
+}
+
+func TestBlockchain_Genesis(t *testing.T) {
+
+	genesis := newTestGenesis()
+	genesis.Alloc = map[string]coin.Amount{"1A": coin.Coins(10), "1B": coin.Coins(5)}
+	store := NewMemoryBlockStore()
+	blockchain, err := NewBlockchain("Node 500", "THE BLOCKCHAIN", genesis, newTestProofOfWork(1), store,
+		LEDGER_MODE_ACCOUNT)
+	if err != nil {
+		t.Fatalf("NewBlockchain() = %v", err)
+	}
+	if got := blockchain.LastBlock().Hash(); got != blockchain.GenesisHash() {
+		t.Errorf("LastBlock() = %x, want the genesis block %x", got, blockchain.GenesisHash())
+	}
+	for address, want := range genesis.Alloc {
+		if got := blockchain.CalculateTotalAmount(address); got != want {
+			t.Errorf("CalculateTotalAmount(%s) = %v, want %v", address, got, want)
+		}
+	}
+
+	other := newTestGenesis()
+	other.ChainID = "other"
+	if _, err := NewBlockchain("Node 500", "THE BLOCKCHAIN", other, newTestProofOfWork(1), store,
+		LEDGER_MODE_ACCOUNT); !errors.Is(err, ErrGenesisMismatch) {
+		t.Errorf("NewBlockchain() with another genesis = %v, want %v", err, ErrGenesisMismatch)
+	}
+}
+
+func TestLoadGenesis(t *testing.T) {
+
+	tests := map[string]struct {
+		json string
+		want error
+	}{
+		"should load a genesis": {
+			json: `{"chain_id": "gochain-dev", "timestamp": 1654369000, "difficulty": 4,
+				"consensus": {"engine": "pow", "block_interval": "10s", "retarget_window": 10},
+				"alloc": {"1A": "100"}}`,
+		},
+		"should load a proof of authority genesis without difficulty": {
+			json: `{"chain_id": "gochain-dev", "timestamp": 1654369000,
+				"consensus": {"engine": "poa", "signers": ["1A", "1B"]}}`,
+		},
+		"should reject a genesis without chain ID": {
+			json: `{"timestamp": 1654369000, "difficulty": 4}`,
+			want: ErrInvalidGenesis,
+		},
+		"should reject a genesis with an unknown field": {
+			json: `{"chain_id": "gochain-dev", "timestamp": 1654369000, "difficulty": 4, "gas_limit": 1}`,
+			want: ErrInvalidGenesis,
+		},
+		"should reject a genesis with an invalid difficulty": {
+			json: `{"chain_id": "gochain-dev", "timestamp": 1654369000, "difficulty": 0}`,
+			want: ErrInvalidGenesis,
+		},
+		"should reject a genesis with an invalid block interval": {
+			json: `{"chain_id": "gochain-dev", "timestamp": 1654369000, "difficulty": 4,
+				"consensus": {"block_interval": "often"}}`,
+			want: ErrInvalidGenesis,
+		},
+		"should reject an allocation without coins": {
+			json: `{"chain_id": "gochain-dev", "timestamp": 1654369000, "difficulty": 4, "alloc": {"1A": "0"}}`,
+			want: ErrInvalidGenesis,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "genesis.json")
+			if err := os.WriteFile(path, []byte(tc.json), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := LoadGenesis(path); !errors.Is(err, tc.want) {
+				t.Errorf("LoadGenesis() = %v, want %v", err, tc.want)
+			}
+		})
+	}
+}
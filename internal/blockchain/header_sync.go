@@ -0,0 +1,120 @@
+package blockchain
+
+import (
+	"errors"
+	"math/big"
+)
+
+const (
+	// MAX_HEADERS_PER_REQUEST - How many headers a node sends in one answer to a locator.
+	MAX_HEADERS_PER_REQUEST = 500
+	// LOCATOR_DENSE_HASHES - How many blocks from the tip the locator lists one by one, before the
+	// distance between two blocks starts to double.
+	LOCATOR_DENSE_HASHES = 10
+)
+
+var ErrNoHeaders = errors.New("there are no headers to validate")
+
+// Locator - Returns the hashes that describe our main chain to a peer: the last blocks one by one from
+// the tip, then blocks further apart each time, and always the genesis block.
+// The peer answers with the headers that follow the first hash it has in its main chain (HeadersAfter).
+func (bc *Blockchain) Locator() [][32]byte {
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+	return locator(bc.tipNode())
+}
+
+func locator(tip *blockNode) [][32]byte {
+	hashes := make([][32]byte, 0)
+	step := int64(1)
+	for n := tip; n != nil; {
+		hashes = append(hashes, n.hash)
+		if n.parent == nil {
+			break
+		}
+		if len(hashes) >= LOCATOR_DENSE_HASHES {
+			step *= 2
+		}
+		number := n.header.number - step
+		if number < 1 {
+			number = 1
+		}
+		n = n.ancestor(number)
+	}
+	return hashes
+}
+
+// HeadersAfter - Returns up to max headers of our main chain that follow the first block of the locator
+// in our main chain. When none of them is in our main chain, the headers start at the genesis block.
+func (bc *Blockchain) HeadersAfter(locator [][32]byte, max int) []*BlockHeader {
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+
+	headers := make([]*BlockHeader, 0)
+	tip := bc.tipNode()
+	if tip == nil || max <= 0 {
+		return headers
+	}
+	start := int64(1)
+	for _, hash := range locator {
+		if n, ok := bc.tree.get(hash); ok && tip.ancestor(n.header.number) == n {
+			start = n.header.number + 1
+			break
+		}
+	}
+	end := start + int64(max) - 1
+	if end > tip.header.number {
+		end = tip.header.number
+	}
+
+	for n := tip.ancestor(end); n != nil && n.header.number >= start; n = n.parent {
+		header := n.header
+		headers = append(headers, &header)
+	}
+	for i, j := 0, len(headers)-1; i < j; i, j = i+1, j-1 {
+		headers[i], headers[j] = headers[j], headers[i]
+	}
+	return headers
+}
+
+// ValidateHeaders - Verifies the headers, in order, form a branch that follows a block we know, with the
+// header rules of ValidateBlock, and do not replace final blocks. Headers that start with another genesis
+// block are of another network and they are rejected.
+// Returns the chainwork of the branch up to the last header.
+func (bc *Blockchain) ValidateHeaders(headers []*BlockHeader) (*big.Int, error) {
+	if len(headers) == 0 {
+		return nil, ErrNoHeaders
+	}
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+
+	first := headers[0]
+	parentNode, known := bc.tree.get(first.previousHash)
+	if !known && first.number == 1 {
+		// Our genesis block is in the tree, the headers are of another network.
+		return nil, &BlockValidationError{Number: first.number, Err: ErrGenesisMismatch}
+	}
+	if !known {
+		return nil, &BlockValidationError{Number: first.number, Err: ErrUnknownParent}
+	}
+	if err := bc.verifyForkDepth(parentNode); err != nil {
+		return nil, &BlockValidationError{Number: first.number, Err: err}
+	}
+
+	work := new(big.Int).Set(parentNode.chainWork)
+	parent := &parentNode.header
+	headerAt := func(number int64) (*BlockHeader, error) {
+		if i := number - first.number; i >= 0 && i < int64(len(headers)) {
+			return headers[i], nil
+		}
+		return parentNode.headerAt(number)
+	}
+	for _, header := range headers {
+		if err := bc.validateHeader(header, parent, headerAt); err != nil {
+			return nil, &BlockValidationError{Number: header.number, Err: err}
+		}
+		work.Add(work, header.Work())
+		parent = header
+	}
+	return work, nil
+}
@@ -0,0 +1,144 @@
+package blockchain
+
+import (
+	"errors"
+	"testing"
+)
+
+// newTestTreeBlockchain - Returns a blockchain with the chain in its store and its tree.
+func newTestTreeBlockchain(chain []*Block) *Blockchain {
+	store := NewMemoryBlockStore()
+	for _, b := range chain {
+		store.Append(b)
+	}
+	return &Blockchain{store: store, tree: newBlockTreeFromChain(chain)}
+}
+
+func TestBlockchain_Locator(t *testing.T) {
+
+	chain := newTestChain(30)
+	blockchain := newTestTreeBlockchain(chain)
+
+	want := []int64{30, 29, 28, 27, 26, 25, 24, 23, 22, 21, 19, 15, 7, 1}
+	got := blockchain.Locator()
+	if len(got) != len(want) {
+		t.Fatalf("len(Locator()) = %d, want %d", len(got), len(want))
+	}
+	for i, number := range want {
+		if got[i] != chain[number-1].Hash() {
+			t.Errorf("Locator()[%d] is not the hash of block %d", i, number)
+		}
+	}
+}
+
+func TestBlockchain_HeadersAfter(t *testing.T) {
+
+	chain := newTestChain(10)
+	blockchain := newTestTreeBlockchain(chain)
+	// side - A block of a side branch after block 3.
+	side := NewBlock(4, 100, chain[2].Hash(), nil)
+	parent, _ := blockchain.tree.get(chain[2].Hash())
+	blockchain.tree.add(&side.header, parent)
+
+	tests := map[string]struct {
+		locator [][32]byte
+		max     int
+		// want - Numbers of the first and the last header.
+		want [2]int64
+	}{
+		"should return the headers after the first block of the locator in the main chain": {
+			locator: [][32]byte{{1}, chain[6].Hash(), chain[2].Hash()},
+			max:     MAX_HEADERS_PER_REQUEST,
+			want:    [2]int64{8, 10},
+		},
+		"should return the headers from the genesis block when the locator is not known": {
+			locator: [][32]byte{{1}},
+			max:     MAX_HEADERS_PER_REQUEST,
+			want:    [2]int64{1, 10},
+		},
+		"should skip the blocks of the locator that are in a side branch": {
+			locator: [][32]byte{side.Hash(), chain[1].Hash()},
+			max:     MAX_HEADERS_PER_REQUEST,
+			want:    [2]int64{3, 10},
+		},
+		"should return at most max headers": {
+			locator: [][32]byte{chain[1].Hash()},
+			max:     4,
+			want:    [2]int64{3, 6},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			headers := blockchain.HeadersAfter(tc.locator, tc.max)
+			if got := int64(len(headers)); got != tc.want[1]-tc.want[0]+1 {
+				t.Fatalf("len(HeadersAfter()) = %d, want %d", got, tc.want[1]-tc.want[0]+1)
+			}
+			for i, h := range headers {
+				if want := chain[tc.want[0]-1+int64(i)]; h.Hash() != want.Hash() {
+					t.Errorf("HeadersAfter()[%d] = block %d, want block %d", i, h.Number(), want.Number())
+				}
+			}
+		})
+	}
+}
+
+func TestBlockchain_ValidateHeaders(t *testing.T) {
+
+	blockchain, _ := NewBlockchain("Node 500", "THE BLOCKCHAIN", newTestGenesis(), newTestProofOfWork(1), NewMemoryBlockStore(), LEDGER_MODE_UTXO)
+	genesis := blockchain.LastBlock()
+	b2 := mineTestBlock(blockchain, genesis, nil, genesis.Timestamp()+1)
+	b3 := mineTestBlock(blockchain, b2, nil, b2.Timestamp()+1)
+
+	otherChain := newTestGenesis()
+	otherChain.ChainID = "other"
+	other, _ := NewBlockchain("Node 501", "THE BLOCKCHAIN", otherChain, newTestProofOfWork(1), NewMemoryBlockStore(), LEDGER_MODE_UTXO)
+	otherGenesis := other.LastBlock()
+	otherB2 := mineTestBlock(other, otherGenesis, nil, otherGenesis.Timestamp()+1)
+
+	harder := *b3.Header()
+	harder.bits = 0x1f010000
+
+	tests := map[string]struct {
+		headers  []*BlockHeader
+		want     error
+		wantWork int64
+	}{
+		"should return the chainwork of a branch that follows a known block": {
+			headers:  []*BlockHeader{b2.Header(), b3.Header()},
+			wantWork: 45,
+		},
+		"should not accept a chain that starts with another genesis block": {
+			headers: []*BlockHeader{otherGenesis.Header(), otherB2.Header()},
+			want:    ErrGenesisMismatch,
+		},
+		"should not accept headers that do not follow a known block": {
+			headers: []*BlockHeader{b3.Header()},
+			want:    ErrUnknownParent,
+		},
+		"should not accept headers that are not in order": {
+			headers: []*BlockHeader{b2.Header(), b2.Header()},
+			want:    ErrUnknownParent,
+		},
+		"should not accept a header without the difficulty of the chain": {
+			headers: []*BlockHeader{b2.Header(), &harder},
+			want:    ErrInvalidDifficulty,
+		},
+		"should not accept no headers": {
+			headers: []*BlockHeader{},
+			want:    ErrNoHeaders,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			work, err := blockchain.ValidateHeaders(tc.headers)
+			if !errors.Is(err, tc.want) {
+				t.Fatalf("ValidateHeaders() = %v, want %v", err, tc.want)
+			}
+			if err == nil && work.Int64() != tc.wantWork {
+				t.Errorf("ValidateHeaders() = %s, want %d", work, tc.wantWork)
+			}
+		})
+	}
+}
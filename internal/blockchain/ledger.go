@@ -0,0 +1,54 @@
+package blockchain
+
+import (
+	"fmt"
+
+	"github.com/martinsaporiti/blockchain-sample/internal/coin"
+)
+
+type LedgerMode string
+
+const (
+	// LEDGER_MODE_UTXO - Transactions spend outputs of previous transactions.
+	LEDGER_MODE_UTXO LedgerMode = "utxo"
+	// LEDGER_MODE_ACCOUNT - Transactions move value between accounts, ordered by a per-sender nonce.
+	LEDGER_MODE_ACCOUNT LedgerMode = "account"
+)
+
+// Ledger - State derived from the chain that decides which transactions are valid.
+// It is advanced block by block and can roll back the last blocks applied.
+type Ledger interface {
+	// NewView - Returns a scratch copy of the ledger. Transactions applied to the view do not modify the ledger.
+	NewView() LedgerView
+	// ApplyBlock - Applies every transaction of the block. If one of them is not valid the ledger is not modified.
+	ApplyBlock(b *Block) error
+	// RevertBlock - Rolls back the last block applied.
+	RevertBlock(b *Block) error
+	// Balance - Returns the coins owned by a blockchain address.
+	Balance(blockchainAddress string) coin.Amount
+	// Nonce - Returns the nonce the next transaction of the address must use.
+	// Ledgers that do not order transactions by nonce always return 0.
+	Nonce(blockchainAddress string) uint64
+	// Prune - Forgets how to roll back the blocks up to the number, they are final and never reverted.
+	Prune(number int64)
+}
+
+// LedgerView - Scratch copy of a ledger.
+type LedgerView interface {
+	// ApplyTransaction - Applies the transaction to the view or returns why it is not valid.
+	ApplyTransaction(t *Transaction) error
+	// Balance - Returns the coins owned by a blockchain address after the transactions applied to the view.
+	Balance(blockchainAddress string) coin.Amount
+}
+
+// NewLedger - Returns an empty ledger for the mode.
+func NewLedger(mode LedgerMode) (Ledger, error) {
+	switch mode {
+	case LEDGER_MODE_UTXO:
+		return NewUTXOSet(), nil
+	case LEDGER_MODE_ACCOUNT:
+		return NewState(), nil
+	default:
+		return nil, fmt.Errorf("unknown ledger mode: %s", mode)
+	}
+}
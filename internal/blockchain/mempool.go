@@ -0,0 +1,259 @@
+package blockchain
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/martinsaporiti/blockchain-sample/internal/coin"
+)
+
+const (
+	DEFAULT_MEMPOOL_MAX_TRANSACTIONS = 5000
+	DEFAULT_MEMPOOL_MAX_SIZE         = 5 << 20
+	DEFAULT_MEMPOOL_MAX_PER_SENDER   = 25
+	DEFAULT_MEMPOOL_TTL              = 3 * time.Hour
+	// DEFAULT_MIN_FEE_BUMP - Percentage a replacement must pay over the fees of the transactions it replaces.
+	DEFAULT_MIN_FEE_BUMP = 10
+	// MAX_DROPPED_TRANSACTIONS - How many dropped transactions the pool remembers, to answer their status.
+	MAX_DROPPED_TRANSACTIONS = 10000
+)
+
+var (
+	ErrMempoolFull            = errors.New("transaction pool is full of transactions with a higher fee rate")
+	ErrSenderLimit            = errors.New("sender has too many pending transactions")
+	ErrReplacementUnderpriced = errors.New("replacement does not pay enough fee")
+)
+
+// MempoolLimits - Bounds of the transaction pool. Zero values use the defaults.
+type MempoolLimits struct {
+	// MaxTransactions - Maximum number of pending transactions.
+	MaxTransactions int
+	// MaxSize - Maximum size in bytes of the encoded pending transactions.
+	MaxSize int
+	// MaxPerSender - Maximum number of pending transactions of a sender.
+	MaxPerSender int
+	// TTL - How long a transaction can wait in the pool before it expires.
+	TTL time.Duration
+	// MinFeeBump - Percentage a replacement must pay over the fees of the transactions it replaces.
+	MinFeeBump int
+}
+
+// withDefaults - Returns the limits with the defaults for the values that are not set.
+func (l MempoolLimits) withDefaults() MempoolLimits {
+	if l.MaxTransactions == 0 {
+		l.MaxTransactions = DEFAULT_MEMPOOL_MAX_TRANSACTIONS
+	}
+	if l.MaxSize == 0 {
+		l.MaxSize = DEFAULT_MEMPOOL_MAX_SIZE
+	}
+	if l.MaxPerSender == 0 {
+		l.MaxPerSender = DEFAULT_MEMPOOL_MAX_PER_SENDER
+	}
+	if l.TTL == 0 {
+		l.TTL = DEFAULT_MEMPOOL_TTL
+	}
+	if l.MinFeeBump == 0 {
+		l.MinFeeBump = DEFAULT_MIN_FEE_BUMP
+	}
+	return l
+}
+
+// SetLimits - Changes the bounds of the pool. The transactions already in the pool are kept until they
+// expire or are evicted by new ones.
+func (tp *TransactionPool) SetLimits(limits MempoolLimits) {
+	tp.mux.Lock()
+	defer tp.mux.Unlock()
+	tp.limits = limits.withDefaults()
+}
+
+// conflicts - Returns the pending entries that conflict with the transaction, in the order they were
+// added: they spend one of its inputs or, in account mode, they are of the same sender with the same nonce.
+func (tp *TransactionPool) conflicts(t *Transaction) []*poolEntry {
+	ids := make(map[string]bool)
+	for _, in := range t.inputs {
+		if id, ok := tp.spent[in.OutPoint()]; ok {
+			ids[id] = true
+		}
+	}
+	if len(t.inputs) == 0 {
+		for id, pending := range tp.entries {
+			if len(pending.t.inputs) == 0 && pending.t.senderBlockchainAddress == t.senderBlockchainAddress &&
+				pending.t.nonce == t.nonce {
+				ids[id] = true
+			}
+		}
+	}
+
+	conflicts := make([]*poolEntry, 0, len(ids))
+	for id := range ids {
+		conflicts = append(conflicts, tp.entries[id])
+	}
+	sort.Slice(conflicts, func(i, j int) bool {
+		return conflicts[i].sequence < conflicts[j].sequence
+	})
+	return conflicts
+}
+
+// checkReplacement - Verifies the entry pays enough to replace the conflicting ones: a higher fee
+// rate than each of them, and MinFeeBump percent more than their fees together.
+func (tp *TransactionPool) checkReplacement(e *poolEntry, conflicts []*poolEntry) error {
+	fees := make([]coin.Amount, 0, len(conflicts))
+	for _, c := range conflicts {
+		if !higherFeeRate(e.t.fee, e.size, c.t.fee, c.size) {
+			return ErrReplacementUnderpriced
+		}
+		fees = append(fees, c.t.fee)
+	}
+	replaced, err := coin.Sum(fees...)
+	if err != nil {
+		return err
+	}
+	bump := replaced / 100 * coin.Amount(tp.limits.MinFeeBump)
+	bump += replaced % 100 * coin.Amount(tp.limits.MinFeeBump) / 100
+	required, err := replaced.Add(bump)
+	if err != nil {
+		return err
+	}
+	if e.t.fee <= replaced || e.t.fee < required {
+		return ErrReplacementUnderpriced
+	}
+	return nil
+}
+
+// evictions - Returns the pending entries to evict so the entry fits in the pool once the replaced ones
+// leave it, the ones with the lowest fee rate first. Only entries with a lower fee rate than the new one
+// are evicted.
+func (tp *TransactionPool) evictions(e *poolEntry, replaced map[string]bool) ([]*poolEntry, error) {
+	count, size := len(tp.entries)+1, tp.size+e.size
+	candidates := make([]*poolEntry, 0, len(tp.entries))
+	for id, pending := range tp.entries {
+		if replaced[id] {
+			count--
+			size -= pending.size
+			continue
+		}
+		candidates = append(candidates, pending)
+	}
+	if count <= tp.limits.MaxTransactions && size <= tp.limits.MaxSize {
+		return nil, nil
+	}
+
+	// The lowest fee rate goes first, between equal rates the newest one.
+	sort.Slice(candidates, func(i, j int) bool {
+		ci, cj := candidates[i], candidates[j]
+		if higherFeeRate(cj.t.fee, cj.size, ci.t.fee, ci.size) {
+			return true
+		}
+		if higherFeeRate(ci.t.fee, ci.size, cj.t.fee, cj.size) {
+			return false
+		}
+		return ci.sequence > cj.sequence
+	})
+	evicted := make([]*poolEntry, 0)
+	for _, c := range candidates {
+		if count <= tp.limits.MaxTransactions && size <= tp.limits.MaxSize {
+			break
+		}
+		if !higherFeeRate(e.t.fee, e.size, c.t.fee, c.size) {
+			return nil, ErrMempoolFull
+		}
+		evicted = append(evicted, c)
+		count--
+		size -= c.size
+	}
+	if count > tp.limits.MaxTransactions || size > tp.limits.MaxSize {
+		return nil, ErrMempoolFull
+	}
+	return evicted, nil
+}
+
+// expire - Removes the transactions added more than TTL before now, and the ones that depended on them.
+func (tp *TransactionPool) expire(now time.Time) {
+	expired := false
+	for _, e := range tp.entries {
+		if now.Sub(e.addedAt) > tp.limits.TTL {
+			tp.drop(e, "expired")
+			expired = true
+		}
+	}
+	if expired {
+		tp.removeInvalid("after the expired ones")
+	}
+}
+
+// removeInvalid - Removes the transactions that can no longer be applied to the ledger after the ones
+// before them, and keeps the view of the ones that remain.
+func (tp *TransactionPool) removeInvalid(reason string) {
+	view := tp.ledger.NewView()
+	for _, e := range tp.sorted() {
+		if err := view.ApplyTransaction(e.t); err != nil {
+			tp.drop(e, fmt.Sprintf("not valid %s: %v", reason, err))
+		}
+	}
+	tp.view = view
+}
+
+// drop - Removes an entry that leaves the pool without being mined, and remembers why.
+func (tp *TransactionPool) drop(e *poolEntry, reason string) {
+	log.Printf("Removing transaction %s: %s", e.id, reason)
+	tp.removeLocked(e.id)
+	tp.dropped.add(e.id, reason)
+}
+
+// Status - Returns if the transaction with the ID is pending or was dropped from the pool, and why it was
+// dropped. Returns ErrTransactionNotFound if the pool does not know the transaction.
+func (tp *TransactionPool) Status(txID string) (TxStatus, string, error) {
+	tp.mux.Lock()
+	defer tp.mux.Unlock()
+	if _, ok := tp.entries[txID]; ok {
+		return TX_STATUS_PENDING, "", nil
+	}
+	if reason, ok := tp.dropped.get(txID); ok {
+		return TX_STATUS_DROPPED, reason, nil
+	}
+	return "", "", ErrTransactionNotFound
+}
+
+// droppedTransactions - Why the last MAX_DROPPED_TRANSACTIONS transactions dropped from the pool left it,
+// by ID. The oldest ones are forgotten first.
+type droppedTransactions struct {
+	reasons map[string]string
+	order   []string
+}
+
+func newDroppedTransactions() *droppedTransactions {
+	return &droppedTransactions{reasons: make(map[string]string)}
+}
+
+func (d *droppedTransactions) add(id string, reason string) {
+	if _, ok := d.reasons[id]; !ok {
+		d.order = append(d.order, id)
+	}
+	d.reasons[id] = reason
+	for len(d.order) > MAX_DROPPED_TRANSACTIONS {
+		delete(d.reasons, d.order[0])
+		d.order = d.order[1:]
+	}
+}
+
+func (d *droppedTransactions) get(id string) (string, bool) {
+	reason, ok := d.reasons[id]
+	return reason, ok
+}
+
+// remove - Forgets a transaction that is added to the pool again.
+func (d *droppedTransactions) remove(id string) {
+	if _, ok := d.reasons[id]; !ok {
+		return
+	}
+	delete(d.reasons, id)
+	for i, o := range d.order {
+		if o == id {
+			d.order = append(d.order[:i], d.order[i+1:]...)
+			break
+		}
+	}
+}
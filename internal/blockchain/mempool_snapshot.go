@@ -0,0 +1,103 @@
+package blockchain
+
+import (
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/martinsaporiti/blockchain-sample/internal/codec"
+)
+
+const (
+	// MEMPOOL_SNAPSHOT_FILE - Name of the file with the snapshot of the pool in the data directory.
+	MEMPOOL_SNAPSHOT_FILE = "mempool.dat"
+)
+
+// SaveSnapshot - Writes the transactions of the pool to the file, in the order they were added and with the
+// time they were added. The snapshot is the codec version byte followed by the list of transactions, each
+// one as the time in unix nanoseconds and its binary encoding with the witness. The file is replaced with a
+// rename, so a crash never leaves half a snapshot.
+func (tp *TransactionPool) SaveSnapshot(path string) error {
+	tp.mux.Lock()
+	e := codec.NewEncoder()
+	e.PutUint8(codec.CODEC_VERSION)
+	entries := tp.sorted()
+	e.PutUint32(uint32(len(entries)))
+	for _, entry := range entries {
+		m, err := entry.t.MarshalBinary()
+		if err != nil {
+			tp.mux.Unlock()
+			return err
+		}
+		e.PutInt64(entry.addedAt.UnixNano())
+		e.PutBytes(m)
+	}
+	tp.mux.Unlock()
+
+	tmp := path + ".tmp"
+	if err := writeFileSync(tmp, e.Bytes()); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+	return syncDir(filepath.Dir(path))
+}
+
+// LoadSnapshot - Adds the transactions of a snapshot written by SaveSnapshot to the pool, and returns how
+// many transactions the pool has after them. Every transaction is verified again on top of the current
+// ledger: the ones that are no longer valid, were mined while the node was stopped, or expired are dropped.
+// A missing file is an empty snapshot.
+func (tp *TransactionPool) LoadSnapshot(path string) (int, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	d := codec.NewDecoder(data)
+	d.Version()
+	n := d.Count()
+	type saved struct {
+		t       *Transaction
+		addedAt time.Time
+	}
+	snapshot := make([]saved, 0, n)
+	for i := 0; i < n && d.Err() == nil; i++ {
+		addedAt := time.Unix(0, d.Int64())
+		m := d.Bytes()
+		if d.Err() != nil {
+			break
+		}
+		t := &Transaction{}
+		if err := t.UnmarshalBinary(m); err != nil {
+			return 0, err
+		}
+		snapshot = append(snapshot, saved{t: t, addedAt: addedAt})
+	}
+	if err := d.Finish(); err != nil {
+		return 0, err
+	}
+
+	for _, s := range snapshot {
+		if err := s.t.Verify(tp.chainID); err != nil {
+			log.Printf("Discarding transaction %s of the snapshot: %v", s.t.ID(), err)
+			continue
+		}
+		if err := tp.addIfValid(s.t, s.addedAt); err != nil {
+			log.Printf("Discarding transaction %s of the snapshot: %v", s.t.ID(), err)
+			tp.mux.Lock()
+			tp.dropped.add(s.t.ID(), "not valid after the restart: "+err.Error())
+			tp.mux.Unlock()
+		}
+	}
+
+	tp.mux.Lock()
+	defer tp.mux.Unlock()
+	tp.expire(time.Now())
+	return len(tp.entries), nil
+}
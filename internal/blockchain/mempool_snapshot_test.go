@@ -0,0 +1,118 @@
+package blockchain
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/martinsaporiti/blockchain-sample/internal/codec"
+)
+
+func TestTransactionPool_Snapshot(t *testing.T) {
+
+	account := newTestAccount()
+	sba := account.address
+	rba := "1CHD4Jjqsak4RV5JHAdYZ9CKY1dQe4tkXW"
+	timestamp := int64(1654369662)
+
+	tests := map[string]struct {
+		// mined - Index of the pending transaction mined while the node is stopped, -1 for none.
+		mined  int
+		limits MempoolLimits
+		want   int
+	}{
+		"should reload the pending transactions": {
+			mined: -1,
+			want:  2,
+		},
+		"should drop the transactions mined while the node was stopped": {
+			mined: 0,
+			want:  1,
+		},
+		"should drop the expired transactions": {
+			mined:  -1,
+			limits: MempoolLimits{TTL: time.Nanosecond},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			utxos, fundingID := newFundedUTXOSet(NewTxOutput(sba, 100), NewTxOutput(sba, 100))
+			pending := []*Transaction{
+				NewTransaction(sba, rba, 100, timestamp, []*TxInput{NewTxInput(fundingID, 0)},
+					[]*TxOutput{NewTxOutput(rba, 100)}),
+				NewTransaction(sba, rba, 100, timestamp, []*TxInput{NewTxInput(fundingID, 1)},
+					[]*TxOutput{NewTxOutput(rba, 100)}),
+			}
+			txPool := NewTransactionPool(nil, utxos, testChainID)
+			for _, tx := range pending {
+				if !txPool.AddAndVerifyTransaction(account.request(tx)) {
+					t.Fatalf("the transaction %s should be accepted", tx.ID())
+				}
+			}
+			path := filepath.Join(t.TempDir(), MEMPOOL_SNAPSHOT_FILE)
+			if err := txPool.SaveSnapshot(path); err != nil {
+				t.Fatalf("SaveSnapshot() = %v", err)
+			}
+			if tc.mined >= 0 {
+				mined := txPool.Transactions()[tc.mined]
+				if err := utxos.ApplyBlock(NewBlock(2, 0, [32]byte{1}, []*Transaction{mined})); err != nil {
+					t.Fatalf("ApplyBlock() = %v", err)
+				}
+			}
+
+			restarted := NewTransactionPool(nil, utxos, testChainID)
+			restarted.SetLimits(tc.limits)
+			got, err := restarted.LoadSnapshot(path)
+			if err != nil {
+				t.Fatalf("LoadSnapshot() = %v", err)
+			}
+			if got != tc.want || restarted.Length() != tc.want {
+				t.Errorf("LoadSnapshot() = %d, Length() = %d, want %d", got, restarted.Length(), tc.want)
+			}
+			for _, tx := range restarted.Transactions() {
+				if err := tx.Verify(testChainID); err != nil {
+					t.Errorf("the reloaded transaction %s should keep its witness: %v", tx.ID(), err)
+				}
+			}
+		})
+	}
+}
+
+func TestTransactionPool_LoadSnapshot(t *testing.T) {
+
+	dir := t.TempDir()
+	truncated := filepath.Join(dir, "truncated.dat")
+	if err := os.WriteFile(truncated, []byte{codec.CODEC_VERSION, 0, 0, 0, 1}, 0o644); err != nil {
+		t.Fatalf("WriteFile() = %v", err)
+	}
+
+	tests := map[string]struct {
+		path string
+		want error
+	}{
+		"should return an empty pool when there is no snapshot": {
+			path: filepath.Join(dir, MEMPOOL_SNAPSHOT_FILE),
+		},
+		"should return an error when the snapshot is truncated": {
+			path: truncated,
+			want: codec.ErrUnexpectedEnd,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			utxos, _ := newFundedUTXOSet(NewTxOutput("15TZoyyxFmeTXJGjYwX1X3ARtXX94BbFrk", 100))
+			txPool := NewTransactionPool(nil, utxos, testChainID)
+			got, err := txPool.LoadSnapshot(tc.path)
+			if !errors.Is(err, tc.want) {
+				t.Errorf("LoadSnapshot() = %v, want %v", err, tc.want)
+			}
+			if got != 0 {
+				t.Errorf("LoadSnapshot() = %d transactions, want 0", got)
+			}
+		})
+	}
+}
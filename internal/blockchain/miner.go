@@ -6,99 +6,158 @@ import (
 	"log"
 )
 
+const (
+	DEFAULT_MAX_BLOCK_TRANSACTIONS = 1000
+	DEFAULT_MAX_BLOCK_SIZE         = 1 << 20
+)
+
 type Miner interface {
 	SignalStartMining()
 	SignalCancelMining()
+	// Hashrate - Returns the hashes per second of the last proof of work, 0 when the blocks are not
+	// sealed with a proof of work.
+	Hashrate() float64
+}
+
+// BlockLimits - Bounds of the blocks the miner assembles. Zero values use the defaults.
+type BlockLimits struct {
+	// MaxTransactions - Maximum number of transactions of a block, coinbase included.
+	MaxTransactions int
+	// MaxSize - Maximum size in bytes of the encoded transactions of a block, coinbase included.
+	MaxSize int
 }
 
 type miner struct {
 	blockchain           *Blockchain
 	txPool               *TransactionPool
+	limits               BlockLimits
 	startMiningChannel   chan bool
 	newBlockMinedChannel chan *Block
 	ctx                  context.Context
 	cancelFn             context.CancelFunc
 }
 
-func NewMiner(blockchain *Blockchain, txPool *TransactionPool, startMiningChannel chan bool, newBlockMinedChannel chan *Block) Miner {
+// NewMiner - Returns a miner that assembles blocks within the limits and seals them with the consensus
+// engine of the blockchain.
+func NewMiner(blockchain *Blockchain, txPool *TransactionPool, limits BlockLimits, startMiningChannel chan bool,
+	newBlockMinedChannel chan *Block) Miner {
+	if limits.MaxTransactions == 0 {
+		limits.MaxTransactions = DEFAULT_MAX_BLOCK_TRANSACTIONS
+	}
+	if limits.MaxSize == 0 {
+		limits.MaxSize = DEFAULT_MAX_BLOCK_SIZE
+	}
 	return &miner{
 		blockchain:           blockchain,
 		txPool:               txPool,
+		limits:               limits,
 		startMiningChannel:   startMiningChannel,
 		newBlockMinedChannel: newBlockMinedChannel,
 	}
 }
 
+// SignalCancelMining - Stops the current mining operation, if there is one.
 func (m *miner) SignalCancelMining() {
-	m.cancelFn()
+	if m.cancelFn != nil {
+		m.cancelFn()
+	}
 }
 
 // SignalStartMining - start mining
 // miner waits for a signal to start mining. That signal is sent by the tx pool.
+// Then it mines blocks while the pool has transactions that can be mined.
 func (m *miner) SignalStartMining() {
 	log.Println(">>> Starting Miner")
 	for {
 		<-m.startMiningChannel
-		if m.txPool.Length() > 0 {
+		for m.txPool.Length() > 0 {
 			fmt.Println("Mining...")
-			m.mineBlock()
+			if !m.mineBlock() {
+				break
+			}
 		}
 	}
 }
 
 // mineBlock - mine a new block
-func (m *miner) mineBlock() {
+// The transactions with the highest fee per byte that fit in the block are mined, the rest stay in the pool.
+// Returns false if there was nothing to mine.
+func (m *miner) mineBlock() bool {
 	ctx := context.Background()
 	ctx, cancel := context.WithCancel(ctx)
 	m.ctx = ctx
 	m.cancelFn = cancel
+	defer cancel()
 
 	log.Println(">>>> 1. action = mining, status = Starting")
-	transactions := m.txPool.Copy()
+	lastBlock := m.blockchain.LastBlock()
+	number := lastBlock.Number() + 1
+	transactions, err := m.assembleTransactions(number)
+	if err != nil {
+		log.Printf(">>>> 4. action = mining, status = Failed, %v", err)
+		return false
+	}
+	if len(transactions) == 1 {
+		log.Println(">>>> 4. action = mining, status = Skipped, no transaction of the pool can be mined")
+		return false
+	}
 	m.printTxs(transactions)
-	transactions = append(transactions, m.blockchain.CreateMinerTransaction())
-	previousHash := m.blockchain.LastBlock().Hash()
-	lastNumber := m.blockchain.LastBlock().Number()
-
-	nonce := m.proofOfWork(ctx, lastNumber+1, transactions)
+	header, err := m.blockchain.newBlockHeader(lastBlock, transactions)
+	if err != nil {
+		log.Printf(">>>> 4. action = mining, status = Failed, %v", err)
+		return false
+	}
 
-	// if nonce == -1, then the miner was cancelled.
-	// if nonce != -1, then the miner mined a block.
-	if nonce != -1 {
-		newBlock := m.blockchain.CreateBlock(lastNumber+1, nonce, previousHash, transactions)
-		if newBlock == nil {
-			log.Println(">>>> 4. action = mining, status = Failed, Block not created")
-		} else {
-			log.Println("<<<< 2. action = mining, status = Success")
-			log.Printf("Sending new block over the network: %d", newBlock.number)
-			m.newBlockMinedChannel <- newBlock
+	block := &Block{header: *header, transactions: transactions}
+	if err := m.blockchain.engine.Seal(ctx, block, &lastBlock.header, m.blockchain.Ledger()); err != nil {
+		if ctx.Err() != nil {
+			// Context cancelled, new block from network added.
+			log.Println("<<<< 3. action = mining, status = Canceled")
+			return true
 		}
+		log.Printf(">>>> 4. action = mining, status = Skipped, %v", err)
+		return false
 	}
 
-	// Checks if the are new transactions in the pool and puts to run again the miner...
-	defer func() {
-		m.SignalStartMining()
-	}()
+	newBlock := m.blockchain.createBlock(block)
+	if newBlock == nil {
+		log.Println(">>>> 4. action = mining, status = Failed, Block not created")
+		return false
+	}
+	log.Printf("<<<< 2. action = mining, status = Success, nonce = %d, hashrate = %.0f H/s",
+		newBlock.Nonce(), m.Hashrate())
+	m.txPool.UpdateFromBlock(newBlock)
+	log.Printf("Sending new block over the network: %d", newBlock.Number())
+	m.newBlockMinedChannel <- newBlock
+	return true
 }
 
-func (m *miner) proofOfWork(ctx context.Context, number int64, transactions []*Transaction) int {
-	log.Printf(">>> Starting Proof of Work for %d transactions", len(transactions))
-	previousHash := m.blockchain.LastBlock().Hash()
-	nonce := -1
-	done := false
-	for !done {
-		nonce += 1
-		select {
-		case <-ctx.Done():
-			// Context cancelled, new block from network added.
-			log.Println("<<<< 3. action = mining, status = Canceled")
-			return -1
-		default:
-			done = m.blockchain.validProof(number, nonce, previousHash, transactions, m.blockchain.difficulty)
-		}
+// Hashrate - Returns the hashes per second of the last proof of work.
+func (m *miner) Hashrate() float64 {
+	if pow, ok := m.blockchain.engine.(*ProofOfWork); ok {
+		return pow.Hashrate()
 	}
+	return 0
+}
 
-	return nonce
+// assembleTransactions - Selects the transactions of the pool for the block number, within the limits,
+// and appends the coinbase that collects their fees.
+func (m *miner) assembleTransactions(number int64) ([]*Transaction, error) {
+	// The size of the coinbase does not depend on the amount it pays.
+	coinbase, err := m.blockchain.CreateMinerTransaction(number, 0)
+	if err != nil {
+		return nil, err
+	}
+	transactions := m.txPool.SelectTransactions(m.limits.MaxTransactions-1, m.limits.MaxSize-coinbase.Size())
+	fees, err := blockFees(transactions)
+	if err != nil {
+		return nil, err
+	}
+	coinbase, err = m.blockchain.CreateMinerTransaction(number, fees)
+	if err != nil {
+		return nil, err
+	}
+	return append(transactions, coinbase), nil
 }
 
 func (m *miner) printTxs(transactions []*Transaction) {
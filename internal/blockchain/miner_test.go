@@ -4,25 +4,40 @@ import (
 	"sync"
 	"testing"
 	"time"
+
+	"github.com/martinsaporiti/blockchain-sample/internal/coin"
 )
 
+// fundTestAddress - Adds a block to the blockchain whose coinbase pays value to the address.
+// Returns the ID of the coinbase.
+func fundTestAddress(blockchain *Blockchain, address string, value coin.Amount) [32]byte {
+	lastBlock := blockchain.LastBlock()
+	coinbase := NewTransaction("THE BLOCKCHAIN", address, value, 1654369000,
+		[]*TxInput{NewCoinbaseInput(lastBlock.Number() + 1)},
+		[]*TxOutput{NewTxOutput(address, value)})
+	blockchain.CreateBlock(lastBlock.Number()+1, 1, lastBlock.Hash(), []*Transaction{coinbase})
+	return coinbase.Hash()
+}
+
 func TestMiner_mineBlockComplete(t *testing.T) {
 
 	sba := "15TZoyyxFmeTXJGjYwX1X3ARtXX94BbFrk"
 	rba := "1CHD4Jjqsak4RV5JHAdYZ9CKY1dQe4tkXW"
-	value := float32(200)
+	value := coin.Coins(200)
 	timestamp := int64(1654369662)
-	tx := NewTransaction(sba, rba, value, timestamp)
 
-	blockchain := NewBlockchain("a node name", "a node address", 1)
-	txPool := NewTransactionPool(nil)
-	txPool.transactions = make(map[string]*Transaction)
-	txPool.transactions[tx.ID()] = tx
+	blockchain, _ := NewBlockchain("a node name", "a node address", newTestGenesis(), newTestProofOfWork(1), NewMemoryBlockStore(), LEDGER_MODE_UTXO)
+	fundingID := fundTestAddress(blockchain, sba, value)
+	tx := NewTransaction(sba, rba, value, timestamp,
+		[]*TxInput{NewTxInput(fundingID, 0)},
+		[]*TxOutput{NewTxOutput(rba, value)})
+	txPool := NewTransactionPool(nil, blockchain.Ledger(), testChainID)
+	txPool.Add(tx)
 
 	startMining := make(chan bool)
 	newBlockMined := make(chan *Block)
 
-	miner := NewMiner(blockchain, txPool, startMining, newBlockMined)
+	miner := NewMiner(blockchain, txPool, BlockLimits{}, startMining, newBlockMined)
 
 	wg := sync.WaitGroup{}
 	wg.Add(1)
@@ -49,18 +64,20 @@ func TestMiner_mineBlockCanceled(t *testing.T) {
 
 	sba := "15TZoyyxFmeTXJGjYwX1X3ARtXX94BbFrk"
 	rba := "1CHD4Jjqsak4RV5JHAdYZ9CKY1dQe4tkXW"
-	value := float32(200)
+	value := coin.Coins(200)
 	timestamp := int64(1654369662)
-	tx := NewTransaction(sba, rba, value, timestamp)
 
-	blockchain := NewBlockchain("a node name", "a node address", 10)
-	txPool := NewTransactionPool(nil)
-	txPool.transactions = make(map[string]*Transaction)
-	txPool.transactions[tx.ID()] = tx
+	blockchain, _ := NewBlockchain("a node name", "a node address", newTestGenesis(), newTestProofOfWork(10), NewMemoryBlockStore(), LEDGER_MODE_UTXO)
+	fundingID := fundTestAddress(blockchain, sba, value)
+	tx := NewTransaction(sba, rba, value, timestamp,
+		[]*TxInput{NewTxInput(fundingID, 0)},
+		[]*TxOutput{NewTxOutput(rba, value)})
+	txPool := NewTransactionPool(nil, blockchain.Ledger(), testChainID)
+	txPool.Add(tx)
 
 	startMining := make(chan bool)
 	newBlockMined := make(chan *Block)
-	miner := NewMiner(blockchain, txPool, startMining, newBlockMined)
+	miner := NewMiner(blockchain, txPool, BlockLimits{}, startMining, newBlockMined)
 
 	go func() {
 		startMining <- true
@@ -0,0 +1,116 @@
+package blockchain
+
+import (
+	"log"
+	"time"
+)
+
+const (
+	// MAX_ORPHAN_BLOCKS - How many blocks can wait for their parent at the same time.
+	MAX_ORPHAN_BLOCKS = 100
+	// MAX_ORPHAN_AGE - How long a block can wait for its parent before it is discarded.
+	MAX_ORPHAN_AGE = 10 * time.Minute
+)
+
+type orphan struct {
+	block      *Block
+	receivedAt time.Time
+}
+
+// orphanPool - Blocks whose parent the node has not seen yet, by hash.
+// When the pool is full the oldest orphan is discarded, and orphans older than MAX_ORPHAN_AGE expire.
+// It is not safe for concurrent use, the blockchain guards it with its mutex.
+type orphanPool struct {
+	orphans map[[32]byte]*orphan
+	// byParent - Hashes of the orphans by the hash of the parent they wait for.
+	byParent map[[32]byte][][32]byte
+}
+
+func newOrphanPool() *orphanPool {
+	return &orphanPool{
+		orphans:  make(map[[32]byte]*orphan),
+		byParent: make(map[[32]byte][][32]byte),
+	}
+}
+
+// add - Keeps the block until its parent arrives.
+func (p *orphanPool) add(block *Block, now time.Time) {
+	p.expire(now)
+	if len(p.orphans) >= MAX_ORPHAN_BLOCKS {
+		p.removeOldest()
+	}
+
+	hash := block.Hash()
+	p.orphans[hash] = &orphan{block: block, receivedAt: now}
+	p.byParent[block.PreviousHash()] = append(p.byParent[block.PreviousHash()], hash)
+}
+
+// has - Returns true if the block with the hash is waiting for its parent.
+func (p *orphanPool) has(hash [32]byte) bool {
+	_, ok := p.orphans[hash]
+	return ok
+}
+
+// len - Returns the number of orphans of the pool.
+func (p *orphanPool) len() int {
+	return len(p.orphans)
+}
+
+// take - Returns and forgets the orphans that wait for the block with the hash, the expired ones are
+// discarded.
+func (p *orphanPool) take(parentHash [32]byte, now time.Time) []*Block {
+	p.expire(now)
+	blocks := make([]*Block, 0)
+	for _, hash := range p.byParent[parentHash] {
+		if o, ok := p.orphans[hash]; ok {
+			blocks = append(blocks, o.block)
+			delete(p.orphans, hash)
+		}
+	}
+	delete(p.byParent, parentHash)
+	return blocks
+}
+
+// expire - Discards the orphans received more than MAX_ORPHAN_AGE before now.
+func (p *orphanPool) expire(now time.Time) {
+	for hash, o := range p.orphans {
+		if now.Sub(o.receivedAt) > MAX_ORPHAN_AGE {
+			log.Printf("Discarding orphan block %d: its parent did not arrive", o.block.Number())
+			p.remove(hash)
+		}
+	}
+}
+
+func (p *orphanPool) removeOldest() {
+	var oldest *orphan
+	for _, o := range p.orphans {
+		if oldest == nil || o.receivedAt.Before(oldest.receivedAt) {
+			oldest = o
+		}
+	}
+	if oldest != nil {
+		log.Printf("Discarding orphan block %d: the orphan pool is full", oldest.block.Number())
+		p.remove(oldest.block.Hash())
+	}
+}
+
+func (p *orphanPool) remove(hash [32]byte) {
+	o, ok := p.orphans[hash]
+	if !ok {
+		return
+	}
+	delete(p.orphans, hash)
+	parentHash := o.block.PreviousHash()
+	siblings := p.byParent[parentHash]
+	for i, h := range siblings {
+		if h == hash {
+			siblings = append(siblings[:i], siblings[i+1:]...)
+			break
+		}
+	}
+	if len(siblings) == 0 {
+		delete(p.byParent, parentHash)
+	} else {
+		p.byParent[parentHash] = siblings
+	}
+}
@@ -0,0 +1,82 @@
+package blockchain
+
+import (
+	"testing"
+	"time"
+)
+
+// newOrphan - Returns a block with the number that waits for the parent.
+func newOrphan(number int64, parent [32]byte) *Block {
+	return &Block{header: BlockHeader{number: number, previousHash: parent}}
+}
+
+func TestOrphanPool(t *testing.T) {
+
+	start := time.Date(2022, 6, 4, 0, 0, 0, 0, time.UTC)
+	parent := [32]byte{1}
+	other := [32]byte{2}
+
+	tests := map[string]struct {
+		// fill - Adds the orphans to the pool and returns the time the parent arrives.
+		fill func(p *orphanPool) time.Time
+		// wantTaken - Numbers of the orphans returned when the parent arrives.
+		wantTaken []int64
+		wantLen   int
+	}{
+		"should return the orphans that wait for the parent": {
+			fill: func(p *orphanPool) time.Time {
+				p.add(newOrphan(5, parent), start)
+				p.add(newOrphan(6, parent), start)
+				p.add(newOrphan(7, other), start)
+				return start
+			},
+			wantTaken: []int64{5, 6},
+			wantLen:   1,
+		},
+		"should discard the orphans older than the max age": {
+			fill: func(p *orphanPool) time.Time {
+				p.add(newOrphan(5, parent), start)
+				p.add(newOrphan(6, parent), start.Add(MAX_ORPHAN_AGE/2))
+				p.add(newOrphan(7, other), start)
+				return start.Add(MAX_ORPHAN_AGE + time.Second)
+			},
+			wantTaken: []int64{6},
+			wantLen:   0,
+		},
+		"should discard the oldest orphan when the pool is full": {
+			fill: func(p *orphanPool) time.Time {
+				p.add(newOrphan(5, parent), start)
+				for i := 1; i < MAX_ORPHAN_BLOCKS; i++ {
+					p.add(newOrphan(int64(i+100), other), start.Add(time.Duration(i)*time.Millisecond))
+				}
+				p.add(newOrphan(6, parent), start.Add(time.Second))
+				return start.Add(time.Second)
+			},
+			wantTaken: []int64{6},
+			wantLen:   MAX_ORPHAN_BLOCKS - 1,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			p := newOrphanPool()
+			now := tc.fill(p)
+
+			taken := p.take(parent, now)
+			if len(taken) != len(tc.wantTaken) {
+				t.Fatalf("len(take()) = %d, want %d", len(taken), len(tc.wantTaken))
+			}
+			for i, b := range taken {
+				if b.Number() != tc.wantTaken[i] {
+					t.Errorf("take()[%d] = block %d, want block %d", i, b.Number(), tc.wantTaken[i])
+				}
+				if p.has(b.Hash()) {
+					t.Errorf("has(block %d) = true after take()", b.Number())
+				}
+			}
+			if got := p.len(); got != tc.wantLen {
+				t.Errorf("len() = %d, want %d", got, tc.wantLen)
+			}
+		})
+	}
+}
@@ -0,0 +1,108 @@
+package blockchain
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"errors"
+	"fmt"
+
+	"github.com/martinsaporiti/blockchain-sample/internal/blkcrypto"
+)
+
+const (
+	// POA_BITS - Bits of the proof of authority blocks signed out of turn, the easiest target. The blocks
+	// signed in turn have IN_TURN_BITS, twice the work, so the branch with the most work is the one with the
+	// most blocks signed in turn.
+	POA_BITS = 0x20100000
+)
+
+var (
+	ErrNoSigners     = errors.New("proof of authority needs at least one signer")
+	ErrUnknownSigner = errors.New("the key of the node is not the key of a signer")
+	ErrNotInTurn     = errors.New("it is not the turn of this node to sign the block")
+	ErrInvalidSeal   = errors.New("block is not sealed by the rules of the consensus")
+)
+
+// ProofOfAuthority - Consensus where a fixed set of signers take turns to sign the blocks: the block number
+// n is signed in turn by the signer n modulo the number of signers. When the signer in turn is down, the
+// next signers can sign the block out of turn, one more every ROUND_TIMEOUT, as in Clique. The seal is the
+// public key of the signer and its signature of the hash of the header.
+type ProofOfAuthority struct {
+	signers []string
+	key     *ecdsa.PrivateKey
+}
+
+// NewProofOfAuthority - Returns the proof of authority engine for the signers, blockchain addresses in
+// the order of their turns. The key signs the blocks of this node, it is nil when the node only validates.
+func NewProofOfAuthority(signers []string, key *ecdsa.PrivateKey) (*ProofOfAuthority, error) {
+	if len(signers) == 0 {
+		return nil, ErrNoSigners
+	}
+	if key != nil {
+		address := blkcrypto.AddressFromPublicKey(&key.PublicKey)
+		found := false
+		for _, s := range signers {
+			found = found || s == address
+		}
+		if !found {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownSigner, address)
+		}
+	}
+	return &ProofOfAuthority{signers: signers, key: key}, nil
+}
+
+func (p *ProofOfAuthority) GenesisBits() uint32 {
+	return POA_BITS
+}
+
+// NextBits - Returns the bits of the round, the blocks signed in turn are heavier.
+func (p *ProofOfAuthority) NextBits(parent *BlockHeader, round int, headerAt HeaderByNumber) (uint32, error) {
+	return roundBits(round), nil
+}
+
+// Signer - Returns the address of the signer of the round of the block number. The signer of the round 0
+// is in turn, the next rounds follow the order of the signers.
+func (p *ProofOfAuthority) Signer(number int64, round int) string {
+	return p.signers[(number+int64(round))%int64(len(p.signers))]
+}
+
+// Seal - Signs the header of the block in the first round of this node: right away when it is in turn,
+// or once the signers before it let their ROUND_TIMEOUT pass.
+func (p *ProofOfAuthority) Seal(ctx context.Context, block *Block, parent *BlockHeader, state Ledger) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	number := block.header.number
+	if p.key == nil {
+		return fmt.Errorf("%w: block %d is signed by %s", ErrNotInTurn, number, p.Signer(number, 0))
+	}
+	address := blkcrypto.AddressFromPublicKey(&p.key.PublicKey)
+	for round := 0; round < len(p.signers); round++ {
+		if p.Signer(number, round) == address {
+			return sealRound(ctx, p.key, block, parent, round)
+		}
+	}
+	return fmt.Errorf("%w: %s", ErrUnknownSigner, address)
+}
+
+// VerifySeal - Verifies the header was signed by the signer of its round, once the round started.
+func (p *ProofOfAuthority) VerifySeal(header *BlockHeader, parent *BlockHeader) error {
+	address, err := headerSigner(header)
+	if err != nil {
+		return err
+	}
+	round := header.Round()
+	if round < 0 || round >= len(p.signers) {
+		return fmt.Errorf("%w: round %d, there are %d signers", ErrInvalidSeal, round, len(p.signers))
+	}
+	if signer := p.Signer(header.number, round); address != signer {
+		return fmt.Errorf("%w: block %d must be signed by %s in round %d", ErrInvalidSeal, header.number, signer,
+			round)
+	}
+	return verifyRoundStart(header, parent)
+}
+
+// VerifyProposer - The turns of proof of authority do not depend on the state.
+func (p *ProofOfAuthority) VerifyProposer(header *BlockHeader, state Ledger) error {
+	return nil
+}
@@ -0,0 +1,206 @@
+package blockchain
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestProofOfAuthority_Seal(t *testing.T) {
+
+	first, second, outsider := newTestAccount(), newTestAccount(), newTestAccount()
+	signers := []string{first.address, second.address}
+	verifier, _ := NewProofOfAuthority(signers, nil)
+	// The timeouts of the rounds of the blocks that follow the parent already passed.
+	parent := &BlockHeader{timestamp: time.Now().Add(-time.Minute).UnixNano()}
+
+	tests := map[string]struct {
+		account *testAccount
+		number  int64
+		// parent - The header the block follows, the old parent when it is nil.
+		parent *BlockHeader
+		// tamper - Changes the sealed header before it is verified.
+		tamper     func(h *BlockHeader)
+		wantSeal   error
+		wantRound  int
+		wantVerify error
+	}{
+		"should seal the block of the turn of the signer": {
+			account: first,
+			number:  2,
+		},
+		"should seal the block of the turn of the second signer": {
+			account: second,
+			number:  3,
+		},
+		"should seal the block of the turn of another signer out of turn when its round started": {
+			account:   first,
+			number:    3,
+			wantRound: 1,
+		},
+		"should not seal the block of the turn of another signer before its round started": {
+			account:  first,
+			number:   3,
+			parent:   &BlockHeader{timestamp: time.Now().UnixNano()},
+			wantSeal: context.DeadlineExceeded,
+		},
+		"should not verify a seal of another signer": {
+			account: first,
+			number:  2,
+			tamper: func(h *BlockHeader) {
+				h.number = 4
+				h.seal = append([]byte{}, h.seal...)
+			},
+			wantVerify: ErrInvalidSeal,
+		},
+		"should not verify a seal of the signer of another round": {
+			account: first,
+			number:  2,
+			tamper: func(h *BlockHeader) {
+				h.nonce = 1
+				h.seal, _ = signHeader(first.privateKey, h)
+			},
+			wantVerify: ErrInvalidSeal,
+		},
+		"should not verify a round after the last signer": {
+			account: first,
+			number:  2,
+			tamper: func(h *BlockHeader) {
+				h.nonce = 2
+				h.seal, _ = signHeader(first.privateKey, h)
+			},
+			wantVerify: ErrInvalidSeal,
+		},
+		"should not verify a block signed out of turn before its round started": {
+			account:   first,
+			number:    3,
+			wantRound: 1,
+			tamper: func(h *BlockHeader) {
+				h.timestamp = parent.timestamp + int64(ROUND_TIMEOUT) - 1
+				h.seal, _ = signHeader(first.privateKey, h)
+			},
+			wantVerify: ErrRoundNotStarted,
+		},
+		"should not verify a header changed after the seal": {
+			account: first,
+			number:  2,
+			tamper: func(h *BlockHeader) {
+				h.timestamp++
+			},
+			wantVerify: ErrInvalidSeal,
+		},
+		"should not verify a header without seal": {
+			account: first,
+			number:  2,
+			tamper: func(h *BlockHeader) {
+				h.seal = nil
+			},
+			wantVerify: ErrInvalidSeal,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			p, err := NewProofOfAuthority(signers, tc.account.privateKey)
+			if err != nil {
+				t.Fatalf("NewProofOfAuthority() = %v", err)
+			}
+			blockParent := parent
+			if tc.parent != nil {
+				blockParent = tc.parent
+			}
+			block := NewBlock(tc.number, 0, [32]byte{1}, nil)
+			block.header.bits = POA_BITS
+
+			ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+			defer cancel()
+			if err := p.Seal(ctx, block, blockParent, nil); !errors.Is(err, tc.wantSeal) {
+				t.Fatalf("Seal() = %v, want %v", err, tc.wantSeal)
+			}
+			if tc.wantSeal != nil {
+				return
+			}
+			if got := block.header.Round(); got != tc.wantRound {
+				t.Errorf("Seal() round = %d, want %d", got, tc.wantRound)
+			}
+			if got, want := block.header.bits, roundBits(tc.wantRound); got != want {
+				t.Errorf("Seal() bits = %08x, want %08x", got, want)
+			}
+			if tc.tamper != nil {
+				tc.tamper(&block.header)
+			}
+			if err := verifier.VerifySeal(&block.header, blockParent); !errors.Is(err, tc.wantVerify) {
+				t.Errorf("VerifySeal() = %v, want %v", err, tc.wantVerify)
+			}
+		})
+	}
+
+	if _, err := NewProofOfAuthority(signers, outsider.privateKey); !errors.Is(err, ErrUnknownSigner) {
+		t.Errorf("NewProofOfAuthority() = %v, want %v", err, ErrUnknownSigner)
+	}
+	if _, err := NewProofOfAuthority(nil, nil); !errors.Is(err, ErrNoSigners) {
+		t.Errorf("NewProofOfAuthority() = %v, want %v", err, ErrNoSigners)
+	}
+	if POA_BITS != targetToBits(powLimit) {
+		t.Errorf("POA_BITS = %08x, want the bits of the easiest target %08x", POA_BITS, targetToBits(powLimit))
+	}
+	inTurn, outOfTurn := (&BlockHeader{bits: IN_TURN_BITS}).Work(), (&BlockHeader{bits: POA_BITS}).Work()
+	if inTurn.Cmp(outOfTurn) <= 0 {
+		t.Errorf("Work() of a block in turn = %s, want more than %s", inTurn, outOfTurn)
+	}
+}
+
+func TestBlockchain_ProofOfAuthoritySignerDown(t *testing.T) {
+
+	first, second := newTestAccount(), newTestAccount()
+	signers := []string{first.address, second.address}
+	verifier, _ := NewProofOfAuthority(signers, nil)
+	firstSigner, _ := NewProofOfAuthority(signers, first.privateKey)
+	secondSigner, _ := NewProofOfAuthority(signers, second.privateKey)
+
+	blockchain, _ := NewBlockchain("Node 500", second.address, newTestGenesis(), verifier, NewMemoryBlockStore(),
+		LEDGER_MODE_UTXO)
+	// seal - Returns the block that follows the parent sealed by the signer.
+	seal := func(signer *ProofOfAuthority, parent *Block) *Block {
+		coinbase, _ := blockchain.CreateMinerTransaction(parent.Number()+1, 0)
+		transactions := []*Transaction{coinbase}
+		header, err := blockchain.newBlockHeader(parent, transactions)
+		if err != nil {
+			t.Fatalf("newBlockHeader() = %v", err)
+		}
+		block := &Block{header: *header, transactions: transactions}
+		if err := signer.Seal(context.Background(), block, &parent.header, nil); err != nil {
+			t.Fatalf("Seal() = %v", err)
+		}
+		return block
+	}
+
+	// The first signer is down when it is its turn to sign the block 2, the genesis block is older than
+	// the timeout of its round.
+	genesis := blockchain.LastBlock()
+	outOfTurn := seal(secondSigner, genesis)
+	if err := blockchain.AddProposedBlockFromNetwork(outOfTurn); err != nil {
+		t.Fatalf("AddProposedBlockFromNetwork() of the block signed out of turn = %v", err)
+	}
+	if err := blockchain.AddProposedBlockFromNetwork(seal(secondSigner, outOfTurn)); err != nil {
+		t.Fatalf("AddProposedBlockFromNetwork() of the next block = %v", err)
+	}
+	if got := blockchain.LastBlock().Number(); got != 3 {
+		t.Fatalf("LastBlock() = block %d, want block 3", got)
+	}
+
+	// When the block of the signer in turn arrives, it is heavier than the one signed out of turn.
+	inTurn := seal(firstSigner, genesis)
+	rival, _ := NewBlockchain("Node 501", second.address, newTestGenesis(), verifier, NewMemoryBlockStore(),
+		LEDGER_MODE_UTXO)
+	if err := rival.AddProposedBlockFromNetwork(outOfTurn); err != nil {
+		t.Fatalf("AddProposedBlockFromNetwork() of the block signed out of turn = %v", err)
+	}
+	if err := rival.AddProposedBlockFromNetwork(inTurn); err != nil {
+		t.Fatalf("AddProposedBlockFromNetwork() of the block signed in turn = %v", err)
+	}
+	if got := rival.LastBlock().Hash(); got != inTurn.Hash() {
+		t.Errorf("LastBlock() should be the block signed in turn")
+	}
+}
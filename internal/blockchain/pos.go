@@ -0,0 +1,178 @@
+package blockchain
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/martinsaporiti/blockchain-sample/internal/blkcrypto"
+	"github.com/martinsaporiti/blockchain-sample/internal/coin"
+)
+
+const (
+	// POS_BITS - Bits of the proof of stake blocks proposed by a backup proposer. Like proof of authority,
+	// the blocks of the proposer in turn have IN_TURN_BITS, twice the work.
+	POS_BITS = POA_BITS
+	// MIN_VALIDATOR_STAKE - Stake an address needs to propose blocks.
+	MIN_VALIDATOR_STAKE = coin.Amount(1 * coin.UNITS_PER_COIN)
+)
+
+var (
+	ErrNoValidators         = errors.New("there are no validators to propose the block")
+	ErrStakingNeedsAccounts = errors.New("proof of stake needs the account ledger mode")
+)
+
+// Validator - Address with at least MIN_VALIDATOR_STAKE bonded, it can propose blocks.
+type Validator struct {
+	Address string
+	Stake   coin.Amount
+}
+
+// ProofOfStake - Consensus where the validators, the addresses with stake in the ledger, propose the
+// blocks. Every block has a ranking of its proposers, drawn at random weighted by stake with the number of
+// the block as seed, so every node draws the same one and no proposer can change it with the content of
+// its block. The first proposer of the ranking is in turn, when it is silent the next ones can propose the
+// block, one more every ROUND_TIMEOUT. The seal is the public key of the proposer and its signature of the
+// hash of the header, like proof of authority.
+// While nothing is bonded, the bootstrap signers take turns like proof of authority.
+type ProofOfStake struct {
+	signers []string
+	key     *ecdsa.PrivateKey
+}
+
+// NewProofOfStake - Returns the proof of stake engine. The signers propose the blocks while there are no
+// validators. The key signs the blocks of this node, it is nil when the node only validates.
+func NewProofOfStake(signers []string, key *ecdsa.PrivateKey) *ProofOfStake {
+	return &ProofOfStake{signers: signers, key: key}
+}
+
+func (p *ProofOfStake) GenesisBits() uint32 {
+	return POS_BITS
+}
+
+// NextBits - Returns the bits of the round, the blocks of the proposer in turn are heavier.
+func (p *ProofOfStake) NextBits(parent *BlockHeader, round int, headerAt HeaderByNumber) (uint32, error) {
+	return roundBits(round), nil
+}
+
+// Ranking - Returns the proposers of the block number in the order of their rounds, chosen with the
+// validators of the state, the ledger after the parent of the block.
+func (p *ProofOfStake) Ranking(number int64, state Ledger) ([]string, error) {
+	accounts, ok := state.(*State)
+	if !ok {
+		return nil, ErrStakingNeedsAccounts
+	}
+	validators := accounts.Validators()
+	if len(validators) > 0 {
+		return rankValidators(validators, number), nil
+	}
+	if len(p.signers) == 0 {
+		return nil, ErrNoValidators
+	}
+	ranking := make([]string, len(p.signers))
+	for round := range ranking {
+		ranking[round] = p.signers[(number+int64(round))%int64(len(p.signers))]
+	}
+	return ranking, nil
+}
+
+// Proposer - Returns the address that must propose the block of the header in its round.
+func (p *ProofOfStake) Proposer(header *BlockHeader, state Ledger) (string, error) {
+	ranking, err := p.Ranking(header.number, state)
+	if err != nil {
+		return "", err
+	}
+	round := header.Round()
+	if round < 0 || round >= len(ranking) {
+		return "", fmt.Errorf("%w: round %d, there are %d proposers", ErrInvalidSeal, round, len(ranking))
+	}
+	return ranking[round], nil
+}
+
+// rankValidators - Draws the validators one by one, with a probability proportional to their stake, until
+// every one has its place. The seed of every draw is the number of the block and the place.
+func rankValidators(validators []Validator, number int64) []string {
+	remaining := append([]Validator{}, validators...)
+	total := new(big.Int)
+	for _, v := range remaining {
+		total.Add(total, big.NewInt(int64(v.Stake)))
+	}
+	ranking := make([]string, 0, len(remaining))
+	seed := make([]byte, 16)
+	binary.BigEndian.PutUint64(seed, uint64(number))
+	for len(remaining) > 0 {
+		binary.BigEndian.PutUint64(seed[8:], uint64(len(ranking)))
+		h := sha256.Sum256(seed)
+		pick := new(big.Int).Mod(new(big.Int).SetBytes(h[:]), total)
+
+		chosen := len(remaining) - 1
+		sum := new(big.Int)
+		for i, v := range remaining {
+			sum.Add(sum, big.NewInt(int64(v.Stake)))
+			if pick.Cmp(sum) < 0 {
+				chosen = i
+				break
+			}
+		}
+		ranking = append(ranking, remaining[chosen].Address)
+		total.Sub(total, big.NewInt(int64(remaining[chosen].Stake)))
+		remaining = append(remaining[:chosen], remaining[chosen+1:]...)
+	}
+	return ranking
+}
+
+// Seal - Signs the header of the block in the first round of this node: right away when it is the
+// proposer in turn, or once the proposers before it in the ranking let their ROUND_TIMEOUT pass.
+func (p *ProofOfStake) Seal(ctx context.Context, block *Block, parent *BlockHeader, state Ledger) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	number := block.header.number
+	ranking, err := p.Ranking(number, state)
+	if err != nil {
+		return err
+	}
+	if p.key != nil {
+		address := blkcrypto.AddressFromPublicKey(&p.key.PublicKey)
+		for round, proposer := range ranking {
+			if proposer == address {
+				return sealRound(ctx, p.key, block, parent, round)
+			}
+		}
+	}
+	return fmt.Errorf("%w: block %d is proposed by %s", ErrNotInTurn, number, ranking[0])
+}
+
+// VerifySeal - Verifies the header is signed, once its round started. Who must sign it depends on the
+// stake, VerifyProposer checks it.
+func (p *ProofOfStake) VerifySeal(header *BlockHeader, parent *BlockHeader) error {
+	if _, err := headerSigner(header); err != nil {
+		return err
+	}
+	return verifyRoundStart(header, parent)
+}
+
+// VerifyProposer - Verifies the header was signed by the proposer of its round. The genesis block has no
+// proposer.
+func (p *ProofOfStake) VerifyProposer(header *BlockHeader, state Ledger) error {
+	if header.number <= 1 {
+		return nil
+	}
+	signer, err := headerSigner(header)
+	if err != nil {
+		return err
+	}
+	proposer, err := p.Proposer(header, state)
+	if err != nil {
+		return err
+	}
+	if signer != proposer {
+		return fmt.Errorf("%w: block %d must be proposed by %s in round %d", ErrInvalidSeal, header.number,
+			proposer, header.Round())
+	}
+	return nil
+}
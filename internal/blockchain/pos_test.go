@@ -0,0 +1,500 @@
+package blockchain
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/martinsaporiti/blockchain-sample/internal/coin"
+)
+
+// newStakedState - Returns a state where every address has bonded its stake.
+func newStakedState(stakes map[string]coin.Amount) *State {
+	transactions := make([]*Transaction, 0)
+	for address, stake := range stakes {
+		transactions = append(transactions, NewTransaction("THE BLOCKCHAIN", address, stake, 1654369000,
+			[]*TxInput{NewCoinbaseInput(int64(len(transactions) + 1))}, []*TxOutput{NewTxOutput(address, stake)}))
+	}
+	state := NewState()
+	if err := state.ApplyBlock(NewBlock(1, 0, [32]byte{}, transactions)); err != nil {
+		panic(err)
+	}
+	bonds := make([]*Transaction, 0)
+	for address, stake := range stakes {
+		bonds = append(bonds, NewStakingTransaction(TX_KIND_BOND, address, stake, 1654369000, 0))
+	}
+	if err := state.ApplyBlock(NewBlock(2, 0, [32]byte{1}, bonds)); err != nil {
+		panic(err)
+	}
+	return state
+}
+
+func TestProofOfStake_Proposer(t *testing.T) {
+
+	a, b, c := "1A", "1B", "1C"
+
+	tests := map[string]struct {
+		signers []string
+		state   Ledger
+		// want - How many of the 1000 blocks every address proposes, at least.
+		want map[string]int
+		err  error
+	}{
+		"should choose the signers in turns while nothing is bonded": {
+			signers: []string{a, b},
+			state:   NewState(),
+			want:    map[string]int{a: 500, b: 500},
+		},
+		"should choose the validators weighted by their stake": {
+			signers: []string{c},
+			state:   newStakedState(map[string]coin.Amount{a: coin.Coins(3), b: coin.Coins(1)}),
+			want:    map[string]int{a: 700, b: 200},
+		},
+		"should not choose an address with less stake than the minimum": {
+			state: newStakedState(map[string]coin.Amount{a: coin.Coins(1), b: MIN_VALIDATOR_STAKE - 1}),
+			want:  map[string]int{a: 1000},
+		},
+		"should fail without validators and signers": {
+			state: NewState(),
+			err:   ErrNoValidators,
+		},
+		"should fail with the UTXO ledger mode": {
+			signers: []string{a},
+			state:   NewUTXOSet(),
+			err:     ErrStakingNeedsAccounts,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			p := NewProofOfStake(tc.signers, nil)
+			got := make(map[string]int)
+			for number := int64(0); number < 1000; number++ {
+				header := &BlockHeader{number: number, previousHash: [32]byte{byte(number), byte(number >> 8)}}
+				proposer, err := p.Proposer(header, tc.state)
+				if !errors.Is(err, tc.err) {
+					t.Fatalf("Proposer() = %v, want %v", err, tc.err)
+				}
+				if err != nil {
+					return
+				}
+				got[proposer]++
+			}
+			for address, want := range tc.want {
+				if got[address] < want {
+					t.Errorf("Proposer() = %s %d times, want at least %d", address, got[address], want)
+				}
+			}
+		})
+	}
+}
+
+func TestProofOfStake_Ranking(t *testing.T) {
+
+	a, b, c := "1A", "1B", "1C"
+
+	tests := map[string]struct {
+		signers []string
+		state   Ledger
+		number  int64
+		want    []string
+		// ordered - The ranking must be want in its order.
+		ordered bool
+	}{
+		"should rank the signers in turns while nothing is bonded": {
+			signers: []string{a, b, c},
+			state:   NewState(),
+			number:  4,
+			want:    []string{b, c, a},
+			ordered: true,
+		},
+		"should rank every validator once": {
+			signers: []string{c},
+			state:   newStakedState(map[string]coin.Amount{a: coin.Coins(3), b: coin.Coins(1)}),
+			number:  4,
+			want:    []string{a, b},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := NewProofOfStake(tc.signers, nil).Ranking(tc.number, tc.state)
+			if err != nil {
+				t.Fatalf("Ranking() = %v", err)
+			}
+			if len(got) != len(tc.want) {
+				t.Fatalf("Ranking() = %v, want %v", got, tc.want)
+			}
+			ranked := make(map[string]bool)
+			for _, address := range got {
+				ranked[address] = true
+			}
+			for i, address := range tc.want {
+				if tc.ordered && got[i] != address {
+					t.Errorf("Ranking() = %v, want %v", got, tc.want)
+				}
+				if !ranked[address] {
+					t.Errorf("Ranking() = %v, want %s in it", got, address)
+				}
+			}
+		})
+	}
+}
+
+func TestProofOfStake_Seal(t *testing.T) {
+
+	first, second, other := newTestAccount(), newTestAccount(), newTestAccount()
+	state := newStakedState(map[string]coin.Amount{first.address: coin.Coins(3), second.address: coin.Coins(1)})
+	ranking, _ := NewProofOfStake(nil, nil).Ranking(3, state)
+	accounts := map[string]*testAccount{first.address: first, second.address: second}
+	inTurn, backup := accounts[ranking[0]], accounts[ranking[1]]
+	verifier := NewProofOfStake(nil, nil)
+	// The timeouts of the rounds of the block that follows the parent already passed.
+	parent := &BlockHeader{number: 2, timestamp: time.Now().Add(-time.Minute).UnixNano()}
+
+	tests := map[string]struct {
+		account *testAccount
+		// tamper - Changes the sealed header before it is verified.
+		tamper     func(h *BlockHeader)
+		wantSeal   error
+		wantRound  int
+		wantVerify error
+	}{
+		"should seal the block of the proposer in turn in the round 0": {
+			account: inTurn,
+		},
+		"should seal the block of the backup proposer in the round 1 when the proposer in turn is silent": {
+			account:   backup,
+			wantRound: 1,
+		},
+		"should not seal the block of an address without stake": {
+			account:  other,
+			wantSeal: ErrNotInTurn,
+		},
+		"should not verify a block of the proposer of another round": {
+			account: inTurn,
+			tamper: func(h *BlockHeader) {
+				h.nonce = 1
+				h.seal, _ = signHeader(inTurn.privateKey, h)
+			},
+			wantVerify: ErrInvalidSeal,
+		},
+		"should not verify a round after the last proposer": {
+			account:   backup,
+			wantRound: 1,
+			tamper: func(h *BlockHeader) {
+				h.nonce = 2
+				h.seal, _ = signHeader(backup.privateKey, h)
+			},
+			wantVerify: ErrInvalidSeal,
+		},
+		"should not verify a block signed by an address without stake": {
+			account: inTurn,
+			tamper: func(h *BlockHeader) {
+				h.seal, _ = signHeader(other.privateKey, h)
+			},
+			wantVerify: ErrInvalidSeal,
+		},
+		"should not verify a block of a backup proposer signed before its round started": {
+			account:   backup,
+			wantRound: 1,
+			tamper: func(h *BlockHeader) {
+				h.timestamp = parent.timestamp + int64(ROUND_TIMEOUT) - 1
+				h.seal, _ = signHeader(backup.privateKey, h)
+			},
+			wantVerify: ErrRoundNotStarted,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			block := NewBlock(3, 0, [32]byte{1}, nil)
+			block.header.bits = POS_BITS
+			p := NewProofOfStake(nil, tc.account.privateKey)
+			if err := p.Seal(context.Background(), block, parent, state); !errors.Is(err, tc.wantSeal) {
+				t.Fatalf("Seal() = %v, want %v", err, tc.wantSeal)
+			}
+			if tc.wantSeal != nil {
+				return
+			}
+			if got := block.header.Round(); got != tc.wantRound {
+				t.Errorf("Seal() round = %d, want %d", got, tc.wantRound)
+			}
+			if tc.tamper != nil {
+				tc.tamper(&block.header)
+			}
+			err := verifier.VerifySeal(&block.header, parent)
+			if err == nil {
+				err = verifier.VerifyProposer(&block.header, state)
+			}
+			if !errors.Is(err, tc.wantVerify) {
+				t.Errorf("VerifySeal() and VerifyProposer() = %v, want %v", err, tc.wantVerify)
+			}
+		})
+	}
+}
+
+func TestBlockchain_ProofOfStakeSilentValidator(t *testing.T) {
+
+	signer, first, second := newTestAccount(), newTestAccount(), newTestAccount()
+	genesis := newTestGenesis()
+	genesis.Alloc = map[string]coin.Amount{first.address: coin.Coins(3), second.address: coin.Coins(3)}
+	verifier := NewProofOfStake([]string{signer.address}, nil)
+	blockchain, _ := NewBlockchain("Node 500", signer.address, genesis, verifier, NewMemoryBlockStore(),
+		LEDGER_MODE_ACCOUNT)
+
+	// The bootstrap signer includes the bonds of both validators. Its block is a minute old, the timeouts of
+	// the rounds of the next block already passed.
+	bonds := []*Transaction{
+		first.signed(NewStakingTransaction(TX_KIND_BOND, first.address, coin.Coins(2), 1654369662, 0)),
+		second.signed(NewStakingTransaction(TX_KIND_BOND, second.address, coin.Coins(1), 1654369662, 0)),
+	}
+	coinbase, _ := blockchain.CreateMinerTransaction(2, 0)
+	transactions := append(bonds, coinbase)
+	header, _ := blockchain.newBlockHeader(blockchain.LastBlock(), transactions)
+	header.timestamp = time.Now().Add(-time.Minute).UnixNano()
+	header.seal, _ = signHeader(signer.privateKey, header)
+	bonded := &Block{header: *header, transactions: transactions}
+	if err := blockchain.AddProposedBlockFromNetwork(bonded); err != nil {
+		t.Fatalf("AddProposedBlockFromNetwork() of the bonds = %v", err)
+	}
+
+	// The validator in turn for the block 3 is silent, the other one proposes it in the next round.
+	ranking, err := verifier.Ranking(3, blockchain.Ledger())
+	if err != nil || len(ranking) != 2 {
+		t.Fatalf("Ranking() = %v, %v, want the two validators", ranking, err)
+	}
+	accounts := map[string]*testAccount{first.address: first, second.address: second}
+	backup := NewProofOfStake(nil, accounts[ranking[1]].privateKey)
+	coinbase, _ = blockchain.CreateMinerTransaction(3, 0)
+	transactions = []*Transaction{coinbase}
+	header, _ = blockchain.newBlockHeader(bonded, transactions)
+	block := &Block{header: *header, transactions: transactions}
+	if err := backup.Seal(context.Background(), block, &bonded.header, blockchain.Ledger()); err != nil {
+		t.Fatalf("Seal() = %v", err)
+	}
+	if err := blockchain.AddProposedBlockFromNetwork(block); err != nil {
+		t.Fatalf("AddProposedBlockFromNetwork() of the backup proposer = %v", err)
+	}
+	if got := blockchain.LastBlock().Number(); got != 3 {
+		t.Errorf("LastBlock() = block %d, want block 3", got)
+	}
+}
+
+func TestBlockchain_ProofOfStakeProposer(t *testing.T) {
+
+	signer, other := newTestAccount(), newTestAccount()
+
+	tests := map[string]struct {
+		account *testAccount
+		want    error
+	}{
+		"should add the block of the proposer": {
+			account: signer,
+		},
+		"should not add the block of another address": {
+			account: other,
+			want:    ErrInvalidSeal,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			blockchain, _ := NewBlockchain("Node 500", tc.account.address, newTestGenesis(),
+				NewProofOfStake([]string{signer.address}, nil), NewMemoryBlockStore(), LEDGER_MODE_ACCOUNT)
+			coinbase, _ := blockchain.CreateMinerTransaction(2, 0)
+			transactions := []*Transaction{coinbase}
+			header, _ := blockchain.newBlockHeader(blockchain.LastBlock(), transactions)
+			header.seal, _ = signHeader(tc.account.privateKey, header)
+
+			err := blockchain.AddProposedBlockFromNetwork(&Block{header: *header, transactions: transactions})
+			if !errors.Is(err, tc.want) {
+				t.Errorf("AddProposedBlockFromNetwork() = %v, want %v", err, tc.want)
+			}
+		})
+	}
+}
+
+func TestState_Slash(t *testing.T) {
+
+	validator, reporter, other := newTestAccount(), newTestAccount(), newTestAccount()
+	// signed - Returns the header of the block with the number that follows the parent, with the timestamp,
+	// signed by the account.
+	signed := func(account *testAccount, number int64, parent [32]byte, timestamp int64) *BlockHeader {
+		header := &BlockHeader{number: number, previousHash: parent, timestamp: timestamp, bits: POS_BITS}
+		header.seal, _ = signHeader(account.privateKey, header)
+		return header
+	}
+
+	tests := map[string]struct {
+		// evidence - Returns the evidence, hashes are the hashes of the blocks of the state by number.
+		evidence func(hashes map[int64][32]byte) *Evidence
+		want     error
+	}{
+		"should slash the validator that signed two blocks with the same number": {
+			evidence: func(hashes map[int64][32]byte) *Evidence {
+				return NewEvidence(signed(validator, 3, hashes[2], 1), signed(validator, 3, hashes[2], 2))
+			},
+		},
+		"should not slash for the same header twice": {
+			evidence: func(hashes map[int64][32]byte) *Evidence {
+				return NewEvidence(signed(validator, 3, hashes[2], 1), signed(validator, 3, hashes[2], 1))
+			},
+			want: ErrInvalidEvidence,
+		},
+		"should not slash for blocks with different numbers": {
+			evidence: func(hashes map[int64][32]byte) *Evidence {
+				return NewEvidence(signed(validator, 3, hashes[2], 1), signed(validator, 4, hashes[2], 2))
+			},
+			want: ErrInvalidEvidence,
+		},
+		"should not slash for blocks signed by different addresses": {
+			evidence: func(hashes map[int64][32]byte) *Evidence {
+				return NewEvidence(signed(validator, 3, hashes[2], 1), signed(reporter, 3, hashes[2], 2))
+			},
+			want: ErrInvalidEvidence,
+		},
+		"should not slash an address without stake": {
+			evidence: func(hashes map[int64][32]byte) *Evidence {
+				return NewEvidence(signed(other, 3, hashes[2], 1), signed(other, 3, hashes[2], 2))
+			},
+			want: ErrNothingToSlash,
+		},
+		"should not slash for blocks of another chain": {
+			evidence: func(hashes map[int64][32]byte) *Evidence {
+				return NewEvidence(signed(validator, 3, [32]byte{9}, 1), signed(validator, 3, [32]byte{9}, 2))
+			},
+			want: ErrEvidenceOtherChain,
+		},
+		"should not slash for blocks after the chain": {
+			evidence: func(hashes map[int64][32]byte) *Evidence {
+				return NewEvidence(signed(validator, 5, hashes[2], 1), signed(validator, 5, hashes[2], 2))
+			},
+			want: ErrEvidenceOtherChain,
+		},
+		"should not slash an address that was not a validator at the number of the blocks": {
+			evidence: func(hashes map[int64][32]byte) *Evidence {
+				return NewEvidence(signed(validator, 2, hashes[1], 1), signed(validator, 2, hashes[1], 2))
+			},
+			want: ErrNotValidator,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			state := newStakedState(map[string]coin.Amount{
+				validator.address: coin.Coins(5),
+				reporter.address:  coin.Coins(1),
+			})
+			evidence, err := ParseEvidence(tc.evidence(state.hashes).Bytes())
+			if err != nil {
+				t.Fatalf("ParseEvidence() = %v", err)
+			}
+			report := NewEvidenceTransaction(reporter.address, evidence, 1654369662, 1)
+			block := NewBlock(3, 0, [32]byte{2}, []*Transaction{report})
+
+			if err := state.ApplyBlock(block); !errors.Is(err, tc.want) {
+				t.Fatalf("ApplyBlock() = %v, want %v", err, tc.want)
+			}
+			wantStake := coin.Coins(5)
+			if tc.want == nil {
+				wantStake = 0
+			}
+			if got := state.Account(validator.address).Stake; got != wantStake {
+				t.Errorf("Stake = %v, want %v", got, wantStake)
+			}
+		})
+	}
+}
+
+func TestState_SlashOnce(t *testing.T) {
+
+	validator, reporter := newTestAccount(), newTestAccount()
+	state := newStakedState(map[string]coin.Amount{
+		validator.address: coin.Coins(5),
+		reporter.address:  coin.Coins(1),
+	})
+	headers := make([]*BlockHeader, 2)
+	for i := range headers {
+		headers[i] = &BlockHeader{number: 3, previousHash: state.hashes[2], timestamp: int64(i), bits: POS_BITS}
+		headers[i].seal, _ = signHeader(validator.privateKey, headers[i])
+	}
+	evidence := NewEvidence(headers[0], headers[1])
+
+	// The validator is slashed and earns new coins, that it bonds again.
+	reward := NewTransaction("THE BLOCKCHAIN", validator.address, coin.Coins(2), 1654369662,
+		[]*TxInput{NewCoinbaseInput(3)}, []*TxOutput{NewTxOutput(validator.address, coin.Coins(2))})
+	slashing := NewBlock(3, 0, [32]byte{2}, []*Transaction{
+		NewEvidenceTransaction(reporter.address, evidence, 1654369662, 1), reward})
+	if err := state.ApplyBlock(slashing); err != nil {
+		t.Fatalf("ApplyBlock() = %v", err)
+	}
+	bond := NewBlock(4, 0, [32]byte{3}, []*Transaction{
+		NewStakingTransaction(TX_KIND_BOND, validator.address, coin.Coins(2), 1654369662, 1)})
+	if err := state.ApplyBlock(bond); err != nil {
+		t.Fatalf("ApplyBlock() = %v", err)
+	}
+
+	again := NewBlock(5, 0, [32]byte{4}, []*Transaction{
+		NewEvidenceTransaction(reporter.address, evidence, 1654369663, 2)})
+	if err := state.ApplyBlock(again); !errors.Is(err, ErrEvidenceUsed) {
+		t.Fatalf("ApplyBlock() = %v, want %v", err, ErrEvidenceUsed)
+	}
+	if got := state.Account(validator.address).Stake; got != coin.Coins(2) {
+		t.Errorf("Stake = %v, want %v", got, coin.Coins(2))
+	}
+
+	// Once the slashing block is rolled back the evidence can be used again.
+	for _, b := range []*Block{bond, slashing} {
+		if err := state.RevertBlock(b); err != nil {
+			t.Fatalf("RevertBlock() = %v", err)
+		}
+	}
+	if err := state.ApplyBlock(slashing); err != nil {
+		t.Errorf("ApplyBlock() after the revert = %v", err)
+	}
+}
+
+func TestState_SlashPruned(t *testing.T) {
+
+	validator, reporter := newTestAccount(), newTestAccount()
+
+	tests := map[string]struct {
+		pruned int64
+		want   error
+	}{
+		"should slash while the block before the headers can be rolled back to": {
+			pruned: 2,
+		},
+		"should reject evidence older than the pruned blocks": {
+			pruned: 3,
+			want:   ErrEvidenceTooOld,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			state := newStakedState(map[string]coin.Amount{
+				validator.address: coin.Coins(5),
+				reporter.address:  coin.Coins(1),
+			})
+			headers := make([]*BlockHeader, 2)
+			for i := range headers {
+				headers[i] = &BlockHeader{number: 3, previousHash: state.hashes[2], timestamp: int64(i), bits: POS_BITS}
+				headers[i].seal, _ = signHeader(validator.privateKey, headers[i])
+			}
+			for _, b := range []*Block{NewBlock(3, 0, [32]byte{2}, nil), NewBlock(4, 0, [32]byte{3}, nil)} {
+				if err := state.ApplyBlock(b); err != nil {
+					t.Fatalf("ApplyBlock() = %v", err)
+				}
+			}
+
+			state.Prune(tc.pruned)
+			evidence := NewEvidenceTransaction(reporter.address, NewEvidence(headers[0], headers[1]), 1654369662, 1)
+			if err := state.NewView().ApplyTransaction(evidence); !errors.Is(err, tc.want) {
+				t.Errorf("ApplyTransaction() = %v, want %v", err, tc.want)
+			}
+		})
+	}
+}
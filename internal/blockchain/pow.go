@@ -0,0 +1,176 @@
+package blockchain
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"math/big"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// POW_CHECK_INTERVAL - How many hashes a proof of work worker computes between two checks of the
+	// cancellation.
+	POW_CHECK_INTERVAL = 1024
+)
+
+// ProofOfWork - Consensus where the hash of the header must meet the target of its bits. The target
+// follows the time between blocks (see DifficultyRules) and the seal is the nonce of the header.
+type ProofOfWork struct {
+	genesisBits uint32
+	rules       DifficultyRules
+	// workers - Number of goroutines that look for the nonce in parallel.
+	workers int
+	// maxNonce - Last nonce the workers try before they change the extra nonce of the coinbase.
+	maxNonce int
+	// hashrate - Hashes per second of the last proof of work.
+	hashrate    float64
+	hashrateMux sync.Mutex
+}
+
+// NewProofOfWork - Returns the proof of work engine.
+// The difficulty, in leading zero hex digits, is the difficulty of the genesis block, the rules adjust
+// it for the next blocks. The nonce is looked for by the number of workers, zero workers use one per CPU.
+func NewProofOfWork(difficulty int, rules DifficultyRules, workers int) (*ProofOfWork, error) {
+	bits, err := DifficultyToBits(difficulty)
+	if err != nil {
+		return nil, err
+	}
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	return &ProofOfWork{
+		genesisBits: bits,
+		rules:       rules.withDefaults(),
+		workers:     workers,
+		maxNonce:    math.MaxInt64,
+	}, nil
+}
+
+func (p *ProofOfWork) GenesisBits() uint32 {
+	return p.genesisBits
+}
+
+// NextBits - Returns the bits of the block that follows the parent.
+// The target is the one of the parent, except every Window blocks, when it is adjusted with the time
+// the last Window blocks took. The first window starts at block 2: the timestamp of the genesis block is
+// set by the genesis, long before the network starts, and it would always ease the first retarget.
+func (p *ProofOfWork) NextBits(parent *BlockHeader, round int, headerAt HeaderByNumber) (uint32, error) {
+	bits := parent.bits
+	window := p.rules.Window
+	if parent.Number() < window+2 || (parent.Number()-2)%window != 0 {
+		return bits, nil
+	}
+
+	first, err := headerAt(parent.Number() - window)
+	if err != nil {
+		return 0, fmt.Errorf("reading the first block of the difficulty window: %w", err)
+	}
+	elapsed := time.Duration(parent.Timestamp() - first.Timestamp())
+	return p.rules.retarget(bits, elapsed), nil
+}
+
+// VerifySeal - Verifies the hash of the header meets its target. Proof of work headers have no other seal.
+func (p *ProofOfWork) VerifySeal(header *BlockHeader, parent *BlockHeader) error {
+	if len(header.seal) != 0 {
+		return fmt.Errorf("%w: proof of work blocks are not signed", ErrInvalidSeal)
+	}
+	if !header.meetsTarget() {
+		return ErrInvalidProof
+	}
+	return nil
+}
+
+// VerifyProposer - Anyone can mine a proof of work block.
+func (p *ProofOfWork) VerifyProposer(header *BlockHeader, state Ledger) error {
+	return nil
+}
+
+// Seal - Looks for the nonce that makes the hash of the header meet its target.
+// Only the header is hashed, so the cost does not depend on the number of transactions.
+// The workers split the nonces between them. When every nonce was tried, the extra nonce of the coinbase,
+// the last transaction, is incremented: it changes the merkle root and the search starts again.
+func (p *ProofOfWork) Seal(ctx context.Context, block *Block, parent *BlockHeader, state Ledger) error {
+	header := &block.header
+	log.Printf(">>> Starting Proof of Work for block %d with %d workers", header.number, p.workers)
+	target := header.Target()
+	start := time.Now()
+	var hashes uint64
+	defer func() {
+		elapsed := time.Since(start).Seconds()
+		if elapsed > 0 {
+			p.hashrateMux.Lock()
+			p.hashrate = float64(hashes) / elapsed
+			p.hashrateMux.Unlock()
+		}
+	}()
+
+	for {
+		nonce, found := p.searchNonce(ctx, *header, target, &hashes)
+		if found {
+			header.nonce = nonce
+			return nil
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if len(block.transactions) == 0 {
+			return fmt.Errorf("no nonce meets the target of block %d", header.number)
+		}
+		coinbase := block.transactions[len(block.transactions)-1]
+		coinbase.nonce++
+		header.merkleRoot = computeMerkleRoot(block.transactions)
+		log.Printf(">>> Every nonce was tried, extra nonce is now %d", coinbase.nonce)
+	}
+}
+
+// searchNonce - Tries the nonces from 0 to maxNonce in parallel, worker i tries the nonces i, i + workers,
+// i + 2 * workers and so on. The first nonce found stops the other workers.
+// Returns false if no nonce meets the target or the context is cancelled.
+func (p *ProofOfWork) searchNonce(ctx context.Context, header BlockHeader, target *big.Int, hashes *uint64) (int, bool) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	found := make(chan int, p.workers)
+	wg := sync.WaitGroup{}
+	for w := 0; w < p.workers; w++ {
+		wg.Add(1)
+		go func(first int) {
+			defer wg.Done()
+			guess := header
+			count := uint64(0)
+			defer func() { atomic.AddUint64(hashes, count) }()
+			for nonce := first; nonce <= p.maxNonce; nonce += p.workers {
+				if count%POW_CHECK_INTERVAL == 0 && ctx.Err() != nil {
+					return
+				}
+				guess.nonce = nonce
+				count++
+				if hashMeetsTarget(guess.Hash(), target) {
+					found <- nonce
+					cancel()
+					return
+				}
+				if nonce > p.maxNonce-p.workers {
+					return
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	close(found)
+
+	nonce, ok := <-found
+	return nonce, ok
+}
+
+// Hashrate - Returns the hashes per second of the last proof of work.
+func (p *ProofOfWork) Hashrate() float64 {
+	p.hashrateMux.Lock()
+	defer p.hashrateMux.Unlock()
+	return p.hashrate
+}
@@ -0,0 +1,145 @@
+package blockchain
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+	"time"
+)
+
+// newTestProofOfWork - Returns a proof of work engine with one worker and the default difficulty rules.
+func newTestProofOfWork(difficulty int) *ProofOfWork {
+	p, err := NewProofOfWork(difficulty, DifficultyRules{}, 1)
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
+
+func TestProofOfWork_NextBits(t *testing.T) {
+
+	pow, _ := NewProofOfWork(1, DifficultyRules{TargetInterval: 10 * time.Second, Window: 4}, 1)
+	bits := uint32(0x1f100000)
+
+	tests := map[string]struct {
+		chain []*Block
+		want  uint32
+	}{
+		"should keep the bits of the parent inside the first window": {
+			chain: newTimedChain(5, bits, time.Second),
+			want:  bits,
+		},
+		"should adjust the bits when the window ends": {
+			chain: newTimedChain(6, bits, 5*time.Second),
+			want:  0x1f080000,
+		},
+		"should keep the bits of the parent inside the next windows": {
+			chain: newTimedChain(8, bits, time.Second),
+			want:  bits,
+		},
+		"should adjust the bits every window": {
+			chain: newTimedChain(10, bits, 20*time.Second),
+			want:  0x1f200000,
+		},
+		"should leave the genesis block out of the first window": {
+			chain: func() []*Block {
+				chain := newTimedChain(6, bits, 10*time.Second)
+				chain[0].header.timestamp -= int64(365 * 24 * time.Hour)
+				return chain
+			}(),
+			want: bits,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			parent := tc.chain[len(tc.chain)-1]
+			got, err := pow.NextBits(&parent.header, 0, chainHeader(tc.chain))
+			if err != nil {
+				t.Fatalf("NextBits() = %v", err)
+			}
+			if got != tc.want {
+				t.Errorf("NextBits() = %08x, want %08x", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestProofOfWork_Seal(t *testing.T) {
+
+	blockchain, _ := NewBlockchain("a node name", "a node address", newTestGenesis(), newTestProofOfWork(2), NewMemoryBlockStore(), LEDGER_MODE_UTXO)
+
+	tests := map[string]struct {
+		workers  int
+		maxNonce int
+		cancel   bool
+		want     bool
+		// wantExtraNonce - The coinbase must have a new extra nonce.
+		wantExtraNonce bool
+	}{
+		"should find the nonce with one worker": {
+			workers:  1,
+			maxNonce: math.MaxInt64,
+			want:     true,
+		},
+		"should find the nonce with several workers": {
+			workers:  4,
+			maxNonce: math.MaxInt64,
+			want:     true,
+		},
+		"should change the extra nonce of the coinbase when every nonce was tried": {
+			workers:        2,
+			maxNonce:       1,
+			want:           true,
+			wantExtraNonce: true,
+		},
+		"should stop when the mining is cancelled": {
+			workers:  4,
+			maxNonce: math.MaxInt64,
+			cancel:   true,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			coinbase, _ := blockchain.CreateMinerTransaction(2, 0)
+			coinbase.timestamp = 1654369662
+			transactions := []*Transaction{coinbase}
+			header, _ := blockchain.newBlockHeader(blockchain.LastBlock(), transactions)
+			header.timestamp = 1654369662
+			p := &ProofOfWork{workers: tc.workers, maxNonce: tc.maxNonce}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			if tc.cancel {
+				cancel()
+			}
+			defer cancel()
+
+			block := &Block{header: *header, transactions: transactions}
+			err := p.Seal(ctx, block, nil, nil)
+			if !tc.want {
+				if !errors.Is(err, context.Canceled) {
+					t.Fatalf("Seal() = %v, want %v", err, context.Canceled)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Seal() = %v", err)
+			}
+			header = &block.header
+			if !header.meetsTarget() {
+				t.Errorf("Seal() nonce %d does not meet the target", header.nonce)
+			}
+			if header.merkleRoot != computeMerkleRoot(transactions) {
+				t.Errorf("Seal() merkle root does not match the transactions")
+			}
+			if got := coinbase.nonce > 0; got != tc.wantExtraNonce {
+				t.Errorf("coinbase extra nonce = %d, want a new one: %v", coinbase.nonce, tc.wantExtraNonce)
+			}
+			if p.Hashrate() <= 0 {
+				t.Errorf("Hashrate() = %v, want more than 0", p.Hashrate())
+			}
+		})
+	}
+}
@@ -0,0 +1,481 @@
+package blockchain
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/martinsaporiti/blockchain-sample/internal/coin"
+)
+
+const (
+	// UNBONDING_BLOCKS - Blocks the unbonded coins wait before they go back to the balance. Until then they
+	// can still be slashed.
+	UNBONDING_BLOCKS = 10
+)
+
+var (
+	ErrInvalidValue       = errors.New("transaction value must be positive")
+	ErrUnexpectedOutputs  = errors.New("account transactions do not spend or create outputs")
+	ErrNonceReused        = errors.New("transaction nonce was already used")
+	ErrNonceGap           = errors.New("transaction nonce is ahead of the sender nonce")
+	ErrInsufficientFunds  = errors.New("transaction would drive the sender balance negative")
+	ErrUnexpectedData     = errors.New("only evidence transactions carry data")
+	ErrStakeRecipient     = errors.New("staking transactions must have the sender as recipient")
+	ErrInsufficientStake  = errors.New("transaction unbonds more than the stake of the sender")
+	ErrEvidenceValue      = errors.New("evidence transactions do not move value")
+	ErrNothingToSlash     = errors.New("the offender of the evidence has no stake")
+	ErrEvidenceUsed       = errors.New("the evidence was already used to slash the offender")
+	ErrEvidenceOtherChain = errors.New("the headers of the evidence do not extend a block of this chain")
+	ErrNotValidator       = errors.New("the offender of the evidence was not a validator at the number of the headers")
+	ErrEvidenceTooOld     = errors.New("the headers of the evidence are older than the final blocks")
+)
+
+// Account - Balance of a blockchain address, the nonce its next transaction must use and its stake.
+type Account struct {
+	Balance coin.Amount
+	Nonce   uint64
+	// Stake - Coins bonded by the address, with enough of them it is a validator of proof of stake.
+	Stake coin.Amount
+	// Unbonding - Coins unbonded that go back to the balance with the block number UnbondingRelease.
+	// Every unbond restarts the wait of all the unbonding coins, the ones already waiting included.
+	Unbonding        coin.Amount
+	UnbondingRelease int64
+}
+
+// State - Account based ledger. Maps every blockchain address to its balance, nonce and stake.
+// It is advanced block by block and keeps, for every block applied that is not final, the previous value
+// of the accounts it modified and the evidence it used so the block can be rolled back.
+type State struct {
+	accounts map[string]Account
+	undo     map[[32]byte]*blockUndo
+	// stakers - Addresses with stake or unbonding coins.
+	stakers map[string]bool
+	// hashes - Hashes of the blocks applied from the last pruned one, by number.
+	hashes map[int64][32]byte
+	// slashed - Evidence already used, it can not slash the offender again.
+	slashed map[evidenceKey]bool
+	// pruned - Number of the last block that can no longer be rolled back.
+	pruned int64
+	// number - Number of the last block applied.
+	number int64
+	mux    sync.RWMutex
+}
+
+// blockUndo - What a block changed in the state: the previous value of the accounts it modified and the
+// evidence it used.
+type blockUndo struct {
+	number   int64
+	accounts map[string]Account
+	evidence []evidenceKey
+}
+
+// evidenceKey - Identifies the evidence of a double signature: a validator can be slashed once for every
+// block number.
+type evidenceKey struct {
+	offender string
+	number   int64
+}
+
+func NewState() *State {
+	return &State{
+		accounts: make(map[string]Account),
+		undo:     make(map[[32]byte]*blockUndo),
+		stakers:  make(map[string]bool),
+		hashes:   make(map[int64][32]byte),
+		slashed:  make(map[evidenceKey]bool),
+	}
+}
+
+// Account - Returns the account of a blockchain address.
+func (s *State) Account(blockchainAddress string) Account {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+	return s.accounts[blockchainAddress]
+}
+
+func (s *State) Balance(blockchainAddress string) coin.Amount {
+	return s.Account(blockchainAddress).Balance
+}
+
+func (s *State) Nonce(blockchainAddress string) uint64 {
+	return s.Account(blockchainAddress).Nonce
+}
+
+// Validators - Returns the addresses with at least MIN_VALIDATOR_STAKE bonded, ordered by address.
+func (s *State) Validators() []Validator {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+	validators := make([]Validator, 0, len(s.stakers))
+	for address := range s.stakers {
+		if stake := s.accounts[address].Stake; stake >= MIN_VALIDATOR_STAKE {
+			validators = append(validators, Validator{Address: address, Stake: stake})
+		}
+	}
+	sort.Slice(validators, func(i, j int) bool {
+		return validators[i].Address < validators[j].Address
+	})
+	return validators
+}
+
+// stateView - Accounts modified and evidence used on top of a state, for the block number.
+type stateView struct {
+	state    *State
+	modified map[string]Account
+	slashed  []evidenceKey
+	number   int64
+}
+
+// NewView - Returns a view of the state for the next block. The state must not be modified while the
+// view is used.
+func (s *State) NewView() LedgerView {
+	s.mux.RLock()
+	number := s.number + 1
+	s.mux.RUnlock()
+	return s.newView(number)
+}
+
+// newView - Returns a view of the state for the block number. The unbonding coins released by that block
+// are already back in the balance of their accounts.
+func (s *State) newView(number int64) *stateView {
+	v := &stateView{state: s, modified: make(map[string]Account), number: number}
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+	for address := range s.stakers {
+		a := s.accounts[address]
+		if a.Unbonding == 0 || a.UnbondingRelease > number {
+			continue
+		}
+		balance, err := a.Balance.Add(a.Unbonding)
+		if err != nil {
+			continue
+		}
+		a.Balance, a.Unbonding, a.UnbondingRelease = balance, 0, 0
+		v.modified[address] = a
+	}
+	return v
+}
+
+func (v *stateView) account(blockchainAddress string) Account {
+	if a, ok := v.modified[blockchainAddress]; ok {
+		return a
+	}
+	return v.state.Account(blockchainAddress)
+}
+
+func (v *stateView) Balance(blockchainAddress string) coin.Amount {
+	return v.account(blockchainAddress).Balance
+}
+
+// ApplyTransaction - Applies the transaction and increments the sender nonce. The sender also pays the
+// fee, that the coinbase of the block collects. The coinbase credits its outputs.
+// Transfers move the value from the sender to the recipient, bonds move it from the balance of the sender
+// to its stake and unbonds from the stake back to the balance, after UNBONDING_BLOCKS blocks. Evidence
+// slashes the stake of the validator that signed two blocks with the same number.
+func (v *stateView) ApplyTransaction(t *Transaction) error {
+	if t.IsCoinbase() {
+		if t.kind != TX_KIND_TRANSFER || len(t.data) != 0 {
+			return fmt.Errorf("%w: %s coinbase", ErrUnsupportedTxKind, t.kind)
+		}
+		if err := checkOutputs(t); err != nil {
+			return err
+		}
+		for _, out := range t.outputs {
+			a := v.account(out.blockchainAddress)
+			balance, err := a.Balance.Add(out.value)
+			if err != nil {
+				return err
+			}
+			a.Balance = balance
+			v.modified[out.blockchainAddress] = a
+		}
+		return nil
+	}
+
+	if len(t.inputs) != 0 || len(t.outputs) != 0 {
+		return ErrUnexpectedOutputs
+	}
+	if t.kind == TX_KIND_EVIDENCE {
+		if t.value != 0 {
+			return ErrEvidenceValue
+		}
+	} else {
+		if t.value <= 0 {
+			return ErrInvalidValue
+		}
+		if len(t.data) != 0 {
+			return ErrUnexpectedData
+		}
+	}
+	if t.fee < 0 {
+		return ErrInvalidFee
+	}
+
+	sender := v.account(t.senderBlockchainAddress)
+	if t.nonce < sender.Nonce {
+		return fmt.Errorf("%w: %d, expected %d", ErrNonceReused, t.nonce, sender.Nonce)
+	}
+	if t.nonce > sender.Nonce {
+		return fmt.Errorf("%w: %d, expected %d", ErrNonceGap, t.nonce, sender.Nonce)
+	}
+
+	switch t.kind {
+	case TX_KIND_TRANSFER:
+		return v.transfer(t, sender)
+	case TX_KIND_BOND:
+		return v.bond(t, sender)
+	case TX_KIND_UNBOND:
+		return v.unbond(t, sender)
+	case TX_KIND_EVIDENCE:
+		return v.slash(t, sender)
+	default:
+		return fmt.Errorf("%w: %s", ErrUnknownTxKind, t.kind)
+	}
+}
+
+func (v *stateView) transfer(t *Transaction, sender Account) error {
+	cost, err := t.value.Add(t.fee)
+	if err != nil {
+		return err
+	}
+	if sender.Balance < cost {
+		return ErrInsufficientFunds
+	}
+
+	sender.Balance -= cost
+	sender.Nonce++
+	v.modified[t.senderBlockchainAddress] = sender
+
+	recipient := v.account(t.recipientBlockchainAddress)
+	balance, err := recipient.Balance.Add(t.value)
+	if err != nil {
+		return err
+	}
+	recipient.Balance = balance
+	v.modified[t.recipientBlockchainAddress] = recipient
+	return nil
+}
+
+func (v *stateView) bond(t *Transaction, sender Account) error {
+	if t.recipientBlockchainAddress != t.senderBlockchainAddress {
+		return ErrStakeRecipient
+	}
+	cost, err := t.value.Add(t.fee)
+	if err != nil {
+		return err
+	}
+	if sender.Balance < cost {
+		return ErrInsufficientFunds
+	}
+	stake, err := sender.Stake.Add(t.value)
+	if err != nil {
+		return err
+	}
+
+	sender.Balance -= cost
+	sender.Stake = stake
+	sender.Nonce++
+	v.modified[t.senderBlockchainAddress] = sender
+	return nil
+}
+
+// unbond - Moves the value from the stake of the sender to its unbonding coins. All of them are released
+// UNBONDING_BLOCKS blocks after this one, the ones of previous unbonds too.
+func (v *stateView) unbond(t *Transaction, sender Account) error {
+	if t.recipientBlockchainAddress != t.senderBlockchainAddress {
+		return ErrStakeRecipient
+	}
+	if sender.Stake < t.value {
+		return ErrInsufficientStake
+	}
+	if sender.Balance < t.fee {
+		return ErrInsufficientFunds
+	}
+	unbonding, err := sender.Unbonding.Add(t.value)
+	if err != nil {
+		return err
+	}
+
+	sender.Balance -= t.fee
+	sender.Stake -= t.value
+	sender.Unbonding = unbonding
+	sender.UnbondingRelease = v.number + UNBONDING_BLOCKS
+	sender.Nonce++
+	v.modified[t.senderBlockchainAddress] = sender
+	return nil
+}
+
+// slash - Burns the stake and the unbonding coins of the offender of the evidence. The reporter, the
+// sender, pays the fee.
+func (v *stateView) slash(t *Transaction, sender Account) error {
+	evidence, err := ParseEvidence(t.data)
+	if err != nil {
+		return err
+	}
+	address, err := evidence.Offender()
+	if err != nil {
+		return err
+	}
+	if offender := v.account(address); offender.Stake == 0 && offender.Unbonding == 0 {
+		return fmt.Errorf("%w: %s", ErrNothingToSlash, address)
+	}
+	key, err := v.verifyEvidence(evidence, address)
+	if err != nil {
+		return err
+	}
+	if sender.Balance < t.fee {
+		return ErrInsufficientFunds
+	}
+
+	sender.Balance -= t.fee
+	sender.Nonce++
+	v.modified[t.senderBlockchainAddress] = sender
+
+	// The offender is read again, it can be the reporter.
+	offender := v.account(address)
+	offender.Stake, offender.Unbonding, offender.UnbondingRelease = 0, 0, 0
+	v.modified[address] = offender
+	v.slashed = append(v.slashed, key)
+	return nil
+}
+
+// verifyEvidence - Verifies the evidence belongs to this chain, one of its headers extends the block of
+// this chain before them, the offender was a validator at that block and the evidence was not used before.
+// Returns the key that marks the evidence as used.
+func (v *stateView) verifyEvidence(e *Evidence, offender string) (evidenceKey, error) {
+	key := evidenceKey{offender: offender, number: e.Number()}
+	for _, k := range v.slashed {
+		if k == key {
+			return key, fmt.Errorf("%w: %s at block %d", ErrEvidenceUsed, offender, key.number)
+		}
+	}
+
+	s := v.state
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+	if s.slashed[key] {
+		return key, fmt.Errorf("%w: %s at block %d", ErrEvidenceUsed, offender, key.number)
+	}
+	// The stake of the offender can only be known while the blocks after the headers can be rolled back.
+	if key.number-1 < s.pruned {
+		return key, fmt.Errorf("%w: block %d", ErrEvidenceTooOld, key.number)
+	}
+	parent, ok := s.hashes[key.number-1]
+	if !ok || !e.Extends(parent) {
+		return key, fmt.Errorf("%w: block %d", ErrEvidenceOtherChain, key.number)
+	}
+	if stake := s.accountAfter(offender, key.number-1).Stake; stake < MIN_VALIDATOR_STAKE {
+		return key, fmt.Errorf("%w: %s", ErrNotValidator, offender)
+	}
+	return key, nil
+}
+
+// accountAfter - Returns the account of the address as it was after the block with the number, rolling
+// back the blocks applied after it. The caller must hold the lock.
+func (s *State) accountAfter(address string, number int64) Account {
+	a := s.accounts[address]
+	for n := s.number; n > number; n-- {
+		undo, ok := s.undo[s.hashes[n]]
+		if !ok {
+			break
+		}
+		if previous, ok := undo.accounts[address]; ok {
+			a = previous
+		}
+	}
+	return a
+}
+
+// ApplyBlock - Applies the state transitions of every transaction of the block.
+// If any transaction is not valid, the state is not modified and the error is returned.
+func (s *State) ApplyBlock(b *Block) error {
+	view := s.newView(b.Number())
+	for _, t := range b.transactions {
+		if err := view.ApplyTransaction(t); err != nil {
+			return err
+		}
+	}
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	undo := &blockUndo{number: b.Number(), accounts: make(map[string]Account, len(view.modified)),
+		evidence: view.slashed}
+	for address, a := range view.modified {
+		undo.accounts[address] = s.accounts[address]
+		s.accounts[address] = a
+		s.updateStaker(address, a)
+	}
+	for _, key := range view.slashed {
+		s.slashed[key] = true
+	}
+	hash := b.Hash()
+	s.undo[hash] = undo
+	s.hashes[b.Number()] = hash
+	s.number = b.Number()
+	return nil
+}
+
+// RevertBlock - Rolls back a block applied with ApplyBlock.
+// The block must be the last block applied.
+func (s *State) RevertBlock(b *Block) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	hash := b.Hash()
+	undo, ok := s.undo[hash]
+	if !ok {
+		return fmt.Errorf("block %d was not applied", b.Number())
+	}
+	for address, a := range undo.accounts {
+		s.updateStaker(address, a)
+		if a == (Account{}) {
+			delete(s.accounts, address)
+			continue
+		}
+		s.accounts[address] = a
+	}
+	for _, key := range undo.evidence {
+		delete(s.slashed, key)
+	}
+	delete(s.undo, hash)
+	delete(s.hashes, b.Number())
+	s.number = b.Number() - 1
+	return nil
+}
+
+// Prune - Forgets how to roll back the blocks up to the number. The hash of the last one is kept, the
+// evidence of the next block still needs it, and the evidence older than it is forgotten too: it is
+// rejected anyway.
+func (s *State) Prune(number int64) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if number <= s.pruned {
+		return
+	}
+	for hash, undo := range s.undo {
+		if undo.number <= number {
+			delete(s.undo, hash)
+		}
+	}
+	for n := range s.hashes {
+		if n < number {
+			delete(s.hashes, n)
+		}
+	}
+	for key := range s.slashed {
+		if key.number-1 < number {
+			delete(s.slashed, key)
+		}
+	}
+	s.pruned = number
+}
+
+// updateStaker - Keeps the index of the addresses with stake up to date with the new account.
+func (s *State) updateStaker(address string, a Account) {
+	if a.Stake > 0 || a.Unbonding > 0 {
+		s.stakers[address] = true
+		return
+	}
+	delete(s.stakers, address)
+}
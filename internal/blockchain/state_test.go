@@ -0,0 +1,268 @@
+package blockchain
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/martinsaporiti/blockchain-sample/internal/coin"
+)
+
+// newFundedState - Returns a state where the address owns the value.
+func newFundedState(blockchainAddress string, value coin.Amount) *State {
+	coinbase := NewTransaction("THE BLOCKCHAIN", blockchainAddress, value, 1654369000,
+		[]*TxInput{NewCoinbaseInput(1)}, []*TxOutput{NewTxOutput(blockchainAddress, value)})
+	state := NewState()
+	state.ApplyBlock(NewBlock(1, 0, [32]byte{}, []*Transaction{coinbase}))
+	return state
+}
+
+func TestState_ApplyBlock(t *testing.T) {
+
+	sba := "15TZoyyxFmeTXJGjYwX1X3ARtXX94BbFrk"
+	rba := "1CHD4Jjqsak4RV5JHAdYZ9CKY1dQe4tkXW"
+	timestamp := int64(1654369662)
+
+	tests := map[string]struct {
+		transactions []*Transaction
+		want         error
+		wantSender   coin.Amount
+		wantReceiver coin.Amount
+		wantNonce    uint64
+	}{
+		"should move the value and increment the nonce": {
+			transactions: []*Transaction{
+				NewAccountTransaction(sba, rba, 30, timestamp, 0),
+				NewAccountTransaction(sba, rba, 20, timestamp, 1),
+			},
+			wantSender:   50,
+			wantReceiver: 50,
+			wantNonce:    2,
+		},
+		"should charge the fee to the sender": {
+			transactions: []*Transaction{withFee(NewAccountTransaction(sba, rba, 30, timestamp, 0), 5)},
+			wantSender:   65,
+			wantReceiver: 30,
+			wantNonce:    1,
+		},
+		"should reject a transaction whose fee drives the balance negative": {
+			transactions: []*Transaction{withFee(NewAccountTransaction(sba, rba, 100, timestamp, 0), 1)},
+			want:         ErrInsufficientFunds,
+			wantSender:   100,
+		},
+		"should reject a reused nonce": {
+			transactions: []*Transaction{
+				NewAccountTransaction(sba, rba, 30, timestamp, 0),
+				NewAccountTransaction(sba, rba, 20, timestamp+1, 0),
+			},
+			want:       ErrNonceReused,
+			wantSender: 100,
+		},
+		"should reject a nonce gap": {
+			transactions: []*Transaction{NewAccountTransaction(sba, rba, 30, timestamp, 1)},
+			want:         ErrNonceGap,
+			wantSender:   100,
+		},
+		"should reject a transaction that drives the balance negative": {
+			transactions: []*Transaction{NewAccountTransaction(sba, rba, 101, timestamp, 0)},
+			want:         ErrInsufficientFunds,
+			wantSender:   100,
+		},
+		"should reject a transaction with outputs": {
+			transactions: []*Transaction{
+				NewTransaction(sba, rba, 10, timestamp, nil, []*TxOutput{NewTxOutput(rba, 10)}),
+			},
+			want:       ErrUnexpectedOutputs,
+			wantSender: 100,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			state := newFundedState(sba, 100)
+			block := NewBlock(2, 0, [32]byte{}, tc.transactions)
+
+			err := state.ApplyBlock(block)
+			if !errors.Is(err, tc.want) {
+				t.Errorf("ApplyBlock() = %v, want %v", err, tc.want)
+			}
+			if got := state.Balance(sba); got != tc.wantSender {
+				t.Errorf("Balance() = %v, want %v", got, tc.wantSender)
+			}
+			if got := state.Balance(rba); got != tc.wantReceiver {
+				t.Errorf("Balance() = %v, want %v", got, tc.wantReceiver)
+			}
+			if got := state.Nonce(sba); got != tc.wantNonce {
+				t.Errorf("Nonce() = %v, want %v", got, tc.wantNonce)
+			}
+		})
+	}
+}
+
+func TestState_RevertBlock(t *testing.T) {
+
+	sba := "15TZoyyxFmeTXJGjYwX1X3ARtXX94BbFrk"
+	rba := "1CHD4Jjqsak4RV5JHAdYZ9CKY1dQe4tkXW"
+	state := newFundedState(sba, 100)
+	block := NewBlock(2, 0, [32]byte{}, []*Transaction{NewAccountTransaction(sba, rba, 40, 1654369662, 0)})
+
+	if err := state.ApplyBlock(block); err != nil {
+		t.Fatalf("ApplyBlock() = %v", err)
+	}
+	if err := state.RevertBlock(block); err != nil {
+		t.Fatalf("RevertBlock() = %v", err)
+	}
+
+	if got := state.Account(sba); got != (Account{Balance: 100}) {
+		t.Errorf("Account() = %v, want %v", got, Account{Balance: 100})
+	}
+	if got := state.Account(rba); got != (Account{}) {
+		t.Errorf("Account() = %v, want %v", got, Account{})
+	}
+}
+
+func TestState_ViewBalance(t *testing.T) {
+
+	sba := "15TZoyyxFmeTXJGjYwX1X3ARtXX94BbFrk"
+	rba := "1CHD4Jjqsak4RV5JHAdYZ9CKY1dQe4tkXW"
+	state := newFundedState(sba, 100)
+
+	view := state.NewView()
+	if err := view.ApplyTransaction(withFee(NewAccountTransaction(sba, rba, 30, 1654369662, 0), 5)); err != nil {
+		t.Fatalf("ApplyTransaction() = %v", err)
+	}
+	if got := view.Balance(sba); got != 65 {
+		t.Errorf("Balance() = %v, want %v", got, 65)
+	}
+	if got := view.Balance(rba); got != 30 {
+		t.Errorf("Balance() = %v, want %v", got, 30)
+	}
+	if got := state.Balance(sba); got != 100 {
+		t.Errorf("Balance() of the state = %v, want %v", got, 100)
+	}
+}
+
+func TestTransactionPool_AccountNonces(t *testing.T) {
+
+	account := newTestAccount()
+	sba := account.address
+	rba := "1CHD4Jjqsak4RV5JHAdYZ9CKY1dQe4tkXW"
+	timestamp := int64(1654369662)
+	txPool := NewTransactionPool(nil, newFundedState(sba, 100), testChainID)
+
+	if !txPool.AddAndVerifyTransaction(account.request(NewAccountTransaction(sba, rba, 10, timestamp, 0))) {
+		t.Errorf("the transaction with the sender nonce should be accepted")
+	}
+	if txPool.AddAndVerifyTransaction(account.request(NewAccountTransaction(sba, rba, 10, timestamp+1, 0))) {
+		t.Errorf("a transaction reusing a pending nonce should be rejected")
+	}
+	if txPool.AddAndVerifyTransaction(account.request(NewAccountTransaction(sba, rba, 10, timestamp, 2))) {
+		t.Errorf("a transaction skipping a nonce should be rejected")
+	}
+	if !txPool.AddAndVerifyTransaction(account.request(NewAccountTransaction(sba, rba, 10, timestamp, 1))) {
+		t.Errorf("the transaction with the next nonce should be accepted")
+	}
+	if got := txPool.Length(); got != 2 {
+		t.Errorf("Length() = %v, want %v", got, 2)
+	}
+}
+
+func TestState_Staking(t *testing.T) {
+
+	sba := "15TZoyyxFmeTXJGjYwX1X3ARtXX94BbFrk"
+	rba := "1CHD4Jjqsak4RV5JHAdYZ9CKY1dQe4tkXW"
+	timestamp := int64(1654369662)
+
+	tests := map[string]struct {
+		transactions []*Transaction
+		want         error
+		wantAccount  Account
+	}{
+		"should move the value of a bond from the balance to the stake": {
+			transactions: []*Transaction{withFee(NewStakingTransaction(TX_KIND_BOND, sba, 40, timestamp, 0), 1)},
+			wantAccount:  Account{Balance: 59, Nonce: 1, Stake: 40},
+		},
+		"should keep the unbonded value until the release block": {
+			transactions: []*Transaction{
+				NewStakingTransaction(TX_KIND_BOND, sba, 40, timestamp, 0),
+				NewStakingTransaction(TX_KIND_UNBOND, sba, 10, timestamp, 1),
+			},
+			wantAccount: Account{Balance: 60, Nonce: 2, Stake: 30, Unbonding: 10, UnbondingRelease: 2 + UNBONDING_BLOCKS},
+		},
+		"should reject a bond larger than the balance": {
+			transactions: []*Transaction{NewStakingTransaction(TX_KIND_BOND, sba, 101, timestamp, 0)},
+			want:         ErrInsufficientFunds,
+			wantAccount:  Account{Balance: 100},
+		},
+		"should reject an unbond larger than the stake": {
+			transactions: []*Transaction{
+				NewStakingTransaction(TX_KIND_BOND, sba, 40, timestamp, 0),
+				NewStakingTransaction(TX_KIND_UNBOND, sba, 41, timestamp, 1),
+			},
+			want:        ErrInsufficientStake,
+			wantAccount: Account{Balance: 100},
+		},
+		"should reject a bond to another address": {
+			transactions: []*Transaction{func() *Transaction {
+				t := NewAccountTransaction(sba, rba, 40, timestamp, 0)
+				t.kind = TX_KIND_BOND
+				return t
+			}()},
+			want:        ErrStakeRecipient,
+			wantAccount: Account{Balance: 100},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			state := newFundedState(sba, 100)
+			block := NewBlock(2, 0, [32]byte{}, tc.transactions)
+
+			if err := state.ApplyBlock(block); !errors.Is(err, tc.want) {
+				t.Errorf("ApplyBlock() = %v, want %v", err, tc.want)
+			}
+			if got := state.Account(sba); got != tc.wantAccount {
+				t.Errorf("Account() = %+v, want %+v", got, tc.wantAccount)
+			}
+		})
+	}
+}
+
+func TestState_UnbondingRelease(t *testing.T) {
+
+	sba := "15TZoyyxFmeTXJGjYwX1X3ARtXX94BbFrk"
+	state := newFundedState(sba, 100)
+	blocks := []*Block{NewBlock(2, 0, [32]byte{}, []*Transaction{
+		NewStakingTransaction(TX_KIND_BOND, sba, 40, 1654369662, 0),
+		NewStakingTransaction(TX_KIND_UNBOND, sba, 40, 1654369662, 1),
+	})}
+	for number := int64(3); number <= 2+UNBONDING_BLOCKS; number++ {
+		blocks = append(blocks, NewBlock(number, 0, [32]byte{byte(number)}, nil))
+	}
+
+	for _, b := range blocks[:len(blocks)-1] {
+		if err := state.ApplyBlock(b); err != nil {
+			t.Fatalf("ApplyBlock() = %v", err)
+		}
+	}
+	if got := state.Balance(sba); got != 60 {
+		t.Errorf("Balance() before the release block = %v, want %v", got, 60)
+	}
+	if len(state.Validators()) != 0 {
+		t.Errorf("Validators() = %v, want none", state.Validators())
+	}
+
+	last := blocks[len(blocks)-1]
+	if err := state.ApplyBlock(last); err != nil {
+		t.Fatalf("ApplyBlock() = %v", err)
+	}
+	if got := state.Account(sba); got != (Account{Balance: 100, Nonce: 2}) {
+		t.Errorf("Account() after the release block = %+v, want %+v", got, Account{Balance: 100, Nonce: 2})
+	}
+
+	if err := state.RevertBlock(last); err != nil {
+		t.Fatalf("RevertBlock() = %v", err)
+	}
+	if got := state.Account(sba).Unbonding; got != 40 {
+		t.Errorf("Unbonding after the revert = %v, want %v", got, 40)
+	}
+}
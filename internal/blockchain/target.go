@@ -0,0 +1,89 @@
+package blockchain
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+const (
+	// MIN_DIFFICULTY - The easiest difficulty, one leading zero hex digit.
+	MIN_DIFFICULTY = 1
+	// MAX_DIFFICULTY - The hardest difficulty that can be configured as leading zero hex digits.
+	MAX_DIFFICULTY = 63
+)
+
+var ErrInvalidDifficultySetting = errors.New("difficulty is out of range")
+
+var (
+	// powLimit - The easiest target a block can have.
+	powLimit = difficultyTarget(MIN_DIFFICULTY)
+	// twoTo256 - Number of possible hashes, used to compute the work of a target.
+	twoTo256 = new(big.Int).Lsh(big.NewInt(1), 256)
+)
+
+// DifficultyToBits - Converts a difficulty given as leading zero hex digits, like the MINING_DIFFICULTY
+// setting, to the compact bits of its target. A hash with that many leading zeros meets the target.
+func DifficultyToBits(zeros int) (uint32, error) {
+	if zeros < MIN_DIFFICULTY || zeros > MAX_DIFFICULTY {
+		return 0, fmt.Errorf("%w: %d, it must be between %d and %d", ErrInvalidDifficultySetting, zeros,
+			MIN_DIFFICULTY, MAX_DIFFICULTY)
+	}
+	return targetToBits(difficultyTarget(zeros)), nil
+}
+
+// difficultyTarget - Returns 2^(256-4*zeros), the target of a difficulty of leading zero hex digits.
+func difficultyTarget(zeros int) *big.Int {
+	return new(big.Int).Lsh(big.NewInt(1), uint(256-4*zeros))
+}
+
+// bitsToTarget - Expands the compact bits to the 256 bits target.
+// The first byte of the bits is the size of the target in bytes and the other three are its most
+// significant bytes. A negative target is returned as zero, no hash can meet it.
+func bitsToTarget(bits uint32) *big.Int {
+	mantissa := bits & 0x007fffff
+	size := uint(bits >> 24)
+	if bits&0x00800000 != 0 {
+		return new(big.Int)
+	}
+
+	if size <= 3 {
+		return big.NewInt(int64(mantissa >> (8 * (3 - size))))
+	}
+	target := big.NewInt(int64(mantissa))
+	return target.Lsh(target, 8*(size-3))
+}
+
+// targetToBits - Compresses the target to its compact bits, keeping its three most significant bytes.
+func targetToBits(target *big.Int) uint32 {
+	if target.Sign() <= 0 {
+		return 0
+	}
+
+	size := uint((target.BitLen() + 7) / 8)
+	var mantissa uint32
+	if size <= 3 {
+		mantissa = uint32(target.Uint64()) << (8 * (3 - size))
+	} else {
+		mantissa = uint32(new(big.Int).Rsh(target, 8*(size-3)).Uint64())
+	}
+	// The bit 0x00800000 is the sign, move the mantissa one byte to keep the target positive.
+	if mantissa&0x00800000 != 0 {
+		mantissa >>= 8
+		size++
+	}
+	return uint32(size<<24) | mantissa
+}
+
+// hashMeetsTarget - Returns true if the hash, read as a big endian integer, is not above the target.
+func hashMeetsTarget(hash [32]byte, target *big.Int) bool {
+	return new(big.Int).SetBytes(hash[:]).Cmp(target) <= 0
+}
+
+// targetWork - Returns the expected number of hashes to find one that meets the target, 2^256 / (target+1).
+func targetWork(target *big.Int) *big.Int {
+	if target.Sign() < 0 {
+		return new(big.Int)
+	}
+	return new(big.Int).Div(twoTo256, new(big.Int).Add(target, big.NewInt(1)))
+}
@@ -0,0 +1,118 @@
+package blockchain
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+)
+
+func TestDifficultyToBits(t *testing.T) {
+
+	tests := map[string]struct {
+		zeros int
+		want  uint32
+		err   error
+	}{
+		"should convert one leading zero": {
+			zeros: 1,
+			want:  0x20100000,
+		},
+		"should convert five leading zeros": {
+			zeros: 5,
+			want:  0x1e100000,
+		},
+		"should reject no leading zeros": {
+			zeros: 0,
+			err:   ErrInvalidDifficultySetting,
+		},
+		"should reject more leading zeros than the hash has": {
+			zeros: 64,
+			err:   ErrInvalidDifficultySetting,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := DifficultyToBits(tc.zeros)
+			if !errors.Is(err, tc.err) {
+				t.Fatalf("DifficultyToBits() = %v, want %v", err, tc.err)
+			}
+			if got != tc.want {
+				t.Errorf("DifficultyToBits() = %08x, want %08x", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestBitsToTarget(t *testing.T) {
+
+	tests := map[string]struct {
+		bits uint32
+		want string
+	}{
+		"should expand the bits": {
+			bits: 0x1d00ffff,
+			want: "ffff0000000000000000000000000000000000000000000000000000",
+		},
+		"should expand small targets": {
+			bits: 0x02123400,
+			want: "1234",
+		},
+		"should return zero for negative targets": {
+			bits: 0x04923456,
+			want: "0",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := bitsToTarget(tc.bits).Text(16); got != tc.want {
+				t.Errorf("bitsToTarget() = %s, want %s", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestTargetToBits(t *testing.T) {
+
+	tests := map[string]struct {
+		target string
+		want   uint32
+	}{
+		"should keep the three most significant bytes": {
+			target: "ffff0000000000000000000000000000000000000000000000000001",
+			want:   0x1d00ffff,
+		},
+		"should move the mantissa when it would be negative": {
+			target: "800000",
+			want:   0x04008000,
+		},
+		"should compress small targets": {
+			target: "1234",
+			want:   0x02123400,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			target, _ := new(big.Int).SetString(tc.target, 16)
+			if got := targetToBits(target); got != tc.want {
+				t.Errorf("targetToBits() = %08x, want %08x", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestHashMeetsTarget(t *testing.T) {
+
+	target := difficultyTarget(2)
+	if !hashMeetsTarget([32]byte{0x00, 0xff}, target) {
+		t.Errorf("hashMeetsTarget() should accept a hash with two leading zero hex digits")
+	}
+	if hashMeetsTarget([32]byte{0x01, 0x01}, target) {
+		t.Errorf("hashMeetsTarget() should reject a hash above the target")
+	}
+	if got := targetWork(target); got.Cmp(big.NewInt(255)) != 0 {
+		t.Errorf("targetWork() = %s, want %d", got, 255)
+	}
+}
@@ -1,66 +1,641 @@
 package blockchain
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"math/big"
 	"strings"
+
+	"github.com/martinsaporiti/blockchain-sample/internal/blkcrypto"
+	"github.com/martinsaporiti/blockchain-sample/internal/codec"
+	"github.com/martinsaporiti/blockchain-sample/internal/coin"
+)
+
+var (
+	ErrMissingWitness   = errors.New("transaction has no public key or signature")
+	ErrWrongSenderKey   = errors.New("transaction public key does not derive the sender address")
+	ErrInvalidSignature = errors.New("transaction signature is not valid")
+	ErrUnknownTxKind    = errors.New("unknown transaction kind")
+	ErrWrongChainID     = errors.New("transaction was signed for another chain")
+	ErrInvalidTxID      = errors.New("invalid transaction ID")
+)
+
+// TxKind - What a transaction does. Transfers move coins, the other kinds manage the stake of the
+// validators of proof of stake.
+type TxKind uint8
+
+const (
+	// TX_KIND_TRANSFER - Moves coins from the sender to the recipient.
+	TX_KIND_TRANSFER TxKind = iota
+	// TX_KIND_BOND - Locks the value of the balance of the sender as stake.
+	TX_KIND_BOND
+	// TX_KIND_UNBOND - Unlocks the value of the stake of the sender, it goes back to the balance after
+	// UNBONDING_BLOCKS blocks.
+	TX_KIND_UNBOND
+	// TX_KIND_EVIDENCE - Carries the proof that a validator signed two blocks with the same number,
+	// its stake is slashed.
+	TX_KIND_EVIDENCE
 )
 
+var txKindNames = map[TxKind]string{
+	TX_KIND_TRANSFER: "transfer",
+	TX_KIND_BOND:     "bond",
+	TX_KIND_UNBOND:   "unbond",
+	TX_KIND_EVIDENCE: "evidence",
+}
+
+func (k TxKind) String() string {
+	if name, ok := txKindNames[k]; ok {
+		return name
+	}
+	return fmt.Sprintf("kind(%d)", uint8(k))
+}
+
+// ParseTxKind - Returns the kind with the name. An empty name is a transfer.
+func ParseTxKind(s string) (TxKind, error) {
+	if s == "" {
+		return TX_KIND_TRANSFER, nil
+	}
+	for k, name := range txKindNames {
+		if name == s {
+			return k, nil
+		}
+	}
+	return 0, fmt.Errorf("%w: %s", ErrUnknownTxKind, s)
+}
+
+// OutPoint - Identifies an output of a transaction.
+type OutPoint struct {
+	TxID  [32]byte
+	Index uint32
+}
+
+func (op OutPoint) String() string {
+	return fmt.Sprintf("%x:%d", op.TxID, op.Index)
+}
+
+// TxInput - References the output of a previous transaction that is spent.
+type TxInput struct {
+	txID  [32]byte
+	index uint32
+}
+
+func NewTxInput(txID [32]byte, index uint32) *TxInput {
+	return &TxInput{txID, index}
+}
+
+// NewCoinbaseInput - Returns the input of a coinbase transaction.
+// It does not spend anything, it carries the block number so every coinbase has a different ID.
+func NewCoinbaseInput(number int64) *TxInput {
+	return &TxInput{index: uint32(number)}
+}
+
+func (in *TxInput) OutPoint() OutPoint {
+	return OutPoint{TxID: in.txID, Index: in.index}
+}
+
+func (in *TxInput) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		TxID  string `json:"tx_id"`
+		Index uint32 `json:"index"`
+	}{
+		TxID:  fmt.Sprintf("%x", in.txID),
+		Index: in.index,
+	})
+}
+
+func (in *TxInput) UnmarshalJSON(data []byte) error {
+	var txID string
+	v := &struct {
+		TxID  *string `json:"tx_id"`
+		Index *uint32 `json:"index"`
+	}{
+		TxID:  &txID,
+		Index: &in.index,
+	}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	id, err := decodeTxID(txID)
+	if err != nil {
+		return err
+	}
+	in.txID = id
+	return nil
+}
+
+// TxOutput - Amount of coins locked to a blockchain address.
+type TxOutput struct {
+	blockchainAddress string
+	value             coin.Amount
+}
+
+func NewTxOutput(blockchainAddress string, value coin.Amount) *TxOutput {
+	return &TxOutput{blockchainAddress, value}
+}
+
+func (out *TxOutput) BlockchainAddress() string {
+	return out.blockchainAddress
+}
+
+func (out *TxOutput) Value() coin.Amount {
+	return out.value
+}
+
+func (out *TxOutput) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		BlockchainAddress string      `json:"blockchain_address"`
+		Value             coin.Amount `json:"value"`
+	}{
+		BlockchainAddress: out.blockchainAddress,
+		Value:             out.value,
+	})
+}
+
+func (out *TxOutput) UnmarshalJSON(data []byte) error {
+	v := &struct {
+		BlockchainAddress *string      `json:"blockchain_address"`
+		Value             *coin.Amount `json:"value"`
+	}{
+		BlockchainAddress: &out.blockchainAddress,
+		Value:             &out.value,
+	}
+	return json.Unmarshal(data, &v)
+}
+
+// Transaction - Transfer of value from a sender to a recipient.
+// In the UTXO ledger mode the transaction spends outputs of previous transactions (inputs) and locks the
+// coins to new addresses (outputs); sender, recipient and value only summarize the transfer.
+// In the account ledger mode the value moves from the sender account to the recipient account and the
+// nonce orders the transactions of the sender.
+// The kind of the transaction tells transfers from the staking transactions of proof of stake, that
+// only exist in the account ledger mode.
+// The chain ID binds the signature to a network, so the transaction can not be replayed on another one.
+// The public key and the signature of the sender (the witness) travel with the transaction so
+// any node can verify it, they are not part of the transaction ID.
 type Transaction struct {
 	senderBlockchainAddress    string
 	recipientBlockchainAddress string
-	value                      float32
+	value                      coin.Amount
+	fee                        coin.Amount
 	timestamp                  int64
+	nonce                      uint64
+	inputs                     []*TxInput
+	outputs                    []*TxOutput
+	kind                       TxKind
+	data                       []byte
+	chainID                    string
+	senderPublicKey            *ecdsa.PublicKey
+	signature                  *blkcrypto.Signature
+}
+
+// NewTransaction - Creates a transaction of the UTXO ledger mode.
+func NewTransaction(sender string, recipient string, value coin.Amount, timestamp int64, inputs []*TxInput, outputs []*TxOutput) *Transaction {
+	return &Transaction{
+		senderBlockchainAddress:    sender,
+		recipientBlockchainAddress: recipient,
+		value:                      value,
+		timestamp:                  timestamp,
+		inputs:                     inputs,
+		outputs:                    outputs,
+	}
+}
+
+// NewAccountTransaction - Creates a transaction of the account ledger mode.
+func NewAccountTransaction(sender string, recipient string, value coin.Amount, timestamp int64, nonce uint64) *Transaction {
+	return &Transaction{
+		senderBlockchainAddress:    sender,
+		recipientBlockchainAddress: recipient,
+		value:                      value,
+		timestamp:                  timestamp,
+		nonce:                      nonce,
+	}
+}
+
+// NewStakingTransaction - Creates a bond or an unbond of the value. The sender is also the recipient,
+// the stake belongs to its account.
+func NewStakingTransaction(kind TxKind, sender string, value coin.Amount, timestamp int64, nonce uint64) *Transaction {
+	t := NewAccountTransaction(sender, sender, value, timestamp, nonce)
+	t.kind = kind
+	return t
+}
+
+// NewEvidenceTransaction - Creates the transaction with which the reporter proves a validator signed two
+// blocks with the same number.
+func NewEvidenceTransaction(reporter string, evidence *Evidence, timestamp int64, nonce uint64) *Transaction {
+	t := NewAccountTransaction(reporter, reporter, 0, timestamp, nonce)
+	t.kind = TX_KIND_EVIDENCE
+	t.data = evidence.Bytes()
+	return t
+}
+
+// SetFee - Sets the fee the sender pays to the miner of the block. It is signed, so it must be set
+// before signing.
+func (t *Transaction) SetFee(fee coin.Amount) {
+	t.fee = fee
+}
+
+func (t *Transaction) Fee() coin.Amount {
+	return t.fee
+}
+
+// SetWitness - Attaches the public key and the signature of the sender.
+func (t *Transaction) SetWitness(senderPublicKey *ecdsa.PublicKey, signature *blkcrypto.Signature) {
+	t.senderPublicKey = senderPublicKey
+	t.signature = signature
+}
+
+// Verify - Verifies the transaction was signed by the owner of the sender address for the chain with the ID.
+// The public key of the witness must derive the sender address and the signature must cover the
+// content of the transaction, the chain ID included. Coinbase transactions are not signed, the block rules
+// verify them.
+func (t *Transaction) Verify(chainID string) error {
+	if t.IsCoinbase() {
+		return nil
+	}
+	if t.senderPublicKey == nil || t.signature == nil {
+		return ErrMissingWitness
+	}
+	if t.chainID != chainID {
+		return fmt.Errorf("%w: %q", ErrWrongChainID, t.chainID)
+	}
+	if blkcrypto.AddressFromPublicKey(t.senderPublicKey) != t.senderBlockchainAddress {
+		return ErrWrongSenderKey
+	}
+	h := t.signingHash()
+	if !ecdsa.Verify(t.senderPublicKey, h[:], t.signature.R, t.signature.S) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+func (t *Transaction) SenderBlockchainAddress() string {
+	return t.senderBlockchainAddress
+}
+
+func (t *Transaction) RecipientBlockchainAddress() string {
+	return t.recipientBlockchainAddress
+}
+
+func (t *Transaction) Value() coin.Amount {
+	return t.value
 }
 
-func NewTransaction(sender string, recipient string, value float32, timestamp int64) *Transaction {
-	return &Transaction{sender, recipient, value, timestamp}
+func (t *Transaction) Timestamp() int64 {
+	return t.timestamp
+}
+
+func (t *Transaction) Kind() TxKind {
+	return t.kind
+}
+
+// ChainID - Returns the ID of the chain the transaction was signed for, empty for the coinbases.
+func (t *Transaction) ChainID() string {
+	return t.chainID
+}
+
+func (t *Transaction) Nonce() uint64 {
+	return t.nonce
+}
+
+func (t *Transaction) Inputs() []*TxInput {
+	return t.inputs
+}
+
+func (t *Transaction) Outputs() []*TxOutput {
+	return t.outputs
+}
+
+// IsCoinbase - Returns true if the transaction creates new coins instead of spending previous outputs.
+func (t *Transaction) IsCoinbase() bool {
+	return len(t.inputs) == 1 && t.inputs[0].txID == [32]byte{}
+}
+
+// Addresses - Returns the blockchain addresses the transaction touches: the sender, unless it is a
+// coinbase, the recipient and the owners of the outputs.
+func (t *Transaction) Addresses() []string {
+	addresses := make([]string, 0, 2+len(t.outputs))
+	seen := make(map[string]bool)
+	add := func(address string) {
+		if address != "" && !seen[address] {
+			seen[address] = true
+			addresses = append(addresses, address)
+		}
+	}
+	if !t.IsCoinbase() {
+		add(t.senderBlockchainAddress)
+	}
+	add(t.recipientBlockchainAddress)
+	for _, out := range t.outputs {
+		add(out.blockchainAddress)
+	}
+	return addresses
 }
 
 func (t *Transaction) Print() {
 	fmt.Printf("%s\n", strings.Repeat("-", 50))
+	fmt.Printf("id: %s\n", t.ID())
 	fmt.Printf("senderBlockchainAddress: %s\n", t.senderBlockchainAddress)
 	fmt.Printf("recipientBlockchainAddress: %s\n", t.recipientBlockchainAddress)
-	fmt.Printf("value: %.1f\n", t.value)
+	fmt.Printf("value: %s\n", t.value)
+	fmt.Printf("fee: %s\n", t.fee)
 	fmt.Printf("timestamp: %d\n", t.timestamp)
+	fmt.Printf("nonce: %d\n", t.nonce)
+	if t.kind != TX_KIND_TRANSFER {
+		fmt.Printf("kind: %s\n", t.kind)
+	}
+	for _, in := range t.inputs {
+		fmt.Printf("input: %s\n", in.OutPoint())
+	}
+	for _, out := range t.outputs {
+		fmt.Printf("output: %s %s\n", out.blockchainAddress, out.value)
+	}
 }
 
-func (t *Transaction) MarshalJSON() ([]byte, error) {
-	return json.Marshal(struct {
-		Sender    string  `json:"sender_blockchain_address"`
-		Recipient string  `json:"recipient_blockchain_address"`
-		Value     float32 `json:"value"`
-		Timestamp int64   `json:"timestamp"`
-	}{
+type transactionPayload struct {
+	Sender    string      `json:"sender_blockchain_address"`
+	Recipient string      `json:"recipient_blockchain_address"`
+	Value     coin.Amount `json:"value"`
+	Fee       coin.Amount `json:"fee"`
+	Timestamp int64       `json:"timestamp"`
+	Nonce     uint64      `json:"nonce"`
+	Inputs    []*TxInput  `json:"inputs"`
+	Outputs   []*TxOutput `json:"outputs"`
+	Kind      string      `json:"kind,omitempty"`
+	Data      string      `json:"data,omitempty"`
+	ChainID   string      `json:"chain_id,omitempty"`
+}
+
+// payload - Returns the signed fields of the transaction for its JSON form.
+// Missing inputs and outputs are encoded as empty lists, the kind, the data and the chain ID only when
+// there are.
+func (t *Transaction) payload() transactionPayload {
+	inputs, outputs := t.inputs, t.outputs
+	if inputs == nil {
+		inputs = []*TxInput{}
+	}
+	if outputs == nil {
+		outputs = []*TxOutput{}
+	}
+	p := transactionPayload{
+		Sender:    t.senderBlockchainAddress,
+		Recipient: t.recipientBlockchainAddress,
+		Value:     t.value,
+		Fee:       t.fee,
+		Timestamp: t.timestamp,
+		Nonce:     t.nonce,
+		Inputs:    inputs,
+		Outputs:   outputs,
+		Data:      hex.EncodeToString(t.data),
+		ChainID:   t.chainID,
+	}
+	if t.kind != TX_KIND_TRANSFER {
+		p.Kind = t.kind.String()
+	}
+	return p
+}
+
+// signingPayload - Returns the fields covered by the ID and the signature in their canonical encoding.
+func (t *Transaction) signingPayload() *codec.TxPayload {
+	p := &codec.TxPayload{
 		Sender:    t.senderBlockchainAddress,
 		Recipient: t.recipientBlockchainAddress,
 		Value:     t.value,
+		Fee:       t.fee,
 		Timestamp: t.timestamp,
+		Nonce:     t.nonce,
+		Inputs:    make([]codec.TxInput, len(t.inputs)),
+		Outputs:   make([]codec.TxOutput, len(t.outputs)),
+		Kind:      uint8(t.kind),
+		Data:      t.data,
+		ChainID:   t.chainID,
+	}
+	for i, in := range t.inputs {
+		p.Inputs[i] = codec.TxInput{TxID: in.txID, Index: in.index}
+	}
+	for i, out := range t.outputs {
+		p.Outputs[i] = codec.TxOutput{Address: out.blockchainAddress, Value: out.value}
+	}
+	return p
+}
+
+// signingHash - Returns the hash signed by the sender.
+// It covers every field of the transaction, so it is also the transaction ID.
+func (t *Transaction) signingHash() [32]byte {
+	return t.signingPayload().Hash()
+}
+
+// MarshalBinary - Encodes the transaction in the canonical encoding: the version byte, the signed payload
+// and the witness (public key and signature, empty when the transaction is not signed).
+func (t *Transaction) MarshalBinary() ([]byte, error) {
+	e := codec.NewEncoder()
+	e.PutUint8(codec.CODEC_VERSION)
+	t.signingPayload().Encode(e)
+	var senderPublicKey, signature []byte
+	if t.senderPublicKey != nil {
+		senderPublicKey = append(fixedBytes(t.senderPublicKey.X), fixedBytes(t.senderPublicKey.Y)...)
+	}
+	if t.signature != nil {
+		signature = append(fixedBytes(t.signature.R), fixedBytes(t.signature.S)...)
+	}
+	e.PutBytes(senderPublicKey)
+	e.PutBytes(signature)
+	return e.Bytes(), nil
+}
+
+// UnmarshalBinary - Decodes a transaction encoded by MarshalBinary.
+func (t *Transaction) UnmarshalBinary(data []byte) error {
+	d := codec.NewDecoder(data)
+	if err := t.decode(d); err != nil {
+		return err
+	}
+	return d.Finish()
+}
+
+func (t *Transaction) decode(d *codec.Decoder) error {
+	d.Version()
+	p := codec.DecodeTxPayload(d)
+	senderPublicKey := d.Bytes()
+	signature := d.Bytes()
+	if err := d.Err(); err != nil {
+		return err
+	}
+
+	*t = Transaction{
+		senderBlockchainAddress:    p.Sender,
+		recipientBlockchainAddress: p.Recipient,
+		value:                      p.Value,
+		fee:                        p.Fee,
+		timestamp:                  p.Timestamp,
+		nonce:                      p.Nonce,
+		kind:                       TxKind(p.Kind),
+		chainID:                    p.ChainID,
+	}
+	if len(p.Data) > 0 {
+		t.data = p.Data
+	}
+	for _, in := range p.Inputs {
+		t.inputs = append(t.inputs, NewTxInput(in.TxID, in.Index))
+	}
+	for _, out := range p.Outputs {
+		t.outputs = append(t.outputs, NewTxOutput(out.Address, out.Value))
+	}
+	if len(senderPublicKey) > 0 {
+		x, y, err := splitKeyBytes(senderPublicKey)
+		if err != nil {
+			return fmt.Errorf("sender public key: %w", err)
+		}
+		t.senderPublicKey = &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}
+	}
+	if len(signature) > 0 {
+		r, s, err := splitKeyBytes(signature)
+		if err != nil {
+			return fmt.Errorf("signature: %w", err)
+		}
+		t.signature = &blkcrypto.Signature{R: r, S: s}
+	}
+	return nil
+}
+
+// fixedBytes - Returns the number as 32 big endian bytes, the size of the coordinates of P256.
+func fixedBytes(n *big.Int) []byte {
+	b := make([]byte, 32)
+	return n.FillBytes(b)
+}
+
+// splitKeyBytes - Splits the binary form of a public key or a signature in its two numbers.
+func splitKeyBytes(b []byte) (*big.Int, *big.Int, error) {
+	if len(b) != 64 {
+		return nil, nil, errors.New("invalid length")
+	}
+	return new(big.Int).SetBytes(b[:32]), new(big.Int).SetBytes(b[32:]), nil
+}
+
+func (t *Transaction) MarshalJSON() ([]byte, error) {
+	var senderPublicKey, signature string
+	if t.senderPublicKey != nil {
+		senderPublicKey = fmt.Sprintf("%064x%064x", t.senderPublicKey.X, t.senderPublicKey.Y)
+	}
+	if t.signature != nil {
+		signature = t.signature.String()
+	}
+	return json.Marshal(struct {
+		ID string `json:"id"`
+		transactionPayload
+		SenderPublicKey string `json:"sender_public_key,omitempty"`
+		Signature       string `json:"signature,omitempty"`
+	}{
+		ID:                 t.ID(),
+		transactionPayload: t.payload(),
+		SenderPublicKey:    senderPublicKey,
+		Signature:          signature,
 	})
 }
 
-func (t *Transaction) UnmarshalJSON(data []byte) error {
+// UnmarshalJSON - Decodes a transaction. The ID is not decoded, it is always computed from the content.
+func (t *Transaction) UnmarshalJSON(b []byte) error {
+	var kind, data, senderPublicKey, signature string
 	v := &struct {
-		Sender    *string  `json:"sender_blockchain_address"`
-		Recipient *string  `json:"recipient_blockchain_address"`
-		Value     *float32 `json:"value"`
-		Timestamp *int64   `json:"timestamp"`
+		Sender    *string      `json:"sender_blockchain_address"`
+		Recipient *string      `json:"recipient_blockchain_address"`
+		Value     *coin.Amount `json:"value"`
+		Fee       *coin.Amount `json:"fee"`
+		Timestamp *int64       `json:"timestamp"`
+		Nonce     *uint64      `json:"nonce"`
+		Inputs    *[]*TxInput  `json:"inputs"`
+		Outputs   *[]*TxOutput `json:"outputs"`
+		Kind      *string      `json:"kind"`
+		Data      *string      `json:"data"`
+		ChainID   *string      `json:"chain_id"`
+		PublicKey *string      `json:"sender_public_key"`
+		Signature *string      `json:"signature"`
 	}{
 		Sender:    &t.senderBlockchainAddress,
 		Recipient: &t.recipientBlockchainAddress,
 		Value:     &t.value,
+		Fee:       &t.fee,
 		Timestamp: &t.timestamp,
+		Nonce:     &t.nonce,
+		Inputs:    &t.inputs,
+		Outputs:   &t.outputs,
+		Kind:      &kind,
+		Data:      &data,
+		ChainID:   &t.chainID,
+		PublicKey: &senderPublicKey,
+		Signature: &signature,
 	}
-	if err := json.Unmarshal(data, &v); err != nil {
+	if err := json.Unmarshal(b, &v); err != nil {
 		return err
 	}
+
+	k, err := ParseTxKind(kind)
+	if err != nil {
+		return err
+	}
+	t.kind = k
+	if data != "" {
+		if t.data, err = hex.DecodeString(data); err != nil {
+			return fmt.Errorf("data: %w", err)
+		}
+	}
+	if senderPublicKey != "" {
+		if err := checkKeyString(senderPublicKey); err != nil {
+			return fmt.Errorf("sender public key: %w", err)
+		}
+		t.senderPublicKey = blkcrypto.PublicKeyFromString(senderPublicKey)
+	}
+	if signature != "" {
+		if err := checkKeyString(signature); err != nil {
+			return fmt.Errorf("signature: %w", err)
+		}
+		t.signature = blkcrypto.SignatureFromString(signature)
+	}
 	return nil
 }
 
+// checkKeyString - Verifies s is the hex encoding of two 32 bytes numbers, the format of public keys and signatures.
+func checkKeyString(s string) error {
+	if len(s) != 128 {
+		return errors.New("invalid length")
+	}
+	_, err := hex.DecodeString(s)
+	return err
+}
+
+// Size - Returns the size of the canonical encoding of the transaction, the space it takes in a block.
+func (t *Transaction) Size() int {
+	b, _ := t.MarshalBinary()
+	return len(b)
+}
+
+// Hash - Returns the content hash of the transaction.
+func (t *Transaction) Hash() [32]byte {
+	return t.signingHash()
+}
+
+// ID - Returns the content hash of the transaction as a hex string.
 func (t *Transaction) ID() string {
-	return fmt.Sprintf("%x_%x_%x", t.senderBlockchainAddress, t.recipientBlockchainAddress, t.timestamp)
+	return fmt.Sprintf("%x", t.Hash())
 }
 
 func (t *Transaction) Equal(tx *Transaction) bool {
 	return t.ID() == tx.ID()
 }
+
+// decodeTxID - Decodes a transaction ID written in hex.
+func decodeTxID(s string) ([32]byte, error) {
+	var id [32]byte
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return id, fmt.Errorf("%w: %v", ErrInvalidTxID, err)
+	}
+	if len(b) != len(id) {
+		return id, fmt.Errorf("%w: it has %d bytes", ErrInvalidTxID, len(b))
+	}
+	copy(id[:], b)
+	return id, nil
+}
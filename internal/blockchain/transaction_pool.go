@@ -1,122 +1,488 @@
 package blockchain
 
 import (
-	"crypto/ecdsa"
-	"crypto/sha256"
-	"encoding/json"
+	"encoding/hex"
+	"errors"
+	"fmt"
 	"log"
-	"strings"
+	"math/bits"
+	"sort"
 	"sync"
+	"time"
 
 	"github.com/martinsaporiti/blockchain-sample/internal/blkcrypto"
+	"github.com/martinsaporiti/blockchain-sample/internal/coin"
 	"github.com/martinsaporiti/blockchain-sample/internal/dto"
 )
 
+// TransactionPool - Transactions waiting to be mined, by ID. The pool is bounded by its limits: when it is
+// full a new transaction evicts the ones with the lowest fee rate, transactions expire after the TTL, and a
+// transaction that conflicts with pending ones replaces them if it pays a higher fee.
 type TransactionPool struct {
-	transactions       map[string]*Transaction
+	entries      map[string]*poolEntry
+	nextSequence uint64
+	// size - Sum of the sizes of the pending transactions.
+	size int
+	// senders - Number of pending transactions of every sender.
+	senders map[string]int
+	// view - The ledger after the pending transactions, applied in order. It is nil when it has to be
+	// built again, after transactions leave the pool.
+	view               LedgerView
+	dropped            *droppedTransactions
+	spent              map[OutPoint]string
+	ledger             Ledger
+	chainID            string
+	limits             MempoolLimits
 	mux                sync.Mutex
 	startMiningChannel chan bool
 }
 
-func NewTransactionPool(startMiningChannel chan bool) *TransactionPool {
+// poolEntry - A pending transaction with the values the pool orders, limits and replaces it by. They are
+// computed once, when the transaction is added.
+type poolEntry struct {
+	t        *Transaction
+	id       string
+	size     int
+	sequence uint64
+	addedAt  time.Time
+}
+
+func newPoolEntry(t *Transaction, addedAt time.Time) *poolEntry {
+	return &poolEntry{t: t, id: t.ID(), size: t.Size(), addedAt: addedAt}
+}
+
+// NewTransactionPool - Creates a pool whose transactions must be valid on top of the given ledger and
+// signed for the chain with the ID.
+func NewTransactionPool(startMiningChannel chan bool, ledger Ledger, chainID string) *TransactionPool {
 
 	return &TransactionPool{
-		transactions:       make(map[string]*Transaction),
+		entries:            make(map[string]*poolEntry),
+		senders:            make(map[string]int),
+		dropped:            newDroppedTransactions(),
+		spent:              make(map[OutPoint]string),
+		ledger:             ledger,
+		chainID:            chainID,
+		limits:             MempoolLimits{}.withDefaults(),
 		startMiningChannel: startMiningChannel,
 	}
 
 }
 
-func (tp *TransactionPool) isNodeAddress(address string) bool {
-	return strings.Contains("THE BLOCKCHAIN", address)
-}
-
 // AddAndVerifyTransaction - Adds a transaction to the transaction pool
-// and verifies the signature of the transaction.
+// and verifies the transaction was signed by the owner of the sender address for our chain.
+// The transaction is rejected if it is not valid on top of the ledger and the transactions
+// already in the pool (an overspend or a wrong nonce), unless it replaces the pending transactions it
+// conflicts with. A transaction that was already mined is rejected the same way: its inputs are spent or
+// its nonce was used.
 // Sends a message to the mining process to start mining.
 func (tp *TransactionPool) AddAndVerifyTransaction(tr *dto.TransactionRequest) bool {
-	sender := *tr.SenderBlockchainAddress
-	recipient := *tr.RecipientBlockchainAddress
-	value := *tr.Value
-	timestamp := *tr.Timestamp
-	senderPublicKey := blkcrypto.PublicKeyFromString(*tr.SenderPublicKey)
-	signature := blkcrypto.SignatureFromString(*tr.Signature)
+	t, err := newTransactionFromRequest(tr)
+	if err != nil {
+		log.Println("action = add transaction, status = failed")
+		log.Printf("ERROR: Invalid transaction: %v", err)
+		return false
+	}
 
-	t := NewTransaction(sender, recipient, value, timestamp)
-	if tp.isNodeAddress(sender) {
-		tp.Add(t)
-		return true
+	if err := t.Verify(tp.chainID); err != nil {
+		log.Println("action = add transaction, status = failed")
+		log.Printf("ERROR: Invalid transaction signature: %v", err)
+		return false
 	}
 
-	if tp.verifyTransactionSignature(senderPublicKey, signature, t) {
-		tp.Add(t)
-		log.Println("action = add transaction, status = success")
+	if err := tp.addIfValid(t, time.Now()); err != nil {
+		log.Println("action = add transaction, status = failed")
+		log.Printf("ERROR: Invalid transaction: %v", err)
+		return false
+	}
+	log.Println("action = add transaction, status = success")
+
+	// The miner keeps mining while the pool has transactions, if it is busy the signal is not needed.
+	select {
+	case tp.startMiningChannel <- true:
+	default:
+	}
+	return true
+}
+
+// newTransactionFromRequest - Builds the transaction described by a request, including its witness.
+func newTransactionFromRequest(tr *dto.TransactionRequest) (*Transaction, error) {
+	if err := checkKeyString(*tr.SenderPublicKey); err != nil {
+		return nil, fmt.Errorf("sender public key: %w", err)
+	}
+	if err := checkKeyString(*tr.Signature); err != nil {
+		return nil, fmt.Errorf("signature: %w", err)
+	}
 
-		if len(tp.transactions) == 1 {
-			go func() {
-				tp.startMiningChannel <- true
-			}()
+	inputs := make([]*TxInput, 0, len(tr.Inputs))
+	for _, in := range tr.Inputs {
+		if in.TxID == nil || in.Index == nil {
+			return nil, errors.New("missing input fields")
 		}
-		return true
+		txID, err := decodeTxID(*in.TxID)
+		if err != nil {
+			return nil, err
+		}
+		inputs = append(inputs, NewTxInput(txID, *in.Index))
+	}
+
+	outputs := make([]*TxOutput, 0, len(tr.Outputs))
+	for _, out := range tr.Outputs {
+		if out.BlockchainAddress == nil || out.Value == nil {
+			return nil, errors.New("missing output fields")
+		}
+		outputs = append(outputs, NewTxOutput(*out.BlockchainAddress, *out.Value))
 	}
 
-	log.Println("action = add transaction, status = failed")
-	log.Println("ERROR: Invalid transaction signature")
-	return false
+	t := NewTransaction(*tr.SenderBlockchainAddress, *tr.RecipientBlockchainAddress, *tr.Value, *tr.Timestamp,
+		inputs, outputs)
+	if tr.Nonce != nil {
+		t.nonce = *tr.Nonce
+	}
+	if tr.Fee != nil {
+		t.fee = *tr.Fee
+	}
+	if tr.Kind != nil {
+		kind, err := ParseTxKind(*tr.Kind)
+		if err != nil {
+			return nil, err
+		}
+		t.kind = kind
+	}
+	if tr.ChainID != nil {
+		t.chainID = *tr.ChainID
+	}
+	if tr.Data != nil && *tr.Data != "" {
+		data, err := hex.DecodeString(*tr.Data)
+		if err != nil {
+			return nil, fmt.Errorf("data: %w", err)
+		}
+		t.data = data
+	}
+	t.SetWitness(blkcrypto.PublicKeyFromString(*tr.SenderPublicKey), blkcrypto.SignatureFromString(*tr.Signature))
+	return t, nil
 }
 
-// verifyTransactionSignature - Verifies the signature of a transaction
-func (tp *TransactionPool) verifyTransactionSignature(senderPublicKey *ecdsa.PublicKey, s *blkcrypto.Signature, t *Transaction) bool {
-	m, _ := json.Marshal(t)
-	h := sha256.Sum256([]byte(m))
-	return ecdsa.Verify(senderPublicKey, h[:], s.R, s.S)
+// addIfValid - Adds the transaction if it can be applied to the ledger after the transactions of the pool.
+// The pending transactions it conflicts with are replaced if it pays enough more, and when the pool is full
+// the ones with the lowest fee rate are evicted. The transactions that depended on the removed ones are
+// removed too.
+// Without removals only the transaction is applied, to the view of the pending ones. The pending
+// transactions are applied again, once, only when some of them are replaced or evicted.
+func (tp *TransactionPool) addIfValid(t *Transaction, now time.Time) error {
+	if t.IsCoinbase() {
+		return errors.New("coinbase transactions are only valid inside blocks")
+	}
+
+	tp.mux.Lock()
+	defer tp.mux.Unlock()
+	tp.expire(now)
+	e := newPoolEntry(t, now)
+	if _, ok := tp.entries[e.id]; ok {
+		return ErrDuplicateTransaction
+	}
+
+	conflicts := tp.conflicts(t)
+	replaced := make(map[string]bool)
+	bySender := tp.senders[t.senderBlockchainAddress]
+	// A replacement takes the place of the first transaction it replaces, the ones after it may depend on it.
+	if len(conflicts) > 0 {
+		if err := tp.checkReplacement(e, conflicts); err != nil {
+			return err
+		}
+		e.sequence = conflicts[0].sequence
+		for _, c := range conflicts {
+			replaced[c.id] = true
+			if c.t.senderBlockchainAddress == t.senderBlockchainAddress {
+				bySender--
+			}
+		}
+	}
+	if bySender >= tp.limits.MaxPerSender {
+		return ErrSenderLimit
+	}
+
+	evicted, err := tp.evictions(e, replaced)
+	if err != nil {
+		return err
+	}
+	if len(conflicts) == 0 && len(evicted) == 0 {
+		if err := tp.pendingView().ApplyTransaction(t); err != nil {
+			return err
+		}
+		tp.add(e)
+		return nil
+	}
+
+	removed := make(map[string]bool, len(replaced)+len(evicted))
+	for id := range replaced {
+		removed[id] = true
+	}
+	for _, ev := range evicted {
+		removed[ev.id] = true
+	}
+	view, invalid, err := tp.replayWith(e, removed)
+	if err != nil {
+		if len(evicted) > 0 {
+			return fmt.Errorf("%w: %v", ErrMempoolFull, err)
+		}
+		return err
+	}
+	for _, c := range conflicts {
+		tp.drop(c, "replaced by "+e.id)
+	}
+	for _, ev := range evicted {
+		tp.drop(ev, "evicted by "+e.id)
+	}
+	for _, i := range invalid {
+		tp.drop(i, "depends on a transaction removed by "+e.id)
+	}
+	tp.add(e)
+	tp.view = view
+	return nil
 }
 
-// Transactions - Returns a transaction from the transaction pool
+// replayWith - Applies to a new view of the ledger the pending transactions, without the removed ones, and
+// the entry at its sequence (at the end if it has none). Returns the view and the pending transactions
+// that can no longer be applied, or an error if the entry can not be applied.
+func (tp *TransactionPool) replayWith(e *poolEntry, removed map[string]bool) (LedgerView, []*poolEntry, error) {
+	view := tp.ledger.NewView()
+	invalid := make([]*poolEntry, 0)
+	applied := false
+	for _, pending := range tp.sorted() {
+		if removed[pending.id] {
+			continue
+		}
+		if !applied && e.sequence != 0 && pending.sequence >= e.sequence {
+			if err := view.ApplyTransaction(e.t); err != nil {
+				return nil, nil, err
+			}
+			applied = true
+		}
+		if err := view.ApplyTransaction(pending.t); err != nil {
+			invalid = append(invalid, pending)
+		}
+	}
+	if !applied {
+		if err := view.ApplyTransaction(e.t); err != nil {
+			return nil, nil, err
+		}
+	}
+	return view, invalid, nil
+}
+
+// pendingView - Returns the view of the ledger after the pending transactions. It is built again if
+// transactions left the pool since the last time, and the ones that are no longer valid are dropped.
+func (tp *TransactionPool) pendingView() LedgerView {
+	if tp.view == nil {
+		tp.removeInvalid("on top of the ledger")
+	}
+	return tp.view
+}
+
+// IsSpent - Returns true if a transaction of the pool spends the output.
+func (tp *TransactionPool) IsSpent(op OutPoint) bool {
+	tp.mux.Lock()
+	defer tp.mux.Unlock()
+	_, ok := tp.spent[op]
+	return ok
+}
+
+// Transactions - Returns the transactions of the pool
+// in the order they were added, so the transactions of every sender are ordered by nonce.
 func (tp *TransactionPool) Transactions() []*Transaction {
-	transactions := make([]*Transaction, 0)
 	tp.mux.Lock()
 	defer tp.mux.Unlock()
-	for _, t := range tp.transactions {
-		transactions = append(transactions, t)
+	entries := tp.sorted()
+	transactions := make([]*Transaction, len(entries))
+	for i, e := range entries {
+		transactions[i] = e.t
 	}
 	return transactions
 }
 
-// Add - Adds a transaction to the transaction pool
-func (tp *TransactionPool) Add(t *Transaction) {
+// sorted - Returns the entries in the order they were added.
+// Ties (transactions added without a sequence) are ordered by sender and nonce.
+func (tp *TransactionPool) sorted() []*poolEntry {
+	entries := make([]*poolEntry, 0, len(tp.entries))
+	for _, e := range tp.entries {
+		entries = append(entries, e)
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		ei, ej := entries[i], entries[j]
+		if ei.sequence != ej.sequence {
+			return ei.sequence < ej.sequence
+		}
+		if ei.t.senderBlockchainAddress != ej.t.senderBlockchainAddress {
+			return ei.t.senderBlockchainAddress < ej.t.senderBlockchainAddress
+		}
+		return ei.t.nonce < ej.t.nonce
+	})
+	return entries
+}
+
+// SelectTransactions - Returns the transactions for the next block, highest fee per byte first, without
+// removing them from the pool. At most maxCount transactions whose sizes add up to at most maxSize bytes
+// are selected, and they can be applied to the ledger in the order they are returned: a transaction that
+// depends on another one of the pool (it spends its outputs or uses the next nonce of the sender) goes
+// after it. Transactions that are not valid or do not fit stay in the pool.
+func (tp *TransactionPool) SelectTransactions(maxCount int, maxSize int) []*Transaction {
 	tp.mux.Lock()
 	defer tp.mux.Unlock()
-	tp.transactions[t.ID()] = t
+
+	candidates := tp.sorted()
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return higherFeeRate(candidates[i].t.fee, candidates[i].size, candidates[j].t.fee, candidates[j].size)
+	})
+
+	selected := make([]*Transaction, 0)
+	size := 0
+	view := tp.ledger.NewView()
+	// Every pass adds the transactions whose dependencies were added by the previous ones.
+	for added := true; added && len(selected) < maxCount; {
+		added = false
+		remaining := candidates[:0]
+		for _, c := range candidates {
+			if len(selected) == maxCount || size+c.size > maxSize || view.ApplyTransaction(c.t) != nil {
+				remaining = append(remaining, c)
+				continue
+			}
+			selected = append(selected, c.t)
+			size += c.size
+			added = true
+		}
+		candidates = remaining
+	}
+	return selected
+}
+
+// higherFeeRate - Returns true if feeA / sizeA > feeB / sizeB. The products are compared in 128 bits,
+// so the rates are exact.
+func higherFeeRate(feeA coin.Amount, sizeA int, feeB coin.Amount, sizeB int) bool {
+	aHi, aLo := bits.Mul64(uint64(feeA), uint64(sizeB))
+	bHi, bLo := bits.Mul64(uint64(feeB), uint64(sizeA))
+	return aHi > bHi || (aHi == bHi && aLo > bLo)
 }
 
-// Copy - Returns a copy of the transaction pool
-// Removes all transactions from the pool.
-func (tp *TransactionPool) Copy() []*Transaction {
+// Add - Adds a transaction to the transaction pool
+func (tp *TransactionPool) Add(t *Transaction) {
 	tp.mux.Lock()
 	defer tp.mux.Unlock()
-	transactions := make([]*Transaction, 0)
-	for _, t := range tp.transactions {
-		transactions = append(transactions, t)
+	tp.add(newPoolEntry(t, time.Now()))
+	// The transaction was not applied to the view of the pending ones.
+	tp.view = nil
+}
+
+// add - Adds the entry at the end of the pool, unless it already has a sequence.
+func (tp *TransactionPool) add(e *poolEntry) {
+	if e.sequence == 0 {
+		tp.nextSequence++
+		e.sequence = tp.nextSequence
+	}
+	tp.entries[e.id] = e
+	tp.size += e.size
+	tp.senders[e.t.senderBlockchainAddress]++
+	tp.dropped.remove(e.id)
+	for _, in := range e.t.inputs {
+		tp.spent[in.OutPoint()] = e.id
 	}
-	tp.transactions = make(map[string]*Transaction)
-	return transactions
 }
 
-// UpdateFromBlock - Updates the transaction pool removing the transactions from a block
+// UpdateFromBlock - Updates the transaction pool removing the transactions from a block.
+// The block must be already applied to the ledger. The transactions of the pool that are no
+// longer valid on top of it (for instance, because they spend the same outputs) or expired are removed too.
 func (tp *TransactionPool) UpdateFromBlock(b *Block) {
 	for _, t := range b.Transactions() {
 		tp.remove(t)
 	}
+
+	tp.mux.Lock()
+	defer tp.mux.Unlock()
+	tp.expire(time.Now())
+	tp.removeInvalid(fmt.Sprintf("after block %d", b.Number()))
+}
+
+// UpdateFromReorg - Updates the transaction pool after the main chain moved to another branch.
+// The ledger must be already on the new branch. The transactions of the disconnected blocks that are
+// not in the connected ones go back to the pool, before the transactions that were waiting, and the
+// ones that are no longer valid on top of the ledger are discarded.
+func (tp *TransactionPool) UpdateFromReorg(event *ReorgEvent) {
+	mined := make(map[string]bool)
+	for _, b := range event.Connected {
+		for _, t := range b.transactions {
+			mined[t.ID()] = true
+		}
+	}
+	// The disconnected blocks go from the tip down, their transactions are taken in chain order.
+	now := time.Now()
+	candidates := make([]*poolEntry, 0)
+	for i := len(event.Disconnected) - 1; i >= 0; i-- {
+		for _, t := range event.Disconnected[i].transactions {
+			if !t.IsCoinbase() {
+				candidates = append(candidates, newPoolEntry(t, now))
+			}
+		}
+	}
+
+	tp.mux.Lock()
+	// The transactions that were waiting keep the time they were added, so they still expire.
+	for _, e := range tp.sorted() {
+		e.sequence = 0
+		candidates = append(candidates, e)
+	}
+	tp.entries = make(map[string]*poolEntry)
+	tp.size = 0
+	tp.senders = make(map[string]int)
+	tp.spent = make(map[OutPoint]string)
+	view := tp.ledger.NewView()
+	for _, e := range candidates {
+		if _, ok := tp.entries[e.id]; ok || mined[e.id] {
+			continue
+		}
+		if err := view.ApplyTransaction(e.t); err != nil {
+			tp.dropped.add(e.id, "not valid after the reorganization: "+err.Error())
+			continue
+		}
+		tp.add(e)
+	}
+	tp.view = view
+	pending := len(tp.entries)
+	tp.mux.Unlock()
+
+	if pending > 0 {
+		select {
+		case tp.startMiningChannel <- true:
+		default:
+		}
+	}
 }
 
 func (tp *TransactionPool) Length() int {
-	return len(tp.transactions)
+	tp.mux.Lock()
+	defer tp.mux.Unlock()
+	return len(tp.entries)
 }
 
 // Remove - Removes a transaction from the transaction pool
 func (tp *TransactionPool) remove(t *Transaction) {
 	tp.mux.Lock()
 	defer tp.mux.Unlock()
-	delete(tp.transactions, t.ID())
+	tp.removeLocked(t.ID())
+}
+
+func (tp *TransactionPool) removeLocked(id string) {
+	e, ok := tp.entries[id]
+	if !ok {
+		return
+	}
+	delete(tp.entries, id)
+	tp.size -= e.size
+	if tp.senders[e.t.senderBlockchainAddress]--; tp.senders[e.t.senderBlockchainAddress] == 0 {
+		delete(tp.senders, e.t.senderBlockchainAddress)
+	}
+	for _, in := range e.t.inputs {
+		if tp.spent[in.OutPoint()] == id {
+			delete(tp.spent, in.OutPoint())
+		}
+	}
+	tp.view = nil
 }
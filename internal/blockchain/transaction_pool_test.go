@@ -2,15 +2,112 @@ package blockchain
 
 import (
 	"crypto/ecdsa"
-	"reflect"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
 	"testing"
+	"time"
 
 	"github.com/martinsaporiti/blockchain-sample/internal/blkcrypto"
+	"github.com/martinsaporiti/blockchain-sample/internal/coin"
 	"github.com/martinsaporiti/blockchain-sample/internal/dto"
 )
 
+// testAccount - Key pair and blockchain address used to sign the transactions of the tests.
+type testAccount struct {
+	privateKey *ecdsa.PrivateKey
+	address    string
+}
+
+func newTestAccount() *testAccount {
+	privateKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	return &testAccount{privateKey: privateKey, address: blkcrypto.AddressFromPublicKey(&privateKey.PublicKey)}
+}
+
+func (a *testAccount) publicKey() string {
+	return fmt.Sprintf("%064x%064x", a.privateKey.X, a.privateKey.Y)
+}
+
+// sign - Returns the signature of the transaction by the account. A transaction without chain ID is signed
+// for the test chain.
+func (a *testAccount) sign(t *Transaction) string {
+	if t.chainID == "" {
+		t.chainID = testChainID
+	}
+	h := t.signingHash()
+	r, s, _ := ecdsa.Sign(rand.Reader, a.privateKey, h[:])
+	return (&blkcrypto.Signature{R: r, S: s}).String()
+}
+
+// signed - Attaches the public key and the signature of the account to the transaction.
+func (a *testAccount) signed(t *Transaction) *Transaction {
+	t.SetWitness(&a.privateKey.PublicKey, blkcrypto.SignatureFromString(a.sign(t)))
+	return t
+}
+
+// request - Returns the request a wallet sends for the transaction, signed by the account.
+func (a *testAccount) request(t *Transaction) *dto.TransactionRequest {
+	spk := a.publicKey()
+	sig := a.sign(t)
+	tr := &dto.TransactionRequest{
+		SenderBlockchainAddress:    &t.senderBlockchainAddress,
+		RecipientBlockchainAddress: &t.recipientBlockchainAddress,
+		SenderPublicKey:            &spk,
+		Value:                      &t.value,
+		Fee:                        &t.fee,
+		Timestamp:                  &t.timestamp,
+		Nonce:                      &t.nonce,
+		Signature:                  &sig,
+		ChainID:                    &t.chainID,
+	}
+	for _, in := range t.inputs {
+		txID := fmt.Sprintf("%x", in.txID)
+		index := in.index
+		tr.Inputs = append(tr.Inputs, &dto.TransactionInput{TxID: &txID, Index: &index})
+	}
+	for _, out := range t.outputs {
+		address := out.blockchainAddress
+		value := out.value
+		tr.Outputs = append(tr.Outputs, &dto.TransactionOutput{BlockchainAddress: &address, Value: &value})
+	}
+	if t.kind != TX_KIND_TRANSFER {
+		kind := t.kind.String()
+		tr.Kind = &kind
+	}
+	if len(t.data) > 0 {
+		data := hex.EncodeToString(t.data)
+		tr.Data = &data
+	}
+	return tr
+}
+
+// withFee - Sets the fee of the transaction and returns it.
+func withFee(t *Transaction, fee coin.Amount) *Transaction {
+	t.SetFee(fee)
+	return t
+}
+
+// newFundedUTXOSet - Returns a UTXO set with the outputs of a coinbase transaction and the coinbase ID.
+func newFundedUTXOSet(outputs ...*TxOutput) (*UTXOSet, [32]byte) {
+	coinbase := NewTransaction("THE BLOCKCHAIN", outputs[0].blockchainAddress, outputs[0].value, 1654369000,
+		[]*TxInput{NewCoinbaseInput(1)}, outputs)
+	utxos := NewUTXOSet()
+	utxos.ApplyBlock(NewBlock(1, 0, [32]byte{}, []*Transaction{coinbase}))
+	return utxos, coinbase.Hash()
+}
+
 func TestTransactionPool_VerifyTransactionSignature(t *testing.T) {
 
+	account := newTestAccount()
+	other := newTestAccount()
+	sba := account.address
+	rba := "1CHD4Jjqsak4RV5JHAdYZ9CKY1dQe4tkXW"
+	inputs := []*TxInput{NewTxInput([32]byte{1}, 0)}
+	outputs := []*TxOutput{NewTxOutput(rba, 200)}
+	signature := blkcrypto.SignatureFromString(account.sign(NewTransaction(sba, rba, 200, 1654369662, inputs, outputs)))
+
 	type input struct {
 		senderPublicKey *ecdsa.PublicKey
 		signature       *blkcrypto.Signature
@@ -18,80 +115,74 @@ func TestTransactionPool_VerifyTransactionSignature(t *testing.T) {
 	}
 
 	tests := map[string]struct {
-		input  input
-		txPool *TransactionPool
-		want   bool
+		input input
+		want  bool
 	}{
 		"should return true when the signature is valid": {
 			input: input{
-				senderPublicKey: blkcrypto.PublicKeyFromString("aed86cb86fe477183b5a9f452d2a7d26e81c9ce16b123c699cbc4cc61cb7111df24ceebf3cb316b5740c19451ed390e9a9b1f5070cef639808af535570b01ce1"),
-				signature:       blkcrypto.SignatureFromString("1dda674ee41218569a870993fe32fd3bf6a7bda3c657d4fae8fd0898adfdaf59eced8a5dd315f239c056197cf2b9a7a0bc4e941853be66e7e8a8427b14b9006b"),
-				tx:              NewTransaction("15TZoyyxFmeTXJGjYwX1X3ARtXX94BbFrk", "1CHD4Jjqsak4RV5JHAdYZ9CKY1dQe4tkXW", 200, 1654369662),
+				senderPublicKey: &account.privateKey.PublicKey,
+				signature:       signature,
+				tx:              NewTransaction(sba, rba, 200, 1654369662, inputs, outputs),
 			},
-			txPool: NewTransactionPool(nil),
-			want:   true,
+			want: true,
 		},
 		"should return false when the signature is invalid": {
 			input: input{
-				senderPublicKey: blkcrypto.PublicKeyFromString("aed86cb86fe477183b5a9f452d2a7d26e81c9ce16b123c699cbc4cc61cb7111df24ceebf3cb316b5740c19451ed390e9a9b1f5070cef639808af535570b01ce1"),
-				signature:       blkcrypto.SignatureFromString("1dda674ee41218569a870993fe32fd3bf6a7bda3c657d4fae8fd0898adfdaf59eced8a5dd315f239c056197cf2b9a7a0bc4e941853be66e7e8a8427b14b9006c"),
-				tx:              NewTransaction("15TZoyyxFmeTXJGjYwX1X3ARtXX94BbFrk", "1CHD4Jjqsak4RV5JHAdYZ9CKY1dQe4tkXW", 200, 1654369662),
+				senderPublicKey: &account.privateKey.PublicKey,
+				signature:       blkcrypto.SignatureFromString(other.sign(NewTransaction(sba, rba, 200, 1654369662, inputs, outputs))),
+				tx:              NewTransaction(sba, rba, 200, 1654369662, inputs, outputs),
 			},
-			txPool: NewTransactionPool(nil),
-			want:   false,
+			want: false,
 		},
-		"should return false when the public key is inavalid": {
+		"should return false when the public key is invalid": {
 			input: input{
-				senderPublicKey: blkcrypto.PublicKeyFromString("aed86cb86fe477183b5a9f452d2a7d26e81c9ce16b123c699cbc4cc61cb7111df24ceebf3cb316b5740c19451ed390e9a9b1f5070cef639808af535570b01ce2"),
-				signature:       blkcrypto.SignatureFromString("1dda674ee41218569a870993fe32fd3bf6a7bda3c657d4fae8fd0898adfdaf59eced8a5dd315f239c056197cf2b9a7a0bc4e941853be66e7e8a8427b14b9006b"),
-				tx:              NewTransaction("15TZoyyxFmeTXJGjYwX1X3ARtXX94BbFrk", "1CHD4Jjqsak4RV5JHAdYZ9CKY1dQe4tkXW", 200, 1654369662),
+				senderPublicKey: &other.privateKey.PublicKey,
+				signature:       signature,
+				tx:              NewTransaction(sba, rba, 200, 1654369662, inputs, outputs),
 			},
-			txPool: NewTransactionPool(nil),
-			want:   false,
+			want: false,
 		},
 		"should return false when the sender is invalid": {
 			input: input{
-				senderPublicKey: blkcrypto.PublicKeyFromString("aed86cb86fe477183b5a9f452d2a7d26e81c9ce16b123c699cbc4cc61cb7111df24ceebf3cb316b5740c19451ed390e9a9b1f5070cef639808af535570b01ce1"),
-				signature:       blkcrypto.SignatureFromString("1dda674ee41218569a870993fe32fd3bf6a7bda3c657d4fae8fd0898adfdaf59eced8a5dd315f239c056197cf2b9a7a0bc4e941853be66e7e8a8427b14b9006b"),
-				tx:              NewTransaction("15TZoyyxFmeTXJGjYwX1X3ARtXX94BbFrc", "1CHD4Jjqsak4RV5JHAdYZ9CKY1dQe4tkXW", 200, 1654369662),
+				senderPublicKey: &account.privateKey.PublicKey,
+				signature:       signature,
+				tx:              NewTransaction(other.address, rba, 200, 1654369662, inputs, outputs),
 			},
-			txPool: NewTransactionPool(nil),
-			want:   false,
+			want: false,
 		},
 		"should return false when the receiver is invalid": {
 			input: input{
-				senderPublicKey: blkcrypto.PublicKeyFromString("aed86cb86fe477183b5a9f452d2a7d26e81c9ce16b123c699cbc4cc61cb7111df24ceebf3cb316b5740c19451ed390e9a9b1f5070cef639808af535570b01ce1"),
-				signature:       blkcrypto.SignatureFromString("1dda674ee41218569a870993fe32fd3bf6a7bda3c657d4fae8fd0898adfdaf59eced8a5dd315f239c056197cf2b9a7a0bc4e941853be66e7e8a8427b14b9006b"),
-				tx:              NewTransaction("15TZoyyxFmeTXJGjYwX1X3ARtXX94BbFrk", "1CHD4Jjqsak4RV5JHAdYZ9CKY1dQe4tkXS", 200, 1654369662),
+				senderPublicKey: &account.privateKey.PublicKey,
+				signature:       signature,
+				tx:              NewTransaction(sba, "1CHD4Jjqsak4RV5JHAdYZ9CKY1dQe4tkXS", 200, 1654369662, inputs, outputs),
 			},
-			txPool: NewTransactionPool(nil),
-			want:   false,
+			want: false,
 		},
 		"should return false when the amount is invalid": {
 			input: input{
-				senderPublicKey: blkcrypto.PublicKeyFromString("aed86cb86fe477183b5a9f452d2a7d26e81c9ce16b123c699cbc4cc61cb7111df24ceebf3cb316b5740c19451ed390e9a9b1f5070cef639808af535570b01ce1"),
-				signature:       blkcrypto.SignatureFromString("1dda674ee41218569a870993fe32fd3bf6a7bda3c657d4fae8fd0898adfdaf59eced8a5dd315f239c056197cf2b9a7a0bc4e941853be66e7e8a8427b14b9006b"),
-				tx:              NewTransaction("15TZoyyxFmeTXJGjYwX1X3ARtXX94BbFrk", "1CHD4Jjqsak4RV5JHAdYZ9CKY1dQe4tkXW", 201, 1654369662),
+				senderPublicKey: &account.privateKey.PublicKey,
+				signature:       signature,
+				tx:              NewTransaction(sba, rba, 201, 1654369662, inputs, outputs),
 			},
-			txPool: NewTransactionPool(nil),
-			want:   false,
+			want: false,
 		},
 		"should return false when the timestamp is invalid": {
 			input: input{
-				senderPublicKey: blkcrypto.PublicKeyFromString("aed86cb86fe477183b5a9f452d2a7d26e81c9ce16b123c699cbc4cc61cb7111df24ceebf3cb316b5740c19451ed390e9a9b1f5070cef639808af535570b01ce1"),
-				signature:       blkcrypto.SignatureFromString("1dda674ee41218569a870993fe32fd3bf6a7bda3c657d4fae8fd0898adfdaf59eced8a5dd315f239c056197cf2b9a7a0bc4e941853be66e7e8a8427b14b9006b"),
-				tx:              NewTransaction("15TZoyyxFmeTXJGjYwX1X3ARtXX94BbFrk", "1CHD4Jjqsak4RV5JHAdYZ9CKY1dQe4tkXW", 200, 1654369661),
+				senderPublicKey: &account.privateKey.PublicKey,
+				signature:       signature,
+				tx:              NewTransaction(sba, rba, 200, 1654369661, inputs, outputs),
 			},
-			txPool: NewTransactionPool(nil),
-			want:   false,
+			want: false,
 		},
 	}
 
 	for name, tc := range tests {
 		t.Run(name, func(t *testing.T) {
-			got := tc.txPool.verifyTransactionSignature(tc.input.senderPublicKey, tc.input.signature, tc.input.tx)
+			tc.input.tx.chainID = testChainID
+			tc.input.tx.SetWitness(tc.input.senderPublicKey, tc.input.signature)
+			got := tc.input.tx.Verify(testChainID) == nil
 			if got != tc.want {
-				t.Errorf("got %v, want %v", got, tc.want)
+				t.Errorf("Verify() == nil is %v, want %v", got, tc.want)
 			}
 		})
 	}
@@ -99,39 +190,85 @@ func TestTransactionPool_VerifyTransactionSignature(t *testing.T) {
 
 func TestTransactionPool_AddAndVerifyTransaction(t *testing.T) {
 
-	sba := "15TZoyyxFmeTXJGjYwX1X3ARtXX94BbFrk"
+	account := newTestAccount()
+	sba := account.address
 	invalid_sba := "15TZoyyxFmeTXJGjYwX1X3ARtXX94BbFrl"
 	rba := "1CHD4Jjqsak4RV5JHAdYZ9CKY1dQe4tkXW"
-	spk := "aed86cb86fe477183b5a9f452d2a7d26e81c9ce16b123c699cbc4cc61cb7111df24ceebf3cb316b5740c19451ed390e9a9b1f5070cef639808af535570b01ce1"
-	value := float32(200)
 	timestamp := int64(1654369662)
-	sig := "1dda674ee41218569a870993fe32fd3bf6a7bda3c657d4fae8fd0898adfdaf59eced8a5dd315f239c056197cf2b9a7a0bc4e941853be66e7e8a8427b14b9006b"
+	utxos, fundingID := newFundedUTXOSet(NewTxOutput(sba, 500), NewTxOutput(rba, 100))
 
 	tests := map[string]struct {
-		input          *dto.TransactionRequest
+		input          func() *dto.TransactionRequest
+		pending        *Transaction
 		want           bool
 		expectedLenght int
 	}{
 		"should return true when the transaction is valid": {
-			input: &dto.TransactionRequest{
-				SenderBlockchainAddress:    &sba,
-				RecipientBlockchainAddress: &rba,
-				SenderPublicKey:            &spk,
-				Value:                      &value,
-				Timestamp:                  &timestamp,
-				Signature:                  &sig,
+			input: func() *dto.TransactionRequest {
+				return account.request(NewTransaction(sba, rba, 200, timestamp,
+					[]*TxInput{NewTxInput(fundingID, 0)},
+					[]*TxOutput{NewTxOutput(rba, 200), NewTxOutput(sba, 300)}))
 			},
 			want:           true,
 			expectedLenght: 1,
 		},
 		"should return false when the sendeer blockchain address is not valid in the transaction": {
-			input: &dto.TransactionRequest{
-				SenderBlockchainAddress:    &invalid_sba,
-				RecipientBlockchainAddress: &rba,
-				SenderPublicKey:            &spk,
-				Value:                      &value,
-				Timestamp:                  &timestamp,
-				Signature:                  &sig,
+			input: func() *dto.TransactionRequest {
+				tr := account.request(NewTransaction(sba, rba, 200, timestamp,
+					[]*TxInput{NewTxInput(fundingID, 0)},
+					[]*TxOutput{NewTxOutput(rba, 200)}))
+				tr.SenderBlockchainAddress = &invalid_sba
+				return tr
+			},
+			want:           false,
+			expectedLenght: 0,
+		},
+		"should return false when the transaction spends more than its inputs": {
+			input: func() *dto.TransactionRequest {
+				return account.request(NewTransaction(sba, rba, 600, timestamp,
+					[]*TxInput{NewTxInput(fundingID, 0)},
+					[]*TxOutput{NewTxOutput(rba, 600)}))
+			},
+			want:           false,
+			expectedLenght: 0,
+		},
+		"should return false when the input does not exist": {
+			input: func() *dto.TransactionRequest {
+				return account.request(NewTransaction(sba, rba, 200, timestamp,
+					[]*TxInput{NewTxInput(fundingID, 5)},
+					[]*TxOutput{NewTxOutput(rba, 200)}))
+			},
+			want:           false,
+			expectedLenght: 0,
+		},
+		"should return false when the input belongs to another address": {
+			input: func() *dto.TransactionRequest {
+				return account.request(NewTransaction(sba, rba, 100, timestamp,
+					[]*TxInput{NewTxInput(fundingID, 1)},
+					[]*TxOutput{NewTxOutput(rba, 100)}))
+			},
+			want:           false,
+			expectedLenght: 0,
+		},
+		"should return false when the input is spent by a transaction of the pool": {
+			input: func() *dto.TransactionRequest {
+				return account.request(NewTransaction(sba, rba, 200, timestamp,
+					[]*TxInput{NewTxInput(fundingID, 0)},
+					[]*TxOutput{NewTxOutput(rba, 200)}))
+			},
+			pending: NewTransaction(sba, sba, 500, timestamp,
+				[]*TxInput{NewTxInput(fundingID, 0)},
+				[]*TxOutput{NewTxOutput(sba, 500)}),
+			want:           false,
+			expectedLenght: 1,
+		},
+		"should return false when the transaction is signed for another chain": {
+			input: func() *dto.TransactionRequest {
+				tx := NewTransaction(sba, rba, 200, timestamp,
+					[]*TxInput{NewTxInput(fundingID, 0)},
+					[]*TxOutput{NewTxOutput(rba, 200), NewTxOutput(sba, 300)})
+				tx.chainID = "other"
+				return account.request(tx)
 			},
 			want:           false,
 			expectedLenght: 0,
@@ -140,71 +277,60 @@ func TestTransactionPool_AddAndVerifyTransaction(t *testing.T) {
 
 	for name, tc := range tests {
 		t.Run(name, func(t *testing.T) {
-			txPool := NewTransactionPool(nil)
-			got := txPool.AddAndVerifyTransaction(tc.input)
+			txPool := NewTransactionPool(nil, utxos, testChainID)
+			if tc.pending != nil {
+				txPool.Add(tc.pending)
+			}
+			got := txPool.AddAndVerifyTransaction(tc.input())
 			if got != tc.want {
 				t.Errorf("got %v, want %v", got, tc.want)
 			}
-			if len(txPool.transactions) != tc.expectedLenght {
-				t.Errorf("got %v, want %v", len(txPool.transactions), tc.expectedLenght)
+			if len(txPool.entries) != tc.expectedLenght {
+				t.Errorf("got %v, want %v", len(txPool.entries), tc.expectedLenght)
 			}
 		})
 	}
 
 }
 
-func TestTransactionPool_Copy(t *testing.T) {
+func TestTransactionPool_RejectsMinedTransactions(t *testing.T) {
 
-	sba := "15TZoyyxFmeTXJGjYwX1X3ARtXX94BbFrk"
+	account := newTestAccount()
+	sba := account.address
 	rba := "1CHD4Jjqsak4RV5JHAdYZ9CKY1dQe4tkXW"
-	spk := "aed86cb86fe477183b5a9f452d2a7d26e81c9ce16b123c699cbc4cc61cb7111df24ceebf3cb316b5740c19451ed390e9a9b1f5070cef639808af535570b01ce1"
-	value := float32(200)
 	timestamp := int64(1654369662)
-	sig := "1dda674ee41218569a870993fe32fd3bf6a7bda3c657d4fae8fd0898adfdaf59eced8a5dd315f239c056197cf2b9a7a0bc4e941853be66e7e8a8427b14b9006b"
+	utxos, fundingID := newFundedUTXOSet(NewTxOutput(sba, 500))
 
 	tests := map[string]struct {
-		input func() *TransactionPool
-		want  []*Transaction
+		ledger Ledger
+		tx     *Transaction
 	}{
-		"should return a copy of the transaction pool": {
-			input: func() *TransactionPool {
-				txPool := NewTransactionPool(nil)
-				txPool.AddAndVerifyTransaction(&dto.TransactionRequest{
-					SenderBlockchainAddress:    &sba,
-					RecipientBlockchainAddress: &rba,
-					SenderPublicKey:            &spk,
-					Signature:                  &sig,
-					Value:                      &value,
-					Timestamp:                  &timestamp,
-				})
-				return txPool
-			},
-			want: []*Transaction{
-				{
-					senderBlockchainAddress:    sba,
-					recipientBlockchainAddress: rba,
-					value:                      value,
-					timestamp:                  timestamp,
-				},
-			},
+		"should reject a mined transaction that spends outputs": {
+			ledger: utxos,
+			tx: NewTransaction(sba, rba, 500, timestamp,
+				[]*TxInput{NewTxInput(fundingID, 0)},
+				[]*TxOutput{NewTxOutput(rba, 500)}),
 		},
-		"should return an empty slice when the transaction pool is empty": {
-			input: func() *TransactionPool {
-				return NewTransactionPool(nil)
-			},
-			want: []*Transaction{},
+		"should reject a mined transaction with a nonce": {
+			ledger: newFundedState(sba, 100),
+			tx:     NewAccountTransaction(sba, rba, 10, timestamp, 0),
 		},
 	}
 
 	for name, tc := range tests {
 		t.Run(name, func(t *testing.T) {
-			txPool := tc.input()
-			got := txPool.Copy()
-			if !reflect.DeepEqual(got, tc.want) {
-				t.Errorf("got %v, want %v", got, tc.want)
+			tr := account.request(tc.tx)
+			txPool := NewTransactionPool(nil, tc.ledger, testChainID)
+			if !txPool.AddAndVerifyTransaction(tr) {
+				t.Fatalf("the transaction should be accepted before it is mined")
+			}
+			block := NewBlock(2, 0, [32]byte{1}, txPool.Transactions())
+			if err := tc.ledger.ApplyBlock(block); err != nil {
+				t.Fatalf("ApplyBlock() = %v", err)
 			}
-			if txPool.Length() > 0 {
-				t.Errorf("got %v, want %v", txPool.Length(), 0)
+			txPool.UpdateFromBlock(block)
+			if txPool.AddAndVerifyTransaction(tr) {
+				t.Errorf("the same request should be rejected once the transaction is mined")
 			}
 		})
 	}
@@ -212,24 +338,31 @@ func TestTransactionPool_Copy(t *testing.T) {
 
 func TestTransactionPool_UpdateFromBlock(t *testing.T) {
 
-	sba := "15TZoyyxFmeTXJGjYwX1X3ARtXX94BbFrk"
+	account := newTestAccount()
+	sba := account.address
 	rba := "1CHD4Jjqsak4RV5JHAdYZ9CKY1dQe4tkXW"
-	spk := "aed86cb86fe477183b5a9f452d2a7d26e81c9ce16b123c699cbc4cc61cb7111df24ceebf3cb316b5740c19451ed390e9a9b1f5070cef639808af535570b01ce1"
-	value := float32(200)
+	value := coin.Coins(200)
 	timestamp := int64(1654369662)
-	sig := "1dda674ee41218569a870993fe32fd3bf6a7bda3c657d4fae8fd0898adfdaf59eced8a5dd315f239c056197cf2b9a7a0bc4e941853be66e7e8a8427b14b9006b"
 
-	sba1 := "14Zd3uAwyovSpuscsE7oYhPUko346z6Zne"
+	account1 := newTestAccount()
+	sba1 := account1.address
 	rba1 := "1JkfWtkFzLHKoa33Vimaxcctc3z2HNWoet"
-	spk1 := "b5238d60aa4f89da3b2fd6e1f61912ed567b9c92f7b920ef15c2677c9638b497669820ff0f419d9104c82bce464af6c0467498f092bfcd938dc5060c9e83729b"
-	value1 := float32(450)
+	value1 := coin.Coins(450)
 	timestamp1 := int64(1654689626)
-	sig1 := "cc08d0df645f1a87a97f1974bd86d3cc1d647849d961b1a5675bd3d56bb8e79e99a17255f1f7a4e09900d84837bf906c5669ad0953b56dd7d6f712328070cb97"
+
+	funding := []*TxOutput{NewTxOutput(sba, value), NewTxOutput(sba1, value1)}
+	_, fundingID := newFundedUTXOSet(funding...)
+	tx := NewTransaction(sba, rba, value, timestamp,
+		[]*TxInput{NewTxInput(fundingID, 0)},
+		[]*TxOutput{NewTxOutput(rba, value)})
+	tx1 := NewTransaction(sba1, rba1, value1, timestamp1,
+		[]*TxInput{NewTxInput(fundingID, 1)},
+		[]*TxOutput{NewTxOutput(rba1, value1)})
 
 	tests := map[string]struct {
 		input  func() *Block
-		txPool func() *TransactionPool
-		want   []*Transaction
+		txPool func(ledger Ledger) *TransactionPool
+		want   string
 	}{
 		"should return a slice with only one transaction ": {
 			input: func() *Block {
@@ -240,48 +373,321 @@ func TestTransactionPool_UpdateFromBlock(t *testing.T) {
 							recipientBlockchainAddress: rba,
 							value:                      value,
 							timestamp:                  timestamp,
+							inputs:                     []*TxInput{NewTxInput(fundingID, 0)},
+							outputs:                    []*TxOutput{NewTxOutput(rba, value)},
 						},
 					},
 				}
 			},
-			txPool: func() *TransactionPool {
-				txPool := NewTransactionPool(nil)
-				txPool.AddAndVerifyTransaction(&dto.TransactionRequest{
-					SenderBlockchainAddress:    &sba,
-					RecipientBlockchainAddress: &rba,
-					SenderPublicKey:            &spk,
-					Signature:                  &sig,
-					Value:                      &value,
-					Timestamp:                  &timestamp,
-				})
-
-				txPool.AddAndVerifyTransaction(&dto.TransactionRequest{
-					SenderBlockchainAddress:    &sba1,
-					RecipientBlockchainAddress: &rba1,
-					SenderPublicKey:            &spk1,
-					Signature:                  &sig1,
-					Value:                      &value1,
-					Timestamp:                  &timestamp1,
-				})
+			txPool: func(ledger Ledger) *TransactionPool {
+				txPool := NewTransactionPool(nil, ledger, testChainID)
+				txPool.AddAndVerifyTransaction(account.request(tx))
+				txPool.AddAndVerifyTransaction(account1.request(tx1))
 				return txPool
 			},
+			want: sba1,
+		},
+		"should remove the transactions that spend the outputs spent by the block": {
+			input: func() *Block {
+				return &Block{
+					transactions: []*Transaction{
+						NewTransaction(sba, sba, value, timestamp1,
+							[]*TxInput{NewTxInput(fundingID, 0)},
+							[]*TxOutput{NewTxOutput(sba, value)}),
+					},
+				}
+			},
+			txPool: func(ledger Ledger) *TransactionPool {
+				txPool := NewTransactionPool(nil, ledger, testChainID)
+				txPool.AddAndVerifyTransaction(account.request(tx))
+				txPool.AddAndVerifyTransaction(account1.request(tx1))
+				return txPool
+			},
+			want: sba1,
 		},
 	}
 
 	for name, tc := range tests {
 		t.Run(name, func(t *testing.T) {
+			utxos, _ := newFundedUTXOSet(funding...)
 			block := tc.input()
-			txPool := tc.txPool()
+			txPool := tc.txPool(utxos)
+			if err := utxos.ApplyBlock(block); err != nil {
+				t.Fatalf("ApplyBlock() = %v", err)
+			}
 			txPool.UpdateFromBlock(block)
 
-			if len(txPool.transactions) != 1 {
-				t.Errorf("got %v, want %v", len(txPool.transactions), 1)
+			if len(txPool.entries) != 1 {
+				t.Errorf("got %v, want %v", len(txPool.entries), 1)
 			}
 
-			if txPool.Transactions()[0].senderBlockchainAddress != sba1 {
-				t.Errorf("got %v, want %v", txPool.Transactions()[0].senderBlockchainAddress, sba1)
+			if txPool.Transactions()[0].senderBlockchainAddress != tc.want {
+				t.Errorf("got %v, want %v", txPool.Transactions()[0].senderBlockchainAddress, tc.want)
 			}
 
 		})
 	}
 }
+
+func TestTransactionPool_SelectTransactions(t *testing.T) {
+
+	sba := "15TZoyyxFmeTXJGjYwX1X3ARtXX94BbFrk"
+	rba := "1CHD4Jjqsak4RV5JHAdYZ9CKY1dQe4tkXW"
+	timestamp := int64(1654369662)
+
+	utxos, fundingID := newFundedUTXOSet(NewTxOutput(sba, 100), NewTxOutput(sba, 100), NewTxOutput(sba, 100))
+	spend := func(txID [32]byte, index uint32, fee coin.Amount) *Transaction {
+		return withFee(NewTransaction(sba, rba, 100-fee, timestamp, []*TxInput{NewTxInput(txID, index)},
+			[]*TxOutput{NewTxOutput(sba, 100-fee)}), fee)
+	}
+	low := spend(fundingID, 0, 1)
+	high := spend(fundingID, 1, 10)
+	none := spend(fundingID, 2, 0)
+	// child - Spends the output of low, so it can only go after it although it pays more.
+	child := withFee(NewTransaction(sba, rba, 80, timestamp, []*TxInput{NewTxInput(low.Hash(), 0)},
+		[]*TxOutput{NewTxOutput(rba, 80)}), 19)
+
+	tests := map[string]struct {
+		maxCount int
+		maxSize  int
+		want     []*Transaction
+	}{
+		"should order the transactions by fee rate and put dependencies first": {
+			maxCount: 10,
+			maxSize:  DEFAULT_MAX_BLOCK_SIZE,
+			want:     []*Transaction{high, low, none, child},
+		},
+		"should select at most max count transactions": {
+			maxCount: 2,
+			maxSize:  DEFAULT_MAX_BLOCK_SIZE,
+			want:     []*Transaction{high, low},
+		},
+		"should select the transactions that fit in max size": {
+			maxCount: 10,
+			maxSize:  high.Size() + low.Size() + none.Size(),
+			want:     []*Transaction{high, low, none},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			txPool := NewTransactionPool(nil, utxos, testChainID)
+			for _, tx := range []*Transaction{none, low, child, high} {
+				if err := txPool.addIfValid(tx, time.Now()); err != nil {
+					t.Fatalf("addIfValid() = %v", err)
+				}
+			}
+
+			got := txPool.SelectTransactions(tc.maxCount, tc.maxSize)
+			if len(got) != len(tc.want) {
+				t.Fatalf("len(SelectTransactions()) = %d, want %d", len(got), len(tc.want))
+			}
+			for i := range got {
+				if got[i].ID() != tc.want[i].ID() {
+					t.Errorf("SelectTransactions()[%d] fee = %s, want fee %s", i, got[i].fee, tc.want[i].fee)
+				}
+			}
+			if txPool.Length() != 4 {
+				t.Errorf("Length() = %d, want 4, the selected transactions stay in the pool", txPool.Length())
+			}
+		})
+	}
+}
+
+func TestTransactionPool_Limits(t *testing.T) {
+
+	sba := "15TZoyyxFmeTXJGjYwX1X3ARtXX94BbFrk"
+	sba1 := "1JkfWtkFzLHKoa33Vimaxcctc3z2HNWoet"
+	rba := "1CHD4Jjqsak4RV5JHAdYZ9CKY1dQe4tkXW"
+	timestamp := int64(1654369662)
+	now := time.Unix(timestamp, 0)
+
+	utxos, fundingID := newFundedUTXOSet(NewTxOutput(sba, 100), NewTxOutput(sba, 100), NewTxOutput(sba, 100),
+		NewTxOutput(sba1, 100))
+	// spend - Spends the funding output with the index, paying the fee. The spends have the same size.
+	spend := func(index uint32, fee coin.Amount) *Transaction {
+		sender := sba
+		if index == 3 {
+			sender = sba1
+		}
+		return withFee(NewTransaction(sender, rba, 100-fee, timestamp, []*TxInput{NewTxInput(fundingID, index)},
+			[]*TxOutput{NewTxOutput(rba, 100-fee)}), fee)
+	}
+	parent := spend(0, 10)
+	child := withFee(NewTransaction(rba, sba, 80, timestamp, []*TxInput{NewTxInput(parent.Hash(), 0)},
+		[]*TxOutput{NewTxOutput(sba, 80)}), 10)
+	state := newFundedState(sba, 100)
+	nonce0 := withFee(NewAccountTransaction(sba, rba, 10, timestamp, 0), 1)
+	nonce1 := withFee(NewAccountTransaction(sba, rba, 10, timestamp, 1), 1)
+	replacement := withFee(NewAccountTransaction(sba, rba, 20, timestamp, 0), 5)
+
+	tests := map[string]struct {
+		ledger  Ledger
+		limits  MempoolLimits
+		pending []*Transaction
+		input   *Transaction
+		// after - Time between the pending transactions and the input.
+		after    time.Duration
+		want     error
+		wantPool []*Transaction
+	}{
+		"should replace a transaction that spends the same output with a higher fee": {
+			pending:  []*Transaction{spend(0, 10)},
+			input:    spend(0, 11),
+			wantPool: []*Transaction{spend(0, 11)},
+		},
+		"should reject a replacement that does not pay the fee bump": {
+			pending:  []*Transaction{spend(0, 20)},
+			input:    spend(0, 21),
+			want:     ErrReplacementUnderpriced,
+			wantPool: []*Transaction{spend(0, 20)},
+		},
+		"should remove the transactions that depend on the replaced one": {
+			pending:  []*Transaction{parent, child, spend(1, 1)},
+			input:    spend(0, 30),
+			wantPool: []*Transaction{spend(0, 30), spend(1, 1)},
+		},
+		"should replace a transaction with the same nonce in its place": {
+			ledger:   state,
+			pending:  []*Transaction{nonce0, nonce1},
+			input:    replacement,
+			wantPool: []*Transaction{replacement, nonce1},
+		},
+		"should reject a transaction the balance left by the pending ones does not cover": {
+			ledger:   state,
+			pending:  []*Transaction{nonce0},
+			input:    withFee(NewAccountTransaction(sba, rba, 95, timestamp, 1), 1),
+			want:     ErrInsufficientFunds,
+			wantPool: []*Transaction{nonce0},
+		},
+		"should evict the transaction with the lowest fee rate when the pool is full": {
+			limits:   MempoolLimits{MaxTransactions: 2},
+			pending:  []*Transaction{spend(0, 5), spend(1, 1)},
+			input:    spend(2, 3),
+			wantPool: []*Transaction{spend(0, 5), spend(2, 3)},
+		},
+		"should evict transactions when the pool is over its size": {
+			limits:   MempoolLimits{MaxSize: 2 * spend(0, 1).Size()},
+			pending:  []*Transaction{spend(0, 5), spend(1, 1)},
+			input:    spend(2, 3),
+			wantPool: []*Transaction{spend(0, 5), spend(2, 3)},
+		},
+		"should reject a transaction when the pool is full of higher fee rates": {
+			limits:   MempoolLimits{MaxTransactions: 2},
+			pending:  []*Transaction{spend(0, 5), spend(1, 3)},
+			input:    spend(2, 3),
+			want:     ErrMempoolFull,
+			wantPool: []*Transaction{spend(0, 5), spend(1, 3)},
+		},
+		"should reject a transaction over the limit of its sender": {
+			limits:   MempoolLimits{MaxPerSender: 2},
+			pending:  []*Transaction{spend(0, 1), spend(1, 1)},
+			input:    spend(2, 1),
+			want:     ErrSenderLimit,
+			wantPool: []*Transaction{spend(0, 1), spend(1, 1)},
+		},
+		"should accept a transaction of another sender": {
+			limits:   MempoolLimits{MaxPerSender: 2},
+			pending:  []*Transaction{spend(0, 1), spend(1, 1)},
+			input:    spend(3, 1),
+			wantPool: []*Transaction{spend(0, 1), spend(1, 1), spend(3, 1)},
+		},
+		"should remove the transactions older than the TTL": {
+			limits:   MempoolLimits{TTL: time.Minute},
+			pending:  []*Transaction{parent, child},
+			input:    spend(1, 1),
+			after:    2 * time.Minute,
+			wantPool: []*Transaction{spend(1, 1)},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			ledger := tc.ledger
+			if ledger == nil {
+				ledger = utxos
+			}
+			txPool := NewTransactionPool(nil, ledger, testChainID)
+			txPool.SetLimits(tc.limits)
+			for _, tx := range tc.pending {
+				if err := txPool.addIfValid(tx, now); err != nil {
+					t.Fatalf("addIfValid() = %v", err)
+				}
+			}
+
+			if err := txPool.addIfValid(tc.input, now.Add(tc.after)); !errors.Is(err, tc.want) {
+				t.Errorf("addIfValid() = %v, want %v", err, tc.want)
+			}
+			got := txPool.Transactions()
+			if len(got) != len(tc.wantPool) {
+				t.Fatalf("len(Transactions()) = %d, want %d", len(got), len(tc.wantPool))
+			}
+			for i := range got {
+				if got[i].ID() != tc.wantPool[i].ID() {
+					t.Errorf("Transactions()[%d] = %s, want %s", i, got[i].ID(), tc.wantPool[i].ID())
+				}
+			}
+		})
+	}
+}
+
+func TestTransactionPool_Status(t *testing.T) {
+
+	sba := "15TZoyyxFmeTXJGjYwX1X3ARtXX94BbFrk"
+	rba := "1CHD4Jjqsak4RV5JHAdYZ9CKY1dQe4tkXW"
+	timestamp := int64(1654369662)
+	utxos, fundingID := newFundedUTXOSet(NewTxOutput(sba, 100))
+	spend := func(fee coin.Amount) *Transaction {
+		return withFee(NewTransaction(sba, rba, 100-fee, timestamp, []*TxInput{NewTxInput(fundingID, 0)},
+			[]*TxOutput{NewTxOutput(rba, 100-fee)}), fee)
+	}
+
+	tests := map[string]struct {
+		pending    []*Transaction
+		txID       string
+		want       TxStatus
+		wantReason string
+		wantErr    error
+	}{
+		"should return pending for a transaction of the pool": {
+			pending: []*Transaction{spend(1)},
+			txID:    spend(1).ID(),
+			want:    TX_STATUS_PENDING,
+		},
+		"should return dropped and the reason for a replaced transaction": {
+			pending:    []*Transaction{spend(1), spend(10)},
+			txID:       spend(1).ID(),
+			want:       TX_STATUS_DROPPED,
+			wantReason: "replaced by " + spend(10).ID(),
+		},
+		"should return the replacement that removed the transaction from the pool": {
+			pending:    []*Transaction{spend(1), spend(10), spend(20)},
+			txID:       spend(10).ID(),
+			want:       TX_STATUS_DROPPED,
+			wantReason: "replaced by " + spend(20).ID(),
+		},
+		"should return an error for an unknown transaction": {
+			txID:    spend(1).ID(),
+			wantErr: ErrTransactionNotFound,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			txPool := NewTransactionPool(nil, utxos, testChainID)
+			for _, tx := range tc.pending {
+				if err := txPool.addIfValid(tx, time.Now()); err != nil {
+					t.Fatalf("addIfValid() = %v", err)
+				}
+			}
+
+			got, reason, err := txPool.Status(tc.txID)
+			if !errors.Is(err, tc.wantErr) {
+				t.Fatalf("Status() = %v, want %v", err, tc.wantErr)
+			}
+			if got != tc.want || reason != tc.wantReason {
+				t.Errorf("Status() = %q %q, want %q %q", got, reason, tc.want, tc.wantReason)
+			}
+		})
+	}
+}
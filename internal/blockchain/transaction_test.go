@@ -0,0 +1,203 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/martinsaporiti/blockchain-sample/internal/blkcrypto"
+	"github.com/martinsaporiti/blockchain-sample/internal/codec"
+	"github.com/martinsaporiti/blockchain-sample/internal/coin"
+)
+
+func TestTransaction_Verify(t *testing.T) {
+
+	account := newTestAccount()
+	other := newTestAccount()
+	sba := account.address
+	rba := "1CHD4Jjqsak4RV5JHAdYZ9CKY1dQe4tkXW"
+	inputs := []*TxInput{NewTxInput([32]byte{1}, 0)}
+	outputs := []*TxOutput{NewTxOutput(rba, 200)}
+	tx := NewTransaction(sba, rba, 200, 1654369662, inputs, outputs)
+	sig := blkcrypto.SignatureFromString(account.sign(tx))
+
+	// withWitness - Attaches the public key and the signature to the transaction of the test chain.
+	withWitness := func(t *Transaction, a *testAccount, s *blkcrypto.Signature) *Transaction {
+		t.chainID = testChainID
+		t.SetWitness(&a.privateKey.PublicKey, s)
+		return t
+	}
+	// forChain - Sets the chain ID of the transaction.
+	forChain := func(t *Transaction, chainID string) *Transaction {
+		t.chainID = chainID
+		return t
+	}
+
+	tests := map[string]struct {
+		input *Transaction
+		want  error
+	}{
+		"should return nil when the signature is valid": {
+			input: withWitness(NewTransaction(sba, rba, 200, 1654369662, inputs, outputs), account, sig),
+		},
+		"should return an error when the signature is invalid": {
+			input: withWitness(NewTransaction(sba, rba, 200, 1654369662, inputs, outputs), account,
+				blkcrypto.SignatureFromString(other.sign(tx))),
+			want: ErrInvalidSignature,
+		},
+		"should return an error when the public key does not derive the sender address": {
+			input: withWitness(NewTransaction(sba, rba, 200, 1654369662, inputs, outputs), other, sig),
+			want:  ErrWrongSenderKey,
+		},
+		"should return an error when the transaction is signed by the owner of another address": {
+			input: other.signed(NewTransaction(sba, rba, 200, 1654369662, inputs, outputs)),
+			want:  ErrWrongSenderKey,
+		},
+		"should return an error when the sender is invalid": {
+			input: withWitness(NewTransaction(other.address, rba, 200, 1654369662, inputs, outputs), other, sig),
+			want:  ErrInvalidSignature,
+		},
+		"should return an error when the receiver is invalid": {
+			input: withWitness(NewTransaction(sba, "1CHD4Jjqsak4RV5JHAdYZ9CKY1dQe4tkXS", 200, 1654369662, inputs, outputs),
+				account, sig),
+			want: ErrInvalidSignature,
+		},
+		"should return an error when the amount is invalid": {
+			input: withWitness(NewTransaction(sba, rba, 201, 1654369662, inputs, outputs), account, sig),
+			want:  ErrInvalidSignature,
+		},
+		"should return an error when the timestamp is invalid": {
+			input: withWitness(NewTransaction(sba, rba, 200, 1654369661, inputs, outputs), account, sig),
+			want:  ErrInvalidSignature,
+		},
+		"should return an error when the outputs are invalid": {
+			input: withWitness(NewTransaction(sba, rba, 200, 1654369662, inputs, []*TxOutput{NewTxOutput(sba, 200)}),
+				account, sig),
+			want: ErrInvalidSignature,
+		},
+		"should return an error when the transaction is signed for another chain": {
+			input: account.signed(forChain(NewTransaction(sba, rba, 200, 1654369662, inputs, outputs), "other")),
+			want:  ErrWrongChainID,
+		},
+		"should return an error when the chain ID changes after the signature": {
+			input: forChain(withWitness(NewTransaction(sba, rba, 200, 1654369662, inputs, outputs), account, sig),
+				"other"),
+			want: ErrWrongChainID,
+		},
+		"should return an error when the transaction has no witness": {
+			input: NewTransaction(sba, rba, 200, 1654369662, inputs, outputs),
+			want:  ErrMissingWitness,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got := tc.input.Verify(testChainID)
+			if !errors.Is(got, tc.want) {
+				t.Errorf("Verify() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestTransaction_JSONKeepsWitness(t *testing.T) {
+
+	account := newTestAccount()
+	tx := account.signed(NewTransaction(account.address, "1CHD4Jjqsak4RV5JHAdYZ9CKY1dQe4tkXW", 200, 1654369662,
+		[]*TxInput{NewTxInput([32]byte{1}, 0)},
+		[]*TxOutput{NewTxOutput("1CHD4Jjqsak4RV5JHAdYZ9CKY1dQe4tkXW", 200)}))
+
+	m, err := json.Marshal(tx)
+	if err != nil {
+		t.Fatalf("Marshal() = %v", err)
+	}
+	var decoded Transaction
+	if err := json.Unmarshal(m, &decoded); err != nil {
+		t.Fatalf("Unmarshal() = %v", err)
+	}
+
+	if decoded.ID() != tx.ID() {
+		t.Errorf("ID() = %v, want %v", decoded.ID(), tx.ID())
+	}
+	if err := decoded.Verify(testChainID); err != nil {
+		t.Errorf("Verify() = %v, want nil", err)
+	}
+}
+
+func TestTransaction_ID(t *testing.T) {
+
+	tx := NewTransaction("A", "B", coin.Coins(2), 1654369662,
+		[]*TxInput{NewTxInput([32]byte{0xaa}, 1)},
+		[]*TxOutput{NewTxOutput("B", coin.Coins(2))})
+	tx.nonce = 7
+	tx.fee = 1000
+
+	// The same golden vector as the codec: the ID is the hash of the canonical encoding.
+	want := "064d93d77b0f473248b463590d497a2ffb2ad1508ea0d77fb55d4b1620fac36f"
+	if got := tx.ID(); got != want {
+		t.Errorf("ID() = %s, want %s", got, want)
+	}
+}
+
+func TestTransaction_MarshalBinary(t *testing.T) {
+
+	account := newTestAccount()
+	rba := "1CHD4Jjqsak4RV5JHAdYZ9CKY1dQe4tkXW"
+
+	tests := map[string]struct {
+		input *Transaction
+	}{
+		"should round trip a signed transaction": {
+			input: account.signed(NewTransaction(account.address, rba, 200, 1654369662,
+				[]*TxInput{NewTxInput([32]byte{1}, 0)},
+				[]*TxOutput{NewTxOutput(rba, coin.Coins(150)+coin.UNITS_PER_COIN/2), NewTxOutput(account.address, coin.Coins(49)+coin.UNITS_PER_COIN/2)})),
+		},
+		"should round trip an account transaction": {
+			input: account.signed(NewAccountTransaction(account.address, rba, coin.UNITS_PER_COIN/10, 1654369662, 3)),
+		},
+		"should round trip a staking transaction": {
+			input: account.signed(NewStakingTransaction(TX_KIND_BOND, account.address, coin.Coins(5), 1654369662, 4)),
+		},
+		"should round trip a coinbase": {
+			input: NewTransaction("THE BLOCKCHAIN", rba, MINING_REWARD, 1654369662,
+				[]*TxInput{NewCoinbaseInput(5)},
+				[]*TxOutput{NewTxOutput(rba, MINING_REWARD)}),
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			m, err := tc.input.MarshalBinary()
+			if err != nil {
+				t.Fatalf("MarshalBinary() = %v", err)
+			}
+			var decoded Transaction
+			if err := decoded.UnmarshalBinary(m); err != nil {
+				t.Fatalf("UnmarshalBinary() = %v", err)
+			}
+			if decoded.ID() != tc.input.ID() {
+				t.Errorf("ID() = %v, want %v", decoded.ID(), tc.input.ID())
+			}
+			if decoded.Kind() != tc.input.Kind() {
+				t.Errorf("Kind() = %v, want %v", decoded.Kind(), tc.input.Kind())
+			}
+			if err := decoded.Verify(testChainID); err != nil {
+				t.Errorf("Verify() = %v, want nil", err)
+			}
+			again, _ := decoded.MarshalBinary()
+			if !bytes.Equal(again, m) {
+				t.Errorf("MarshalBinary() of the decoded transaction = %x, want %x", again, m)
+			}
+		})
+	}
+
+	m, _ := tests["should round trip a signed transaction"].input.MarshalBinary()
+	var decoded Transaction
+	if err := decoded.UnmarshalBinary(m[:len(m)-1]); !errors.Is(err, codec.ErrUnexpectedEnd) {
+		t.Errorf("UnmarshalBinary() of truncated data = %v, want %v", err, codec.ErrUnexpectedEnd)
+	}
+	if err := decoded.UnmarshalBinary(append(m, 0)); !errors.Is(err, codec.ErrTrailingData) {
+		t.Errorf("UnmarshalBinary() with trailing data = %v, want %v", err, codec.ErrTrailingData)
+	}
+}
@@ -0,0 +1,149 @@
+package blockchain
+
+// TxStatus - What happened to a transaction the node has seen.
+type TxStatus string
+
+const (
+	// TX_STATUS_PENDING - The transaction waits in the pool to be mined.
+	TX_STATUS_PENDING TxStatus = "pending"
+	// TX_STATUS_CONFIRMED - The transaction is in a block of the main chain.
+	TX_STATUS_CONFIRMED TxStatus = "confirmed"
+	// TX_STATUS_DROPPED - The transaction left the pool without being mined: it was replaced, evicted,
+	// expired or it is no longer valid.
+	TX_STATUS_DROPPED TxStatus = "dropped"
+)
+
+// TxLocation - Where a transaction is in the main chain.
+type TxLocation struct {
+	BlockNumber int64
+	BlockHash   [32]byte
+	// Index - Position of the transaction in its block.
+	Index int
+	// Confirmations - Number of blocks of the main chain from the block of the transaction up to the tip,
+	// both included.
+	Confirmations int64
+}
+
+// AddressTransaction - A transaction of the main chain that touches an address, and where it is.
+type AddressTransaction struct {
+	Transaction *Transaction
+	Location    TxLocation
+}
+
+// txIndex - Location of the transactions of the main chain, by ID, and the IDs of the transactions that
+// touch every address, in chain order. It is updated when blocks join or leave the main chain.
+// It is not safe for concurrent use, the blockchain guards it with its mutex.
+type txIndex struct {
+	locations map[[32]byte]TxLocation
+	byAddress map[string][][32]byte
+}
+
+func newTxIndex() *txIndex {
+	return &txIndex{
+		locations: make(map[[32]byte]TxLocation),
+		byAddress: make(map[string][][32]byte),
+	}
+}
+
+// newTxIndexFromChain - Returns the index of the transactions of the chain.
+func newTxIndexFromChain(chain []*Block) *txIndex {
+	x := newTxIndex()
+	for _, b := range chain {
+		x.connect(b)
+	}
+	return x
+}
+
+// connect - Adds the transactions of a block that joins the main chain.
+func (x *txIndex) connect(b *Block) {
+	hash := b.Hash()
+	for i, t := range b.transactions {
+		id := t.Hash()
+		x.locations[id] = TxLocation{BlockNumber: b.Number(), BlockHash: hash, Index: i}
+		for _, address := range t.Addresses() {
+			x.byAddress[address] = append(x.byAddress[address], id)
+		}
+	}
+}
+
+// disconnect - Removes the transactions of a block that leaves the main chain, the last block connected.
+// A transaction that is also in a block of the new branch keeps that location.
+func (x *txIndex) disconnect(b *Block) {
+	hash := b.Hash()
+	for i := len(b.transactions) - 1; i >= 0; i-- {
+		t := b.transactions[i]
+		id := t.Hash()
+		if l, ok := x.locations[id]; ok && l.BlockHash == hash {
+			delete(x.locations, id)
+		}
+		for _, address := range t.Addresses() {
+			ids := x.byAddress[address]
+			if len(ids) > 0 && ids[len(ids)-1] == id {
+				ids = ids[:len(ids)-1]
+			}
+			if len(ids) == 0 {
+				delete(x.byAddress, address)
+			} else {
+				x.byAddress[address] = ids
+			}
+		}
+	}
+}
+
+func (x *txIndex) get(txID [32]byte) (TxLocation, bool) {
+	l, ok := x.locations[txID]
+	return l, ok
+}
+
+// TransactionLocation - Returns the block of the main chain that includes the transaction with the ID, and
+// the number of confirmations it has. Returns ErrTransactionNotFound if the transaction is not mined.
+func (bc *Blockchain) TransactionLocation(txID string) (TxLocation, error) {
+	id, err := decodeTxID(txID)
+	if err != nil {
+		return TxLocation{}, err
+	}
+
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+	l, ok := bc.txIndex.get(id)
+	if !ok {
+		return TxLocation{}, ErrTransactionNotFound
+	}
+	l.Confirmations = bc.store.Tip().Number() - l.BlockNumber + 1
+	return l, nil
+}
+
+// AddressHistory - Returns the transactions of the main chain that touch the address, the newest first,
+// skipping the first offset ones and at most limit of them, and how many transactions touch the address.
+func (bc *Blockchain) AddressHistory(blockchainAddress string, offset int, limit int) ([]*AddressTransaction,
+	int, error) {
+	if offset < 0 {
+		offset = 0
+	}
+	if limit < 0 {
+		limit = 0
+	}
+
+	// The blocks are read under the lock too, a reorganization could remove them from the store.
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+	ids := bc.txIndex.byAddress[blockchainAddress]
+	total := len(ids)
+	tip := bc.store.Tip().Number()
+	history := make([]*AddressTransaction, 0, limit)
+	blocks := make(map[[32]byte]*Block)
+	for i := total - 1 - offset; i >= 0 && len(history) < limit; i-- {
+		l, _ := bc.txIndex.get(ids[i])
+		l.Confirmations = tip - l.BlockNumber + 1
+		b, ok := blocks[l.BlockHash]
+		if !ok {
+			var err error
+			if b, err = bc.store.GetByHash(l.BlockHash); err != nil {
+				return nil, 0, err
+			}
+			blocks[l.BlockHash] = b
+		}
+		history = append(history, &AddressTransaction{Transaction: b.transactions[l.Index], Location: l})
+	}
+	return history, total, nil
+}
@@ -0,0 +1,195 @@
+package blockchain
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestBlockchain_TransactionLocation(t *testing.T) {
+
+	tests := map[string]struct {
+		// blocks - Returns the blocks proposed after a3.
+		blocks            func(f *forkTest) []*Block
+		txID              func(f *forkTest) string
+		wantBlock         func(f *forkTest) *Block
+		wantConfirmations int64
+		want              error
+	}{
+		"should locate a mined transaction": {
+			blocks:            func(f *forkTest) []*Block { return nil },
+			txID:              func(f *forkTest) string { return f.payment.ID() },
+			wantBlock:         func(f *forkTest) *Block { return f.a3 },
+			wantConfirmations: 1,
+		},
+		"should count the blocks on top of the transaction": {
+			blocks: func(f *forkTest) []*Block {
+				a4 := f.mine(f.a3, 1)
+				return []*Block{a4, f.mine(a4, 1)}
+			},
+			txID:              func(f *forkTest) string { return f.payment.ID() },
+			wantBlock:         func(f *forkTest) *Block { return f.a3 },
+			wantConfirmations: 3,
+		},
+		"should forget the transactions of the blocks that leave the main chain": {
+			blocks: func(f *forkTest) []*Block {
+				b3 := f.mine(f.fork, 2)
+				return []*Block{b3, f.mine(b3, 2)}
+			},
+			txID: func(f *forkTest) string { return f.payment.ID() },
+			want: ErrTransactionNotFound,
+		},
+		"should locate the transaction in the block of the new branch": {
+			blocks: func(f *forkTest) []*Block {
+				b3 := f.mine(f.fork, 2, f.payment)
+				return []*Block{b3, f.mine(b3, 2)}
+			},
+			txID: func(f *forkTest) string { return f.payment.ID() },
+			wantBlock: func(f *forkTest) *Block {
+				return f.blockchain.Chain()[2]
+			},
+			wantConfirmations: 2,
+		},
+		"should not locate a transaction of a side branch": {
+			blocks: func(f *forkTest) []*Block {
+				return []*Block{f.mine(f.fork, 2, f.payment)}
+			},
+			txID:              func(f *forkTest) string { return f.payment.ID() },
+			wantBlock:         func(f *forkTest) *Block { return f.a3 },
+			wantConfirmations: 1,
+		},
+		"should return an error when the ID is not valid": {
+			blocks: func(f *forkTest) []*Block { return nil },
+			txID:   func(f *forkTest) string { return "00ff" },
+			want:   ErrInvalidTxID,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			f := newForkTest(t)
+			for _, b := range tc.blocks(f) {
+				if err := f.blockchain.AddProposedBlockFromNetwork(b); err != nil {
+					t.Fatalf("AddProposedBlockFromNetwork() = %v", err)
+				}
+			}
+
+			got, err := f.blockchain.TransactionLocation(tc.txID(f))
+			if !errors.Is(err, tc.want) {
+				t.Fatalf("TransactionLocation() = %v, want %v", err, tc.want)
+			}
+			if tc.want != nil {
+				return
+			}
+			block := tc.wantBlock(f)
+			if got.BlockHash != block.Hash() || got.BlockNumber != block.Number() {
+				t.Errorf("TransactionLocation() = block %d %x, want block %d %x", got.BlockNumber, got.BlockHash,
+					block.Number(), block.Hash())
+			}
+			if block.transactions[got.Index].ID() != tc.txID(f) {
+				t.Errorf("TransactionLocation() index = %d, it is not the transaction", got.Index)
+			}
+			if got.Confirmations != tc.wantConfirmations {
+				t.Errorf("TransactionLocation() confirmations = %d, want %d", got.Confirmations, tc.wantConfirmations)
+			}
+		})
+	}
+}
+
+func TestBlockchain_AddressHistory(t *testing.T) {
+
+	sender := func(f *forkTest) string { return f.payment.SenderBlockchainAddress() }
+	recipient := func(f *forkTest) string { return f.recipient.address }
+	funding := func(f *forkTest) string { return f.fork.transactions[0].ID() }
+
+	tests := map[string]struct {
+		// blocks - Returns the blocks proposed after a3.
+		blocks  func(f *forkTest) []*Block
+		address func(f *forkTest) string
+		offset  int
+		limit   int
+		// want - Returns the IDs of the transactions expected, the newest first.
+		want      func(f *forkTest) []string
+		wantTotal int
+	}{
+		"should return the transactions of the address, the newest first": {
+			blocks:    func(f *forkTest) []*Block { return nil },
+			address:   sender,
+			limit:     10,
+			want:      func(f *forkTest) []string { return []string{f.payment.ID(), funding(f)} },
+			wantTotal: 2,
+		},
+		"should return a page of the transactions": {
+			blocks:    func(f *forkTest) []*Block { return nil },
+			address:   sender,
+			offset:    1,
+			limit:     1,
+			want:      func(f *forkTest) []string { return []string{funding(f)} },
+			wantTotal: 2,
+		},
+		"should return no transactions after the last page": {
+			blocks:    func(f *forkTest) []*Block { return nil },
+			address:   sender,
+			offset:    2,
+			limit:     10,
+			want:      func(f *forkTest) []string { return []string{} },
+			wantTotal: 2,
+		},
+		"should return no transactions for an unknown address": {
+			blocks:  func(f *forkTest) []*Block { return nil },
+			address: func(f *forkTest) string { return newTestAccount().address },
+			limit:   10,
+			want:    func(f *forkTest) []string { return []string{} },
+		},
+		"should forget the transactions of the blocks that leave the main chain": {
+			blocks: func(f *forkTest) []*Block {
+				b3 := f.mine(f.fork, 2)
+				return []*Block{b3, f.mine(b3, 2)}
+			},
+			address: recipient,
+			limit:   10,
+			want:    func(f *forkTest) []string { return []string{} },
+		},
+		"should keep the transactions mined again in the new branch": {
+			blocks: func(f *forkTest) []*Block {
+				b3 := f.mine(f.fork, 2, f.payment)
+				return []*Block{b3, f.mine(b3, 2)}
+			},
+			address:   sender,
+			limit:     10,
+			want:      func(f *forkTest) []string { return []string{f.payment.ID(), funding(f)} },
+			wantTotal: 2,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			f := newForkTest(t)
+			for _, b := range tc.blocks(f) {
+				if err := f.blockchain.AddProposedBlockFromNetwork(b); err != nil {
+					t.Fatalf("AddProposedBlockFromNetwork() = %v", err)
+				}
+			}
+
+			history, total, err := f.blockchain.AddressHistory(tc.address(f), tc.offset, tc.limit)
+			if err != nil {
+				t.Fatalf("AddressHistory() = %v", err)
+			}
+			if total != tc.wantTotal {
+				t.Errorf("AddressHistory() total = %d, want %d", total, tc.wantTotal)
+			}
+			want := tc.want(f)
+			if len(history) != len(want) {
+				t.Fatalf("AddressHistory() = %d transactions, want %d", len(history), len(want))
+			}
+			for i, h := range history {
+				if h.Transaction.ID() != want[i] {
+					t.Errorf("AddressHistory()[%d] = %s, want %s", i, h.Transaction.ID(), want[i])
+				}
+				block := f.blockchain.Chain()[h.Location.BlockNumber-1]
+				if block.Hash() != h.Location.BlockHash || block.transactions[h.Location.Index].ID() != want[i] {
+					t.Errorf("AddressHistory()[%d] location = %+v, it is not in the main chain", i, h.Location)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,351 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/martinsaporiti/blockchain-sample/internal/coin"
+)
+
+var (
+	ErrNoInputs             = errors.New("transaction has no inputs")
+	ErrNoOutputs            = errors.New("transaction has no outputs")
+	ErrInvalidOutputValue   = errors.New("transaction output value must be positive")
+	ErrInvalidFee           = errors.New("transaction fee must not be negative")
+	ErrMissingInput         = errors.New("transaction input does not exist or was already spent")
+	ErrDoubleSpend          = errors.New("transaction input is spent twice")
+	ErrWrongOwner           = errors.New("transaction input does not belong to the sender")
+	ErrOverspend            = errors.New("transaction spends more than its inputs")
+	ErrDuplicateTransaction = errors.New("transaction already exists")
+	ErrUnsupportedTxKind    = errors.New("transaction kind is not supported by the ledger")
+)
+
+// UnspentOutput - Output that was not spent yet and the outpoint that identifies it.
+type UnspentOutput struct {
+	OutPoint
+	Output *TxOutput
+}
+
+func (u *UnspentOutput) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		TxID              string      `json:"tx_id"`
+		Index             uint32      `json:"index"`
+		BlockchainAddress string      `json:"blockchain_address"`
+		Value             coin.Amount `json:"value"`
+	}{
+		TxID:              fmt.Sprintf("%x", u.TxID),
+		Index:             u.Index,
+		BlockchainAddress: u.Output.blockchainAddress,
+		Value:             u.Output.value,
+	})
+}
+
+// UTXOSet - Keeps every unspent output of the chain.
+// It is advanced block by block and keeps, for every block applied that is not final, the outputs it
+// spent so the block can be rolled back.
+type UTXOSet struct {
+	outputs   map[OutPoint]*TxOutput
+	byAddress map[string]map[OutPoint]struct{}
+	undo      map[[32]byte]*utxoUndo
+	mux       sync.RWMutex
+}
+
+// utxoUndo - The outputs a block spent, and its number.
+type utxoUndo struct {
+	number int64
+	spent  []*UnspentOutput
+}
+
+func NewUTXOSet() *UTXOSet {
+	return &UTXOSet{
+		outputs:   make(map[OutPoint]*TxOutput),
+		byAddress: make(map[string]map[OutPoint]struct{}),
+		undo:      make(map[[32]byte]*utxoUndo),
+	}
+}
+
+// Get - Returns the unspent output identified by the outpoint.
+func (u *UTXOSet) Get(op OutPoint) (*TxOutput, bool) {
+	u.mux.RLock()
+	defer u.mux.RUnlock()
+	out, ok := u.outputs[op]
+	return out, ok
+}
+
+// Balance - Returns the sum of the unspent outputs of a blockchain address.
+func (u *UTXOSet) Balance(blockchainAddress string) coin.Amount {
+	u.mux.RLock()
+	defer u.mux.RUnlock()
+	var total coin.Amount
+	for op := range u.byAddress[blockchainAddress] {
+		// Outputs are checked when they are created, the total supply can not overflow.
+		total += u.outputs[op].value
+	}
+	return total
+}
+
+// UnspentOutputs - Returns the unspent outputs of a blockchain address sorted by outpoint.
+func (u *UTXOSet) UnspentOutputs(blockchainAddress string) []*UnspentOutput {
+	u.mux.RLock()
+	defer u.mux.RUnlock()
+	utxos := make([]*UnspentOutput, 0, len(u.byAddress[blockchainAddress]))
+	for op := range u.byAddress[blockchainAddress] {
+		utxos = append(utxos, &UnspentOutput{OutPoint: op, Output: u.outputs[op]})
+	}
+	sort.Slice(utxos, func(i, j int) bool {
+		c := bytes.Compare(utxos[i].TxID[:], utxos[j].TxID[:])
+		return c < 0 || (c == 0 && utxos[i].Index < utxos[j].Index)
+	})
+	return utxos
+}
+
+// Nonce - Transactions of the UTXO model are not ordered by nonce.
+func (u *UTXOSet) Nonce(blockchainAddress string) uint64 {
+	return 0
+}
+
+// utxoView - Outputs created and spent on top of a UTXO set.
+type utxoView struct {
+	set     *UTXOSet
+	created map[OutPoint]*TxOutput
+	spent   map[OutPoint]*TxOutput
+}
+
+// NewView - Returns a view of the set. The set must not be modified while the view is used.
+func (u *UTXOSet) NewView() LedgerView {
+	return u.newView()
+}
+
+func (u *UTXOSet) newView() *utxoView {
+	return &utxoView{
+		set:     u,
+		created: make(map[OutPoint]*TxOutput),
+		spent:   make(map[OutPoint]*TxOutput),
+	}
+}
+
+func (v *utxoView) find(op OutPoint) (*TxOutput, bool) {
+	if _, ok := v.spent[op]; ok {
+		return nil, false
+	}
+	if out, ok := v.created[op]; ok {
+		return out, true
+	}
+	v.set.mux.RLock()
+	defer v.set.mux.RUnlock()
+	out, ok := v.set.outputs[op]
+	return out, ok
+}
+
+// ApplyTransaction - Spends the inputs of the transaction and adds its outputs.
+// Transactions can spend outputs created by transactions applied before to the view.
+// Only transfers are supported, staking needs the account ledger mode.
+func (v *utxoView) ApplyTransaction(t *Transaction) error {
+	if t.kind != TX_KIND_TRANSFER || len(t.data) != 0 {
+		return fmt.Errorf("%w: %s", ErrUnsupportedTxKind, t.kind)
+	}
+	if t.IsCoinbase() {
+		if err := checkOutputs(t); err != nil {
+			return err
+		}
+	} else {
+		if err := v.checkTransaction(t); err != nil {
+			return err
+		}
+	}
+
+	txID := t.Hash()
+	for i := range t.outputs {
+		if _, ok := v.find(OutPoint{TxID: txID, Index: uint32(i)}); ok {
+			return fmt.Errorf("%w: %x", ErrDuplicateTransaction, txID)
+		}
+	}
+
+	if !t.IsCoinbase() {
+		for _, in := range t.inputs {
+			op := in.OutPoint()
+			out, _ := v.find(op)
+			v.spent[op] = out
+		}
+	}
+	for i, out := range t.outputs {
+		v.created[OutPoint{TxID: txID, Index: uint32(i)}] = out
+	}
+	return nil
+}
+
+// Balance - Returns the sum of the outputs of the address in the set and created by the view, without the
+// ones spent by the view.
+func (v *utxoView) Balance(blockchainAddress string) coin.Amount {
+	total := v.set.Balance(blockchainAddress)
+	for op, out := range v.spent {
+		if _, ok := v.created[op]; !ok && out.blockchainAddress == blockchainAddress {
+			total -= out.value
+		}
+	}
+	for op, out := range v.created {
+		if _, ok := v.spent[op]; !ok && out.blockchainAddress == blockchainAddress {
+			total += out.value
+		}
+	}
+	return total
+}
+
+// checkTransaction - Verifies the inputs of t exist, belong to the sender and cover the outputs and the fee.
+func (v *utxoView) checkTransaction(t *Transaction) error {
+	if len(t.inputs) == 0 {
+		return ErrNoInputs
+	}
+	if err := checkOutputs(t); err != nil {
+		return err
+	}
+	if t.fee < 0 {
+		return ErrInvalidFee
+	}
+
+	var inputsTotal coin.Amount
+	spent := make(map[OutPoint]struct{})
+	for _, in := range t.inputs {
+		op := in.OutPoint()
+		if _, ok := spent[op]; ok {
+			return ErrDoubleSpend
+		}
+		spent[op] = struct{}{}
+
+		out, ok := v.find(op)
+		if !ok {
+			return fmt.Errorf("%w: %s", ErrMissingInput, op)
+		}
+		if out.blockchainAddress != t.senderBlockchainAddress {
+			return fmt.Errorf("%w: %s", ErrWrongOwner, op)
+		}
+		var err error
+		if inputsTotal, err = inputsTotal.Add(out.value); err != nil {
+			return err
+		}
+	}
+
+	total, err := outputsTotal(t)
+	if err != nil {
+		return err
+	}
+	if total, err = total.Add(t.fee); err != nil {
+		return err
+	}
+	if total > inputsTotal {
+		return ErrOverspend
+	}
+	return nil
+}
+
+func checkOutputs(t *Transaction) error {
+	if len(t.outputs) == 0 {
+		return ErrNoOutputs
+	}
+	for _, out := range t.outputs {
+		if out.value <= 0 {
+			return ErrInvalidOutputValue
+		}
+	}
+	_, err := outputsTotal(t)
+	return err
+}
+
+// outputsTotal - Returns the sum of the outputs of t, or coin.ErrOverflow if it does not fit in an amount.
+func outputsTotal(t *Transaction) (coin.Amount, error) {
+	values := make([]coin.Amount, len(t.outputs))
+	for i, out := range t.outputs {
+		values[i] = out.value
+	}
+	return coin.Sum(values...)
+}
+
+// ApplyBlock - Spends the inputs and adds the outputs of every transaction of the block.
+// If any transaction is not valid, the set is not modified and the error is returned.
+// Transactions can spend outputs created by previous transactions of the same block.
+func (u *UTXOSet) ApplyBlock(b *Block) error {
+	view := u.newView()
+	for _, t := range b.transactions {
+		if err := view.ApplyTransaction(t); err != nil {
+			return err
+		}
+	}
+
+	u.mux.Lock()
+	defer u.mux.Unlock()
+	undo := make([]*UnspentOutput, 0, len(view.spent))
+	for op, out := range view.spent {
+		if _, ok := view.created[op]; ok {
+			// Created and spent inside the same block.
+			delete(view.created, op)
+			continue
+		}
+		u.remove(op)
+		undo = append(undo, &UnspentOutput{OutPoint: op, Output: out})
+	}
+	for op, out := range view.created {
+		u.add(op, out)
+	}
+	u.undo[b.Hash()] = &utxoUndo{number: b.Number(), spent: undo}
+	return nil
+}
+
+// RevertBlock - Rolls back a block applied with ApplyBlock.
+// The block must be the last block applied.
+func (u *UTXOSet) RevertBlock(b *Block) error {
+	u.mux.Lock()
+	defer u.mux.Unlock()
+
+	hash := b.Hash()
+	undo, ok := u.undo[hash]
+	if !ok {
+		return fmt.Errorf("block %d was not applied", b.Number())
+	}
+
+	for _, t := range b.transactions {
+		txID := t.Hash()
+		for i := range t.outputs {
+			u.remove(OutPoint{TxID: txID, Index: uint32(i)})
+		}
+	}
+	for _, utxo := range undo.spent {
+		u.add(utxo.OutPoint, utxo.Output)
+	}
+	delete(u.undo, hash)
+	return nil
+}
+
+// Prune - Forgets the outputs spent by the blocks up to the number, they can no longer be rolled back.
+func (u *UTXOSet) Prune(number int64) {
+	u.mux.Lock()
+	defer u.mux.Unlock()
+	for hash, undo := range u.undo {
+		if undo.number <= number {
+			delete(u.undo, hash)
+		}
+	}
+}
+
+func (u *UTXOSet) add(op OutPoint, out *TxOutput) {
+	u.outputs[op] = out
+	if _, ok := u.byAddress[out.blockchainAddress]; !ok {
+		u.byAddress[out.blockchainAddress] = make(map[OutPoint]struct{})
+	}
+	u.byAddress[out.blockchainAddress][op] = struct{}{}
+}
+
+func (u *UTXOSet) remove(op OutPoint) {
+	out, ok := u.outputs[op]
+	if !ok {
+		return
+	}
+	delete(u.outputs, op)
+	delete(u.byAddress[out.blockchainAddress], op)
+	if len(u.byAddress[out.blockchainAddress]) == 0 {
+		delete(u.byAddress, out.blockchainAddress)
+	}
+}
@@ -0,0 +1,195 @@
+package blockchain
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/martinsaporiti/blockchain-sample/internal/coin"
+)
+
+func TestUTXOSet_ApplyBlock(t *testing.T) {
+
+	sba := "15TZoyyxFmeTXJGjYwX1X3ARtXX94BbFrk"
+	rba := "1CHD4Jjqsak4RV5JHAdYZ9CKY1dQe4tkXW"
+	timestamp := int64(1654369662)
+
+	spend := func(fundingID [32]byte, index uint32, outputs ...*TxOutput) *Transaction {
+		return NewTransaction(sba, rba, outputs[0].value, timestamp, []*TxInput{NewTxInput(fundingID, index)}, outputs)
+	}
+
+	tests := map[string]struct {
+		transactions func(fundingID [32]byte) []*Transaction
+		want         error
+		wantSender   coin.Amount
+		wantReceiver coin.Amount
+	}{
+		"should move the coins to the outputs": {
+			transactions: func(fundingID [32]byte) []*Transaction {
+				return []*Transaction{spend(fundingID, 0, NewTxOutput(rba, 30), NewTxOutput(sba, 70))}
+			},
+			wantSender:   70,
+			wantReceiver: 30,
+		},
+		"should allow spending an output created in the same block": {
+			transactions: func(fundingID [32]byte) []*Transaction {
+				first := spend(fundingID, 0, NewTxOutput(sba, 100))
+				second := spend(first.Hash(), 0, NewTxOutput(rba, 100))
+				return []*Transaction{first, second}
+			},
+			wantSender:   0,
+			wantReceiver: 100,
+		},
+		"should reject an overspend": {
+			transactions: func(fundingID [32]byte) []*Transaction {
+				return []*Transaction{spend(fundingID, 0, NewTxOutput(rba, 101))}
+			},
+			want:       ErrOverspend,
+			wantSender: 100,
+		},
+		"should leave the fee out of the outputs": {
+			transactions: func(fundingID [32]byte) []*Transaction {
+				return []*Transaction{withFee(spend(fundingID, 0, NewTxOutput(rba, 30), NewTxOutput(sba, 60)), 10)}
+			},
+			wantSender:   60,
+			wantReceiver: 30,
+		},
+		"should reject outputs and fee that spend more than the inputs": {
+			transactions: func(fundingID [32]byte) []*Transaction {
+				return []*Transaction{withFee(spend(fundingID, 0, NewTxOutput(rba, 30), NewTxOutput(sba, 70)), 1)}
+			},
+			want:       ErrOverspend,
+			wantSender: 100,
+		},
+		"should reject a negative fee": {
+			transactions: func(fundingID [32]byte) []*Transaction {
+				return []*Transaction{withFee(spend(fundingID, 0, NewTxOutput(rba, 100)), -1)}
+			},
+			want:       ErrInvalidFee,
+			wantSender: 100,
+		},
+		"should reject a double spend in the same block": {
+			transactions: func(fundingID [32]byte) []*Transaction {
+				return []*Transaction{
+					spend(fundingID, 0, NewTxOutput(rba, 100)),
+					spend(fundingID, 0, NewTxOutput(rba, 50)),
+				}
+			},
+			want:       ErrMissingInput,
+			wantSender: 100,
+		},
+		"should reject spending an output of another address": {
+			transactions: func(fundingID [32]byte) []*Transaction {
+				return []*Transaction{spend(fundingID, 1, NewTxOutput(rba, 10))}
+			},
+			want:       ErrWrongOwner,
+			wantSender: 100,
+		},
+		"should reject a transaction without inputs": {
+			transactions: func(fundingID [32]byte) []*Transaction {
+				return []*Transaction{NewTransaction(sba, rba, 10, timestamp, nil, []*TxOutput{NewTxOutput(rba, 10)})}
+			},
+			want:       ErrNoInputs,
+			wantSender: 100,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			utxos, fundingID := newFundedUTXOSet(NewTxOutput(sba, 100), NewTxOutput("1JkfWtkFzLHKoa33Vimaxcctc3z2HNWoet", 5))
+			block := NewBlock(2, 0, [32]byte{}, tc.transactions(fundingID))
+
+			err := utxos.ApplyBlock(block)
+			if !errors.Is(err, tc.want) {
+				t.Errorf("ApplyBlock() = %v, want %v", err, tc.want)
+			}
+			if got := utxos.Balance(sba); got != tc.wantSender {
+				t.Errorf("Balance() = %v, want %v", got, tc.wantSender)
+			}
+			if got := utxos.Balance(rba); got != tc.wantReceiver {
+				t.Errorf("Balance() = %v, want %v", got, tc.wantReceiver)
+			}
+		})
+	}
+}
+
+func TestUTXOSet_RevertBlock(t *testing.T) {
+
+	sba := "15TZoyyxFmeTXJGjYwX1X3ARtXX94BbFrk"
+	rba := "1CHD4Jjqsak4RV5JHAdYZ9CKY1dQe4tkXW"
+	utxos, fundingID := newFundedUTXOSet(NewTxOutput(sba, 100))
+	tx := NewTransaction(sba, rba, 100, 1654369662, []*TxInput{NewTxInput(fundingID, 0)}, []*TxOutput{NewTxOutput(rba, 100)})
+	block := NewBlock(2, 0, [32]byte{}, []*Transaction{tx})
+
+	if err := utxos.ApplyBlock(block); err != nil {
+		t.Fatalf("ApplyBlock() = %v", err)
+	}
+	if err := utxos.RevertBlock(block); err != nil {
+		t.Fatalf("RevertBlock() = %v", err)
+	}
+
+	if got := utxos.Balance(sba); got != 100 {
+		t.Errorf("Balance() = %v, want %v", got, 100)
+	}
+	if got := utxos.Balance(rba); got != 0 {
+		t.Errorf("Balance() = %v, want %v", got, 0)
+	}
+	if _, ok := utxos.Get(OutPoint{TxID: fundingID}); !ok {
+		t.Errorf("Get() should return the output restored by RevertBlock()")
+	}
+}
+
+func TestUTXOSet_Prune(t *testing.T) {
+
+	sba := "15TZoyyxFmeTXJGjYwX1X3ARtXX94BbFrk"
+	rba := "1CHD4Jjqsak4RV5JHAdYZ9CKY1dQe4tkXW"
+	utxos, fundingID := newFundedUTXOSet(NewTxOutput(sba, 100))
+	tx := NewTransaction(sba, rba, 100, 1654369662, []*TxInput{NewTxInput(fundingID, 0)}, []*TxOutput{NewTxOutput(rba, 100)})
+	block := NewBlock(2, 0, [32]byte{}, []*Transaction{tx})
+	if err := utxos.ApplyBlock(block); err != nil {
+		t.Fatalf("ApplyBlock() = %v", err)
+	}
+
+	utxos.Prune(1)
+	if got := len(utxos.undo); got != 1 {
+		t.Errorf("len(undo) after Prune(1) = %d, want %d", got, 1)
+	}
+	utxos.Prune(2)
+	if got := len(utxos.undo); got != 0 {
+		t.Errorf("len(undo) after Prune(2) = %d, want %d", got, 0)
+	}
+	if err := utxos.RevertBlock(block); err == nil {
+		t.Errorf("RevertBlock() of a pruned block = nil, want an error")
+	}
+}
+
+func TestUTXOSet_ViewBalance(t *testing.T) {
+
+	sba := "15TZoyyxFmeTXJGjYwX1X3ARtXX94BbFrk"
+	rba := "1CHD4Jjqsak4RV5JHAdYZ9CKY1dQe4tkXW"
+	timestamp := int64(1654369662)
+	utxos, fundingID := newFundedUTXOSet(NewTxOutput(sba, 100))
+	first := NewTransaction(sba, rba, 30, timestamp, []*TxInput{NewTxInput(fundingID, 0)},
+		[]*TxOutput{NewTxOutput(rba, 30), NewTxOutput(sba, 70)})
+	second := NewTransaction(sba, rba, 70, timestamp, []*TxInput{NewTxInput(first.Hash(), 1)},
+		[]*TxOutput{NewTxOutput(rba, 70)})
+
+	view := utxos.NewView()
+	if err := view.ApplyTransaction(first); err != nil {
+		t.Fatalf("ApplyTransaction() = %v", err)
+	}
+	if got := view.Balance(sba); got != 70 {
+		t.Errorf("Balance() = %v, want %v", got, 70)
+	}
+	if err := view.ApplyTransaction(second); err != nil {
+		t.Fatalf("ApplyTransaction() = %v", err)
+	}
+	if got := view.Balance(sba); got != 0 {
+		t.Errorf("Balance() = %v, want %v", got, 0)
+	}
+	if got := view.Balance(rba); got != 100 {
+		t.Errorf("Balance() = %v, want %v", got, 100)
+	}
+	if got := utxos.Balance(sba); got != 100 {
+		t.Errorf("Balance() of the set = %v, want %v", got, 100)
+	}
+}
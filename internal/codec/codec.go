@@ -0,0 +1,192 @@
+package codec
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/martinsaporiti/blockchain-sample/internal/coin"
+)
+
+const (
+	// CODEC_VERSION - Version of the encoding. It is the first byte of every encoded transaction and block,
+	// so the format can change without making the old encodings ambiguous.
+	CODEC_VERSION = 1
+	// MAX_FIELD_SIZE - Longest length prefixed field or list the decoder accepts.
+	MAX_FIELD_SIZE = 1 << 20
+)
+
+var (
+	ErrUnexpectedEnd      = errors.New("unexpected end of encoded data")
+	ErrTrailingData       = errors.New("trailing bytes after encoded data")
+	ErrUnsupportedVersion = errors.New("unsupported encoding version")
+	ErrFieldTooLong       = errors.New("encoded field too long")
+)
+
+// Encoder - Appends values in the canonical encoding: integers are fixed width and big endian,
+// byte strings and lists are prefixed by their length as an uint32.
+type Encoder struct {
+	buf []byte
+}
+
+func NewEncoder() *Encoder {
+	return &Encoder{buf: make([]byte, 0, 256)}
+}
+
+func (e *Encoder) PutUint8(v uint8) {
+	e.buf = append(e.buf, v)
+}
+
+func (e *Encoder) PutUint32(v uint32) {
+	var b [4]byte
+	binary.BigEndian.PutUint32(b[:], v)
+	e.buf = append(e.buf, b[:]...)
+}
+
+func (e *Encoder) PutUint64(v uint64) {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], v)
+	e.buf = append(e.buf, b[:]...)
+}
+
+func (e *Encoder) PutInt64(v int64) {
+	e.PutUint64(uint64(v))
+}
+
+// PutHash - Appends a 32 bytes hash, without length prefix.
+func (e *Encoder) PutHash(h [32]byte) {
+	e.buf = append(e.buf, h[:]...)
+}
+
+func (e *Encoder) PutBytes(b []byte) {
+	e.PutUint32(uint32(len(b)))
+	e.buf = append(e.buf, b...)
+}
+
+func (e *Encoder) PutString(s string) {
+	e.PutBytes([]byte(s))
+}
+
+// PutAmount - Appends an amount as an int64 of base units.
+func (e *Encoder) PutAmount(a coin.Amount) {
+	e.PutInt64(int64(a))
+}
+
+// Bytes - Returns the encoded data.
+func (e *Encoder) Bytes() []byte {
+	return e.buf
+}
+
+// Decoder - Reads values encoded by an Encoder. The first error is kept and every following read
+// returns zero values, so callers check Err (or Finish) once after reading all the fields.
+type Decoder struct {
+	buf []byte
+	err error
+}
+
+func NewDecoder(buf []byte) *Decoder {
+	return &Decoder{buf: buf}
+}
+
+func (d *Decoder) next(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if len(d.buf) < n {
+		d.err = ErrUnexpectedEnd
+		return nil
+	}
+	b := d.buf[:n]
+	d.buf = d.buf[n:]
+	return b
+}
+
+func (d *Decoder) Uint8() uint8 {
+	b := d.next(1)
+	if b == nil {
+		return 0
+	}
+	return b[0]
+}
+
+func (d *Decoder) Uint32() uint32 {
+	b := d.next(4)
+	if b == nil {
+		return 0
+	}
+	return binary.BigEndian.Uint32(b)
+}
+
+func (d *Decoder) Uint64() uint64 {
+	b := d.next(8)
+	if b == nil {
+		return 0
+	}
+	return binary.BigEndian.Uint64(b)
+}
+
+func (d *Decoder) Int64() int64 {
+	return int64(d.Uint64())
+}
+
+func (d *Decoder) Hash() [32]byte {
+	var h [32]byte
+	copy(h[:], d.next(len(h)))
+	return h
+}
+
+// Count - Reads the length of a list. Every element takes at least one byte, so a count larger than
+// the remaining data is an error and no list is allocated for it.
+func (d *Decoder) Count() int {
+	n := d.Uint32()
+	if d.err == nil && n > MAX_FIELD_SIZE {
+		d.err = fmt.Errorf("%w: %d elements", ErrFieldTooLong, n)
+	}
+	if d.err == nil && int(n) > len(d.buf) {
+		d.err = ErrUnexpectedEnd
+	}
+	if d.err != nil {
+		return 0
+	}
+	return int(n)
+}
+
+func (d *Decoder) Bytes() []byte {
+	n := d.Count()
+	b := d.next(n)
+	if b == nil {
+		return nil
+	}
+	return append([]byte{}, b...)
+}
+
+func (d *Decoder) String() string {
+	return string(d.Bytes())
+}
+
+func (d *Decoder) Amount() coin.Amount {
+	return coin.Amount(d.Int64())
+}
+
+// Version - Reads the version byte and fails if it is not CODEC_VERSION.
+func (d *Decoder) Version() {
+	v := d.Uint8()
+	if d.err == nil && v != CODEC_VERSION {
+		d.err = fmt.Errorf("%w: %d", ErrUnsupportedVersion, v)
+	}
+}
+
+func (d *Decoder) Err() error {
+	return d.err
+}
+
+// Finish - Returns the first error of the decoder, or ErrTrailingData if there is data left.
+func (d *Decoder) Finish() error {
+	if d.err != nil {
+		return d.err
+	}
+	if len(d.buf) > 0 {
+		return fmt.Errorf("%w: %d bytes", ErrTrailingData, len(d.buf))
+	}
+	return nil
+}
@@ -0,0 +1,233 @@
+package codec
+
+import (
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/martinsaporiti/blockchain-sample/internal/coin"
+)
+
+// golden - Joins the hex parts of an expected encoding.
+func golden(parts ...string) string {
+	return strings.Join(parts, "")
+}
+
+func TestEncoder(t *testing.T) {
+
+	tests := map[string]struct {
+		input func(e *Encoder)
+		want  string
+	}{
+		"should encode integers as fixed width big endian": {
+			input: func(e *Encoder) {
+				e.PutUint8(1)
+				e.PutUint32(2)
+				e.PutUint64(3)
+				e.PutInt64(-1)
+			},
+			want: golden("01", "00000002", "0000000000000003", "ffffffffffffffff"),
+		},
+		"should prefix strings with their length": {
+			input: func(e *Encoder) {
+				e.PutString("abc")
+				e.PutString("")
+			},
+			want: golden("00000003", "616263", "00000000"),
+		},
+		"should encode amounts as base units": {
+			input: func(e *Encoder) {
+				e.PutAmount(coin.Coins(1))
+				e.PutAmount(coin.UNITS_PER_COIN / 2)
+				e.PutAmount(10_025_000_000)
+			},
+			want: golden("0000000005f5e100", "0000000002faf080", "0000000255895c40"),
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			e := NewEncoder()
+			tc.input(e)
+			if got := hex.EncodeToString(e.Bytes()); got != tc.want {
+				t.Errorf("Bytes() = %s, want %s", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestTxPayload(t *testing.T) {
+
+	payload := &TxPayload{
+		Sender:    "A",
+		Recipient: "B",
+		Value:     coin.Coins(2),
+		Fee:       1000,
+		Timestamp: 1654369662,
+		Nonce:     7,
+		Inputs:    []TxInput{{TxID: [32]byte{0xaa}, Index: 1}},
+		Outputs:   []TxOutput{{Address: "B", Value: coin.Coins(2)}},
+	}
+	want := golden(
+		"00000001", "41", // sender
+		"00000001", "42", // recipient
+		"000000000bebc200", // value
+		"00000000000003e8", // fee
+		"00000000629bad7e", // timestamp
+		"0000000000000007", // nonce
+		"00000001",         // inputs
+		"aa"+strings.Repeat("00", 31), "00000001",
+		"00000001", // outputs
+		"00000001", "42", "000000000bebc200",
+		"00",       // kind
+		"00000000", // data
+		"00000000", // chain ID
+	)
+
+	e := NewEncoder()
+	payload.Encode(e)
+	if got := hex.EncodeToString(e.Bytes()); got != want {
+		t.Fatalf("Encode() = %s, want %s", got, want)
+	}
+
+	d := NewDecoder(e.Bytes())
+	decoded := DecodeTxPayload(d)
+	if err := d.Finish(); err != nil {
+		t.Fatalf("Finish() = %v", err)
+	}
+	if decoded.Hash() != payload.Hash() {
+		t.Errorf("DecodeTxPayload() = %+v, want %+v", decoded, payload)
+	}
+
+	h := payload.Hash()
+	if got := hex.EncodeToString(h[:]); got != "064d93d77b0f473248b463590d497a2ffb2ad1508ea0d77fb55d4b1620fac36f" {
+		t.Errorf("Hash() = %s, want the hash of the version byte and the golden encoding", got)
+	}
+}
+
+func TestTxPayload_Kind(t *testing.T) {
+
+	payload := &TxPayload{Sender: "A", Recipient: "A", Value: coin.Coins(2), Kind: 1, Data: []byte{0xab}}
+	want := golden(
+		"00000001", "41", // sender
+		"00000001", "41", // recipient
+		"000000000bebc200", // value
+		"0000000000000000", // fee
+		"0000000000000000", // timestamp
+		"0000000000000000", // nonce
+		"00000000",         // inputs
+		"00000000",         // outputs
+		"01",               // kind
+		"00000001", "ab",   // data
+		"00000000", // chain ID
+	)
+
+	e := NewEncoder()
+	payload.Encode(e)
+	if got := hex.EncodeToString(e.Bytes()); got != want {
+		t.Fatalf("Encode() = %s, want %s", got, want)
+	}
+
+	d := NewDecoder(e.Bytes())
+	decoded := DecodeTxPayload(d)
+	if err := d.Finish(); err != nil {
+		t.Fatalf("Finish() = %v", err)
+	}
+	if decoded.Hash() != payload.Hash() {
+		t.Errorf("DecodeTxPayload() = %+v, want %+v", decoded, payload)
+	}
+}
+
+func TestTxPayload_ChainID(t *testing.T) {
+
+	payload := &TxPayload{Sender: "A", Recipient: "B", Value: coin.Coins(2), ChainID: "C"}
+	want := golden(
+		"00000001", "41", // sender
+		"00000001", "42", // recipient
+		"000000000bebc200", // value
+		"0000000000000000", // fee
+		"0000000000000000", // timestamp
+		"0000000000000000", // nonce
+		"00000000",         // inputs
+		"00000000",         // outputs
+		"00",               // kind
+		"00000000",         // data
+		"00000001", "43",   // chain ID
+	)
+
+	e := NewEncoder()
+	payload.Encode(e)
+	if got := hex.EncodeToString(e.Bytes()); got != want {
+		t.Fatalf("Encode() = %s, want %s", got, want)
+	}
+
+	d := NewDecoder(e.Bytes())
+	decoded := DecodeTxPayload(d)
+	if err := d.Finish(); err != nil {
+		t.Fatalf("Finish() = %v", err)
+	}
+	if decoded.ChainID != payload.ChainID || decoded.Hash() != payload.Hash() {
+		t.Errorf("DecodeTxPayload() = %+v, want %+v", decoded, payload)
+	}
+
+	other := *payload
+	other.ChainID = "D"
+	if other.Hash() == payload.Hash() {
+		t.Errorf("Hash() is the same for the chain IDs %q and %q", payload.ChainID, other.ChainID)
+	}
+}
+
+func TestDecoder_Errors(t *testing.T) {
+
+	tests := map[string]struct {
+		input func(d *Decoder)
+		data  string
+		want  error
+	}{
+		"should fail when the data ends before the field": {
+			input: func(d *Decoder) { d.Uint64() },
+			data:  "000000",
+			want:  ErrUnexpectedEnd,
+		},
+		"should fail when there is data left": {
+			input: func(d *Decoder) { d.Uint8() },
+			data:  "0102",
+			want:  ErrTrailingData,
+		},
+		"should fail when a length is longer than the data": {
+			input: func(d *Decoder) { d.Bytes() },
+			data:  "0000000241",
+			want:  ErrUnexpectedEnd,
+		},
+		"should fail when a length is longer than the maximum": {
+			input: func(d *Decoder) { d.Bytes() },
+			data:  "ffffffff41",
+			want:  ErrFieldTooLong,
+		},
+		"should fail when the version is not supported": {
+			input: func(d *Decoder) { d.Version() },
+			data:  "02",
+			want:  ErrUnsupportedVersion,
+		},
+		"should keep the first error": {
+			input: func(d *Decoder) {
+				d.Uint32()
+				d.Version()
+			},
+			data: "00",
+			want: ErrUnexpectedEnd,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			data, _ := hex.DecodeString(tc.data)
+			d := NewDecoder(data)
+			tc.input(d)
+			if err := d.Finish(); !errors.Is(err, tc.want) {
+				t.Errorf("Finish() = %v, want %v", err, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package codec
+
+import (
+	"crypto/sha256"
+
+	"github.com/martinsaporiti/blockchain-sample/internal/coin"
+)
+
+// TxInput - Output of a previous transaction spent by a transaction.
+type TxInput struct {
+	TxID  [32]byte
+	Index uint32
+}
+
+// TxOutput - Amount locked to a blockchain address.
+type TxOutput struct {
+	Address string
+	Value   coin.Amount
+}
+
+// TxPayload - Fields of a transaction covered by its ID and by the signature of the sender.
+// The node and the wallet both encode transactions with it, so they always sign the same bytes.
+type TxPayload struct {
+	Sender    string
+	Recipient string
+	Value     coin.Amount
+	Fee       coin.Amount
+	Timestamp int64
+	Nonce     uint64
+	Inputs    []TxInput
+	Outputs   []TxOutput
+	// Kind - Kind of the transaction, 0 is a transfer.
+	Kind uint8
+	// Data - Content that depends on the kind, like the evidence of a slashing.
+	Data []byte
+	// ChainID - Network the transaction was signed for, empty for the coinbases.
+	ChainID string
+}
+
+// Encode - Appends the payload: sender, recipient, value, fee, timestamp, nonce, the inputs (transaction ID
+// and index), the outputs (address and value), the kind, the data and the chain ID.
+func (p *TxPayload) Encode(e *Encoder) {
+	e.PutString(p.Sender)
+	e.PutString(p.Recipient)
+	e.PutAmount(p.Value)
+	e.PutAmount(p.Fee)
+	e.PutInt64(p.Timestamp)
+	e.PutUint64(p.Nonce)
+	e.PutUint32(uint32(len(p.Inputs)))
+	for _, in := range p.Inputs {
+		e.PutHash(in.TxID)
+		e.PutUint32(in.Index)
+	}
+	e.PutUint32(uint32(len(p.Outputs)))
+	for _, out := range p.Outputs {
+		e.PutString(out.Address)
+		e.PutAmount(out.Value)
+	}
+	e.PutUint8(p.Kind)
+	e.PutBytes(p.Data)
+	e.PutString(p.ChainID)
+}
+
+// DecodeTxPayload - Reads a payload written by Encode.
+func DecodeTxPayload(d *Decoder) *TxPayload {
+	p := &TxPayload{
+		Sender:    d.String(),
+		Recipient: d.String(),
+		Value:     d.Amount(),
+		Fee:       d.Amount(),
+		Timestamp: d.Int64(),
+		Nonce:     d.Uint64(),
+	}
+	if n := d.Count(); n > 0 {
+		p.Inputs = make([]TxInput, n)
+		for i := range p.Inputs {
+			p.Inputs[i] = TxInput{TxID: d.Hash(), Index: d.Uint32()}
+		}
+	}
+	if n := d.Count(); n > 0 {
+		p.Outputs = make([]TxOutput, n)
+		for i := range p.Outputs {
+			p.Outputs[i] = TxOutput{Address: d.String(), Value: d.Amount()}
+		}
+	}
+	p.Kind = d.Uint8()
+	p.Data = d.Bytes()
+	p.ChainID = d.String()
+	return p
+}
+
+// Hash - Returns the hash of the version byte followed by the payload.
+// It is the transaction ID and the digest the sender signs.
+func (p *TxPayload) Hash() [32]byte {
+	e := NewEncoder()
+	e.PutUint8(CODEC_VERSION)
+	p.Encode(e)
+	return sha256.Sum256(e.Bytes())
+}
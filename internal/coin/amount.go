@@ -0,0 +1,123 @@
+package coin
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+const (
+	// DECIMALS - Digits of an amount after the decimal point.
+	DECIMALS = 8
+	// UNITS_PER_COIN - Base units of a coin.
+	UNITS_PER_COIN = 100_000_000
+)
+
+var (
+	ErrInvalidAmount = errors.New("invalid amount")
+	ErrOverflow      = errors.New("amount overflow")
+)
+
+// Amount - Quantity of coins in base units. Integers, unlike floats, add up exactly and can represent
+// any decimal amount with up to DECIMALS digits.
+type Amount int64
+
+// Coins - Returns the amount of n whole coins.
+func Coins(n int64) Amount {
+	return Amount(n * UNITS_PER_COIN)
+}
+
+// ParseAmount - Parses a decimal amount of coins like "12", "0.1" or "1.00000001".
+// Negative amounts and amounts with more than DECIMALS digits after the point are not valid.
+func ParseAmount(s string) (Amount, error) {
+	whole, fraction, hasPoint := strings.Cut(s, ".")
+	if whole == "" || (hasPoint && fraction == "") || len(fraction) > DECIMALS ||
+		!isDigits(whole) || !isDigits(fraction) {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidAmount, s)
+	}
+
+	w, err := strconv.ParseInt(whole, 10, 64)
+	if err != nil || w > math.MaxInt64/UNITS_PER_COIN {
+		return 0, fmt.Errorf("%w: %q", ErrOverflow, s)
+	}
+	var f int64
+	if fraction != "" {
+		f, _ = strconv.ParseInt(fraction+strings.Repeat("0", DECIMALS-len(fraction)), 10, 64)
+	}
+	return Amount(w * UNITS_PER_COIN).Add(Amount(f))
+}
+
+func isDigits(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// String - Formats the amount in coins, without trailing zeros: "12", "0.1", "1.00000001".
+func (a Amount) String() string {
+	sign := ""
+	units := uint64(a)
+	if a < 0 {
+		sign = "-"
+		units = uint64(-a)
+	}
+	whole := units / UNITS_PER_COIN
+	fraction := units % UNITS_PER_COIN
+	if fraction == 0 {
+		return fmt.Sprintf("%s%d", sign, whole)
+	}
+	f := strings.TrimRight(fmt.Sprintf("%0*d", DECIMALS, fraction), "0")
+	return fmt.Sprintf("%s%d.%s", sign, whole, f)
+}
+
+// Add - Returns a + b, or ErrOverflow if the result does not fit in an Amount.
+func (a Amount) Add(b Amount) (Amount, error) {
+	if (b > 0 && a > math.MaxInt64-b) || (b < 0 && a < math.MinInt64-b) {
+		return 0, ErrOverflow
+	}
+	return a + b, nil
+}
+
+// Sub - Returns a - b, or ErrOverflow if the result does not fit in an Amount.
+func (a Amount) Sub(b Amount) (Amount, error) {
+	if (b < 0 && a > math.MaxInt64+b) || (b > 0 && a < math.MinInt64+b) {
+		return 0, ErrOverflow
+	}
+	return a - b, nil
+}
+
+// Sum - Returns the sum of the amounts, or ErrOverflow if it does not fit in an Amount.
+func Sum(amounts ...Amount) (Amount, error) {
+	var total Amount
+	for _, a := range amounts {
+		var err error
+		if total, err = total.Add(a); err != nil {
+			return 0, err
+		}
+	}
+	return total, nil
+}
+
+// MarshalJSON - Encodes the amount as a decimal string, so it is not rounded by JSON numbers.
+func (a Amount) MarshalJSON() ([]byte, error) {
+	return json.Marshal(a.String())
+}
+
+func (a *Amount) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("%w: amounts are decimal strings", ErrInvalidAmount)
+	}
+	v, err := ParseAmount(s)
+	if err != nil {
+		return err
+	}
+	*a = v
+	return nil
+}
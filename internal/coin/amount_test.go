@@ -0,0 +1,107 @@
+package coin
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestParseAmount(t *testing.T) {
+
+	tests := map[string]struct {
+		input   string
+		want    Amount
+		wantErr error
+	}{
+		"should parse whole coins":                  {input: "12", want: 12 * UNITS_PER_COIN},
+		"should parse a fraction":                   {input: "0.1", want: 10_000_000},
+		"should parse the smallest unit":            {input: "1.00000001", want: UNITS_PER_COIN + 1},
+		"should reject more than 8 decimals":        {input: "0.000000001", wantErr: ErrInvalidAmount},
+		"should reject negative amounts":            {input: "-1", wantErr: ErrInvalidAmount},
+		"should reject an empty string":             {input: "", wantErr: ErrInvalidAmount},
+		"should reject a point without a fraction":  {input: "1.", wantErr: ErrInvalidAmount},
+		"should reject a fraction without a number": {input: ".5", wantErr: ErrInvalidAmount},
+		"should reject exponents":                   {input: "1e8", wantErr: ErrInvalidAmount},
+		"should reject amounts that overflow":       {input: "92233720368.54775808", wantErr: ErrOverflow},
+		"should parse the largest amount":           {input: "92233720368.54775807", want: math.MaxInt64},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := ParseAmount(tc.input)
+			if !errors.Is(err, tc.wantErr) {
+				t.Fatalf("ParseAmount() = %v, want %v", err, tc.wantErr)
+			}
+			if got != tc.want {
+				t.Errorf("ParseAmount() = %d, want %d", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestAmount_String(t *testing.T) {
+
+	tests := map[string]struct {
+		input Amount
+		want  string
+	}{
+		"should format zero":                    {input: 0, want: "0"},
+		"should format whole coins":             {input: Coins(100), want: "100"},
+		"should trim the trailing zeros":        {input: 150_000_000, want: "1.5"},
+		"should format the smallest unit":       {input: 1, want: "0.00000001"},
+		"should format negative amounts":        {input: -150_000_000, want: "-1.5"},
+		"should format the most negative value": {input: math.MinInt64, want: "-92233720368.54775808"},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := tc.input.String(); got != tc.want {
+				t.Errorf("String() = %s, want %s", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestAmount_Arithmetic(t *testing.T) {
+
+	tenth, _ := ParseAmount("0.1")
+	fifth, _ := ParseAmount("0.2")
+	sum, err := tenth.Add(fifth)
+	if err != nil || sum.String() != "0.3" {
+		t.Errorf("0.1 + 0.2 = %s, %v, want 0.3", sum, err)
+	}
+
+	if _, err := Amount(math.MaxInt64).Add(1); !errors.Is(err, ErrOverflow) {
+		t.Errorf("Add() = %v, want %v", err, ErrOverflow)
+	}
+	if _, err := Amount(math.MinInt64).Sub(1); !errors.Is(err, ErrOverflow) {
+		t.Errorf("Sub() = %v, want %v", err, ErrOverflow)
+	}
+	if got, err := Coins(1).Sub(Coins(3)); err != nil || got != -Coins(2) {
+		t.Errorf("Sub() = %s, %v, want -2", got, err)
+	}
+	if _, err := Sum(math.MaxInt64/2, math.MaxInt64/2, 2); !errors.Is(err, ErrOverflow) {
+		t.Errorf("Sum() = %v, want %v", err, ErrOverflow)
+	}
+}
+
+func TestAmount_JSON(t *testing.T) {
+
+	m, err := json.Marshal(struct {
+		Value Amount `json:"value"`
+	}{Value: 150_000_000})
+	if err != nil || string(m) != `{"value":"1.5"}` {
+		t.Errorf("Marshal() = %s, %v, want {\"value\":\"1.5\"}", m, err)
+	}
+
+	var v struct {
+		Value Amount `json:"value"`
+	}
+	if err := json.Unmarshal([]byte(`{"value":"0.1"}`), &v); err != nil || v.Value != 10_000_000 {
+		t.Errorf("Unmarshal() = %d, %v, want 10000000", v.Value, err)
+	}
+	if err := json.Unmarshal([]byte(`{"value":0.1}`), &v); !errors.Is(err, ErrInvalidAmount) {
+		t.Errorf("Unmarshal() of a number = %v, want %v", err, ErrInvalidAmount)
+	}
+}
@@ -1,7 +1,26 @@
 package config
 
+import "time"
+
 type Config struct {
-	BlockchainAddress string
-	Port              uint16
-	MiningDifficulty  int
+	BlockchainAddress    string
+	Port                 uint16
+	MiningDifficulty     int
+	DataDir              string
+	LedgerMode           string
+	MaxBlockTransactions int
+	MaxBlockSize         int
+	TargetBlockInterval  time.Duration
+	RetargetWindow       int64
+	MiningWorkers        int
+	Consensus            string
+	Signers              []string
+	SignerKey            string
+	GenesisFile          string
+	Checkpoints          []string
+	MaxReorgDepth        int64
+	MempoolMaxTxs        int
+	MempoolMaxSize       int
+	MempoolMaxPerSender  int
+	MempoolTTL           time.Duration
 }
@@ -0,0 +1,239 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/martinsaporiti/blockchain-sample/internal/blockchain"
+)
+
+const (
+	// SYNC_INTERVAL - How often the node asks its neighbors for the tip of their chain.
+	SYNC_INTERVAL = 10 * time.Second
+	// SYNC_FETCH_ATTEMPTS - How many times a block is asked, each time to another neighbor, before the
+	// sync leaves it for the next round.
+	SYNC_FETCH_ATTEMPTS = 3
+)
+
+// chainSync - State of the header-first synchronization.
+// The headers of a branch are downloaded and validated before any block, then the blocks are downloaded
+// in parallel from the neighbors. What was downloaded is kept when a round can not connect the whole
+// branch, so the next round resumes from there.
+type chainSync struct {
+	mux sync.Mutex
+	// headers - Validated headers of the branch whose blocks are not connected yet. The first one follows
+	// a block we know.
+	headers []*blockchain.BlockHeader
+	// blocks - Downloaded blocks of the branch, by hash.
+	blocks map[[32]byte]*blockchain.Block
+}
+
+func (s *chainSync) reset() {
+	s.headers = nil
+	s.blocks = make(map[[32]byte]*blockchain.Block)
+}
+
+// syncPeriodically - Every SYNC_INTERVAL synchronizes the chain from the neighbors.
+func (c *controller) syncPeriodically() {
+	for range time.Tick(SYNC_INTERVAL) {
+		c.syncFromNetwork()
+	}
+}
+
+// syncFromNetwork - Asks the neighbors for their tip and synchronizes from the one with the most work,
+// when it has more work than our chain. The neighbors with another genesis block are of another network
+// and they are ignored.
+func (c *controller) syncFromNetwork() {
+	maxWork, err := c.blockchain.ChainWork(c.blockchain.LastBlock().Hash())
+	if err != nil {
+		log.Printf("ERROR: reading the work of our chain: %v", err)
+		return
+	}
+
+	genesis := fmt.Sprintf("%x", c.blockchain.GenesisHash())
+	peer := ""
+	for _, n := range c.gateway.Neighbors() {
+		status, err := c.gateway.GetStatus(n)
+		if err != nil {
+			log.Printf("ERROR: %v", err)
+			continue
+		}
+		if status.Genesis != genesis {
+			log.Printf("Ignoring neighbor %s, its genesis block %s is not ours", n, status.Genesis)
+			continue
+		}
+		work, ok := new(big.Int).SetString(status.ChainWork, 10)
+		if !ok {
+			log.Printf("ERROR: neighbor %s reports an invalid chain work: %q", n, status.ChainWork)
+			continue
+		}
+		if work.Cmp(maxWork) > 0 {
+			log.Printf("Neighbor %s is at block %d with more work than our chain", n, status.Number)
+			maxWork = work
+			peer = n
+		}
+	}
+	if peer == "" {
+		return
+	}
+	if err := c.syncFrom(peer); err != nil {
+		log.Printf("ERROR: synchronizing from %s: %v", peer, err)
+	}
+}
+
+// syncFrom - Downloads and validates the headers the peer has after our chain, then downloads their
+// blocks and adds them to our chain.
+func (c *controller) syncFrom(peer string) error {
+	c.chainSync.mux.Lock()
+	defer c.chainSync.mux.Unlock()
+
+	work, err := c.downloadHeaders(peer)
+	if err != nil {
+		return err
+	}
+	if len(c.chainSync.headers) == 0 {
+		return nil
+	}
+	tipWork, err := c.blockchain.ChainWork(c.blockchain.LastBlock().Hash())
+	if err != nil {
+		return err
+	}
+	if work.Cmp(tipWork) <= 0 {
+		// Our chain got more work while the headers were downloaded.
+		c.chainSync.reset()
+		return nil
+	}
+
+	last := c.chainSync.headers[len(c.chainSync.headers)-1]
+	log.Printf("Synchronizing %d blocks up to block %d from %s", len(c.chainSync.headers), last.Number(), peer)
+	c.downloadBlocks(peer)
+	return c.connectSynced()
+}
+
+// downloadHeaders - Asks the peer for the headers that follow the branch being synchronized, or our chain
+// when there is none, until the peer has no more. Every answer is validated with the headers before it.
+// Returns the chainwork of the branch.
+func (c *controller) downloadHeaders(peer string) (*big.Int, error) {
+	s := &c.chainSync
+	c.forgetConnected()
+
+	var work *big.Int
+	for {
+		locator := c.blockchain.Locator()
+		if n := len(s.headers); n > 0 {
+			locator = append([][32]byte{s.headers[n-1].Hash()}, locator...)
+		}
+		headers, err := c.gateway.GetHeaders(peer, locator)
+		if err != nil {
+			return nil, err
+		}
+		if len(headers) == 0 {
+			break
+		}
+		if n := len(s.headers); n > 0 && headers[0].PreviousHash() != s.headers[n-1].Hash() {
+			// The peer moved to another branch, the sync starts again from our chain.
+			s.reset()
+		}
+
+		branch := make([]*blockchain.BlockHeader, 0, len(s.headers)+len(headers))
+		branch = append(append(branch, s.headers...), headers...)
+		work, err = c.blockchain.ValidateHeaders(branch)
+		if err != nil {
+			s.reset()
+			return nil, err
+		}
+		s.headers = branch
+		c.forgetConnected()
+		if len(headers) < blockchain.MAX_HEADERS_PER_REQUEST {
+			break
+		}
+	}
+
+	if len(s.headers) > 0 && work == nil {
+		return c.blockchain.ValidateHeaders(s.headers)
+	}
+	return work, nil
+}
+
+// forgetConnected - Removes from the branch being synchronized the blocks that we already have.
+func (c *controller) forgetConnected() {
+	s := &c.chainSync
+	for len(s.headers) > 0 && c.blockchain.HasBlock(s.headers[0].Hash()) {
+		delete(s.blocks, s.headers[0].Hash())
+		s.headers = s.headers[1:]
+	}
+}
+
+// downloadBlocks - Downloads the missing blocks of the branch in parallel, one worker per neighbor.
+// When a neighbor fails, the block is asked to the next one, up to SYNC_FETCH_ATTEMPTS times.
+func (c *controller) downloadBlocks(peer string) {
+	s := &c.chainSync
+	peers := []string{peer}
+	for _, n := range c.gateway.Neighbors() {
+		if n != peer {
+			peers = append(peers, n)
+		}
+	}
+
+	jobs := make(chan [32]byte)
+	mux := sync.Mutex{}
+	wg := sync.WaitGroup{}
+	for w := range peers {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for hash := range jobs {
+				for attempt := 0; attempt < SYNC_FETCH_ATTEMPTS; attempt++ {
+					block, err := c.gateway.GetBlock(peers[(w+attempt)%len(peers)], hash)
+					if err != nil {
+						log.Printf("ERROR: %v", err)
+						continue
+					}
+					mux.Lock()
+					s.blocks[hash] = block
+					mux.Unlock()
+					break
+				}
+			}
+		}(w)
+	}
+
+	for _, h := range s.headers {
+		hash := h.Hash()
+		mux.Lock()
+		_, ok := s.blocks[hash]
+		mux.Unlock()
+		if !ok {
+			jobs <- hash
+		}
+	}
+	close(jobs)
+	wg.Wait()
+}
+
+// connectSynced - Adds the downloaded blocks to our chain in the order of the headers, with the same
+// validation of any block from the network. It stops at the first block that was not downloaded, the
+// next round resumes from it.
+func (c *controller) connectSynced() error {
+	s := &c.chainSync
+	for len(s.headers) > 0 {
+		hash := s.headers[0].Hash()
+		block, ok := s.blocks[hash]
+		if !ok {
+			return fmt.Errorf("block %d was not downloaded, the sync will resume from it", s.headers[0].Number())
+		}
+		err := c.AddProposedBlockFromNetwork(block, "")
+		if err != nil && !errors.Is(err, blockchain.ErrKnownBlock) {
+			s.reset()
+			return err
+		}
+		delete(s.blocks, hash)
+		s.headers = s.headers[1:]
+	}
+	log.Printf("Synchronized up to block %d", c.blockchain.LastBlock().Number())
+	return nil
+}
@@ -1,12 +1,21 @@
 package controller
 
 import (
+	"crypto/ecdsa"
+	"errors"
+	"fmt"
 	"log"
+	"math"
 	"net/http"
+	"path/filepath"
 	"strconv"
+	"strings"
 	"sync"
+	"time"
 
+	"github.com/martinsaporiti/blockchain-sample/internal/blkcrypto"
 	"github.com/martinsaporiti/blockchain-sample/internal/blockchain"
+	"github.com/martinsaporiti/blockchain-sample/internal/coin"
 	"github.com/martinsaporiti/blockchain-sample/internal/config"
 	"github.com/martinsaporiti/blockchain-sample/internal/dto"
 	"github.com/martinsaporiti/blockchain-sample/internal/gateway"
@@ -14,6 +23,14 @@ import (
 
 const (
 	MINING_SENDER = "THE BLOCKCHAIN"
+	// MEMPOOL_SNAPSHOT_INTERVAL - How often the transaction pool is saved to the data directory.
+	MEMPOOL_SNAPSHOT_INTERVAL = 30 * time.Second
+	// MAX_MISSING_ANCESTORS - How many missing ancestors of an orphan block are asked to the peer that sent it.
+	MAX_MISSING_ANCESTORS = 100
+	// ADDRESS_PAGE_SIZE - How many transactions of an address are returned when the page size is not given.
+	ADDRESS_PAGE_SIZE = 20
+	// MAX_ADDRESS_PAGE_SIZE - How many transactions of an address can be asked in a page.
+	MAX_ADDRESS_PAGE_SIZE = 100
 )
 
 type Controller interface {
@@ -21,8 +38,17 @@ type Controller interface {
 	CreateTransaction(tx *dto.TransactionRequest) bool
 	AddTransaction(tr *dto.TransactionRequest) bool
 	GetTransactions() []*blockchain.Transaction
-	AddProposedBlockFromNetwork(block *blockchain.Block)
-	CalculateTotalAmount(blockchainAddress string) float32
+	AddProposedBlockFromNetwork(block *blockchain.Block, sender string) error
+	GetBlock(hash string) (*blockchain.Block, error)
+	GetStatus() (*dto.StatusResponse, error)
+	GetHeaders(locator []string) ([]*blockchain.BlockHeader, error)
+	CalculateTotalAmount(blockchainAddress string) coin.Amount
+	GetUnspentOutputs(blockchainAddress string) []*blockchain.UnspentOutput
+	GetAccount(blockchainAddress string) *dto.AccountResponse
+	GetTransactionProof(txID string) (*dto.TransactionProofResponse, error)
+	GetTransactionStatus(txID string) (*dto.TransactionStatusResponse, error)
+	GetAddress(blockchainAddress string, page int, limit int) (*dto.AddressResponse, error)
+	Stop()
 }
 
 type controller struct {
@@ -34,18 +60,83 @@ type controller struct {
 	nodeName             string
 	startMiningChannel   chan bool
 	newBlockMinedChannel chan *blockchain.Block
+	chainSync            chainSync
+	// mempoolFile - Where the transaction pool is saved, empty when there is no data directory.
+	mempoolFile string
+	// saveMux - Serializes the saves of the transaction pool, the periodic one and the one of Stop.
+	saveMux sync.Mutex
+	// quit - Closed by Stop to end the periodic work of the node.
+	quit chan struct{}
+	// fetching - Hashes of the missing blocks whose ancestors are being fetched, one fetch per hash.
+	fetching    map[[32]byte]bool
+	fetchingMux sync.Mutex
 }
 
-func New(config config.Config) Controller {
+func New(config config.Config) (Controller, error) {
 	gtw := gateway.New(config.Port)
 	nodeName := MINING_SENDER + " " + strconv.FormatInt(int64(config.Port), 10)
-	blchain := blockchain.NewBlockchain(nodeName, config.BlockchainAddress, config.MiningDifficulty)
 
-	startMiningChannel := make(chan bool)
+	store, err := newBlockStore(config)
+	if err != nil {
+		return nil, err
+	}
+
+	genesis, err := newGenesis(config)
+	if err != nil {
+		store.Close()
+		return nil, err
+	}
+	engine, err := newConsensusEngine(config, genesis)
+	if err != nil {
+		store.Close()
+		return nil, err
+	}
+	blchain, err := blockchain.NewBlockchain(nodeName, config.BlockchainAddress, genesis, engine, store,
+		blockchain.LedgerMode(config.LedgerMode))
+	if err != nil {
+		store.Close()
+		return nil, err
+	}
+	checkpoints, err := blockchain.ParseCheckpoints(config.Checkpoints)
+	if err != nil {
+		store.Close()
+		return nil, err
+	}
+	finality := blockchain.FinalityRules{Checkpoints: checkpoints, MaxReorgDepth: config.MaxReorgDepth}
+	if err := blchain.SetFinalityRules(finality); err != nil {
+		store.Close()
+		return nil, err
+	}
+
+	// The pool does not wait for the miner, one pending signal is enough to wake it up.
+	startMiningChannel := make(chan bool, 1)
 	newBlockMinedChannel := make(chan *blockchain.Block)
-	txPool := blockchain.NewTransactionPool(startMiningChannel)
+	txPool := blockchain.NewTransactionPool(startMiningChannel, blchain.Ledger(), blchain.ChainID())
+	txPool.SetLimits(blockchain.MempoolLimits{
+		MaxTransactions: config.MempoolMaxTxs,
+		MaxSize:         config.MempoolMaxSize,
+		MaxPerSender:    config.MempoolMaxPerSender,
+		TTL:             config.MempoolTTL,
+	})
 
-	miner := blockchain.NewMiner(blchain, txPool, startMiningChannel, newBlockMinedChannel)
+	limits := blockchain.BlockLimits{
+		MaxTransactions: config.MaxBlockTransactions,
+		MaxSize:         config.MaxBlockSize,
+	}
+	miner := blockchain.NewMiner(blchain, txPool, limits, startMiningChannel, newBlockMinedChannel)
+
+	// The transactions that were waiting when the node stopped are loaded again, the ones mined or no longer
+	// valid on top of the chain are dropped.
+	var mempoolFile string
+	if config.DataDir != "" {
+		mempoolFile = filepath.Join(config.DataDir, blockchain.MEMPOOL_SNAPSHOT_FILE)
+		n, err := txPool.LoadSnapshot(mempoolFile)
+		if err != nil {
+			log.Printf("ERROR: Could not load the transaction pool: %v", err)
+		} else {
+			log.Printf("Loaded %d transactions into the pool", n)
+		}
+	}
 
 	ctrl := &controller{
 		blockchainAddress:    config.BlockchainAddress,
@@ -56,46 +147,135 @@ func New(config config.Config) Controller {
 		miner:                miner,
 		startMiningChannel:   startMiningChannel,
 		newBlockMinedChannel: newBlockMinedChannel,
+		mempoolFile:          mempoolFile,
+		quit:                 make(chan struct{}),
+		fetching:             make(map[[32]byte]bool),
 	}
 
+	ctrl.chainSync.reset()
+	blchain.OnReorg(ctrl.reorganized)
 	ctrl.start()
-	return ctrl
+	return ctrl, nil
 }
 
-func (c *controller) start() {
-	c.gateway.StartSyncNeighbors()
-	c.updateBlockchainFromNetwork()
-	go c.miner.SignalStartMining()
-	go c.newBlockMined(c.newBlockMinedChannel)
+// newBlockStore - Returns the store for the blocks.
+// If there is no data directory configured, the blocks are kept only in memory.
+func newBlockStore(config config.Config) (blockchain.BlockStore, error) {
+	if config.DataDir == "" {
+		return blockchain.NewMemoryBlockStore(), nil
+	}
+	log.Printf("Using data directory: %s", config.DataDir)
+	return blockchain.NewFileBlockStore(filepath.Join(config.DataDir, "blocks"))
 }
 
-// updateBlockchainFromNetwork - Updates the blockchain from the network.
-func (c *controller) updateBlockchainFromNetwork() {
-	maxLength := len(c.blockchain.Chain()) - 1
-	var longestChain []*blockchain.Block = nil
+// newGenesis - Returns the genesis of the network, read from the genesis file. Without a file, the genesis
+// has the default chain ID and timestamp, no allocations and the consensus settings of the flags, so the
+// nodes started with the same flags share the genesis block.
+func newGenesis(config config.Config) (*blockchain.Genesis, error) {
+	if config.GenesisFile != "" {
+		log.Printf("Using genesis file: %s", config.GenesisFile)
+		return blockchain.LoadGenesis(config.GenesisFile)
+	}
+	consensus := blockchain.ConsensusMode(config.Consensus)
+	if consensus == "" {
+		consensus = blockchain.CONSENSUS_POW
+	}
+	genesis := &blockchain.Genesis{
+		ChainID:    blockchain.DEFAULT_CHAIN_ID,
+		Timestamp:  blockchain.DEFAULT_GENESIS_TIMESTAMP,
+		Difficulty: config.MiningDifficulty,
+		Consensus: blockchain.GenesisConsensus{
+			Engine:         consensus,
+			Signers:        config.Signers,
+			RetargetWindow: config.RetargetWindow,
+		},
+	}
+	if config.TargetBlockInterval != 0 {
+		genesis.Consensus.BlockInterval = config.TargetBlockInterval.String()
+	}
+	return genesis, genesis.Validate()
+}
 
-	wg := sync.WaitGroup{}
-	wg.Add(c.gateway.NumberOfNeighbords())
+// newConsensusEngine - Returns the engine that seals and verifies the blocks, with the consensus settings
+// of the genesis. With proof of authority, the node signs blocks only if it has the key of one of the
+// signers, with proof of stake if it has the key of a validator.
+func newConsensusEngine(config config.Config, genesis *blockchain.Genesis) (blockchain.ConsensusEngine, error) {
+	var key *ecdsa.PrivateKey
+	if config.SignerKey != "" {
+		k, err := blkcrypto.PrivateKeyFromHex(config.SignerKey)
+		if err != nil {
+			return nil, err
+		}
+		key = k
+	}
 
-	chainsChan := c.gateway.GetChains(&wg)
+	settings := genesis.Consensus
+	switch settings.Engine {
+	case blockchain.CONSENSUS_POW:
+		rules, err := settings.DifficultyRules()
+		if err != nil {
+			return nil, err
+		}
+		return blockchain.NewProofOfWork(genesis.Difficulty, rules, config.MiningWorkers)
+	case blockchain.CONSENSUS_POA:
+		log.Printf("Using proof of authority with %d signers", len(settings.Signers))
+		return blockchain.NewProofOfAuthority(settings.Signers, key)
+	case blockchain.CONSENSUS_POS:
+		if blockchain.LedgerMode(config.LedgerMode) != blockchain.LEDGER_MODE_ACCOUNT {
+			return nil, blockchain.ErrStakingNeedsAccounts
+		}
+		log.Printf("Using proof of stake with %d bootstrap signers", len(settings.Signers))
+		return blockchain.NewProofOfStake(settings.Signers, key), nil
+	default:
+		return nil, fmt.Errorf("unknown consensus: %s", settings.Engine)
+	}
+}
 
-	go func(wg *sync.WaitGroup) {
-		wg.Wait()
-		close(chainsChan)
-	}(&wg)
+func (c *controller) start() {
+	c.gateway.StartSyncNeighbors()
+	c.syncFromNetwork()
+	go c.syncPeriodically()
+	if c.mempoolFile != "" {
+		go c.saveMempoolPeriodically()
+	}
+	go c.miner.SignalStartMining()
+	go c.newBlockMined(c.newBlockMinedChannel)
+}
 
-	for chain := range chainsChan {
-		log.Printf("The length of the chain received is %d and mine is: %d", len(chain), len(c.blockchain.Chain()))
-		if len(chain) > maxLength && c.blockchain.IsValidChain(chain) {
-			maxLength = len(chain)
-			longestChain = chain
+// saveMempoolPeriodically - Every MEMPOOL_SNAPSHOT_INTERVAL saves the transaction pool, so the pending
+// transactions survive a restart.
+func (c *controller) saveMempoolPeriodically() {
+	ticker := time.NewTicker(MEMPOOL_SNAPSHOT_INTERVAL)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			c.saveMempool()
+		case <-c.quit:
+			return
 		}
 	}
+}
+
+func (c *controller) saveMempool() {
+	c.saveMux.Lock()
+	defer c.saveMux.Unlock()
+	if err := c.txPool.SaveSnapshot(c.mempoolFile); err != nil {
+		log.Printf("ERROR: Could not save the transaction pool: %v", err)
+	}
+}
 
-	if longestChain != nil {
-		c.blockchain.SetChain(longestChain)
-		c.txPool.UpdateFromBlock(c.blockchain.LastBlock())
-		log.Printf("New chain is %d blocks long and is valid", len(longestChain))
+// Stop - Saves the transaction pool when the node stops, so the transactions that arrived after the last
+// periodic save survive the restart too. The periodic save is stopped and the block store is closed, the
+// node can not be used after it.
+func (c *controller) Stop() {
+	close(c.quit)
+	if c.mempoolFile != "" {
+		c.saveMempool()
+		log.Printf("Saved %d transactions of the pool", c.txPool.Length())
+	}
+	if err := c.blockchain.Close(); err != nil {
+		log.Printf("ERROR: Could not close the block store: %v", err)
 	}
 }
 
@@ -130,24 +310,375 @@ func (c *controller) GetTransactions() []*blockchain.Transaction {
 }
 
 // AddProposedBlockFromNetwork - Adds a block to the blockchain.
-// This method is called by the neighbors.
-// If the proposed block is valid, it is added to the blockchain and all the transactions in the block are removed
-// from the pool.
-func (c *controller) AddProposedBlockFromNetwork(block *blockchain.Block) {
-	added := c.blockchain.AddProposedBlockFromNetwork(block)
-	if added {
-		// All the transactions in the block are removed from the pool.
-		c.txPool.UpdateFromBlock(block)
-		// Stops the miner (current mining operation).
-		c.miner.SignalCancelMining()
+// This method is called by the neighbors, the sender is the address of the peer that sent the block.
+// If the proposed block is valid, it is added to the blockchain. When it changes the last block, the
+// transactions mined by every block that joined the main chain, the orphans it connected too, are removed
+// from the pool. After a reorganization the pool was already updated, see reorganized. Otherwise, returns
+// why the block was ignored.
+// When the parent of the block is not known, the missing ancestors are asked to the sender.
+func (c *controller) AddProposedBlockFromNetwork(block *blockchain.Block, sender string) error {
+	lastBlock := c.blockchain.LastBlock()
+	if err := c.blockchain.AddProposedBlockFromNetwork(block); err != nil {
+		if errors.Is(err, blockchain.ErrOrphanBlock) && sender != "" {
+			c.startFetchingAncestors(block, sender)
+		}
+		return err
+	}
+	newLastBlock := c.blockchain.LastBlock()
+	if newLastBlock.Hash() == lastBlock.Hash() {
+		// The block was added to a side branch.
+		return nil
+	}
+	for _, b := range c.connectedSince(lastBlock, newLastBlock) {
+		c.txPool.UpdateFromBlock(b)
+	}
+	// Stops the miner (current mining operation).
+	c.miner.SignalCancelMining()
+	// Wakes up the miner for the next block, with proof of authority or stake it may be the turn of this node.
+	select {
+	case c.startMiningChannel <- true:
+	default:
+	}
+	return nil
+}
+
+// connectedSince - Returns the blocks after the last block up to the new last block, oldest first, when the
+// new one descends from it. Returns nil when the main chain moved to another branch.
+func (c *controller) connectedSince(lastBlock *blockchain.Block, newLastBlock *blockchain.Block) []*blockchain.Block {
+	connected := make([]*blockchain.Block, 0)
+	for b := newLastBlock; b.Hash() != lastBlock.Hash(); {
+		if b.Number() <= lastBlock.Number() {
+			return nil
+		}
+		connected = append([]*blockchain.Block{b}, connected...)
+		parent, err := c.blockchain.BlockByHash(b.PreviousHash())
+		if err != nil {
+			log.Printf("ERROR: reading the parent of block %d: %v", b.Number(), err)
+			return connected
+		}
+		b = parent
+	}
+	return connected
+}
+
+// startFetchingAncestors - Fetches the ancestors of the orphan block in the background, unless they are
+// already being fetched. The sender address comes from a header anyone can set, so the ancestors are only
+// asked to a neighbor.
+func (c *controller) startFetchingAncestors(orphan *blockchain.Block, sender string) {
+	if !c.isNeighbor(sender) {
+		log.Printf("Not fetching the ancestors of block %d from %s, it is not a neighbor", orphan.Number(), sender)
+		return
+	}
+	missing := orphan.PreviousHash()
+	c.fetchingMux.Lock()
+	defer c.fetchingMux.Unlock()
+	if c.fetching[missing] {
+		return
+	}
+	c.fetching[missing] = true
+	go func() {
+		c.fetchAncestors(orphan, sender)
+		c.fetchingMux.Lock()
+		delete(c.fetching, missing)
+		c.fetchingMux.Unlock()
+	}()
+}
+
+func (c *controller) isNeighbor(address string) bool {
+	for _, n := range c.gateway.Neighbors() {
+		if n == address {
+			return true
+		}
+	}
+	return false
+}
+
+// fetchAncestors - Asks the peer for the ancestors of the orphan block, by hash, until one of them
+// connects to a block we know. The blocks received go through the normal validation, from the oldest
+// one up, and the last one connects the orphan. It stops at a genesis block, ours is always known.
+func (c *controller) fetchAncestors(orphan *blockchain.Block, peer string) {
+	missing := make([]*blockchain.Block, 0)
+	hash := orphan.PreviousHash()
+	for !c.blockchain.HasBlock(hash) {
+		if len(missing) == MAX_MISSING_ANCESTORS {
+			log.Printf("ERROR: block %d is more than %d blocks ahead of our chain", orphan.Number(),
+				MAX_MISSING_ANCESTORS)
+			return
+		}
+		block, err := c.gateway.GetBlock(peer, hash)
+		if err != nil {
+			log.Printf("ERROR: fetching the ancestors of block %d: %v", orphan.Number(), err)
+			return
+		}
+		if block.Number() == 1 {
+			log.Printf("ERROR: block %d descends from another genesis block %x", orphan.Number(), block.Hash())
+			return
+		}
+		missing = append(missing, block)
+		hash = block.PreviousHash()
 	}
+
+	log.Printf("Fetched %d missing blocks from %s", len(missing), peer)
+	for i := len(missing) - 1; i >= 0; i-- {
+		err := c.AddProposedBlockFromNetwork(missing[i], "")
+		if err != nil && !errors.Is(err, blockchain.ErrKnownBlock) {
+			log.Printf("ERROR: adding the ancestors of block %d: %v", orphan.Number(), err)
+			return
+		}
+	}
+}
+
+// GetBlock - Returns the block with the hash, in hex, from the main chain or from a side branch.
+// This method is called by the neighbors to fetch the blocks they are missing.
+func (c *controller) GetBlock(hash string) (*blockchain.Block, error) {
+	h, err := blockchain.ParseBlockHash(hash)
+	if err != nil {
+		return nil, err
+	}
+	return c.blockchain.BlockByHash(h)
+}
+
+// GetStatus - Returns the tip of our main chain, its chainwork, the last final block and the hashrate of
+// our miner.
+// This method is called by the neighbors to decide whether they have to synchronize from us.
+func (c *controller) GetStatus() (*dto.StatusResponse, error) {
+	lastBlock := c.blockchain.LastBlock()
+	work, err := c.blockchain.ChainWork(lastBlock.Hash())
+	if err != nil {
+		return nil, err
+	}
+	return &dto.StatusResponse{
+		Genesis:         fmt.Sprintf("%x", c.blockchain.GenesisHash()),
+		Number:          lastBlock.Number(),
+		Hash:            fmt.Sprintf("%x", lastBlock.Hash()),
+		ChainWork:       work.String(),
+		FinalizedNumber: c.blockchain.FinalizedNumber(),
+		Hashrate:        c.miner.Hashrate(),
+	}, nil
+}
+
+// GetHeaders - Returns the headers of our main chain that follow the first block of the locator, a list of
+// block hashes in hex, that we have in our main chain.
+// This method is called by the neighbors that synchronize from us.
+func (c *controller) GetHeaders(locator []string) ([]*blockchain.BlockHeader, error) {
+	hashes := make([][32]byte, len(locator))
+	for i, s := range locator {
+		hash, err := blockchain.ParseBlockHash(s)
+		if err != nil {
+			return nil, err
+		}
+		hashes[i] = hash
+	}
+	return c.blockchain.HeadersAfter(hashes, blockchain.MAX_HEADERS_PER_REQUEST), nil
+}
+
+// reorganized - Called when the main chain moves to another branch.
+// The transactions of the blocks that left the main chain go back to the pool, and the ones mined by the
+// blocks that joined it are removed.
+func (c *controller) reorganized(event *blockchain.ReorgEvent) {
+	c.txPool.UpdateFromReorg(event)
 }
 
 // CalculateTotalAmount - Returns the total amount of USD per a given address.
-func (c *controller) CalculateTotalAmount(blockchainAddress string) float32 {
+func (c *controller) CalculateTotalAmount(blockchainAddress string) coin.Amount {
 	return c.blockchain.CalculateTotalAmount(blockchainAddress)
 }
 
+// GetUnspentOutputs - Returns the outputs a given address can spend.
+// Outputs already spent by a transaction of the pool are left out.
+// When the ledger is not UTXO based, there are no outputs to spend.
+func (c *controller) GetUnspentOutputs(blockchainAddress string) []*blockchain.UnspentOutput {
+	utxos := make([]*blockchain.UnspentOutput, 0)
+	utxoSet, ok := c.blockchain.Ledger().(*blockchain.UTXOSet)
+	if !ok {
+		return utxos
+	}
+	for _, utxo := range utxoSet.UnspentOutputs(blockchainAddress) {
+		if !c.txPool.IsSpent(utxo.OutPoint) {
+			utxos = append(utxos, utxo)
+		}
+	}
+	return utxos
+}
+
+// GetAccount - Returns the balance of a given address and the nonce its next transaction must use.
+// The chain ID tells the wallet the network its transactions must be signed for.
+// The nonce counts the transactions of the address that are waiting in the pool.
+func (c *controller) GetAccount(blockchainAddress string) *dto.AccountResponse {
+	ledger := c.blockchain.Ledger()
+	nonce := ledger.Nonce(blockchainAddress)
+	if c.blockchain.LedgerMode() == blockchain.LEDGER_MODE_ACCOUNT {
+		for _, t := range c.txPool.Transactions() {
+			if t.SenderBlockchainAddress() == blockchainAddress && t.Nonce() >= nonce {
+				nonce = t.Nonce() + 1
+			}
+		}
+	}
+	response := &dto.AccountResponse{
+		BlockchainAddress: blockchainAddress,
+		Balance:           ledger.Balance(blockchainAddress),
+		Nonce:             nonce,
+		LedgerMode:        string(c.blockchain.LedgerMode()),
+		ChainID:           c.blockchain.ChainID(),
+	}
+	if state, ok := ledger.(*blockchain.State); ok {
+		account := state.Account(blockchainAddress)
+		response.Stake = account.Stake
+		response.Unbonding = account.Unbonding
+	}
+	return response
+}
+
+// GetTransactionProof - Returns the merkle proof that a mined transaction is part of its block.
+// With the proof and the block header, a wallet can verify a payment without downloading the block.
+func (c *controller) GetTransactionProof(txID string) (*dto.TransactionProofResponse, error) {
+	block, proof, err := c.blockchain.TransactionProof(txID)
+	if err != nil {
+		return nil, err
+	}
+
+	steps := make([]*dto.ProofStep, 0, len(proof.Steps))
+	for _, step := range proof.Steps {
+		position := "right"
+		if step.Left {
+			position = "left"
+		}
+		steps = append(steps, &dto.ProofStep{Hash: fmt.Sprintf("%x", step.Hash), Position: position})
+	}
+	return &dto.TransactionProofResponse{
+		TxID:        txID,
+		BlockNumber: block.Number(),
+		BlockHash:   fmt.Sprintf("%x", block.Hash()),
+		MerkleRoot:  fmt.Sprintf("%x", block.MerkleRoot()),
+		Index:       proof.Index,
+		Proof:       steps,
+	}, nil
+}
+
+// GetTransactionStatus - Returns what happened to the transaction with the ID: confirmed in a block of the
+// main chain, with its number of confirmations, pending in the pool, or dropped from the pool and why.
+// Returns blockchain.ErrTransactionNotFound if the node does not know the transaction.
+func (c *controller) GetTransactionStatus(txID string) (*dto.TransactionStatusResponse, error) {
+	txID = strings.ToLower(txID)
+	location, err := c.blockchain.TransactionLocation(txID)
+	if err == nil {
+		return &dto.TransactionStatusResponse{
+			TxID:          txID,
+			Status:        string(blockchain.TX_STATUS_CONFIRMED),
+			BlockNumber:   &location.BlockNumber,
+			BlockHash:     fmt.Sprintf("%x", location.BlockHash),
+			Index:         &location.Index,
+			Confirmations: location.Confirmations,
+		}, nil
+	}
+	if !errors.Is(err, blockchain.ErrTransactionNotFound) {
+		return nil, err
+	}
+
+	status, reason, err := c.txPool.Status(txID)
+	if err != nil {
+		return nil, err
+	}
+	return &dto.TransactionStatusResponse{TxID: txID, Status: string(status), Reason: reason}, nil
+}
+
+// GetAddress - Returns the balance of an address, its balance after the transactions of the pool, the
+// transactions of the pool that touch it and a page of its mined transactions, the newest first.
+// Pages start at 1. A page size of 0 uses ADDRESS_PAGE_SIZE and sizes over MAX_ADDRESS_PAGE_SIZE are cut.
+func (c *controller) GetAddress(blockchainAddress string, page int, limit int) (*dto.AddressResponse, error) {
+	if page < 1 {
+		page = 1
+	}
+	if limit <= 0 {
+		limit = ADDRESS_PAGE_SIZE
+	}
+	if limit > MAX_ADDRESS_PAGE_SIZE {
+		limit = MAX_ADDRESS_PAGE_SIZE
+	}
+
+	ledger := c.blockchain.Ledger()
+	view := ledger.NewView()
+	pending := make([]*dto.AddressTransaction, 0)
+	for _, t := range c.txPool.Transactions() {
+		// A transaction mined while the pool is read no longer applies, the ledger already has it.
+		if err := view.ApplyTransaction(t); err != nil {
+			continue
+		}
+		if touchesAddress(t, blockchainAddress) {
+			pending = append(pending, newAddressTransaction(t, blockchainAddress, nil))
+		}
+	}
+	// The newest pending transactions first, as the mined ones.
+	for i, j := 0, len(pending)-1; i < j; i, j = i+1, j-1 {
+		pending[i], pending[j] = pending[j], pending[i]
+	}
+
+	// A page so far that its offset does not fit in an int is past the history, it is empty.
+	offset := math.MaxInt
+	if page-1 <= math.MaxInt/limit {
+		offset = (page - 1) * limit
+	}
+	history, total, err := c.blockchain.AddressHistory(blockchainAddress, offset, limit)
+	if err != nil {
+		return nil, err
+	}
+	transactions := make([]*dto.AddressTransaction, 0, len(history))
+	for _, h := range history {
+		location := h.Location
+		transactions = append(transactions, newAddressTransaction(h.Transaction, blockchainAddress, &location))
+	}
+
+	return &dto.AddressResponse{
+		BlockchainAddress: blockchainAddress,
+		Balance:           ledger.Balance(blockchainAddress),
+		PendingBalance:    view.Balance(blockchainAddress),
+		Pending:           pending,
+		Transactions:      transactions,
+		Page:              page,
+		Limit:             limit,
+		Total:             total,
+	}, nil
+}
+
+// touchesAddress - Returns true if the address sends or receives coins in the transaction.
+func touchesAddress(t *blockchain.Transaction, blockchainAddress string) bool {
+	for _, address := range t.Addresses() {
+		if address == blockchainAddress {
+			return true
+		}
+	}
+	return false
+}
+
+// newAddressTransaction - Returns the transaction as seen by the address. A nil location means the
+// transaction is pending.
+func newAddressTransaction(t *blockchain.Transaction, blockchainAddress string,
+	location *blockchain.TxLocation) *dto.AddressTransaction {
+	direction := "in"
+	if !t.IsCoinbase() && t.SenderBlockchainAddress() == blockchainAddress {
+		direction = "out"
+		if t.RecipientBlockchainAddress() == blockchainAddress {
+			direction = "self"
+		}
+	}
+	at := &dto.AddressTransaction{
+		TxID:                       t.ID(),
+		Status:                     string(blockchain.TX_STATUS_PENDING),
+		SenderBlockchainAddress:    t.SenderBlockchainAddress(),
+		RecipientBlockchainAddress: t.RecipientBlockchainAddress(),
+		Value:                      t.Value(),
+		Fee:                        t.Fee(),
+		Timestamp:                  t.Timestamp(),
+		Direction:                  direction,
+	}
+	if location != nil {
+		at.Status = string(blockchain.TX_STATUS_CONFIRMED)
+		at.BlockNumber = &location.BlockNumber
+		at.Confirmations = location.Confirmations
+	}
+	return at
+}
+
 // newBlockMined - Called when a new block is mined.
 // Notifies the neighbors of the new block.
 func (c *controller) newBlockMined(newBlockMinedChannel chan *blockchain.Block) {
@@ -0,0 +1,13 @@
+package dto
+
+import "github.com/martinsaporiti/blockchain-sample/internal/coin"
+
+type AccountResponse struct {
+	BlockchainAddress string      `json:"blockchain_address"`
+	Balance           coin.Amount `json:"balance"`
+	Nonce             uint64      `json:"nonce"`
+	Stake             coin.Amount `json:"stake,omitempty"`
+	Unbonding         coin.Amount `json:"unbonding,omitempty"`
+	LedgerMode        string      `json:"ledger_mode"`
+	ChainID           string      `json:"chain_id"`
+}
@@ -0,0 +1,32 @@
+package dto
+
+import "github.com/martinsaporiti/blockchain-sample/internal/coin"
+
+// AddressTransaction - A transaction that touches an address. Status is "pending" or "confirmed", and
+// Direction is "in", "out" or "self" when the address sends to itself.
+type AddressTransaction struct {
+	TxID                       string      `json:"tx_id"`
+	Status                     string      `json:"status"`
+	BlockNumber                *int64      `json:"block_number,omitempty"`
+	Confirmations              int64       `json:"confirmations"`
+	SenderBlockchainAddress    string      `json:"sender_blockchain_address"`
+	RecipientBlockchainAddress string      `json:"recipient_blockchain_address"`
+	Value                      coin.Amount `json:"value"`
+	Fee                        coin.Amount `json:"fee"`
+	Timestamp                  int64       `json:"timestamp"`
+	Direction                  string      `json:"direction"`
+}
+
+// AddressResponse - Balance and history of an address. PendingBalance is the balance after the transactions
+// of the pool. Transactions is a page of the mined transactions, the newest first, and Total how many
+// transactions of the chain touch the address.
+type AddressResponse struct {
+	BlockchainAddress string                `json:"blockchain_address"`
+	Balance           coin.Amount           `json:"balance"`
+	PendingBalance    coin.Amount           `json:"pending_balance"`
+	Pending           []*AddressTransaction `json:"pending"`
+	Transactions      []*AddressTransaction `json:"transactions"`
+	Page              int                   `json:"page"`
+	Limit             int                   `json:"limit"`
+	Total             int                   `json:"total"`
+}
@@ -1,14 +1,18 @@
 package dto
 
-import "encoding/json"
+import (
+	"encoding/json"
+
+	"github.com/martinsaporiti/blockchain-sample/internal/coin"
+)
 
 type AmountResponse struct {
-	Amount float32 `json:"amount"`
+	Amount coin.Amount `json:"amount"`
 }
 
 func (ar *AmountResponse) MarshalJSON() ([]byte, error) {
 	return json.Marshal(struct {
-		Amount float32 `json:"amount"`
+		Amount coin.Amount `json:"amount"`
 	}{
 		Amount: ar.Amount,
 	})
@@ -10,3 +10,15 @@ func JsonStatus(message string) []byte {
 	})
 	return m
 }
+
+// JsonError - Returns a status message with the reason of the failure.
+func JsonError(message string, err error) []byte {
+	m, _ := json.Marshal(struct {
+		Message string `json:"message"`
+		Error   string `json:"error"`
+	}{
+		Message: message,
+		Error:   err.Error(),
+	})
+	return m
+}
@@ -0,0 +1,15 @@
+package dto
+
+// StatusResponse - The tip of the main chain of a node. Genesis is the hash of its genesis block, nodes
+// with another one are of another network. ChainWork is the total work of the chain,
+// in decimal, because it does not fit in a JSON number. FinalizedNumber is the number of the last block
+// no reorganization can replace, 0 when no block is final yet. Hashrate is the hashes per second of the last
+// proof of work of the node.
+type StatusResponse struct {
+	Genesis         string  `json:"genesis"`
+	Number          int64   `json:"number"`
+	Hash            string  `json:"hash"`
+	ChainWork       string  `json:"chain_work"`
+	FinalizedNumber int64   `json:"finalized_number"`
+	Hashrate        float64 `json:"hashrate"`
+}
@@ -0,0 +1,17 @@
+package dto
+
+// ProofStep - Sibling hash of a level of the merkle tree. Position is "left" or "right",
+// the side of the sibling in the hash of the level.
+type ProofStep struct {
+	Hash     string `json:"hash"`
+	Position string `json:"position"`
+}
+
+type TransactionProofResponse struct {
+	TxID        string       `json:"tx_id"`
+	BlockNumber int64        `json:"block_number"`
+	BlockHash   string       `json:"block_hash"`
+	MerkleRoot  string       `json:"merkle_root"`
+	Index       int          `json:"index"`
+	Proof       []*ProofStep `json:"proof"`
+}
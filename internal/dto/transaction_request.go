@@ -1,12 +1,31 @@
 package dto
 
+import "github.com/martinsaporiti/blockchain-sample/internal/coin"
+
+type TransactionInput struct {
+	TxID  *string `json:"tx_id"`
+	Index *uint32 `json:"index"`
+}
+
+type TransactionOutput struct {
+	BlockchainAddress *string      `json:"blockchain_address"`
+	Value             *coin.Amount `json:"value"`
+}
+
 type TransactionRequest struct {
-	SenderBlockchainAddress    *string  `json:"sender_blockchain_address"`
-	RecipientBlockchainAddress *string  `json:"recipient_blockchain_address"`
-	SenderPublicKey            *string  `json:"sender_public_key"`
-	Value                      *float32 `json:"value"`
-	Timestamp                  *int64   `json:"timestamp"`
-	Signature                  *string  `json:"signature"`
+	SenderBlockchainAddress    *string              `json:"sender_blockchain_address"`
+	RecipientBlockchainAddress *string              `json:"recipient_blockchain_address"`
+	SenderPublicKey            *string              `json:"sender_public_key"`
+	Value                      *coin.Amount         `json:"value"`
+	Fee                        *coin.Amount         `json:"fee"`
+	Timestamp                  *int64               `json:"timestamp"`
+	Nonce                      *uint64              `json:"nonce"`
+	Inputs                     []*TransactionInput  `json:"inputs"`
+	Outputs                    []*TransactionOutput `json:"outputs"`
+	Kind                       *string              `json:"kind,omitempty"`
+	Data                       *string              `json:"data,omitempty"`
+	ChainID                    *string              `json:"chain_id,omitempty"`
+	Signature                  *string              `json:"signature"`
 }
 
 func (tr *TransactionRequest) Validate() bool {
@@ -0,0 +1,13 @@
+package dto
+
+// TransactionStatusResponse - What happened to a transaction. Status is "pending", "confirmed" or "dropped".
+// The block fields are set for confirmed transactions, and the reason for dropped ones.
+type TransactionStatusResponse struct {
+	TxID          string `json:"tx_id"`
+	Status        string `json:"status"`
+	BlockNumber   *int64 `json:"block_number,omitempty"`
+	BlockHash     string `json:"block_hash,omitempty"`
+	Index         *int   `json:"index,omitempty"`
+	Confirmations int64  `json:"confirmations"`
+	Reason        string `json:"reason,omitempty"`
+}
@@ -0,0 +1,15 @@
+package dto
+
+import "github.com/martinsaporiti/blockchain-sample/internal/coin"
+
+type UnspentOutput struct {
+	TxID              string      `json:"tx_id"`
+	Index             uint32      `json:"index"`
+	BlockchainAddress string      `json:"blockchain_address"`
+	Value             coin.Amount `json:"value"`
+}
+
+type UnspentOutputsResponse struct {
+	UnspentOutputs []*UnspentOutput `json:"unspent_outputs"`
+	Length         int              `json:"length"`
+}
@@ -1,14 +1,15 @@
 package gateway
 
 import (
-	"sync"
-
 	"github.com/martinsaporiti/blockchain-sample/internal/blockchain"
+	"github.com/martinsaporiti/blockchain-sample/internal/dto"
 )
 
 type Gateway interface {
 	StartSyncNeighbors()
 	NotifyNeighbors(endpoint, method string, message interface{})
-	GetChains(wg *sync.WaitGroup) chan []*blockchain.Block
-	NumberOfNeighbords() int
+	Neighbors() []string
+	GetStatus(peer string) (*dto.StatusResponse, error)
+	GetHeaders(peer string, locator [][32]byte) ([]*blockchain.BlockHeader, error)
+	GetBlock(peer string, hash [32]byte) (*blockchain.Block, error)
 }
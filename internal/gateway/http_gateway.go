@@ -3,13 +3,16 @@ package gateway
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/martinsaporiti/blockchain-sample/internal/blockchain"
+	"github.com/martinsaporiti/blockchain-sample/internal/dto"
 	"github.com/martinsaporiti/blockchain-sample/internal/network"
 )
 
@@ -20,8 +23,17 @@ const (
 	NEIGHBOR_IP_RANGE_START          = 1
 	NEIGHBOR_IP_RANGE_END            = 3
 	BLOCKCHIN_NEIGHBOR_SYNC_TIME_SEC = 10
+	// NODE_ADDRESS_HEADER - Header with the address (host:port) of the node that sends a notification,
+	// the receiver asks it for the blocks it is missing if it is one of its neighbors.
+	NODE_ADDRESS_HEADER = "X-Node-Address"
+	// PEER_REQUEST_TIMEOUT - How long the node waits for a neighbor to answer a request.
+	PEER_REQUEST_TIMEOUT = 10 * time.Second
 )
 
+// peerClient - Client for the requests whose answer the node waits for, so a neighbor that does not answer
+// does not block it.
+var peerClient = &http.Client{Timeout: PEER_REQUEST_TIMEOUT}
+
 type httpGateway struct {
 	port         uint16
 	neighbors    []string
@@ -34,8 +46,13 @@ func New(port uint16) Gateway {
 	}
 }
 
-func (g *httpGateway) NumberOfNeighbords() int {
-	return len(g.neighbors)
+// Neighbors - Returns the addresses (host:port) of the neighbors.
+func (g *httpGateway) Neighbors() []string {
+	g.muxNeighbors.Lock()
+	defer g.muxNeighbors.Unlock()
+	neighbors := make([]string, len(g.neighbors))
+	copy(neighbors, g.neighbors)
+	return neighbors
 }
 
 func (g *httpGateway) syncNeighbors() {
@@ -72,6 +89,7 @@ func (g *httpGateway) NotifyNeighbors(endpoint, method string, message interface
 			} else {
 				req, _ = http.NewRequest(method, finalEndpoint, nil)
 			}
+			req.Header.Set(NODE_ADDRESS_HEADER, fmt.Sprintf("%s:%d", network.GetHost(), g.port))
 			_, err := client.Do(req)
 			if err != nil {
 				log.Println("ERROR: Failed notifying neighbors")
@@ -80,29 +98,68 @@ func (g *httpGateway) NotifyNeighbors(endpoint, method string, message interface
 	}
 }
 
-// GetChains - Returns the chains of all neighbors
-func (g *httpGateway) GetChains(wg *sync.WaitGroup) chan []*blockchain.Block {
-	// this channel will be used to return the chains of all neighbors:
-	chainsChann := make(chan []*blockchain.Block)
+// GetStatus - Returns the tip of the main chain of the peer.
+func (g *httpGateway) GetStatus(peer string) (*dto.StatusResponse, error) {
+	resp, err := peerClient.Get(fmt.Sprintf("http://%s/status", peer))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("getting the status of %s: %s", peer, resp.Status)
+	}
 
-	// For each neighbor, get the chain and add it to the channel
-	for _, n := range g.neighbors {
-		go func(wg *sync.WaitGroup, neighbor string, chainsChann chan []*blockchain.Block) {
-			defer wg.Done()
-			endpoint := fmt.Sprintf("http://%s/chain", neighbor)
-			log.Printf("Calling to resolve conflics: endpoint %s\n", endpoint)
-			resp, _ := http.Get(endpoint)
-			if resp.StatusCode == 200 {
-				var bcResp blockchain.Blockchain
-				decoder := json.NewDecoder(resp.Body)
-				if err := decoder.Decode(&bcResp); err != nil {
-					log.Printf("Error decoding response %v", err)
-				}
-				chain := bcResp.Chain()
-				chainsChann <- chain
-			}
-		}(wg, n, chainsChann)
+	var status dto.StatusResponse
+	if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+		return nil, fmt.Errorf("decoding the status of %s: %w", peer, err)
 	}
+	return &status, nil
+}
 
-	return chainsChann
+// GetHeaders - Returns the headers of the main chain of the peer that follow the first block of the
+// locator it knows, up to blockchain.MAX_HEADERS_PER_REQUEST.
+func (g *httpGateway) GetHeaders(peer string, locator [][32]byte) ([]*blockchain.BlockHeader, error) {
+	hashes := make([]string, len(locator))
+	for i, hash := range locator {
+		hashes[i] = fmt.Sprintf("%x", hash)
+	}
+	endpoint := fmt.Sprintf("http://%s/headers?locator=%s", peer, strings.Join(hashes, ","))
+	resp, err := peerClient.Get(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("getting headers from %s: %s", peer, resp.Status)
+	}
+
+	var headersResp struct {
+		Headers []*blockchain.BlockHeader `json:"headers"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&headersResp); err != nil {
+		return nil, fmt.Errorf("decoding headers from %s: %w", peer, err)
+	}
+	return headersResp.Headers, nil
+}
+
+// GetBlock - Returns the block with the hash from the peer.
+func (g *httpGateway) GetBlock(peer string, hash [32]byte) (*blockchain.Block, error) {
+	endpoint := fmt.Sprintf("http://%s/block?hash=%x", peer, hash)
+	resp, err := peerClient.Get(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("getting block %x from %s: %s", hash, peer, resp.Status)
+	}
+
+	var block blockchain.Block
+	if err := json.NewDecoder(resp.Body).Decode(&block); err != nil {
+		return nil, fmt.Errorf("decoding block %x from %s: %w", hash, peer, err)
+	}
+	if block.Hash() != hash {
+		return nil, errors.New("the peer answered with another block")
+	}
+	return &block, nil
 }
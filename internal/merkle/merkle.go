@@ -0,0 +1,115 @@
+package merkle
+
+import (
+	"crypto/sha256"
+	"errors"
+)
+
+// Leaves and inner nodes are hashed with a different prefix, so an inner node can never be presented
+// as a leaf (second preimage attack).
+const (
+	LEAF_PREFIX = 0x00
+	NODE_PREFIX = 0x01
+)
+
+var ErrIndexOutOfRange = errors.New("leaf index out of range")
+
+// Tree - Merkle tree built over a list of leaves.
+// When a level has an odd number of nodes, the last one is promoted to the next level without hashing.
+type Tree struct {
+	// levels[0] are the hashes of the leaves, the last level has only the root.
+	levels [][][32]byte
+}
+
+// Step - Hash of the sibling of the path at a level of the tree.
+// Left is true when the sibling is on the left of the path.
+type Step struct {
+	Hash [32]byte
+	Left bool
+}
+
+// Proof - Siblings needed to compute the root from a leaf, from the bottom of the tree to the top.
+type Proof struct {
+	Index int
+	Steps []Step
+}
+
+// New - Builds the tree of the leaves.
+func New(leaves [][32]byte) *Tree {
+	level := make([][32]byte, len(leaves))
+	for i, leaf := range leaves {
+		level[i] = hashLeaf(leaf)
+	}
+
+	t := &Tree{levels: [][][32]byte{level}}
+	for len(level) > 1 {
+		next := make([][32]byte, 0, (len(level)+1)/2)
+		for i := 0; i < len(level); i += 2 {
+			if i+1 == len(level) {
+				next = append(next, level[i])
+				continue
+			}
+			next = append(next, hashNode(level[i], level[i+1]))
+		}
+		t.levels = append(t.levels, next)
+		level = next
+	}
+	return t
+}
+
+// Root - Returns the root of the tree. The root of a tree without leaves is the zero hash.
+func (t *Tree) Root() [32]byte {
+	top := t.levels[len(t.levels)-1]
+	if len(top) == 0 {
+		return [32]byte{}
+	}
+	return top[0]
+}
+
+// Root - Returns the root of the tree of the leaves.
+func Root(leaves [][32]byte) [32]byte {
+	return New(leaves).Root()
+}
+
+// Proof - Returns the proof that the leaf at the index is part of the tree.
+func (t *Tree) Proof(index int) (*Proof, error) {
+	if index < 0 || index >= len(t.levels[0]) {
+		return nil, ErrIndexOutOfRange
+	}
+
+	proof := &Proof{Index: index, Steps: make([]Step, 0, len(t.levels)-1)}
+	position := index
+	for _, level := range t.levels[:len(t.levels)-1] {
+		sibling := position ^ 1
+		if sibling < len(level) {
+			proof.Steps = append(proof.Steps, Step{Hash: level[sibling], Left: sibling < position})
+		}
+		position /= 2
+	}
+	return proof, nil
+}
+
+// Verify - Returns true if the proof links the leaf to the root.
+func Verify(root [32]byte, leaf [32]byte, proof *Proof) bool {
+	h := hashLeaf(leaf)
+	for _, step := range proof.Steps {
+		if step.Left {
+			h = hashNode(step.Hash, h)
+		} else {
+			h = hashNode(h, step.Hash)
+		}
+	}
+	return h == root
+}
+
+func hashLeaf(leaf [32]byte) [32]byte {
+	return sha256.Sum256(append([]byte{LEAF_PREFIX}, leaf[:]...))
+}
+
+func hashNode(left [32]byte, right [32]byte) [32]byte {
+	b := make([]byte, 0, 1+len(left)+len(right))
+	b = append(b, NODE_PREFIX)
+	b = append(b, left[:]...)
+	b = append(b, right[:]...)
+	return sha256.Sum256(b)
+}
@@ -0,0 +1,86 @@
+package merkle
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"testing"
+)
+
+func leaves(n int) [][32]byte {
+	l := make([][32]byte, n)
+	for i := range l {
+		l[i] = sha256.Sum256([]byte(fmt.Sprintf("tx %d", i)))
+	}
+	return l
+}
+
+func TestRoot(t *testing.T) {
+
+	tests := map[string]struct {
+		input [][32]byte
+		want  [32]byte
+	}{
+		"should return the zero hash when there are no leaves": {
+			input: nil,
+			want:  [32]byte{},
+		},
+		"should return the hash of the leaf when there is only one": {
+			input: leaves(1),
+			want:  hashLeaf(leaves(1)[0]),
+		},
+		"should hash the leaves in pairs": {
+			input: leaves(2),
+			want:  hashNode(hashLeaf(leaves(2)[0]), hashLeaf(leaves(2)[1])),
+		},
+		"should promote the last node of an odd level": {
+			input: leaves(3),
+			want: hashNode(
+				hashNode(hashLeaf(leaves(3)[0]), hashLeaf(leaves(3)[1])),
+				hashLeaf(leaves(3)[2])),
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := Root(tc.input); got != tc.want {
+				t.Errorf("Root() = %x, want %x", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestTree_Proof(t *testing.T) {
+
+	for n := 1; n <= 9; n++ {
+		l := leaves(n)
+		tree := New(l)
+		for i := range l {
+			proof, err := tree.Proof(i)
+			if err != nil {
+				t.Fatalf("Proof(%d) with %d leaves = %v", i, n, err)
+			}
+			if !Verify(tree.Root(), l[i], proof) {
+				t.Errorf("Verify() of leaf %d with %d leaves = false, want true", i, n)
+			}
+			if n > 1 && Verify(tree.Root(), l[(i+1)%n], proof) {
+				t.Errorf("Verify() of another leaf with the proof of leaf %d = true, want false", i)
+			}
+		}
+	}
+
+	if _, err := New(leaves(3)).Proof(3); err != ErrIndexOutOfRange {
+		t.Errorf("Proof() = %v, want %v", err, ErrIndexOutOfRange)
+	}
+}
+
+func TestVerify_ShouldRejectAnInnerNodeAsLeaf(t *testing.T) {
+
+	l := leaves(4)
+	tree := New(l)
+	inner := tree.levels[1][0]
+	proof := &Proof{Index: 0, Steps: []Step{{Hash: tree.levels[1][1], Left: false}}}
+
+	if Verify(tree.Root(), inner, proof) {
+		t.Errorf("Verify() of an inner node = true, want false")
+	}
+}
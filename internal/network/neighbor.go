@@ -57,7 +57,7 @@ func FindNeighbors(myHost string, myPort uint16, startIp uint16, endIp uint16, s
 
 // IsFoundHost checks if a host is found
 func IsFoundHost(host string, port uint16) bool {
-	target := fmt.Sprintf("%s:%d", host, port)
+	target := net.JoinHostPort(host, strconv.Itoa(int(port)))
 	_, err := net.DialTimeout("tcp", target, 1*time.Second)
 	return err == nil
 }
@@ -2,15 +2,20 @@ package servers
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"log"
+	"math"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/martinsaporiti/blockchain-sample/internal/blockchain"
 	"github.com/martinsaporiti/blockchain-sample/internal/config"
 	"github.com/martinsaporiti/blockchain-sample/internal/controller"
 	"github.com/martinsaporiti/blockchain-sample/internal/dto"
+	"github.com/martinsaporiti/blockchain-sample/internal/gateway"
 )
 
 type BlockchainServer struct {
@@ -132,8 +137,163 @@ func (bcs *BlockchainServer) AmountHandler(w http.ResponseWriter, r *http.Reques
 	}
 }
 
-func (bcs *BlockchainServer) AddNewBlockHandler(w http.ResponseWriter, req *http.Request) {
+func (bcs *BlockchainServer) UnspentOutputsHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		blockchainAddress := r.URL.Query().Get("blockchain_address")
+		utxos := bcs.controller.GetUnspentOutputs(blockchainAddress)
+		w.Header().Add("Content-Type", "application/json")
+		m, _ := json.Marshal(struct {
+			UnspentOutputs []*blockchain.UnspentOutput `json:"unspent_outputs"`
+			Length         int                         `json:"length"`
+		}{
+			UnspentOutputs: utxos,
+			Length:         len(utxos),
+		})
+		w.Write(m)
+
+	default:
+		log.Println("ERROR: Invalid request method")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (bcs *BlockchainServer) AccountHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		blockchainAddress := r.URL.Query().Get("blockchain_address")
+		account := bcs.controller.GetAccount(blockchainAddress)
+		w.Header().Add("Content-Type", "application/json")
+		m, _ := json.Marshal(account)
+		w.Write(m)
+
+	default:
+		log.Println("ERROR: Invalid request method")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (bcs *BlockchainServer) TransactionProofHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		txID := r.URL.Query().Get("id")
+		w.Header().Add("Content-Type", "application/json")
+		proof, err := bcs.controller.GetTransactionProof(txID)
+		if err != nil {
+			log.Printf("ERROR: %v", err)
+			if errors.Is(err, blockchain.ErrTransactionNotFound) {
+				w.WriteHeader(http.StatusNotFound)
+			} else {
+				w.WriteHeader(http.StatusBadRequest)
+			}
+			io.WriteString(w, string(dto.JsonError("fail", err)))
+			return
+		}
+		m, _ := json.Marshal(proof)
+		w.Write(m)
+
+	default:
+		log.Println("ERROR: Invalid request method")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (bcs *BlockchainServer) TransactionStatusHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		txID := strings.TrimPrefix(r.URL.Path, "/tx/")
+		w.Header().Add("Content-Type", "application/json")
+		status, err := bcs.controller.GetTransactionStatus(txID)
+		if err != nil {
+			log.Printf("ERROR: %v", err)
+			if errors.Is(err, blockchain.ErrTransactionNotFound) {
+				w.WriteHeader(http.StatusNotFound)
+			} else {
+				w.WriteHeader(http.StatusBadRequest)
+			}
+			io.WriteString(w, string(dto.JsonError("fail", err)))
+			return
+		}
+		m, _ := json.Marshal(status)
+		w.Write(m)
+
+	default:
+		log.Println("ERROR: Invalid request method")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (bcs *BlockchainServer) AddressHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		blockchainAddress := strings.TrimPrefix(r.URL.Path, "/address/")
+		w.Header().Add("Content-Type", "application/json")
+		page, err := positiveQueryInt(r, "page")
+		var limit int
+		if err == nil {
+			limit, err = positiveQueryInt(r, "limit")
+		}
+		// The offset of the page must fit in an int even with the largest page size.
+		if err == nil && page > math.MaxInt/controller.MAX_ADDRESS_PAGE_SIZE {
+			err = fmt.Errorf("page must be at most %d: %d", math.MaxInt/controller.MAX_ADDRESS_PAGE_SIZE, page)
+		}
+		if err == nil && blockchainAddress == "" {
+			err = errors.New("missing blockchain address")
+		}
+		if err != nil {
+			log.Printf("ERROR: %v", err)
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, string(dto.JsonError("fail", err)))
+			return
+		}
+		address, err := bcs.controller.GetAddress(blockchainAddress, page, limit)
+		if err != nil {
+			log.Printf("ERROR: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			io.WriteString(w, string(dto.JsonError("fail", err)))
+			return
+		}
+		m, _ := json.Marshal(address)
+		w.Write(m)
+
+	default:
+		log.Println("ERROR: Invalid request method")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// positiveQueryInt - Returns the value of a query parameter that must be a positive integer, or 0 if it
+// is not given.
+func positiveQueryInt(r *http.Request, name string) (int, error) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("%s must be a positive integer: %q", name, v)
+	}
+	return n, nil
+}
+
+func (bcs *BlockchainServer) BlockHandler(w http.ResponseWriter, req *http.Request) {
 	switch req.Method {
+	case http.MethodGet:
+		hash := req.URL.Query().Get("hash")
+		w.Header().Add("Content-Type", "application/json")
+		block, err := bcs.controller.GetBlock(hash)
+		if err != nil {
+			log.Printf("ERROR: %v", err)
+			if errors.Is(err, blockchain.ErrBlockNotFound) {
+				w.WriteHeader(http.StatusNotFound)
+			} else {
+				w.WriteHeader(http.StatusBadRequest)
+			}
+			io.WriteString(w, string(dto.JsonError("fail", err)))
+			return
+		}
+		m, _ := json.Marshal(block)
+		w.Write(m)
 	case http.MethodPost:
 		decoder := json.NewDecoder(req.Body)
 		var proposedBlock blockchain.Block
@@ -143,8 +303,21 @@ func (bcs *BlockchainServer) AddNewBlockHandler(w http.ResponseWriter, req *http
 			io.WriteString(w, string(dto.JsonStatus("fail")))
 			return
 		}
-		bcs.controller.AddProposedBlockFromNetwork(&proposedBlock)
 		w.Header().Add("Content-Type", "application/json")
+		if err := bcs.controller.AddProposedBlockFromNetwork(&proposedBlock,
+			req.Header.Get(gateway.NODE_ADDRESS_HEADER)); err != nil {
+			var validationErr *blockchain.BlockValidationError
+			if errors.Is(err, blockchain.ErrOrphanBlock) {
+				// The block is kept until its parent arrives, it is asked to the sender.
+				w.WriteHeader(http.StatusAccepted)
+			} else if errors.As(err, &validationErr) {
+				w.WriteHeader(http.StatusBadRequest)
+			} else {
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+			io.WriteString(w, string(dto.JsonError("fail", err)))
+			return
+		}
 		io.WriteString(w, string(dto.JsonStatus("success")))
 	default:
 		log.Printf("ERROR: Invalid HTTP Method")
@@ -152,11 +325,68 @@ func (bcs *BlockchainServer) AddNewBlockHandler(w http.ResponseWriter, req *http
 	}
 }
 
+func (bcs *BlockchainServer) StatusHandler(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+		w.Header().Add("Content-Type", "application/json")
+		status, err := bcs.controller.GetStatus()
+		if err != nil {
+			log.Printf("ERROR: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			io.WriteString(w, string(dto.JsonError("fail", err)))
+			return
+		}
+		m, _ := json.Marshal(status)
+		w.Write(m)
+
+	default:
+		log.Println("ERROR: Invalid request method")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (bcs *BlockchainServer) HeadersHandler(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+		locator := make([]string, 0)
+		if l := req.URL.Query().Get("locator"); l != "" {
+			locator = strings.Split(l, ",")
+		}
+		w.Header().Add("Content-Type", "application/json")
+		headers, err := bcs.controller.GetHeaders(locator)
+		if err != nil {
+			log.Printf("ERROR: %v", err)
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, string(dto.JsonError("fail", err)))
+			return
+		}
+		m, _ := json.Marshal(struct {
+			Headers []*blockchain.BlockHeader `json:"headers"`
+			Length  int                       `json:"length"`
+		}{
+			Headers: headers,
+			Length:  len(headers),
+		})
+		w.Write(m)
+
+	default:
+		log.Println("ERROR: Invalid request method")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
 func (bcs *BlockchainServer) Start() {
 	http.HandleFunc("/", bcs.GetChainHandler)
 	http.HandleFunc("/transactions", bcs.TransactionsHandler)
 	http.HandleFunc("/amount", bcs.AmountHandler)
-	http.HandleFunc("/block", bcs.AddNewBlockHandler)
+	http.HandleFunc("/utxos", bcs.UnspentOutputsHandler)
+	http.HandleFunc("/account", bcs.AccountHandler)
+	http.HandleFunc("/block", bcs.BlockHandler)
+	http.HandleFunc("/tx/proof", bcs.TransactionProofHandler)
+	http.HandleFunc("/tx/", bcs.TransactionStatusHandler)
+	http.HandleFunc("/address/", bcs.AddressHandler)
+	http.HandleFunc("/status", bcs.StatusHandler)
+	http.HandleFunc("/headers", bcs.HeadersHandler)
 	log.Printf("Listening on port %d", bcs.config.Port)
 	log.Fatal(http.ListenAndServe("0.0.0.0:"+strconv.Itoa(int(bcs.config.Port)), nil))
 }
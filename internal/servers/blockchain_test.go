@@ -0,0 +1,86 @@
+package servers
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/martinsaporiti/blockchain-sample/internal/config"
+	"github.com/martinsaporiti/blockchain-sample/internal/controller"
+	"github.com/martinsaporiti/blockchain-sample/internal/dto"
+)
+
+// addressController - Controller that answers GetAddress with an empty page and remembers the request.
+type addressController struct {
+	controller.Controller
+	called bool
+	page   int
+	limit  int
+}
+
+func (c *addressController) GetAddress(blockchainAddress string, page int, limit int) (*dto.AddressResponse,
+	error) {
+	c.called, c.page, c.limit = true, page, limit
+	return &dto.AddressResponse{BlockchainAddress: blockchainAddress, Page: page, Limit: limit}, nil
+}
+
+func TestBlockchainServer_AddressHandler(t *testing.T) {
+
+	maxPage := math.MaxInt / controller.MAX_ADDRESS_PAGE_SIZE
+
+	tests := map[string]struct {
+		target    string
+		want      int
+		wantPage  int
+		wantLimit int
+	}{
+		"should ask the controller for the page": {
+			target:    "/address/1CHD4Jjqsak4RV5JHAdYZ9CKY1dQe4tkXW?page=2&limit=10",
+			want:      http.StatusOK,
+			wantPage:  2,
+			wantLimit: 10,
+		},
+		"should leave the page and the limit to the controller when they are not given": {
+			target: "/address/1CHD4Jjqsak4RV5JHAdYZ9CKY1dQe4tkXW",
+			want:   http.StatusOK,
+		},
+		"should accept the last page whose offset fits in an int": {
+			target:   fmt.Sprintf("/address/1CHD4Jjqsak4RV5JHAdYZ9CKY1dQe4tkXW?page=%d", maxPage),
+			want:     http.StatusOK,
+			wantPage: maxPage,
+		},
+		"should reject a page whose offset does not fit in an int": {
+			target: fmt.Sprintf("/address/1CHD4Jjqsak4RV5JHAdYZ9CKY1dQe4tkXW?page=%d&limit=1", maxPage+1),
+			want:   http.StatusBadRequest,
+		},
+		"should reject a page that is not a positive integer": {
+			target: "/address/1CHD4Jjqsak4RV5JHAdYZ9CKY1dQe4tkXW?page=0",
+			want:   http.StatusBadRequest,
+		},
+		"should reject a request without address": {
+			target: "/address/",
+			want:   http.StatusBadRequest,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			ctrl := &addressController{}
+			server := NewBlockchainServer(config.Config{}, ctrl)
+			w := httptest.NewRecorder()
+			server.AddressHandler(w, httptest.NewRequest(http.MethodGet, tc.target, nil))
+			if w.Code != tc.want {
+				t.Fatalf("AddressHandler() status = %d, want %d: %s", w.Code, tc.want, w.Body)
+			}
+			if ctrl.called != (tc.want == http.StatusOK) {
+				t.Fatalf("AddressHandler() called GetAddress = %v, want %v", ctrl.called, !ctrl.called)
+			}
+			if ctrl.page != tc.wantPage || ctrl.limit != tc.wantLimit {
+				t.Errorf("GetAddress() page = %d, limit = %d, want %d, %d", ctrl.page, ctrl.limit, tc.wantPage,
+					tc.wantLimit)
+			}
+		})
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"io"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
 	"path"
 	"strconv"
@@ -15,6 +16,8 @@ import (
 	"time"
 
 	"github.com/martinsaporiti/blockchain-sample/internal/blkcrypto"
+	"github.com/martinsaporiti/blockchain-sample/internal/blockchain"
+	"github.com/martinsaporiti/blockchain-sample/internal/coin"
 	"github.com/martinsaporiti/blockchain-sample/internal/dto"
 	"github.com/martinsaporiti/blockchain-sample/internal/wallet"
 )
@@ -90,26 +93,112 @@ func (ws *Server) CreateTransactionHandler(w http.ResponseWriter, r *http.Reques
 
 		publicKey := blkcrypto.PublicKeyFromString(*t.SenderPrivateKey)
 		privateKey := blkcrypto.PrivateKeyFromString(*t.SenderPrivateKey, publicKey)
-		value, err := strconv.ParseFloat(*t.Value, 32)
+		value, err := coin.ParseAmount(*t.Value)
 		if err != nil {
 			log.Printf("ERROR: %s", err.Error())
 			io.WriteString(w, string(dto.JsonStatus("fail")))
 			return
 		}
+		// The fee is optional, without it the transaction is mined after the ones that pay a fee.
+		var fee coin.Amount
+		if t.Fee != nil && *t.Fee != "" {
+			if fee, err = coin.ParseAmount(*t.Fee); err != nil {
+				log.Printf("ERROR: %s", err.Error())
+				io.WriteString(w, string(dto.JsonStatus("fail")))
+				return
+			}
+		}
+
+		account, err := ws.account(*t.SenderBlockchainAddress)
+		if err != nil {
+			log.Printf("ERROR: %s", err.Error())
+			io.WriteString(w, string(dto.JsonStatus("fail")))
+			return
+		}
+
+		// Bonds and unbonds move coins between the balance and the stake of the sender.
+		kind := blockchain.TX_KIND_TRANSFER
+		if t.Kind != nil {
+			if kind, err = blockchain.ParseTxKind(*t.Kind); err != nil {
+				log.Printf("ERROR: %s", err.Error())
+				io.WriteString(w, string(dto.JsonStatus("fail")))
+				return
+			}
+		}
+		if kind != blockchain.TX_KIND_TRANSFER {
+			staking := kind == blockchain.TX_KIND_BOND || kind == blockchain.TX_KIND_UNBOND
+			if !staking || account.LedgerMode != "account" {
+				log.Printf("ERROR: the wallet can not create %s transactions in %s mode", kind, account.LedgerMode)
+				io.WriteString(w, string(dto.JsonStatus("fail")))
+				return
+			}
+			t.RecipientBlockchainAddress = t.SenderBlockchainAddress
+		}
 
-		value32 := float32(value)
 		timestamp := time.Now().Unix()
-		transaction := wallet.NewTransaction(privateKey, publicKey, *t.SenderBlockchainAddress,
-			*t.RecipientBlockchainAddress, value32, timestamp)
-		signature := transaction.GenerateSignature()
+		var transaction *wallet.Transaction
+		if account.LedgerMode == "account" {
+			transaction = wallet.NewTransaction(privateKey, publicKey, *t.SenderBlockchainAddress,
+				*t.RecipientBlockchainAddress, value, timestamp, nil, nil)
+			transaction.SetNonce(account.Nonce)
+			transaction.SetKind(uint8(kind))
+		} else {
+			utxos, err := ws.unspentOutputs(*t.SenderBlockchainAddress)
+			if err != nil {
+				log.Printf("ERROR: %s", err.Error())
+				io.WriteString(w, string(dto.JsonStatus("fail")))
+				return
+			}
+
+			cost, err := value.Add(fee)
+			if err != nil {
+				log.Printf("ERROR: %s", err.Error())
+				io.WriteString(w, string(dto.JsonStatus("fail")))
+				return
+			}
+			inputs, change, err := wallet.SelectInputs(utxos, cost)
+			if err != nil {
+				log.Printf("ERROR: %s", err.Error())
+				io.WriteString(w, string(dto.JsonStatus("fail")))
+				return
+			}
+
+			outputs := []*dto.TransactionOutput{
+				{BlockchainAddress: t.RecipientBlockchainAddress, Value: &value},
+			}
+			if change > 0 {
+				outputs = append(outputs, &dto.TransactionOutput{BlockchainAddress: t.SenderBlockchainAddress, Value: &change})
+			}
+			transaction = wallet.NewTransaction(privateKey, publicKey, *t.SenderBlockchainAddress,
+				*t.RecipientBlockchainAddress, value, timestamp, inputs, outputs)
+		}
+		transaction.SetFee(fee)
+		transaction.SetChainID(account.ChainID)
+
+		signature, err := transaction.GenerateSignature()
+		if err != nil {
+			log.Printf("ERROR: %s", err.Error())
+			io.WriteString(w, string(dto.JsonStatus("fail")))
+			return
+		}
 		signatureStr := signature.String()
+		nonce := transaction.Nonce()
 		bt := &dto.TransactionRequest{
 			SenderBlockchainAddress:    t.SenderBlockchainAddress,
 			RecipientBlockchainAddress: t.RecipientBlockchainAddress,
 			SenderPublicKey:            t.SenderPublicKey,
-			Value:                      &value32,
+			Value:                      &value,
+			Fee:                        &fee,
 			Timestamp:                  &timestamp,
+			Nonce:                      &nonce,
+			Inputs:                     transaction.Inputs(),
+			Outputs:                    transaction.Outputs(),
 			Signature:                  &signatureStr,
+			ChainID:                    &account.ChainID,
+		}
+		if kind != blockchain.TX_KIND_TRANSFER {
+			name := kind.String()
+			bt.Kind = &name
 		}
 
 		m, _ := json.Marshal(bt)
@@ -137,16 +226,72 @@ func (ws *Server) CreateTransactionHandler(w http.ResponseWriter, r *http.Reques
 	}
 }
 
+// account - Asks the gateway for the balance and the next nonce of the address.
+func (ws *Server) account(blockchainAddress string) (*dto.AccountResponse, error) {
+	endpoint := fmt.Sprintf("%s/account", ws.Gateway())
+	req, _ := http.NewRequest(http.MethodGet, endpoint, nil)
+	q := req.URL.Query()
+	q.Add("blockchain_address", blockchainAddress)
+	req.URL.RawQuery = q.Encode()
+
+	client := http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status getting the account: %d", resp.StatusCode)
+	}
+
+	var ar dto.AccountResponse
+	if err := json.NewDecoder(resp.Body).Decode(&ar); err != nil {
+		return nil, err
+	}
+	return &ar, nil
+}
+
+// unspentOutputs - Asks the gateway for the outputs the address can spend.
+func (ws *Server) unspentOutputs(blockchainAddress string) ([]*dto.UnspentOutput, error) {
+	endpoint := fmt.Sprintf("%s/utxos", ws.Gateway())
+	req, _ := http.NewRequest(http.MethodGet, endpoint, nil)
+	q := req.URL.Query()
+	q.Add("blockchain_address", blockchainAddress)
+	req.URL.RawQuery = q.Encode()
+
+	client := http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status getting unspent outputs: %d", resp.StatusCode)
+	}
+
+	var uor dto.UnspentOutputsResponse
+	if err := json.NewDecoder(resp.Body).Decode(&uor); err != nil {
+		return nil, err
+	}
+	return uor.UnspentOutputs, nil
+}
+
+// WalletAmountHandler - Returns the balance of the address, its balance after the pending transactions and
+// its last transactions, pending ones first.
 func (ws *Server) WalletAmountHandler(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case http.MethodGet:
 		w.Header().Add("Content-Type", "application/json")
 		blockchainAddress := r.URL.Query().Get("blockchain_address")
-		endpoint := fmt.Sprintf("%s/amount", ws.Gateway())
+		endpoint := fmt.Sprintf("%s/address/%s", ws.Gateway(), url.PathEscape(blockchainAddress))
 		client := http.Client{}
 		bcsReq, _ := http.NewRequest(http.MethodGet, endpoint, nil)
 		q := bcsReq.URL.Query()
-		q.Add("blockchain_address", blockchainAddress)
+		if page := r.URL.Query().Get("page"); page != "" {
+			q.Add("page", page)
+		}
 		bcsReq.URL.RawQuery = q.Encode()
 
 		resp, err := client.Do(bcsReq)
@@ -156,23 +301,33 @@ func (ws *Server) WalletAmountHandler(w http.ResponseWriter, r *http.Request) {
 			io.WriteString(w, string(dto.JsonStatus("fail")))
 			return
 		}
+		defer resp.Body.Close()
 
-		w.Header().Add("Content-Type", "application/json")
 		if resp.StatusCode == http.StatusOK {
 			decoder := json.NewDecoder(resp.Body)
 
-			var bar dto.AmountResponse
-			if err := decoder.Decode(&bar); err != nil {
+			var ar dto.AddressResponse
+			if err := decoder.Decode(&ar); err != nil {
 				io.WriteString(w, string(dto.JsonStatus("fail")))
 				return
 			}
 
 			m, _ := json.Marshal(struct {
-				Message string  `json:"message"`
-				Amount  float32 `json:"amount"`
+				Message       string                    `json:"message"`
+				Amount        coin.Amount               `json:"amount"`
+				PendingAmount coin.Amount               `json:"pending_amount"`
+				Transactions  []*dto.AddressTransaction `json:"transactions"`
+				Page          int                       `json:"page"`
+				Limit         int                       `json:"limit"`
+				Total         int                       `json:"total"`
 			}{
-				Message: "success",
-				Amount:  bar.Amount,
+				Message:       "success",
+				Amount:        ar.Balance,
+				PendingAmount: ar.PendingBalance,
+				Transactions:  append(ar.Pending, ar.Transactions...),
+				Page:          ar.Page,
+				Limit:         ar.Limit,
+				Total:         ar.Total,
 			})
 
 			io.WriteString(w, string(m[:]))
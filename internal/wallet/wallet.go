@@ -4,13 +4,15 @@ import (
 	"crypto/ecdsa"
 	"crypto/elliptic"
 	"crypto/rand"
-	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 
-	"github.com/btcsuite/btcd/btcutil/base58"
 	"github.com/martinsaporiti/blockchain-sample/internal/blkcrypto"
-	"golang.org/x/crypto/ripemd160"
+	"github.com/martinsaporiti/blockchain-sample/internal/codec"
+	"github.com/martinsaporiti/blockchain-sample/internal/coin"
+	"github.com/martinsaporiti/blockchain-sample/internal/dto"
 )
 
 type Wallet struct {
@@ -26,46 +28,8 @@ func New() *Wallet {
 	w.privateKey = privateKey
 	w.publicKey = &privateKey.PublicKey
 
-	// 2. Perform SHA256 hashing on the public key (32 bytes).
-	h2 := sha256.New()
-	h2.Write(w.publicKey.X.Bytes())
-	h2.Write(w.publicKey.Y.Bytes())
-	digest2 := h2.Sum(nil)
-
-	// 3. Perform RIPEMD-160 hashing on the result of SHA-256 (20 bytes).
-	h3 := ripemd160.New()
-	h3.Write(digest2)
-	digest3 := h3.Sum(nil)
-
-	// 4. Add version byte in front of RIPEMD-160 hash (0x00 for Main Network).
-	vd4 := make([]byte, 21)
-	vd4[0] = 0x00
-	copy(vd4[1:], digest3[:])
-
-	// 5. Perform SHA-256 hash on the extended RIPEMD-160 result
-	h5 := sha256.New()
-	h5.Write(vd4)
-	digest5 := h5.Sum(nil)
-
-	// 6. Perform SHA-256 hash on the result of the previous SHA-256 hash
-	h6 := sha256.New()
-	h6.Write(digest5)
-	digest6 := h6.Sum(nil)
-
-	// 7. Take the first 4 bytes of the second SHA-256 hash. This is the address checksum
-	chsum := digest6[:4]
-
-	// 8. Add the 4 checksum bytes from stage 7 at the end of extended RIPEMD-160 hash from stage 4.
-	// This is the 25-byte binary Bitcoin Address.
-	dc8 := make([]byte, 25)
-	copy(dc8[:21], vd4[:])
-	copy(dc8[21:], chsum[:])
-
-	// 9. Convert the result from a byte string into a base58 string using Base58Check encoding.
-	// This is the most commonly used Bitcoin Address format
-	address := base58.Encode(dc8)
-
-	w.blockchainAddress = address
+	// 2. Derive the blockchain address from the public key.
+	w.blockchainAddress = blkcrypto.AddressFromPublicKey(w.publicKey)
 	return w
 }
 
@@ -107,11 +71,18 @@ type Transaction struct {
 	senderPublicKey            *ecdsa.PublicKey
 	senderBlockchainAddress    string
 	recipientBlockchainAddress string
-	value                      float32
+	value                      coin.Amount
+	fee                        coin.Amount
 	timestamp                  int64
+	nonce                      uint64
+	inputs                     []*dto.TransactionInput
+	outputs                    []*dto.TransactionOutput
+	kind                       uint8
+	chainID                    string
 }
 
-func NewTransaction(privateKey *ecdsa.PrivateKey, publicKey *ecdsa.PublicKey, sender, recipient string, value float32, timestamp int64) *Transaction {
+func NewTransaction(privateKey *ecdsa.PrivateKey, publicKey *ecdsa.PublicKey, sender, recipient string, value coin.Amount,
+	timestamp int64, inputs []*dto.TransactionInput, outputs []*dto.TransactionOutput) *Transaction {
 	return &Transaction{
 		senderPrivateKey:           privateKey,
 		senderPublicKey:            publicKey,
@@ -119,28 +90,118 @@ func NewTransaction(privateKey *ecdsa.PrivateKey, publicKey *ecdsa.PublicKey, se
 		recipientBlockchainAddress: recipient,
 		value:                      value,
 		timestamp:                  timestamp,
+		inputs:                     inputs,
+		outputs:                    outputs,
 	}
 }
 
-func (t *Transaction) GenerateSignature() *blkcrypto.Signature {
-	m, _ := json.Marshal(t)
-	h := sha256.Sum256([]byte(m))
-	r, s, _ := ecdsa.Sign(rand.Reader, t.senderPrivateKey, h[:])
-	return &blkcrypto.Signature{R: r, S: s}
+// SetNonce - Sets the nonce of the sender the transaction uses when the ledger is account based.
+func (t *Transaction) SetNonce(nonce uint64) {
+	t.nonce = nonce
 }
 
-func (t *Transaction) MarshalJSON() ([]byte, error) {
-	return json.Marshal(struct {
-		SenderBlockchainAddress    string  `json:"sender_blockchain_address"`
-		RecipientBlockchainAddress string  `json:"recipient_blockchain_address"`
-		Value                      float32 `json:"value"`
-		Timestamp                  int64   `json:"timestamp"`
-	}{
-		SenderBlockchainAddress:    t.senderBlockchainAddress,
-		RecipientBlockchainAddress: t.recipientBlockchainAddress,
-		Value:                      t.value,
-		Timestamp:                  t.timestamp,
-	})
+// SetKind - Sets the kind of the transaction, the number of a kind of the blockchain. Transfers are 0.
+func (t *Transaction) SetKind(kind uint8) {
+	t.kind = kind
+}
+
+// SetChainID - Sets the ID of the chain the transaction is signed for, the nodes of other chains reject it.
+func (t *Transaction) SetChainID(chainID string) {
+	t.chainID = chainID
+}
+
+// SetFee - Sets the fee paid to the miner of the block that includes the transaction.
+func (t *Transaction) SetFee(fee coin.Amount) {
+	t.fee = fee
+}
+
+func (t *Transaction) Fee() coin.Amount {
+	return t.fee
+}
+
+func (t *Transaction) Nonce() uint64 {
+	return t.nonce
+}
+
+func (t *Transaction) Inputs() []*dto.TransactionInput {
+	return t.inputs
+}
+
+func (t *Transaction) Outputs() []*dto.TransactionOutput {
+	return t.outputs
+}
+
+// GenerateSignature - Signs the canonical encoding of the transaction, the same bytes the blockchain hashes
+// to compute its ID.
+func (t *Transaction) GenerateSignature() (*blkcrypto.Signature, error) {
+	p, err := t.signingPayload()
+	if err != nil {
+		return nil, err
+	}
+	h := p.Hash()
+	r, s, err := ecdsa.Sign(rand.Reader, t.senderPrivateKey, h[:])
+	if err != nil {
+		return nil, err
+	}
+	return &blkcrypto.Signature{R: r, S: s}, nil
+}
+
+// signingPayload - Returns the fields signed by the sender.
+func (t *Transaction) signingPayload() (*codec.TxPayload, error) {
+	p := &codec.TxPayload{
+		Sender:    t.senderBlockchainAddress,
+		Recipient: t.recipientBlockchainAddress,
+		Value:     t.value,
+		Fee:       t.fee,
+		Timestamp: t.timestamp,
+		Nonce:     t.nonce,
+		Inputs:    make([]codec.TxInput, len(t.inputs)),
+		Outputs:   make([]codec.TxOutput, len(t.outputs)),
+		Kind:      t.kind,
+		ChainID:   t.chainID,
+	}
+	for i, in := range t.inputs {
+		if in.TxID == nil || in.Index == nil {
+			return nil, errors.New("incomplete transaction input")
+		}
+		txID, err := hex.DecodeString(*in.TxID)
+		if err != nil || len(txID) != 32 {
+			return nil, fmt.Errorf("invalid transaction id %q", *in.TxID)
+		}
+		copy(p.Inputs[i].TxID[:], txID)
+		p.Inputs[i].Index = *in.Index
+	}
+	for i, out := range t.outputs {
+		if out.BlockchainAddress == nil || out.Value == nil {
+			return nil, errors.New("incomplete transaction output")
+		}
+		p.Outputs[i] = codec.TxOutput{Address: *out.BlockchainAddress, Value: *out.Value}
+	}
+	return p, nil
+}
+
+// SelectInputs - Picks unspent outputs until they cover the value (the amount sent plus the fee).
+// Returns the inputs to spend and the change that must go back to the sender.
+func SelectInputs(utxos []*dto.UnspentOutput, value coin.Amount) ([]*dto.TransactionInput, coin.Amount, error) {
+	inputs := make([]*dto.TransactionInput, 0)
+	var total coin.Amount
+	for _, utxo := range utxos {
+		if total >= value {
+			break
+		}
+		txID := utxo.TxID
+		index := utxo.Index
+		inputs = append(inputs, &dto.TransactionInput{TxID: &txID, Index: &index})
+		var err error
+		if total, err = total.Add(utxo.Value); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	if total < value {
+		return nil, 0, errors.New("not enough funds")
+	}
+	return inputs, total - value, nil
 }
 
 type TransactionRequest struct {
@@ -149,6 +210,9 @@ type TransactionRequest struct {
 	RecipientBlockchainAddress *string `json:"recipient_blockchain_address"`
 	SenderPublicKey            *string `json:"sender_public_key"`
 	Value                      *string `json:"value"`
+	Fee                        *string `json:"fee"`
+	// Kind - Empty for a transfer, bond or unbond to manage the stake of the sender.
+	Kind *string `json:"kind"`
 }
 
 func (tr *TransactionRequest) IsValid() bool {